@@ -0,0 +1,313 @@
+// Package bench runs YCSB-like workloads against a cluster and reports their throughput and latencies, so that the
+// performance of different implementations or fragmentation schemes can be compared on the same workload.
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"../labrpc"
+	"../models"
+)
+
+// operations of a workload
+const (
+	OpInsert = "insert"
+	OpRead   = "read"
+	OpJoin   = "join"
+)
+
+// Mix tells how often each operation is run, as weights relative to each other.
+type Mix struct {
+	Name   string
+	Insert int
+	Read   int
+	Join   int
+}
+
+// standard workloads
+var (
+	InsertHeavy = Mix{Name: "insert-heavy", Insert: 90, Read: 10}
+	ReadHeavy   = Mix{Name: "read-heavy", Insert: 5, Read: 95}
+	JoinHeavy   = Mix{Name: "join-heavy", Insert: 10, Read: 40, Join: 50}
+)
+
+// Config parameterizes a run.
+type Config struct {
+	Mix Mix
+	// the number of nodes of the cluster
+	Nodes int
+	// the number of students loaded before the run, each of them registers Courses courses
+	Students int
+	Courses  int
+	// the number of operations run, spread over Clients concurrent clients
+	Operations int
+	Clients    int
+	// the seed of the random choices, so that runs can be repeated
+	Seed int64
+}
+
+// Percentiles summarizes the latencies of an operation.
+type Percentiles struct {
+	Count              int
+	P50, P95, P99, Max time.Duration
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	Mix        string
+	Operations int
+	// operations that failed
+	Errors     int
+	Elapsed    time.Duration
+	Throughput float64
+	// operation -> latencies
+	Latencies map[string]Percentiles
+}
+
+func (r Report) String() string {
+	s := fmt.Sprintf("%v: %v operations (%v errors) in %v, %.1f ops/s", r.Mix, r.Operations, r.Errors, r.Elapsed,
+		r.Throughput)
+	for _, op := range []string{OpInsert, OpRead, OpJoin} {
+		if p, ok := r.Latencies[op]; ok {
+			s += fmt.Sprintf("\n  %-6v n=%-6v p50=%-10v p95=%-10v p99=%-10v max=%v", op, p.Count, p.P50, p.P95, p.P99,
+				p.Max)
+		}
+	}
+	return s
+}
+
+// the grades of the students range from 0 to maxGrade, and the courses they register are numbered from 0 to
+// courseIds-1
+const (
+	maxGrade  = 4.0
+	courseIds = 10
+)
+
+var studentSchema = models.TableSchema{TableName: "student", ColumnSchemas: []models.ColumnSchema{
+	{Name: "sid", DataType: models.TypeInt32},
+	{Name: "name", DataType: models.TypeString},
+	{Name: "age", DataType: models.TypeInt32},
+	{Name: "grade", DataType: models.TypeFloat},
+}}
+
+var courseRegistrationSchema = models.TableSchema{TableName: "courseRegistration", ColumnSchemas: []models.ColumnSchema{
+	{Name: "sid", DataType: models.TypeInt32},
+	{Name: "courseId", DataType: models.TypeInt32},
+}}
+
+// validate checks that the cluster has nodes and clients, that the weights of the mix are not negative and some is
+// positive, and that there are students to read if the mix reads.
+func (config Config) validate() error {
+	mix := config.Mix
+	switch {
+	case config.Nodes <= 0:
+		return errors.New("invalid config: no node")
+	case config.Clients <= 0:
+		return errors.New("invalid config: no client")
+	case config.Operations < 0 || config.Students < 0 || config.Courses < 0:
+		return errors.New("invalid config: negative count")
+	case mix.Insert < 0 || mix.Read < 0 || mix.Join < 0 || mix.Insert+mix.Read+mix.Join <= 0:
+		return errors.New("invalid config: no operation in the mix " + mix.Name)
+	case mix.Read > 0 && config.Students == 0:
+		return errors.New("invalid config: no student to read")
+	}
+	return nil
+}
+
+// Run creates a cluster, loads the tables and runs the workload against it.
+func Run(config Config) (Report, error) {
+	if err := config.validate(); err != nil {
+		return Report{}, err
+	}
+	network := labrpc.MakeNetwork()
+	defer network.Cleanup()
+	models.NewCluster(config.Nodes, network, "BenchCluster")
+	client := func(name string) *labrpc.ClientEnd {
+		end := network.MakeEnd(name)
+		network.Connect(name, "BenchCluster")
+		network.Enable(name, true)
+		return end
+	}
+	loader := client("BenchLoader")
+	if err := load(loader, config); err != nil {
+		return Report{}, err
+	}
+
+	var mu sync.Mutex
+	latencies := make(map[string][]time.Duration)
+	errs := 0
+	next := config.Students
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < config.Clients; i++ {
+		n := config.Operations / config.Clients
+		if i < config.Operations%config.Clients {
+			n++
+		}
+		end := client("BenchClient" + strconv.Itoa(i))
+		rng := rand.New(rand.NewSource(config.Seed + int64(i)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < n; k++ {
+				op := pick(config.Mix, rng)
+				ok := true
+				begin := time.Now()
+				switch op {
+				case OpInsert:
+					mu.Lock()
+					sid := next
+					next++
+					mu.Unlock()
+					reply := ""
+					end.Call("Cluster.FragmentWrite", []interface{}{"student", student(sid, rng)}, &reply)
+					ok = strings.HasPrefix(reply, "0")
+				case OpRead:
+					result := models.Dataset{}
+					end.Call("Cluster.Get", []interface{}{"student", rng.Intn(config.Students)}, &result)
+					ok = result.Schema.TableName != ""
+				case OpJoin:
+					result := models.Dataset{}
+					ok = end.Call("Cluster.Join", []string{"student", "courseRegistration"}, &result)
+				}
+				latency := time.Since(begin)
+				mu.Lock()
+				latencies[op] = append(latencies[op], latency)
+				if !ok {
+					errs++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := Report{Mix: config.Mix.Name, Operations: config.Operations, Errors: errs, Elapsed: elapsed,
+		Latencies: make(map[string]Percentiles)}
+	if elapsed > 0 {
+		report.Throughput = float64(config.Operations) / elapsed.Seconds()
+	}
+	for op, values := range latencies {
+		report.Latencies[op] = percentiles(values)
+	}
+	return report, nil
+}
+
+// load builds the tables, student split by grade over the nodes and courseRegistration split by courseId over as many
+// of them as there are courses, with sid as the primary key of student, and inserts the initial rows.
+func load(end *labrpc.ClientEnd, config Config) error {
+	students, courses := tableRules(config.Nodes)
+	for _, table := range []struct {
+		schema models.TableSchema
+		rules  *models.RuleSet
+		key    string
+	}{{courseRegistrationSchema, courses, ""}, {studentSchema, students, "sid"}} {
+		rules, err := table.rules.Marshal()
+		if err != nil {
+			return err
+		}
+		params := []interface{}{table.schema, rules}
+		if table.key != "" {
+			params = append(params, table.key)
+		}
+		reply := ""
+		end.Call("Cluster.BuildTable", params, &reply)
+		if !strings.HasPrefix(reply, "0") {
+			return errors.New("cannot build " + table.schema.TableName + ": " + reply)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(config.Seed))
+	for sid := 0; sid < config.Students; sid++ {
+		if err := write(end, "student", student(sid, rng)); err != nil {
+			return err
+		}
+		for k := 0; k < config.Courses; k++ {
+			if err := write(end, "courseRegistration", models.Row{sid, rng.Intn(courseIds)}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tableRules returns the rules of student and of courseRegistration on a cluster of the nodes.
+func tableRules(nodes int) (*models.RuleSet, *models.RuleSet) {
+	students := models.NewRuleSet(studentSchema)
+	addRangeRules(students, "grade", nodes, func(i int) interface{} {
+		return maxGrade * float64(i) / float64(nodes)
+	})
+	courses := models.NewRuleSet(courseRegistrationSchema)
+	fragments := nodes
+	if fragments > courseIds {
+		fragments = courseIds
+	}
+	addRangeRules(courses, "courseId", fragments, func(i int) interface{} {
+		return courseIds * i / fragments
+	})
+	return students, courses
+}
+
+// addRangeRules adds n fragments splitting the values of the column at the bounds, the i-th holding the values from
+// bound(i) (included) to bound(i+1) (excluded) and placed on node i, the first and the last being open ended so that
+// every value falls in one.
+func addRangeRules(rules *models.RuleSet, column string, n int, bound func(i int) interface{}) {
+	for i := 0; i < n; i++ {
+		atoms := []models.Atom{}
+		if i > 0 {
+			atoms = append(atoms, models.Atom{Op: ">=", Val: bound(i)})
+		}
+		if i < n-1 {
+			atoms = append(atoms, models.Atom{Op: "<", Val: bound(i + 1)})
+		}
+		predicate := models.Predicate{}
+		if len(atoms) > 0 {
+			predicate[column] = atoms
+		}
+		rules.AddHorizontalRule(predicate, i)
+	}
+}
+
+// write inserts a row into the table, failing unless the cluster accepts it.
+func write(end *labrpc.ClientEnd, tableName string, row models.Row) error {
+	reply := ""
+	if !end.Call("Cluster.FragmentWrite", []interface{}{tableName, row}, &reply) {
+		return errors.New("cannot write into " + tableName + ": the cluster does not answer")
+	}
+	if !strings.HasPrefix(reply, "0") {
+		return errors.New("cannot write into " + tableName + ": " + reply)
+	}
+	return nil
+}
+
+func student(sid int, rng *rand.Rand) models.Row {
+	return models.Row{sid, "student" + strconv.Itoa(sid), 18 + rng.Intn(10), float64(rng.Intn(41)) / 10}
+}
+
+// pick chooses an operation by the weights of the mix.
+func pick(mix Mix, rng *rand.Rand) string {
+	n := rng.Intn(mix.Insert + mix.Read + mix.Join)
+	if n < mix.Insert {
+		return OpInsert
+	}
+	if n < mix.Insert+mix.Read {
+		return OpRead
+	}
+	return OpJoin
+}
+
+func percentiles(values []time.Duration) Percentiles {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	at := func(p float64) time.Duration {
+		return values[int(p*float64(len(values)-1))]
+	}
+	return Percentiles{Count: len(values), P50: at(0.5), P95: at(0.95), P99: at(0.99), Max: values[len(values)-1]}
+}
@@ -0,0 +1,96 @@
+package bench
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	for _, mix := range []Mix{InsertHeavy, ReadHeavy, JoinHeavy} {
+		report, err := Run(Config{Mix: mix, Nodes: 3, Students: 20, Courses: 2, Operations: 60, Clients: 4, Seed: 1})
+		if err != nil {
+			t.Fatalf("%v: %v", mix.Name, err)
+		}
+		if report.Errors != 0 {
+			t.Errorf("%v: %v operations failed", mix.Name, report.Errors)
+		}
+		n := 0
+		for _, p := range report.Latencies {
+			n += p.Count
+			if p.P50 > p.P95 || p.P95 > p.P99 || p.P99 > p.Max {
+				t.Errorf("%v: unordered percentiles %v", mix.Name, p)
+			}
+		}
+		if n != 60 {
+			t.Errorf("%v: %v operations measured, expected 60", mix.Name, n)
+		}
+		t.Log(report)
+	}
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	if _, err := Run(Config{Mix: ReadHeavy, Nodes: 0, Clients: 1}); err == nil {
+		t.Error("expected an error for a cluster without nodes")
+	}
+	if _, err := Run(Config{Mix: ReadHeavy, Nodes: 1, Operations: 10, Clients: 1}); err == nil {
+		t.Error("expected an error for reading without students")
+	}
+	if _, err := Run(Config{Mix: Mix{Name: "negative", Insert: 1, Read: -1}, Nodes: 1, Students: 1,
+		Clients: 1}); err == nil {
+		t.Error("expected an error for a negative weight")
+	}
+	// nothing to read, the students are all inserted by the run
+	report, err := Run(Config{Mix: Mix{Name: "insert-only", Insert: 1}, Nodes: 2, Operations: 10, Clients: 2})
+	if err != nil || report.Errors != 0 {
+		t.Errorf("expected the inserts to succeed, actual %v %v", report, err)
+	}
+}
+
+// every node holds a fragment of student, and of courseRegistration unless there are more nodes than courses
+func TestTableRules(t *testing.T) {
+	// nodes -> the fragments of courseRegistration
+	for nodes, courseFragments := range map[int]int{1: 1, 2: 2, 5: 5, 12: 10} {
+		students, courses := tableRules(nodes)
+		for _, table := range []struct {
+			name      string
+			rules     []byte
+			fragments int
+		}{{"student", marshal(t, students), nodes}, {"courseRegistration", marshal(t, courses), courseFragments}} {
+			keys := make(map[string]interface{})
+			if err := json.Unmarshal(table.rules, &keys); err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != table.fragments {
+				t.Errorf("%v on %v nodes: expected %v fragments, actual %v", table.name, nodes, table.fragments,
+					len(keys))
+			}
+			for i := 0; i < table.fragments; i++ {
+				if _, ok := keys[strconv.Itoa(i)]; !ok {
+					t.Errorf("%v on %v nodes: no fragment on node %v", table.name, nodes, i)
+				}
+			}
+		}
+	}
+}
+
+func marshal(t *testing.T, rules interface{ Marshal() ([]byte, error) }) []byte {
+	marshaled, err := rules.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return marshaled
+}
+
+func benchmarkMix(b *testing.B, mix Mix, nodes int) {
+	report, err := Run(Config{Mix: mix, Nodes: nodes, Students: 100, Courses: 3, Operations: b.N, Clients: 8, Seed: 1})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(report.Throughput, "ops/s")
+	b.ReportMetric(float64(report.Latencies[OpRead].P99.Microseconds()), "read-p99-us")
+}
+
+func BenchmarkInsertHeavy(b *testing.B) { benchmarkMix(b, InsertHeavy, 3) }
+func BenchmarkReadHeavy(b *testing.B)   { benchmarkMix(b, ReadHeavy, 3) }
+func BenchmarkJoinHeavy(b *testing.B)   { benchmarkMix(b, JoinHeavy, 3) }
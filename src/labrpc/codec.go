@@ -0,0 +1,905 @@
+package labrpc
+
+//
+// codecs encoding the arguments and the replies of the RPCs.
+//
+// GobCodec encodes them with labgob, as the network always did. The
+// values held in interface{} (e.g., the elements of an argument list
+// []interface{}) must then be registered with labgob.Register.
+//
+// JSONCodec and BinaryCodec tag the values held in interface{} with
+// the names of their types instead, and learn the types as they encode
+// them, so that nothing needs to be registered: the network runs in a
+// single process, so any type decoded has been encoded before. as with
+// gob, a pointer held in interface{} is sent as the value it points
+// to, and decoded as such on the other side. JSON is
+// readable, e.g., to debug what is sent, while the binary format is
+// compact and cheap to encode, e.g., for large datasets.
+//
+// a call is encoded with the codec chosen by the caller, see
+// ClientEnd.CallCodec, and the server decodes it and encodes its
+// reply with the same codec.
+//
+
+import "../labgob"
+import "bytes"
+import "encoding"
+import "encoding/base64"
+import "encoding/binary"
+import "encoding/json"
+import "fmt"
+import "io"
+import "math"
+import "math/bits"
+import "reflect"
+import "strconv"
+import "sync"
+
+type Codec interface {
+	// the name the codec is selected by, see CodecByName
+	Name() string
+	Encode(v interface{}) ([]byte, error)
+	// decode into v, which must be a non-nil pointer
+	Decode(data []byte, v interface{}) error
+}
+
+var GobCodec Codec = gobCodec{}
+var JSONCodec Codec = jsonCodec{}
+var BinaryCodec Codec = binaryCodec{}
+
+// the codecs by name, nil for an unknown name.
+func CodecByName(name string) Codec {
+	for _, codec := range []Codec{GobCodec, JSONCodec, BinaryCodec} {
+		if codec.Name() == name {
+			return codec
+		}
+	}
+	return nil
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Encode(v interface{}) ([]byte, error) {
+	b := new(bytes.Buffer)
+	if err := labgob.NewEncoder(b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gobCodec) Decode(data []byte, v interface{}) error {
+	return labgob.NewDecoder(bytes.NewBuffer(data)).Decode(v)
+}
+
+//
+// the types of the values held in interface{}, by name.
+//
+
+var typeRegistry = struct {
+	mu     sync.RWMutex
+	byName map[string]reflect.Type
+}{byName: map[string]reflect.Type{}}
+
+// the name a type is tagged with, qualified by the path of its
+// package if it is a named type.
+func typeName(t reflect.Type) string {
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}
+
+// remember a type as it is encoded, and return its name.
+func rememberType(t reflect.Type) (string, error) {
+	name := typeName(t)
+	typeRegistry.mu.RLock()
+	known, ok := typeRegistry.byName[name]
+	typeRegistry.mu.RUnlock()
+	if ok {
+		if known != t {
+			return "", fmt.Errorf("labrpc: two types are named %v", name)
+		}
+		return name, nil
+	}
+	typeRegistry.mu.Lock()
+	typeRegistry.byName[name] = t
+	typeRegistry.mu.Unlock()
+	return name, nil
+}
+
+func lookupType(name string) (reflect.Type, error) {
+	typeRegistry.mu.RLock()
+	defer typeRegistry.mu.RUnlock()
+	if t, ok := typeRegistry.byName[name]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("labrpc: unknown type %v", name)
+}
+
+// the value held by an interface{} of type iface must be of a type
+// implementing it.
+func checkImplements(t reflect.Type, iface reflect.Type) error {
+	if !t.Implements(iface) {
+		return fmt.Errorf("labrpc: %v does not implement %v", t, iface)
+	}
+	return nil
+}
+
+var binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+var binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+
+// whether the values of a type encode themselves, e.g., time.Time,
+// whose fields are unexported.
+func marshalsItself(t reflect.Type) bool {
+	return t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && t.Implements(binaryMarshalerType) &&
+		reflect.PtrTo(t).Implements(binaryUnmarshalerType)
+}
+
+// the value held by an interface{}, following its pointers, invalid
+// for nil.
+func held(v reflect.Value) reflect.Value {
+	v = v.Elem()
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	return v
+}
+
+// the value pointed to by v, following the pointers, as the top-level
+// values are encoded.
+func indirect(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return rv, fmt.Errorf("labrpc: cannot encode nil")
+	}
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return rv, fmt.Errorf("labrpc: cannot encode a nil pointer")
+		}
+		rv = rv.Elem()
+	}
+	return rv, nil
+}
+
+// the value pointed to by v, allocating the pointers on the way, into
+// which a top-level value is decoded.
+func indirectAlloc(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return rv, fmt.Errorf("labrpc: decode into a non-pointer %T", v)
+	}
+	rv = rv.Elem()
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	return rv, nil
+}
+
+//
+// the compact binary format. integers are varints, floats are varints
+// of their reversed bytes (so that small integral floats take a byte or
+// two, as in gob), strings, slices and maps are preceded by their
+// lengths (plus one, zero standing for nil), structs are their exported
+// fields in order, and the values held in interface{} are preceded by
+// a tag: a basic type, or the name of a type the first time it is
+// encoded in a message and its index in the message afterwards.
+//
+
+const (
+	tagNil = iota
+	tagNewName
+	tagName
+	tagBasic
+)
+
+// the unnamed basic types, tagged tagBasic + their index.
+var basicTypes = []reflect.Type{
+	reflect.TypeOf(false), reflect.TypeOf(""), reflect.TypeOf(int(0)), reflect.TypeOf(int8(0)),
+	reflect.TypeOf(int16(0)), reflect.TypeOf(int32(0)), reflect.TypeOf(int64(0)), reflect.TypeOf(uint(0)),
+	reflect.TypeOf(uint8(0)), reflect.TypeOf(uint16(0)), reflect.TypeOf(uint32(0)), reflect.TypeOf(uint64(0)),
+	reflect.TypeOf(float32(0)), reflect.TypeOf(float64(0)),
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string { return "binary" }
+
+func (binaryCodec) Encode(v interface{}) ([]byte, error) {
+	rv, err := indirect(v)
+	if err != nil {
+		return nil, err
+	}
+	e := &binaryEncoder{names: map[reflect.Type]uint64{}}
+	if err := e.value(rv); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+func (binaryCodec) Decode(data []byte, v interface{}) error {
+	rv, err := indirectAlloc(v)
+	if err != nil {
+		return err
+	}
+	d := &binaryDecoder{r: bytes.NewReader(data)}
+	if err := d.value(rv); err != nil {
+		return err
+	}
+	if d.r.Len() != 0 {
+		return fmt.Errorf("labrpc: %v bytes left after decoding %v", d.r.Len(), rv.Type())
+	}
+	return nil
+}
+
+type binaryEncoder struct {
+	buf bytes.Buffer
+	// the types named in the message so far, by their index
+	names   map[reflect.Type]uint64
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *binaryEncoder) uvarint(x uint64) {
+	e.buf.Write(e.scratch[:binary.PutUvarint(e.scratch[:], x)])
+}
+
+func (e *binaryEncoder) varint(x int64) {
+	e.buf.Write(e.scratch[:binary.PutVarint(e.scratch[:], x)])
+}
+
+func (e *binaryEncoder) str(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *binaryEncoder) value(v reflect.Value) error {
+	if marshalsItself(v.Type()) {
+		data, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.str(string(data))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(1)
+		} else {
+			e.buf.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.varint(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uvarint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.uvarint(bits.ReverseBytes64(math.Float64bits(v.Float())))
+	case reflect.String:
+		e.str(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.uvarint(0)
+			return nil
+		}
+		e.uvarint(uint64(v.Len()) + 1)
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.buf.Write(v.Bytes())
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := e.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.uvarint(0)
+			return nil
+		}
+		e.uvarint(uint64(v.Len()) + 1)
+		for _, key := range v.MapKeys() {
+			if err := e.value(key); err != nil {
+				return err
+			}
+			if err := e.value(v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				// unexported, as gob skips them
+				continue
+			}
+			if err := e.value(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			e.buf.WriteByte(0)
+			return nil
+		}
+		e.buf.WriteByte(1)
+		return e.value(v.Elem())
+	case reflect.Interface:
+		x := held(v)
+		if !x.IsValid() {
+			e.uvarint(tagNil)
+			return nil
+		}
+		if err := e.tag(x.Type()); err != nil {
+			return err
+		}
+		return e.value(x)
+	default:
+		return fmt.Errorf("labrpc: cannot encode %v", v.Type())
+	}
+	return nil
+}
+
+func (e *binaryEncoder) tag(t reflect.Type) error {
+	for i, basic := range basicTypes {
+		if t == basic {
+			e.uvarint(uint64(tagBasic + i))
+			return nil
+		}
+	}
+	if index, ok := e.names[t]; ok {
+		e.uvarint(tagName)
+		e.uvarint(index)
+		return nil
+	}
+	name, err := rememberType(t)
+	if err != nil {
+		return err
+	}
+	e.names[t] = uint64(len(e.names))
+	e.uvarint(tagNewName)
+	e.str(name)
+	return nil
+}
+
+type binaryDecoder struct {
+	r *bytes.Reader
+	// the types named in the message so far
+	names []reflect.Type
+}
+
+func (d *binaryDecoder) uvarint() (uint64, error) {
+	return binary.ReadUvarint(d.r)
+}
+
+func (d *binaryDecoder) varint() (int64, error) {
+	return binary.ReadVarint(d.r)
+}
+
+// a length preceding items of the given size, checked against what is
+// left so that a corrupt message does not allocate too much. one more
+// is allowed for the lengths of slices and maps, shifted by one.
+func (d *binaryDecoder) length(size uintptr) (int, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if size > 0 && n > uint64(d.r.Len())+1 {
+		return 0, fmt.Errorf("labrpc: length %v exceeds the message", n)
+	}
+	return int(n), nil
+}
+
+func (d *binaryDecoder) bytes() ([]byte, error) {
+	n, err := d.length(1)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (d *binaryDecoder) value(v reflect.Value) error {
+	t := v.Type()
+	if marshalsItself(t) {
+		data, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := d.varint()
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(x) {
+			return fmt.Errorf("labrpc: %v overflows %v", x, t)
+		}
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(x) {
+			return fmt.Errorf("labrpc: %v overflows %v", x, t)
+		}
+		v.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		x, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(math.Float64frombits(bits.ReverseBytes64(x)))
+	case reflect.String:
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case reflect.Slice:
+		n, err := d.length(t.Elem().Size())
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		s := reflect.MakeSlice(t, n-1, n-1)
+		if t.Elem().Kind() == reflect.Uint8 {
+			if _, err := io.ReadFull(d.r, s.Bytes()); err != nil {
+				return err
+			}
+		} else {
+			for i := 0; i < n-1; i++ {
+				if err := d.value(s.Index(i)); err != nil {
+					return err
+				}
+			}
+		}
+		v.Set(s)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := d.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		n, err := d.length(t.Key().Size() + t.Elem().Size())
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		m := reflect.MakeMapWithSize(t, n-1)
+		for i := 0; i < n-1; i++ {
+			key := reflect.New(t.Key()).Elem()
+			if err := d.value(key); err != nil {
+				return err
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if err := d.value(elem); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			if err := d.value(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == 0 {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		p := reflect.New(t.Elem())
+		if err := d.value(p.Elem()); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.Interface:
+		concrete, err := d.tag()
+		if err != nil {
+			return err
+		}
+		if concrete == nil {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if err := checkImplements(concrete, t); err != nil {
+			return err
+		}
+		x := reflect.New(concrete).Elem()
+		if err := d.value(x); err != nil {
+			return err
+		}
+		v.Set(x)
+	default:
+		return fmt.Errorf("labrpc: cannot decode %v", t)
+	}
+	return nil
+}
+
+// the type tagged, nil for a nil interface{}.
+func (d *binaryDecoder) tag() (reflect.Type, error) {
+	tag, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case tag == tagNil:
+		return nil, nil
+	case tag == tagNewName:
+		name, err := d.bytes()
+		if err != nil {
+			return nil, err
+		}
+		t, err := lookupType(string(name))
+		if err != nil {
+			return nil, err
+		}
+		d.names = append(d.names, t)
+		return t, nil
+	case tag == tagName:
+		index, err := d.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if index >= uint64(len(d.names)) {
+			return nil, fmt.Errorf("labrpc: unknown type index %v", index)
+		}
+		return d.names[index], nil
+	case tag-tagBasic < uint64(len(basicTypes)):
+		return basicTypes[tag-tagBasic], nil
+	}
+	return nil, fmt.Errorf("labrpc: unknown type tag %v", tag)
+}
+
+//
+// JSON. structs are objects of their exported fields, maps with string
+// keys are objects and other maps arrays of [key, value] pairs, the
+// values encoding themselves are base64 strings, and the values held in
+// interface{} are objects {"Type": name, "Value": value}.
+//
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Encode(v interface{}) ([]byte, error) {
+	rv, err := indirect(v)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := jsonTree(rv)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+func (jsonCodec) Decode(data []byte, v interface{}) error {
+	rv, err := indirectAlloc(v)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// the numbers are kept as they were written, so that large integers
+	// are not rounded through float64
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return err
+	}
+	return jsonFill(rv, tree)
+}
+
+type jsonTagged struct {
+	Type  string
+	Value interface{}
+}
+
+// the value as the tree of maps, slices and scalars json.Marshal
+// writes.
+func jsonTree(v reflect.Value) (interface{}, error) {
+	if marshalsItself(v.Type()) {
+		return v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return json.Number(strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return json.Number(strconv.FormatUint(v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("labrpc: json cannot encode %v", f)
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, err := jsonTree(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Key().Kind() == reflect.String {
+			object := make(map[string]interface{}, v.Len())
+			for _, key := range v.MapKeys() {
+				elem, err := jsonTree(v.MapIndex(key))
+				if err != nil {
+					return nil, err
+				}
+				object[key.String()] = elem
+			}
+			return object, nil
+		}
+		pairs := make([]interface{}, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			k, err := jsonTree(key)
+			if err != nil {
+				return nil, err
+			}
+			elem, err := jsonTree(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, []interface{}{k, elem})
+		}
+		return pairs, nil
+	case reflect.Struct:
+		t := v.Type()
+		object := make(map[string]interface{}, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+			field, err := jsonTree(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			object[t.Field(i).Name] = field
+		}
+		return object, nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return jsonTree(v.Elem())
+	case reflect.Interface:
+		x := held(v)
+		if !x.IsValid() {
+			return nil, nil
+		}
+		name, err := rememberType(x.Type())
+		if err != nil {
+			return nil, err
+		}
+		value, err := jsonTree(x)
+		if err != nil {
+			return nil, err
+		}
+		return jsonTagged{Type: name, Value: value}, nil
+	}
+	return nil, fmt.Errorf("labrpc: cannot encode %v", v.Type())
+}
+
+// fill v with what jsonTree wrote, as read by encoding/json.
+func jsonFill(v reflect.Value, tree interface{}) error {
+	t := v.Type()
+	mismatch := func() error {
+		return fmt.Errorf("labrpc: json cannot decode %T into %v", tree, t)
+	}
+	if marshalsItself(t) {
+		s, ok := tree.(string)
+		if !ok {
+			return mismatch()
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+	}
+	if tree == nil {
+		switch v.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		return mismatch()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := tree.(bool)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := tree.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		x, err := n.Int64()
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(x) {
+			return fmt.Errorf("labrpc: %v overflows %v", x, t)
+		}
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := tree.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		x, err := strconv.ParseUint(string(n), 10, 64)
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(x) {
+			return fmt.Errorf("labrpc: %v overflows %v", x, t)
+		}
+		v.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		n, ok := tree.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		x, err := n.Float64()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(x)
+	case reflect.String:
+		s, ok := tree.(string)
+		if !ok {
+			return mismatch()
+		}
+		v.SetString(s)
+	case reflect.Slice, reflect.Array:
+		items, ok := tree.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(items), len(items)))
+		} else if len(items) != v.Len() {
+			return mismatch()
+		}
+		for i, item := range items {
+			if err := jsonFill(v.Index(i), item); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m := reflect.MakeMap(t)
+		fill := func(k interface{}, e interface{}) error {
+			key := reflect.New(t.Key()).Elem()
+			if err := jsonFill(key, k); err != nil {
+				return err
+			}
+			elem := reflect.New(t.Elem()).Elem()
+			if err := jsonFill(elem, e); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, elem)
+			return nil
+		}
+		if t.Key().Kind() == reflect.String {
+			object, ok := tree.(map[string]interface{})
+			if !ok {
+				return mismatch()
+			}
+			for k, e := range object {
+				if err := fill(k, e); err != nil {
+					return err
+				}
+			}
+		} else {
+			pairs, ok := tree.([]interface{})
+			if !ok {
+				return mismatch()
+			}
+			for _, p := range pairs {
+				pair, ok := p.([]interface{})
+				if !ok || len(pair) != 2 {
+					return mismatch()
+				}
+				if err := fill(pair[0], pair[1]); err != nil {
+					return err
+				}
+			}
+		}
+		v.Set(m)
+	case reflect.Struct:
+		object, ok := tree.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field, ok := object[t.Field(i).Name]
+			if t.Field(i).PkgPath != "" || !ok {
+				continue
+			}
+			if err := jsonFill(v.Field(i), field); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		p := reflect.New(t.Elem())
+		if err := jsonFill(p.Elem(), tree); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.Interface:
+		object, ok := tree.(map[string]interface{})
+		name, named := object["Type"].(string)
+		if !ok || !named {
+			return mismatch()
+		}
+		concrete, err := lookupType(name)
+		if err != nil {
+			return err
+		}
+		if err := checkImplements(concrete, t); err != nil {
+			return err
+		}
+		x := reflect.New(concrete).Elem()
+		if err := jsonFill(x, object["Value"]); err != nil {
+			return err
+		}
+		v.Set(x)
+	default:
+		return fmt.Errorf("labrpc: cannot decode %v", t)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package labrpc
+
+import "reflect"
+import "testing"
+import "time"
+
+type CodecRow []interface{}
+
+type CodecArgs struct {
+	Name    string
+	Rows    []CodecRow
+	Counts  map[int]float32
+	Next    *CodecArgs
+	At      time.Time
+	Data    []byte
+	Columns map[string]interface{}
+	hidden  int
+}
+
+type CodecServer struct{}
+
+// echo the argument list, with its length appended.
+func (cs *CodecServer) Echo(args []interface{}, reply *[]interface{}) {
+	*reply = append(args, len(args))
+}
+
+// NaN replies NaN, which json cannot encode.
+func (cs *CodecServer) NaN(args int, reply *[]interface{}) {
+	*reply = nanArgs()
+}
+
+func codecArgs() CodecArgs {
+	return CodecArgs{
+		Name:    "student",
+		Rows:    []CodecRow{{1, "Smith", int64(20), 3.5, nil}, {uint8(2), true, CodecRow{"nested"}}, nil},
+		Counts:  map[int]float32{-1: 0.5, 7: 2},
+		Next:    &CodecArgs{Name: "next", Columns: map[string]interface{}{"sid": []int{1, 2}}},
+		At:      time.Unix(1700000000, 42).UTC(),
+		Data:    []byte{0, 1, 255},
+		Columns: map[string]interface{}{"grade": float32(3.5), "ok": &CodecArgs{Name: "pointer"}},
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, BinaryCodec} {
+		args := codecArgs()
+		args.hidden = 1
+		data, err := codec.Encode(&args)
+		if err != nil {
+			t.Fatalf("%v: encode: %v", codec.Name(), err)
+		}
+		decoded := CodecArgs{}
+		if err := codec.Decode(data, &decoded); err != nil {
+			t.Fatalf("%v: decode: %v", codec.Name(), err)
+		}
+		expected := codecArgs()
+		// as with gob, the pointers held in interface{} are sent as the values they point to
+		expected.Columns["ok"] = CodecArgs{Name: "pointer"}
+		if !reflect.DeepEqual(expected, decoded) {
+			t.Fatalf("%v: expected %v, got %v", codec.Name(), expected, decoded)
+		}
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec, BinaryCodec} {
+		if _, err := codec.Encode(make(chan int)); err == nil {
+			t.Fatalf("%v: expected a channel not to be encoded", codec.Name())
+		}
+		data, _ := codec.Encode("not an int")
+		x := 0
+		if err := codec.Decode(data, &x); err == nil {
+			t.Fatalf("%v: expected a string not to decode into an int", codec.Name())
+		}
+		if err := codec.Decode(data, x); err == nil {
+			t.Fatalf("%v: expected a non-pointer to be refused", codec.Name())
+		}
+	}
+	if _, err := JSONCodec.Encode(nanArgs()); err == nil {
+		t.Fatalf("expected json not to encode NaN")
+	}
+	if CodecByName("binary") != BinaryCodec || CodecByName("xml") != nil {
+		t.Fatalf("wrong codecs by name")
+	}
+}
+
+func nanArgs() []interface{} {
+	zero := 0.0
+	return []interface{}{zero / zero}
+}
+
+func TestCodecCall(t *testing.T) {
+	rn := MakeNetwork()
+	defer rn.Cleanup()
+
+	e := rn.MakeEnd("end1-99")
+	rs := MakeServer()
+	rs.AddService(MakeService(&CodecServer{}))
+	rn.AddServer("server99", rs)
+	rn.Connect("end1-99", "server99")
+	rn.Enable("end1-99", true)
+
+	args := []interface{}{"scan", CodecRow{1, 2.5}, map[string]interface{}{"sid": 1}}
+	expected := append(append([]interface{}{}, args...), 3)
+	sizes := map[string]int64{}
+	for _, codec := range []Codec{JSONCodec, BinaryCodec} {
+		before := rn.GetTotalBytes()
+		reply := []interface{}{}
+		if !e.CallCodec(codec, "CodecServer.Echo", args, &reply) {
+			t.Fatalf("%v: call failed", codec.Name())
+		}
+		if !reflect.DeepEqual(expected, reply) {
+			t.Fatalf("%v: expected %v, got %v", codec.Name(), expected, reply)
+		}
+		sizes[codec.Name()] = rn.GetTotalBytes() - before
+	}
+	if sizes["binary"] >= sizes["json"] {
+		t.Fatalf("expected the binary codec to be compact, sizes %v", sizes)
+	}
+}
+
+func TestCodecCallEncodeError(t *testing.T) {
+	rn := MakeNetwork()
+	defer rn.Cleanup()
+
+	e := rn.MakeEnd("end1-99")
+	rs := MakeServer()
+	rs.AddService(MakeService(&CodecServer{}))
+	rn.AddServer("server99", rs)
+	rn.Connect("end1-99", "server99")
+	rn.Enable("end1-99", true)
+
+	reply := []interface{}{}
+	if e.CallCodec(JSONCodec, "CodecServer.NaN", 0, &reply) {
+		t.Fatalf("expected a reply json cannot encode to fail the call")
+	}
+	if !e.CallCodec(BinaryCodec, "CodecServer.NaN", 0, &reply) || len(reply) != 1 {
+		t.Fatalf("expected the binary codec to encode NaN, got %v", reply)
+	}
+}
@@ -13,7 +13,8 @@ package labrpc
 // adapted from Go net/rpc/server.go.
 //
 // sends labgob-encoded values to ensure that RPCs
-// don't include references to program objects.
+// don't include references to program objects, or values
+// encoded with another codec, see codec.go.
 //
 // net := MakeNetwork() -- holds network, clients, servers.
 // end := net.MakeEnd(endname) -- create a client end-point, to talk to one server.
@@ -24,6 +25,7 @@ package labrpc
 // net.Reliable(bool) -- false means drop/delay messages
 //
 // end.Call("Raft.AppendEntries", &args, &reply) -- send an RPC, wait for reply.
+// end.CallCodec(codec, "Raft.AppendEntries", &args, &reply) -- the same, encoded with codec.
 // the "Raft" is the name of the server struct to be called.
 // the "AppendEntries" is the name of the method to be called.
 // Call() returns true to indicate that the server executed the request
@@ -49,11 +51,6 @@ package labrpc
 //   pass svc to srv.AddService()
 //
 
-import (
-	"../labgob"
-	"fmt"
-)
-import "bytes"
 import "reflect"
 import "sync"
 import "log"
@@ -67,6 +64,7 @@ type reqMsg struct {
 	svcMeth  string      // e.g. "Raft.AppendEntries"
 	argsType reflect.Type
 	args     []byte
+	codec    Codec // that encoded args, the reply is encoded with it too
 	replyCh  chan replyMsg
 }
 
@@ -85,19 +83,25 @@ type ClientEnd struct {
 // the return value indicates success; false means that
 // no reply was received from the server.
 func (e *ClientEnd) Call(svcMeth string, args interface{}, reply interface{}) bool {
+	return e.CallCodec(GobCodec, svcMeth, args, reply)
+}
+
+// send an RPC encoded with the given codec, see Codec, and wait
+// for the reply, as Call does.
+func (e *ClientEnd) CallCodec(codec Codec, svcMeth string, args interface{}, reply interface{}) bool {
 	req := reqMsg{}
 	req.endname = e.endname
 	req.svcMeth = svcMeth
 	req.argsType = reflect.TypeOf(args)
+	req.codec = codec
 	req.replyCh = make(chan replyMsg)
 
-	qb := new(bytes.Buffer)
-	qe := labgob.NewEncoder(qb)
-	err := qe.Encode(args)
+	qb, err := codec.Encode(args)
 	if err != nil {
-		fmt.Println(err.Error())
+		// the server would not be able to decode the request
+		return false
 	}
-	req.args = qb.Bytes()
+	req.args = qb
 
 	//
 	// send the request.
@@ -115,9 +119,7 @@ func (e *ClientEnd) Call(svcMeth string, args interface{}, reply interface{}) bo
 	//
 	rep := <-req.replyCh
 	if rep.ok {
-		rb := bytes.NewBuffer(rep.reply)
-		rd := labgob.NewDecoder(rb)
-		if err := rd.Decode(reply); err != nil {
+		if err := codec.Decode(rep.reply, reply); err != nil {
 			log.Fatalf("ClientEnd.Call(): decode reply: %v\n", err)
 		}
 		return true
@@ -486,9 +488,9 @@ func (svc *Service) dispatch(methname string, req reqMsg) replyMsg {
 		args := reflect.New(req.argsType)
 
 		// decode the argument.
-		ab := bytes.NewBuffer(req.args)
-		ad := labgob.NewDecoder(ab)
-		ad.Decode(args.Interface())
+		if err := req.codec.Decode(req.args, args.Interface()); err != nil {
+			return replyMsg{false, nil}
+		}
 
 		// allocate space for the reply.
 		replyType := method.Type.In(2)
@@ -500,11 +502,13 @@ func (svc *Service) dispatch(methname string, req reqMsg) replyMsg {
 		function.Call([]reflect.Value{svc.rcvr, args.Elem(), replyv})
 
 		// encode the reply.
-		rb := new(bytes.Buffer)
-		re := labgob.NewEncoder(rb)
-		re.EncodeValue(replyv)
+		rb, err := req.codec.Encode(replyv.Interface())
+		if err != nil {
+			// the caller would not be able to decode the reply
+			return replyMsg{false, nil}
+		}
 
-		return replyMsg{true, rb.Bytes()}
+		return replyMsg{true, rb}
 	} else {
 		choices := []string{}
 		for k, _ := range svc.methods {
@@ -0,0 +1,303 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Workload is a sample of the queries run against a table, see SuggestFragmentation.
+type Workload struct {
+	Queries []WorkloadQuery
+}
+
+// WorkloadQuery is one query of a Workload.
+type WorkloadQuery struct {
+	// the columns read by the query, all columns if empty
+	Columns []string
+	// the filter of the query, the atoms comparing a column with a value by <, <=, > or >= are used as boundaries of
+	// horizontal fragments
+	Filter Predicate
+	// the table the query joins with, if any
+	JoinWith string
+	// how many times the query is run, 1 if not set
+	Weight int
+}
+
+// ColumnStats summarizes the values of a column.
+type ColumnStats struct {
+	Name     string
+	Count    int
+	Nulls    int
+	Distinct int
+	// whether all values are numbers, Min and Max are only set in that case
+	Numeric  bool
+	Min, Max float64
+}
+
+// SuggestFragmentation recommends the fragmentation rules of a table for a workload, in the format BuildTable
+// expects, so that the table can be rebuilt with them:
+//   - columns read by the same queries are grouped into vertical fragments, so that a query only reads the fragments
+//     holding its columns;
+//   - the column filtered by ranges the most is split at the boundaries of the ranges into horizontal fragments, so
+//     that a filtered query only reads the fragments in its ranges;
+//   - the fragments are preferably placed on the nodes holding the table joined the most, so that joins can be done
+//     by the nodes instead of shipping rows to the coordinator.
+//
+// Each fragment has as many replicas as the fragments of the table have now. The reply is empty if no rules can be
+// suggested, e.g., the table does not exist.
+// params: tableName string, workload Workload
+func (c *Cluster) SuggestFragmentation(params []interface{}, reply *[]byte) {
+	rs, err := c.suggestFragmentation(params[0].(string), params[1].(Workload))
+	if err != nil {
+		*reply = nil
+		return
+	}
+	rules, err := rs.Marshal()
+	if err != nil {
+		*reply = nil
+		return
+	}
+	*reply = rules
+}
+
+func (c *Cluster) suggestFragmentation(tableName string, workload Workload) (*RuleSet, error) {
+	q := c.beginRawQuery(QueryHints{})
+	defer c.endQuery(q)
+
+	schema, ok := q.catalog.Schema(tableName)
+	if !ok {
+		return nil, errors.New("no such table")
+	}
+	stats := columnStatistics(schema, getTableRows(c, q, tableName, schema.ColumnSchemas))
+	for i := range workload.Queries {
+		if workload.Queries[i].Weight <= 0 {
+			workload.Queries[i].Weight = 1
+		}
+	}
+
+	nodes := len(c.nodeIds)
+	replication := nodes
+	for _, fragment := range q.placement.Fragments(tableName) {
+		if n := len(q.placement.Replicas(fragment)); n < replication {
+			replication = n
+		}
+	}
+	if replication == 0 {
+		replication = 1
+	}
+	// fragments are placed on distinct sets of consecutive nodes, of which there are as many as the nodes, or only one
+	// if each fragment is placed on all nodes
+	maxFragments := nodes
+	if replication == nodes {
+		maxFragments = 1
+	}
+
+	groups := verticalGroups(schema, workload)
+	if len(groups) > maxFragments {
+		groups = [][]string{allColumns(schema)}
+	}
+	ranges := horizontalRanges(schema, stats, workload, maxFragments/len(groups))
+
+	order := c.placementOrder(q.placement, workload)
+	rs := NewRuleSet(schema)
+	k := 0
+	for _, predicate := range ranges {
+		for _, group := range groups {
+			replicas := make([]int, replication)
+			for i := range replicas {
+				replicas[i] = order[(k+i)%nodes]
+			}
+			rs.AddRule(predicate, group, replicas...)
+			k++
+		}
+	}
+	return rs, rs.Validate()
+}
+
+// columnStatistics computes the statistics of each column of the rows.
+func columnStatistics(schema TableSchema, rows []Row) []ColumnStats {
+	stats := make([]ColumnStats, len(schema.ColumnSchemas))
+	for i, cs := range schema.ColumnSchemas {
+		s := ColumnStats{Name: cs.Name, Numeric: true}
+		distinct := make(map[string]bool)
+		seen := false
+		for _, row := range rows {
+			s.Count++
+			if row[i] == nil {
+				s.Nulls++
+				continue
+			}
+			distinct[fmt.Sprint(row[i])] = true
+			v, ok := numberValue(row[i])
+			if !ok {
+				s.Numeric = false
+				continue
+			}
+			if !seen || v < s.Min {
+				s.Min = v
+			}
+			if !seen || v > s.Max {
+				s.Max = v
+			}
+			seen = true
+		}
+		s.Distinct = len(distinct)
+		if !s.Numeric {
+			s.Min, s.Max = 0, 0
+		}
+		stats[i] = s
+	}
+	return stats
+}
+
+// numberValue converts a numeric value of a row or a predicate to float64.
+func numberValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// verticalGroups groups the columns read by the same queries, in the order of the schema. The columns read by no
+// query form a group of their own.
+func verticalGroups(schema TableSchema, workload Workload) [][]string {
+	groups := make([][]string, 0)
+	signatures := make(map[string]int)
+	for _, cs := range schema.ColumnSchemas {
+		readers := make([]string, 0)
+		for i, query := range workload.Queries {
+			if len(query.Columns) == 0 || contains(query.Columns, cs.Name) {
+				readers = append(readers, strconv.Itoa(i))
+			}
+		}
+		signature := strings.Join(readers, ",")
+		if g, ok := signatures[signature]; ok {
+			groups[g] = append(groups[g], cs.Name)
+		} else {
+			signatures[signature] = len(groups)
+			groups = append(groups, []string{cs.Name})
+		}
+	}
+	return groups
+}
+
+// horizontalRanges splits the numeric column filtered by ranges with the most weight into at most maxRanges ranges,
+// at the boundaries of the filters lying between the smallest and the largest value of the column. Columns having
+// nulls are not split, as a null satisfies no range. A single empty predicate is returned if no column is split.
+func horizontalRanges(schema TableSchema, stats []ColumnStats, workload Workload, maxRanges int) []Predicate {
+	best, bestWeight := -1, 0
+	// column index -> boundary -> weight of the filters using it
+	boundaries := make(map[int]map[float64]int)
+	for i, cs := range schema.ColumnSchemas {
+		if !stats[i].Numeric || stats[i].Nulls > 0 || stats[i].Count == 0 {
+			continue
+		}
+		boundaries[i] = make(map[float64]int)
+		weight := 0
+		for _, query := range workload.Queries {
+			for _, atom := range query.Filter[cs.Name] {
+				v, ok := numberValue(atom.Val)
+				if !ok || atom.Op == "=" || atom.Op == "==" || atom.Op == "!=" || atom.Op == "<>" {
+					continue
+				}
+				if v >= stats[i].Min && v < stats[i].Max {
+					boundaries[i][v] += query.Weight
+					weight += query.Weight
+				}
+			}
+		}
+		if weight > bestWeight {
+			best, bestWeight = i, weight
+		}
+	}
+	if best < 0 || maxRanges < 2 {
+		return []Predicate{{}}
+	}
+
+	points := make([]float64, 0, len(boundaries[best]))
+	for v := range boundaries[best] {
+		points = append(points, v)
+	}
+	// keep the most used boundaries, then order them by value
+	sort.Slice(points, func(i, j int) bool {
+		wi, wj := boundaries[best][points[i]], boundaries[best][points[j]]
+		return wi > wj || (wi == wj && points[i] < points[j])
+	})
+	if len(points) > maxRanges-1 {
+		points = points[:maxRanges-1]
+	}
+	sort.Float64s(points)
+
+	column := schema.ColumnSchemas[best].Name
+	ranges := make([]Predicate, 0, len(points)+1)
+	for i := 0; i <= len(points); i++ {
+		atoms := make([]Atom, 0, 2)
+		if i > 0 {
+			atoms = append(atoms, Atom{Op: ">", Val: points[i-1]})
+		}
+		if i < len(points) {
+			atoms = append(atoms, Atom{Op: "<=", Val: points[i]})
+		}
+		ranges = append(ranges, Predicate{column: atoms})
+	}
+	return ranges
+}
+
+// placementOrder orders the node numbers, the nodes holding all fragments of the table joined the most come first.
+func (c *Cluster) placementOrder(placement *Placement, workload Workload) []int {
+	joins := make(map[string]int)
+	joined := ""
+	for _, query := range workload.Queries {
+		if query.JoinWith == "" {
+			continue
+		}
+		joins[query.JoinWith] += query.Weight
+		if joined == "" || joins[query.JoinWith] > joins[joined] {
+			joined = query.JoinWith
+		}
+	}
+	first, rest := make([]int, 0), make([]int, 0)
+	fragments := placement.Fragments(joined)
+	for _, nodeId := range c.nodeIds {
+		number, _ := strconv.Atoi(strings.TrimPrefix(nodeId, "Node"))
+		if len(fragments) > 0 && nodeHoldsAll(placement, nodeId, fragments) {
+			first = append(first, number)
+		} else {
+			rest = append(rest, number)
+		}
+	}
+	return append(first, rest...)
+}
+
+func allColumns(schema TableSchema) []string {
+	columns := make([]string, len(schema.ColumnSchemas))
+	for i, cs := range schema.ColumnSchemas {
+		columns[i] = cs.Name
+	}
+	return columns
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSuggestFragmentation(t *testing.T) {
+	setupLab3()
+
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0": rangeFragment("grade", ">=", 0, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+
+	// queries filtering by grade split the table by grade, and the fragments go to node3 holding courseRegistration
+	workload := Workload{Queries: []WorkloadQuery{
+		{Filter: Predicate{"grade": {{Op: ">", Val: 3.6}}}, Weight: 3},
+		{Filter: Predicate{"grade": {{Op: "<=", Val: 1.0}}}},
+		{JoinWith: courseRegistrationTableName},
+	}}
+	rules := []byte{}
+	cli.Call("Cluster.SuggestFragmentation", []interface{}{studentTableName, workload}, &rules)
+	suggested := make(map[string]Rule)
+	if err := json.Unmarshal(rules, &suggested); err != nil || len(suggested) != 2 {
+		t.Fatalf("Expected two horizontal fragments, actual %s", rules)
+	}
+	if _, ok := suggested["3"]; !ok {
+		t.Errorf("A fragment should be placed on node3, actual %s", rules)
+	}
+	for _, rule := range suggested {
+		if len(rule.Column) != 4 || len(rule.Predicate["grade"]) == 0 {
+			t.Errorf("Expected fragments split by grade with all columns, actual %s", rules)
+		}
+	}
+
+	// the suggested rules can be applied as they are
+	setupLab3()
+	studentTablePartitionRules = rules
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+	results := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows:   joinedTableContent,
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results with the suggested rules, expected %v, actual %v", expectedDataset, results)
+	}
+
+	// queries reading different columns split the table vertically
+	workload = Workload{Queries: []WorkloadQuery{
+		{Columns: []string{"sid", "name", "age"}},
+		{Columns: []string{"sid", "grade"}},
+	}}
+	rs, err := c.suggestFragmentation(studentTableName, workload)
+	if err != nil || len(rs.fragments) != 3 {
+		t.Fatalf("Expected three vertical fragments, actual %v %v", rs, err)
+	}
+	if columns := rs.fragments[1].columns; len(columns) != 2 || columns[0] != "name" || columns[1] != "age" {
+		t.Errorf("Expected name and age to be grouped, actual %v", rs.fragments)
+	}
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"../labrpc"
+)
+
+// loadRefreshInterval is how often the coordinator reads the load of a rate limited node, see SetNodeRateLimit.
+const loadRefreshInterval = 50 * time.Millisecond
+
+// NodeLoad is the load a node signals back to the coordinator, see Node.RPCLoad.
+type NodeLoad struct {
+	// how many RPCs wait for a slot, see NodeResources.MaxConcurrentRPCs
+	Queued int
+	// how many RPCs are being served
+	Serving int
+	// how many rows the node stores over all its fragments, and how many it can store, 0 for no limit
+	StoredRows      int
+	StorageCapacity int
+	// whether the node asks the coordinator to back off, as more RPCs are queued than NodeResources.MaxQueuedRPCs or
+	// its storage is full
+	Overloaded bool
+	// how many calls the coordinator has delayed to keep to the rate limit of the node, only counted by the
+	// coordinator, see Cluster.NodeLoads
+	Throttled int
+}
+
+// RPCLoad replies the load of this node. It is served right away, without waiting for a slot, so that an overloaded
+// node can still signal its load.
+func (n *Node) RPCLoad(args interface{}, reply *NodeLoad) {
+	n.mu.RLock()
+	stored := 0
+	for _, t := range n.TableMap {
+		stored += t.Count()
+	}
+	n.mu.RUnlock()
+
+	n.resourceMu.Lock()
+	defer n.resourceMu.Unlock()
+	load := NodeLoad{Queued: n.queued, Serving: n.serving, StoredRows: stored,
+		StorageCapacity: n.resources.StorageCapacity}
+	load.Overloaded = (n.resources.MaxQueuedRPCs > 0 && n.queued > n.resources.MaxQueuedRPCs) ||
+		(load.StorageCapacity > 0 && stored >= load.StorageCapacity)
+	*reply = load
+}
+
+// RateLimit throttles the calls of the coordinator to a node with a token bucket, see Cluster.SetNodeRateLimit.
+type RateLimit struct {
+	// how many calls per second are sent to the node, halved while the node is overloaded. There is no limit if not
+	// positive, though the load of the node is still followed.
+	Rate float64
+	// how many calls may be sent at once after the node has been idle, at least 1
+	Burst int
+}
+
+// nodeLimiter is the token bucket of a node and the last load the node has signalled.
+type nodeLimiter struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	load   NodeLoad
+	// when the load was last read, zero to read it at the next call
+	loadAt time.Time
+}
+
+func newNodeLimiter(limit RateLimit) *nodeLimiter {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &nodeLimiter{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+}
+
+// refresh reads the load of the node through end if the last one is too old.
+func (l *nodeLimiter) refresh(end *labrpc.ClientEnd) {
+	l.mu.Lock()
+	if time.Since(l.loadAt) < loadRefreshInterval {
+		l.mu.Unlock()
+		return
+	}
+	// the other calls keep to the old load while this one reads the new one
+	l.loadAt = time.Now()
+	l.mu.Unlock()
+
+	load := NodeLoad{}
+	if !end.Call("Node.RPCLoad", "", &load) {
+		return
+	}
+	l.mu.Lock()
+	load.Throttled = l.load.Throttled
+	l.load = load
+	l.mu.Unlock()
+}
+
+// wait takes a token from the bucket, waiting for one to be refilled if it is empty.
+func (l *nodeLimiter) wait() {
+	throttled := false
+	for {
+		l.mu.Lock()
+		rate := l.limit.Rate
+		if rate <= 0 {
+			l.mu.Unlock()
+			return
+		}
+		if l.load.Overloaded {
+			rate /= 2
+		}
+		now := time.Now()
+		l.tokens = math.Min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return
+		}
+		if !throttled {
+			throttled = true
+			l.load.Throttled++
+		}
+		delay := time.Duration((1 - l.tokens) / rate * float64(time.Second))
+		l.mu.Unlock()
+		time.Sleep(delay)
+	}
+}
+
+// overloaded tells whether the node has signalled that it is overloaded, reading its load through end if the last
+// one is too old.
+func (l *nodeLimiter) overloaded(end *labrpc.ClientEnd) bool {
+	l.refresh(end)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.load.Overloaded
+}
+
+// nodeClient is the client end through which the coordinator calls a node, keeping to the rate limit of the node if
+// it has one, see SetNodeRateLimit.
+type nodeClient struct {
+	end *labrpc.ClientEnd
+	// nil if the node is not rate limited
+	limiter *nodeLimiter
+	// the codec of the cluster, see Cluster.SetCodec
+	codec labrpc.Codec
+}
+
+// Call makes the call in the way of labrpc.ClientEnd.Call, encoded with the codec of the cluster, once the rate limit
+// of the node allows it.
+func (nc *nodeClient) Call(method string, args interface{}, reply interface{}) bool {
+	if nc.limiter != nil {
+		nc.limiter.refresh(nc.end)
+		nc.limiter.wait()
+	}
+	return nc.end.CallCodec(nc.codec, method, args, reply)
+}
+
+// readOrder orders the replicas of a fragment in which they are read: the replicas on the nodes which have signalled
+// that they are overloaded come last, so that the reads are routed around them as long as another replica answers.
+// The load of such a node is still read, so that the reads come back once it has recovered.
+func (c *Cluster) readOrder(replicas []string) []string {
+	overloaded := make(map[string]bool)
+	for _, nodeId := range replicas {
+		nc := c.nodeEnd(nodeId)
+		overloaded[nodeId] = nc.limiter != nil && nc.limiter.overloaded(nc.end)
+	}
+	ordered := append([]string(nil), replicas...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return !overloaded[ordered[i]] && overloaded[ordered[j]]
+	})
+	return ordered
+}
+
+// SetNodeRateLimit throttles the calls of the coordinator to a node, see RateLimit, and makes the coordinator follow
+// the load of the node: the calls slow down while the node is overloaded, and the reads go to the other replicas of
+// its fragments first. A zero RateLimit removes the limit.
+// params: nodeId string, limit RateLimit
+func (c *Cluster) SetNodeRateLimit(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	nodeId := params[0].(string)
+	limit := params[1].(RateLimit)
+	if !contains(c.nodeIds, nodeId) {
+		*reply = "1 no such node"
+		return
+	}
+	if limit.Rate < 0 || limit.Burst < 0 {
+		*reply = "1 rate and burst must not be negative"
+		return
+	}
+	c.limiterMu.Lock()
+	defer c.limiterMu.Unlock()
+	if limit == (RateLimit{}) {
+		delete(c.limiters, nodeId)
+	} else {
+		c.limiters[nodeId] = newNodeLimiter(limit)
+	}
+	*reply = "0 OK"
+}
+
+// NodeLoads replies the last load signalled by each rate limited node, see SetNodeRateLimit.
+func (c *Cluster) NodeLoads(args interface{}, reply *map[string]NodeLoad) {
+	c.limiterMu.Lock()
+	defer c.limiterMu.Unlock()
+	loads := make(map[string]NodeLoad, len(c.limiters))
+	for nodeId, l := range c.limiters {
+		l.mu.Lock()
+		loads[nodeId] = l.load
+		l.mu.Unlock()
+	}
+	*reply = loads
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNodeRateLimit(t *testing.T) {
+	setupSoftDelete(0)
+	reply := ""
+	cli.Call("Cluster.SetNodeRateLimit", []interface{}{"Node2", RateLimit{Rate: 20, Burst: 1}}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("SetNodeRateLimit failed: %v", reply)
+	}
+	cli.Call("Cluster.SetNodeRateLimit", []interface{}{"Node7", RateLimit{Rate: 20}}, &reply)
+	if reply != "1 no such node" {
+		t.Errorf("expected an unknown node, actual %v", reply)
+	}
+
+	// one read of node2 every 50ms once the burst is spent
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if rows := scanRows(studentTableName); len(rows) != 3 {
+			t.Fatalf("expected 3 students, actual %v", rows)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected the reads of node2 to be throttled, actual %v", elapsed)
+	}
+	loads := make(map[string]NodeLoad)
+	cli.Call("Cluster.NodeLoads", "", &loads)
+	if load, ok := loads["Node2"]; !ok || load.Throttled == 0 || load.StoredRows != 2 || load.Overloaded {
+		t.Errorf("expected node2 to be throttled, actual %v", loads)
+	}
+}
+
+func TestNodeOverload(t *testing.T) {
+	setupSoftDelete(0)
+	reply := ""
+	// node0 holds the replica of Smith, so that its storage is full
+	cli.Call("Cluster.SetNodeResources", []interface{}{"Node0", NodeResources{StorageCapacity: 1}}, &reply)
+	cli.Call("Cluster.SetNodeRateLimit", []interface{}{"Node0", RateLimit{Burst: 1}}, &reply)
+	if rows := scanRows(studentTableName); len(rows) != 3 {
+		t.Fatalf("expected 3 students, actual %v", rows)
+	}
+	loads := make(map[string]NodeLoad)
+	cli.Call("Cluster.NodeLoads", "", &loads)
+	if !loads["Node0"].Overloaded {
+		t.Fatalf("expected node0 to signal its overload, actual %v", loads)
+	}
+
+	// the reads go to node1 while node0 is overloaded
+	count0, count1 := network.GetCount("Node0"), network.GetCount("Node1")
+	if rows := scanRows(studentTableName); len(rows) != 3 {
+		t.Fatalf("expected 3 students, actual %v", rows)
+	}
+	if network.GetCount("Node0") != count0 || network.GetCount("Node1") == count1 {
+		t.Errorf("expected node1 to be read instead of node0")
+	}
+
+	cli.Call("Cluster.SetNodeResources", []interface{}{"Node0", NodeResources{}}, &reply)
+	time.Sleep(2 * loadRefreshInterval)
+	scanRows(studentTableName)
+	count0 = network.GetCount("Node0")
+	scanRows(studentTableName)
+	if network.GetCount("Node0") == count0 {
+		t.Errorf("expected node0 to be read again once it has recovered")
+	}
+}
@@ -0,0 +1,327 @@
+package models
+
+import (
+	"sort"
+	"sync"
+)
+
+// CatalogTable is the entry of a table in the catalog: how the table has been built, the ids of its rows and how many
+// fragment numbers it has given out.
+type CatalogTable struct {
+	// the logical schema of the table, without the hidden id column
+	Schema TableSchema
+	// the primary key column, "" for none
+	Key string
+	// how the fragments of the table are stored by the nodes
+	Storage TableStorage
+	// the ids of the rows in the order they were written
+	Ids []string
+	// how many fragment numbers have been given out for this table, the fragments are named "tableName|i" with i below
+	// this number, see Placement.Fragments for the fragments that currently exist
+	Num int
+}
+
+// Catalog holds the tables of a coordinator. Queries read a CatalogSnapshot taken when they start (see beginQuery), so
+// that a table built, dropped or renamed while they run is seen either as it was or as it is after the DDL, never
+// half-created. Each DDL bumps the version of the catalog, the writes of rows do not.
+// The schemas and the ids of the entries are never modified in place: an entry is replaced, and the ids are only
+// appended to, so that a snapshot shares them with the catalog instead of copying them. The writers of the catalog
+// hold writeMu.
+// Each change of an entry, DDL or write, is numbered as well, so that a copy of the catalog can be brought up to date
+// with the changes made since it was copied, see ChangesSince.
+type Catalog struct {
+	mu      sync.RWMutex
+	version int
+	tables  map[string]CatalogTable
+	// how many changes the catalog has had
+	changes int
+	// table name -> the change which changed its entry last, and the change which changed it otherwise than by
+	// appending ids last
+	changedAt map[string]int
+	resetAt   map[string]int
+}
+
+// CatalogChanges are the changes of a catalog since one of its changes, which bring a copy of the catalog made then up
+// to date, see Catalog.ChangesSince.
+type CatalogChanges struct {
+	// the change of the catalog the copy is brought up to
+	Change int
+	// the names of all tables, the tables of the copy missing from them have been dropped
+	TableNames []string
+	// the entries changed otherwise than by appending ids, in full
+	Tables map[string]CatalogTable
+	// table name -> the ids appended to the other entries changed
+	AddedIds map[string][]string
+}
+
+// CatalogSnapshot is the catalog as of a version, which later changes of the catalog leave as it is.
+type CatalogSnapshot struct {
+	Version int
+	tables  map[string]CatalogTable
+}
+
+// NewCatalog creates an empty Catalog.
+func NewCatalog() *Catalog {
+	return &Catalog{tables: make(map[string]CatalogTable), changedAt: make(map[string]int),
+		resetAt: make(map[string]int)}
+}
+
+// Snapshot copies the catalog as of its current version.
+func (cat *Catalog) Snapshot() *CatalogSnapshot {
+	cat.mu.RLock()
+	defer cat.mu.RUnlock()
+
+	s := &CatalogSnapshot{Version: cat.version, tables: make(map[string]CatalogTable, len(cat.tables))}
+	for tableName, table := range cat.tables {
+		s.tables[tableName] = table
+	}
+	return s
+}
+
+// ChangesSince returns the changes of the catalog since the given change, for a copy of the catalog holding the given
+// number of ids of each table. All entries are sent in full if since is negative, or is not a change of this catalog.
+func (cat *Catalog) ChangesSince(since int, idCounts map[string]int) CatalogChanges {
+	cat.mu.RLock()
+	defer cat.mu.RUnlock()
+
+	if since > cat.changes {
+		since = -1
+	}
+	changes := CatalogChanges{Change: cat.changes, TableNames: make([]string, 0, len(cat.tables)),
+		Tables: make(map[string]CatalogTable), AddedIds: make(map[string][]string)}
+	for tableName, table := range cat.tables {
+		changes.TableNames = append(changes.TableNames, tableName)
+		if since >= 0 && cat.changedAt[tableName] <= since {
+			continue
+		}
+		count, held := idCounts[tableName]
+		if since >= 0 && cat.resetAt[tableName] <= since && held && count <= len(table.Ids) {
+			changes.AddedIds[tableName] = table.Ids[count:]
+		} else {
+			changes.Tables[tableName] = table
+		}
+	}
+	return changes
+}
+
+// ApplyChanges brings the catalog, a copy of another one, up to date with the changes of the other one, see
+// ChangesSince and Standby.
+func (cat *Catalog) ApplyChanges(changes CatalogChanges) {
+	cat.mu.Lock()
+	defer cat.mu.Unlock()
+
+	kept := make(map[string]bool, len(changes.TableNames))
+	for _, tableName := range changes.TableNames {
+		kept[tableName] = true
+	}
+	ddl := len(changes.Tables) > 0
+	// the changes are numbered as those of this catalog, which goes on from them once the standby takes over
+	for tableName := range cat.tables {
+		if !kept[tableName] {
+			delete(cat.tables, tableName)
+			delete(cat.changedAt, tableName)
+			delete(cat.resetAt, tableName)
+			cat.changes++
+			ddl = true
+		}
+	}
+	for tableName, table := range changes.Tables {
+		table.Ids = append(make([]string, 0, len(table.Ids)), table.Ids...)
+		cat.tables[tableName] = table
+		cat.changed(tableName, true)
+	}
+	for tableName, ids := range changes.AddedIds {
+		if table, ok := cat.tables[tableName]; ok {
+			table.Ids = append(table.Ids, ids...)
+			cat.tables[tableName] = table
+			cat.changed(tableName, false)
+		}
+	}
+	if ddl {
+		cat.version++
+	}
+}
+
+// IdCounts returns how many ids each table has.
+func (cat *Catalog) IdCounts() map[string]int {
+	cat.mu.RLock()
+	defer cat.mu.RUnlock()
+	counts := make(map[string]int, len(cat.tables))
+	for tableName, table := range cat.tables {
+		counts[tableName] = len(table.Ids)
+	}
+	return counts
+}
+
+// Version returns how many DDLs have changed the catalog.
+func (cat *Catalog) Version() int {
+	cat.mu.RLock()
+	defer cat.mu.RUnlock()
+	return cat.version
+}
+
+// Table returns the entry of a table, false if there is no such table.
+func (cat *Catalog) Table(tableName string) (CatalogTable, bool) {
+	cat.mu.RLock()
+	defer cat.mu.RUnlock()
+	table, ok := cat.tables[tableName]
+	return table, ok
+}
+
+// Schema returns the logical schema of a table, false if there is no such table.
+func (cat *Catalog) Schema(tableName string) (TableSchema, bool) {
+	table, ok := cat.Table(tableName)
+	return table.Schema, ok
+}
+
+// Key returns the primary key column of a table, false if the table has none.
+func (cat *Catalog) Key(tableName string) (string, bool) {
+	table, _ := cat.Table(tableName)
+	return table.Key, table.Key != ""
+}
+
+// Storage returns how the fragments of a table are stored.
+func (cat *Catalog) Storage(tableName string) TableStorage {
+	table, _ := cat.Table(tableName)
+	return table.Storage
+}
+
+// Ids returns the ids of the rows of a table in the order they were written.
+func (cat *Catalog) Ids(tableName string) []string {
+	table, _ := cat.Table(tableName)
+	return table.Ids
+}
+
+// Num returns how many fragment numbers a table has given out.
+func (cat *Catalog) Num(tableName string) int {
+	table, _ := cat.Table(tableName)
+	return table.Num
+}
+
+// CreateTable adds a table to the catalog, replacing the table of the same name if any.
+func (cat *Catalog) CreateTable(table CatalogTable) {
+	cat.mu.Lock()
+	defer cat.mu.Unlock()
+	cat.version++
+	cat.tables[table.Schema.TableName] = table
+	cat.changed(table.Schema.TableName, true)
+}
+
+// DropTable removes a table from the catalog.
+func (cat *Catalog) DropTable(tableName string) {
+	cat.mu.Lock()
+	defer cat.mu.Unlock()
+	cat.version++
+	delete(cat.tables, tableName)
+	cat.changes++
+	delete(cat.changedAt, tableName)
+	delete(cat.resetAt, tableName)
+}
+
+// RenameTable gives a table another name.
+func (cat *Catalog) RenameTable(from string, to string) {
+	cat.mu.Lock()
+	defer cat.mu.Unlock()
+	table, ok := cat.tables[from]
+	if !ok {
+		return
+	}
+	cat.version++
+	table.Schema.TableName = to
+	cat.tables[to] = table
+	delete(cat.tables, from)
+	delete(cat.changedAt, from)
+	delete(cat.resetAt, from)
+	cat.changed(to, true)
+}
+
+// SetKey makes a column the primary key of a table.
+func (cat *Catalog) SetKey(tableName string, column string) {
+	cat.update(tableName, true, true, func(table *CatalogTable) { table.Key = column })
+}
+
+// AddIds appends the ids of the rows written into a table.
+func (cat *Catalog) AddIds(tableName string, ids ...string) {
+	cat.update(tableName, false, false, func(table *CatalogTable) { table.Ids = append(table.Ids, ids...) })
+}
+
+// SetIds replaces the ids of the rows of a table, e.g., once some of them have been deleted.
+func (cat *Catalog) SetIds(tableName string, ids []string) {
+	cat.update(tableName, false, true, func(table *CatalogTable) { table.Ids = append([]string(nil), ids...) })
+}
+
+// IncrementNum gives out the next fragment number of a table.
+func (cat *Catalog) IncrementNum(tableName string) {
+	cat.update(tableName, false, true, func(table *CatalogTable) { table.Num++ })
+}
+
+// update modifies the entry of an existing table, bumping the version of the catalog if the change is a DDL. The
+// change resets the entry unless it only appends ids.
+func (cat *Catalog) update(tableName string, ddl bool, reset bool, change func(table *CatalogTable)) {
+	cat.mu.Lock()
+	defer cat.mu.Unlock()
+	table, ok := cat.tables[tableName]
+	if !ok {
+		return
+	}
+	if ddl {
+		cat.version++
+	}
+	change(&table)
+	cat.tables[tableName] = table
+	cat.changed(tableName, reset)
+}
+
+// changed numbers a change of the entry of a table, see ChangesSince. The caller must hold mu.
+func (cat *Catalog) changed(tableName string, reset bool) {
+	cat.changes++
+	cat.changedAt[tableName] = cat.changes
+	if reset {
+		cat.resetAt[tableName] = cat.changes
+	}
+}
+
+// Table returns the entry of a table as of the snapshot, false if there was no such table.
+func (s *CatalogSnapshot) Table(tableName string) (CatalogTable, bool) {
+	table, ok := s.tables[tableName]
+	return table, ok
+}
+
+// Schema returns the logical schema of a table as of the snapshot, false if there was no such table.
+func (s *CatalogSnapshot) Schema(tableName string) (TableSchema, bool) {
+	table, ok := s.tables[tableName]
+	return table.Schema, ok
+}
+
+// Key returns the primary key column of a table as of the snapshot, false if the table had none.
+func (s *CatalogSnapshot) Key(tableName string) (string, bool) {
+	key := s.tables[tableName].Key
+	return key, key != ""
+}
+
+// Ids returns the ids of the rows of a table written before the snapshot was taken.
+func (s *CatalogSnapshot) Ids(tableName string) []string {
+	return s.tables[tableName].Ids
+}
+
+// TableNames returns the names of the tables of the snapshot in order.
+func (s *CatalogSnapshot) TableNames() []string {
+	names := make([]string, 0, len(s.tables))
+	for tableName := range s.tables {
+		names = append(names, tableName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// installCatalog installs the placement together with a change of the catalog, so that the queries starting from now
+// on pin both of them changed, and those started before pin both of them as they were. The caller must hold writeMu.
+func (c *Cluster) installCatalog(p *Placement, change func(cat *Catalog)) {
+	c.placement.mu.Lock()
+	change(c.catalog)
+	c.placement.current = p
+	c.placement.mu.Unlock()
+	if c.gossipInterval > 0 {
+		c.publishMetadata(p)
+	}
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// a snapshot of the catalog keeps the tables and the rows as of when it was taken, and only the DDLs bump the version
+func TestCatalogSnapshot(t *testing.T) {
+	setupSoftDelete(0)
+	version := c.catalog.Version()
+	s := c.catalog.Snapshot()
+	reply := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Eve", 20, 3.0}}, &reply)
+	if len(s.Ids(studentTableName)) != 3 || len(c.catalog.Ids(studentTableName)) != 4 {
+		t.Errorf("expected 3 rows in the snapshot and 4 in the catalog, actual %v and %v", s.Ids(studentTableName),
+			c.catalog.Ids(studentTableName))
+	}
+	if c.catalog.Version() != version {
+		t.Errorf("a write should not bump the version %v, actual %v", version, c.catalog.Version())
+	}
+
+	cli.Call("Cluster.RenameTable", []interface{}{courseRegistrationTableName, "enrolment"}, &reply)
+	cli.Call("Cluster.DropTable", []interface{}{studentTableName}, &reply)
+	if c.catalog.Version() != version+2 {
+		t.Errorf("expected the version %v, actual %v", version+2, c.catalog.Version())
+	}
+	if schema, ok := s.Schema(courseRegistrationTableName); !ok || schema.TableName != courseRegistrationTableName {
+		t.Errorf("the snapshot should keep the old name, actual %v", schema)
+	}
+	if schema, ok := c.catalog.Schema("enrolment"); !ok || schema.TableName != "enrolment" {
+		t.Errorf("expected the renamed table, actual %v", schema)
+	}
+	if key, ok := s.Key(studentTableName); !ok || key != "sid" || len(s.Ids(studentTableName)) != 3 {
+		t.Errorf("the snapshot should keep the dropped table, actual %v", s.tables[studentTableName])
+	}
+}
+
+// a join running while its table is built again sees the table either as it was or as built, never without its
+// fragments
+// a table one of whose replicas cannot be created is not installed, and the replicas created are dropped
+func TestBuildTableFailure(t *testing.T) {
+	setupLab3()
+	scores := TableSchema{TableName: "score", ColumnSchemas: []ColumnSchema{
+		{Name: "sid", DataType: TypeInt32}, {Name: "points", DataType: TypeInt32}}}
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("points", "<", 50, "sid", "points"),
+		"2":   rangeFragment("points", ">=", "fifty", "sid", "points"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{scores, rules, "", TableStorage{}, true}, &reply)
+	if !strings.HasPrefix(reply, "1") {
+		t.Fatalf("expected the table not to be built, actual %v", reply)
+	}
+	if _, ok := c.catalog.Schema("score"); ok || len(c.currentPlacement().Fragments("score")) != 0 {
+		t.Errorf("expected the table not to be installed")
+	}
+	for _, nodeId := range c.nodeIds {
+		for fragment := range c.nodes[nodeId].TableMap {
+			if fragmentTable(fragment) == "score" {
+				t.Errorf("expected %v to be dropped from %v", fragment, nodeId)
+			}
+		}
+	}
+
+	// the table is built by a retry, which does not take it for existing
+	rules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("points", "<", 50, "sid", "points"),
+		"2":   rangeFragment("points", ">=", 50, "sid", "points"),
+	})
+	cli.Call("Cluster.BuildTable", []interface{}{scores, rules, "", TableStorage{}, true}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("expected the table to be built, actual %v", reply)
+	}
+	cli.Call("Cluster.FragmentWrite", []interface{}{"score", Row{1, 90}}, &reply)
+	if rows := scanRows("score"); reply != "0 OK" || len(rows) != 1 {
+		t.Errorf("expected the row to be written, actual %v %v", reply, rows)
+	}
+}
+
+func TestConcurrentBuildTableAndJoin(t *testing.T) {
+	setupSoftDelete(0)
+	scores := TableSchema{TableName: "score", ColumnSchemas: []ColumnSchema{
+		{Name: "sid", DataType: TypeInt32}, {Name: "points", DataType: TypeInt32}}}
+	rules, _ := NewRuleSet(scores).AddVerticalRule([]string{"sid"}, 3).AddVerticalRule([]string{"points"}, 4).
+		Marshal()
+	builder := network.MakeEnd("builder")
+	network.Connect("builder", c.Name)
+	network.Enable("builder", true)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			reply := ""
+			builder.Call("Cluster.BuildTable", []interface{}{scores, rules}, &reply)
+			builder.Call("Cluster.FragmentWrite", []interface{}{"score", Row{1, 90}}, &reply)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		result := Dataset{}
+		cli.Call("Cluster.Join", []string{studentTableName, "score"}, &result)
+		if result.Error != "" || len(result.Rows) > 1 {
+			t.Fatalf("unexpected join results %v", result)
+		}
+		if len(result.Rows) == 1 && (len(result.Rows[0]) != 5 || result.Rows[0][4] != 90) {
+			t.Fatalf("expected the row of the table built, actual %v", result)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,433 @@
+package models
+
+import (
+	"errors"
+	"sync"
+
+	"../labrpc"
+	"github.com/google/uuid"
+)
+
+// Client is a client library of a cluster routing point operations by itself: it keeps the partition map of the
+// coordinator (see Cluster.PartitionMap), so that Get and Insert go to the nodes holding the row directly, while the
+// coordinator is only asked for the other requests (through Coordinator, or Execute to have them executed once
+// however many times they are retried), or when the partition map turns out to be stale. Calls may be made
+// concurrently.
+type Client struct {
+	network *labrpc.Network
+	// the prefix of the names of the client ends of the client
+	name        string
+	coordinator *labrpc.ClientEnd
+	mu          sync.Mutex
+	// nil until the partition map is fetched
+	partitions *CoordinatorMetadata
+}
+
+// NewClient creates a Client of the cluster named clusterName in the network, whose client ends are named after
+// clientName. The partition map is fetched on the first point operation.
+func NewClient(network *labrpc.Network, clientName string, clusterName string) *Client {
+	end := network.MakeEnd(clientName)
+	network.Connect(clientName, clusterName)
+	network.Enable(clientName, true)
+	return &Client{network: network, name: clientName, coordinator: end}
+}
+
+// Coordinator returns the client end connected to the coordinator, for the requests that are not point operations.
+func (cl *Client) Coordinator() *labrpc.ClientEnd {
+	return cl.coordinator
+}
+
+// Refresh fetches the partition map from the coordinator, e.g., after the tables have been built.
+func (cl *Client) Refresh() error {
+	partitions := CoordinatorMetadata{}
+	if !cl.coordinator.Call("Cluster.PartitionMap", "", &partitions) {
+		return errors.New("the cluster does not answer")
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.partitions = &partitions
+	return nil
+}
+
+// partitionMap returns the partition map, fetching it if it has not been fetched yet.
+func (cl *Client) partitionMap() (*CoordinatorMetadata, bool) {
+	cl.mu.Lock()
+	partitions := cl.partitions
+	cl.mu.Unlock()
+	if partitions != nil {
+		return partitions, true
+	}
+	if err := cl.Refresh(); err != nil {
+		return nil, false
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.partitions, true
+}
+
+// nodeEnd returns a client end of the client connected to the given node.
+func (cl *Client) nodeEnd(nodeId string) *labrpc.ClientEnd {
+	endName := cl.name + "->" + nodeId
+	end := cl.network.MakeEnd(endName)
+	cl.network.Connect(endName, nodeId)
+	cl.network.Enable(endName, true)
+	return end
+}
+
+// Get looks up a single row by its primary key as Cluster.Get does. The row is read from the nodes directly if every
+// fragment that may hold it holds all columns of the table, otherwise, or if the nodes cannot answer even with a
+// refreshed partition map, it is looked up through the coordinator. The client has no privileged user, so the masked
+// columns are masked either way, see Cluster.MaskColumn.
+func (cl *Client) Get(tableName string, key interface{}) Dataset {
+	for attempt := 0; attempt < 2; attempt++ {
+		partitions, ok := cl.partitionMap()
+		if !ok {
+			break
+		}
+		if _, known := partitions.Schemas[tableName]; !known || partitions.Keys[tableName] == "" {
+			break
+		}
+		if result, ok := cl.directGet(partitions, tableName, key); ok {
+			return result
+		}
+		cl.Refresh()
+	}
+	result := Dataset{}
+	if !cl.Execute(NewRequest("Get", []interface{}{tableName, key}), &result) {
+		return Dataset{}
+	}
+	return result
+}
+
+// directGet reads the row with the key from the first replica answering for each fragment that may hold it. It
+// returns false if some fragment does not hold all columns, or cannot be read from any of its replicas.
+func (cl *Client) directGet(partitions *CoordinatorMetadata, tableName string, key interface{}) (Dataset, bool) {
+	schema := partitions.Schemas[tableName]
+	keyColumn := partitions.Keys[tableName]
+	result := Dataset{Schema: schema, Rows: make([]Row, 0)}
+	// a row in overlapping fragments is returned once
+	found := make(map[interface{}]bool)
+	for fragment, rule := range partitions.FragmentRules {
+		if fragmentTable(fragment) != tableName || !admitsKey(rule.Predicate, keyColumn, key, schema) {
+			continue
+		}
+		if len(rule.Column) != len(schema.ColumnSchemas) {
+			return Dataset{}, false
+		}
+		read := false
+		for _, nodeId := range partitions.FragmentNodes[fragment] {
+			rows := Dataset{}
+			args := LookupKeyArgs{Fragment: fragment, Column: keyColumn, Key: key, Masks: partitions.Masks[tableName]}
+			ok := cl.nodeEnd(nodeId).Call("Node.RPCLookupKey", args, &rows)
+			if !ok || rows.Schema.TableName == "" {
+				continue
+			}
+			kept := make([]Row, 0, len(rows.Rows))
+			for _, row := range rows.Rows {
+				if !found[row[0]] {
+					found[row[0]] = true
+					kept = append(kept, row)
+				}
+			}
+			result.Rows = append(result.Rows, projectRows(rows.Schema.ColumnSchemas, kept, schema.ColumnSchemas)...)
+			read = true
+			break
+		}
+		if !read {
+			return Dataset{}, false
+		}
+	}
+	return result, true
+}
+
+// Insert writes a row as Cluster.FragmentWrite does, and returns the reply of the write. The row is sent to the
+// replicas of the fragments admitting it directly, while the coordinator records the row (see Cluster.RegisterRow)
+// at the same time. If the coordinator rejects the row, the replicas written remove it, and the row is written
+// through the coordinator if the partition map was stale. As with Cluster.FragmentWrite, the row is written into all
+// fragments admitting it or none: if a fragment has no replica accepting it, the row is removed from the others and
+// forgotten by the coordinator. The fragments admitting the row must hold all columns of the table, otherwise the row
+// is written through the coordinator, which tells why it cannot be.
+func (cl *Client) Insert(tableName string, row Row) string {
+	partitions, ok := cl.partitionMap()
+	if !ok {
+		return "1 the cluster does not answer"
+	}
+	schema, known := partitions.Schemas[tableName]
+	// the coordinator tells why a read-only table cannot be written
+	if !known || partitions.ReadOnly[""] || partitions.ReadOnly[tableName] {
+		return cl.coordinatorInsert(tableName, row)
+	}
+	id := uuid.New().String()
+	fullRow := append(copyRow(row), id)
+	locations := make([]RowLocation, 0)
+	columns := make(map[string]bool)
+	for fragment, rule := range partitions.FragmentRules {
+		if fragmentTable(fragment) != tableName || !admitsRow(rule.Predicate, row, schema) {
+			continue
+		}
+		for _, column := range rule.Column {
+			columns[column] = true
+		}
+		for _, nodeId := range partitions.FragmentNodes[fragment] {
+			locations = append(locations, RowLocation{NodeId: nodeId, Fragment: fragment})
+		}
+	}
+	if len(locations) == 0 || len(columns) < len(schema.ColumnSchemas) {
+		return cl.coordinatorInsert(tableName, row)
+	}
+
+	registered := ""
+	written := make([]bool, len(locations))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		args := []interface{}{tableName, fullRow, locations, partitions.Epoch}
+		if !cl.coordinator.Call("Cluster.RegisterRow", args, &registered) {
+			registered = "1 the cluster does not answer"
+		}
+	}()
+	for i, location := range locations {
+		wg.Add(1)
+		go func(i int, location RowLocation) {
+			defer wg.Done()
+			reply := ""
+			cl.nodeEnd(location.NodeId).Call("Node.RPCInsert", InsertArgs{Fragment: location.Fragment, Row: fullRow},
+				&reply)
+			written[i] = len(reply) > 0 && reply[0] == '0'
+		}(i, location)
+	}
+	wg.Wait()
+
+	failed := make([]RowLocation, 0)
+	accepted := make(map[string]bool)
+	for i, location := range locations {
+		if !written[i] {
+			failed = append(failed, location)
+		} else {
+			accepted[location.Fragment] = true
+		}
+	}
+	unwritten := ""
+	for _, location := range locations {
+		if !accepted[location.Fragment] {
+			unwritten = location.Fragment
+		}
+	}
+	if len(registered) == 0 || registered[0] != '0' || unwritten != "" {
+		// the replicas which have not answered may have inserted the row all the same
+		for _, location := range locations {
+			reply := ""
+			args := FragmentIdsArgs{Fragment: location.Fragment, Ids: []string{id}}
+			cl.nodeEnd(location.NodeId).Call("Node.RPCRemoveRows", args, &reply)
+		}
+	}
+	if len(registered) == 0 || registered[0] != '0' {
+		if registered == "1 Stale Partition Map" {
+			cl.Refresh()
+			return cl.coordinatorInsert(tableName, row)
+		}
+		return registered
+	}
+	if unwritten != "" {
+		failed = locations
+	}
+	if len(failed) > 0 {
+		reply := ""
+		cl.coordinator.Call("Cluster.ReleaseRow", []interface{}{tableName, id, failed}, &reply)
+	}
+	if unwritten != "" {
+		return "1 cannot write into " + unwritten
+	}
+	return "0 OK"
+}
+
+func (cl *Client) coordinatorInsert(tableName string, row Row) string {
+	reply := ""
+	if !cl.Execute(NewRequest("FragmentWrite", []interface{}{tableName, row}), &reply) {
+		return "1 the cluster does not answer"
+	}
+	return reply
+}
+
+// admitsRow tells whether a row in the layout of the schema satisfies the predicate.
+func admitsRow(predicate Predicate, row Row, schema TableSchema) bool {
+	for i, cs := range schema.ColumnSchemas {
+		if i < len(row) && !admitsKey(predicate, cs.Name, row[i], schema) {
+			return false
+		}
+	}
+	return true
+}
+
+// PartitionMap returns the metadata of the tables of this coordinator through which clients can route point
+// operations by themselves, see Client. The epoch of the placement tells whether the map is still current, see
+// RegisterRow.
+func (c *Cluster) PartitionMap(args interface{}, reply *CoordinatorMetadata) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	*reply = c.metadata(c.currentPlacement())
+}
+
+// RegisterRow records a row written to the nodes by a client directly, as FragmentWrite records the rows it writes:
+// its id (the last value of the row) and the locations it is written to, and its primary key, if any. The locations
+// the row could not be written to are forgotten by ReleaseRow.
+// The reply is "0 OK", "1 Duplicate Key", "1 Null Key", "1 Read Only Table" (or Cluster), or "1 Stale Partition Map"
+// if the placement has changed since the epoch the client routed the row by.
+// params: tableName string, row Row, locations []RowLocation, epoch int
+func (c *Cluster) RegisterRow(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tableName := params[0].(string)
+	row := params[1].(Row)
+	locations := params[2].([]RowLocation)
+	epoch := params[3].(int)
+	schema, ok := c.catalog.Schema(tableName)
+	if !ok {
+		if err := c.currentPlacement().renamedError(tableName); err != "" {
+			*reply = "1 " + err
+		} else {
+			*reply = "1 No Such Table"
+		}
+		return
+	}
+	if err := c.currentPlacement().readOnlyError(tableName); err != "" {
+		*reply = "1 " + err
+		return
+	}
+	if c.currentPlacement().Epoch != epoch {
+		*reply = "1 Stale Partition Map"
+		return
+	}
+	id := row[len(row)-1].(string)
+	if keyColumn, ok := c.catalog.Key(tableName); ok {
+		for i, cs := range schema.ColumnSchemas {
+			if cs.Name == keyColumn && i < len(row) && row[i] == nil {
+				*reply = "1 Null Key"
+				return
+			}
+			if cs.Name == keyColumn && i < len(row) && !c.rowIndex.SetKey(tableName, row[i], id) {
+				*reply = "1 Duplicate Key"
+				return
+			}
+		}
+	}
+	for _, location := range locations {
+		c.rowIndex.Add(tableName, id, location)
+		c.fragmentVersions[location.Fragment]++
+	}
+	c.catalog.AddIds(tableName, id)
+	*reply = "0 OK"
+}
+
+// ReleaseRow forgets locations of a row recorded by RegisterRow that the row could not be written to, and the row
+// itself if none of its locations is left.
+// params: tableName string, id string, locations []RowLocation
+func (c *Cluster) ReleaseRow(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tableName := params[0].(string)
+	id := params[1].(string)
+	for _, location := range params[2].([]RowLocation) {
+		c.rowIndex.RemoveLocation(tableName, id, location)
+		c.fragmentVersions[location.Fragment]++
+	}
+	if len(c.rowIndex.Locations(tableName, id)) == 0 {
+		c.rowIndex.Remove(tableName, id)
+		ids := c.catalog.Ids(tableName)
+		for i := range ids {
+			if ids[i] == id {
+				c.catalog.SetIds(tableName, append(ids[:i:i], ids[i+1:]...))
+				break
+			}
+		}
+	}
+	*reply = "0 OK"
+}
+
+// RPCLookupKey returns the rows of a fragment whose value of the column equals the key, together with the schema of
+// the fragment. A dataset with an empty table name is returned if the fragment does not exist on this node, its
+// predicate does not admit the key (anymore), e.g., the rows have been moved to another fragment, or its store has
+// failed. The columns of the masks, if any, are masked, see Cluster.MaskColumn.
+func (n *Node) RPCLookupKey(args LookupKeyArgs, dataset *Dataset) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fragment := args.Fragment
+	column := args.Column
+	key := args.Key
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		*dataset = Dataset{}
+		return
+	}
+	if t.predicate != nil {
+		for _, atom := range (*t.predicate)[column] {
+			if !atom.Check(key) {
+				*dataset = Dataset{}
+				return
+			}
+		}
+	}
+	position := -1
+	for i, cs := range t.schema.ColumnSchemas {
+		if cs.Name == column {
+			position = i
+		}
+	}
+	result := Dataset{Schema: *t.schema, Rows: make([]Row, 0)}
+	if position >= 0 {
+		iterator := n.rowIterator(t)
+		for iterator.HasNext() {
+			row := *iterator.Next()
+			if keyString(row[position]) == keyString(key) {
+				result.Rows = append(result.Rows, row)
+			}
+		}
+	}
+	if storeError(t) != nil {
+		*dataset = Dataset{}
+		return
+	}
+	result.Rows = maskRows(result.Schema, result.Rows, args.Masks)
+	*dataset = result
+}
+
+// RPCRemoveRows removes the rows with the given ids from a fragment, e.g., rows written by a client that the
+// coordinator refused to record.
+func (n *Node) RPCRemoveRows(args FragmentIdsArgs, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer n.logIfOk("RPCRemoveRows", args, reply)
+
+	fragment := args.Fragment
+	removed := make(map[string]bool)
+	for _, id := range args.Ids {
+		removed[id] = true
+	}
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		*reply = "1 no such table"
+		return
+	}
+	rows := make([]Row, 0)
+	iterator := n.rowIterator(t)
+	for iterator.HasNext() {
+		row := *iterator.Next()
+		if id, _ := row[0].(string); removed[id] {
+			rows = append(rows, row)
+		}
+	}
+	for i := range rows {
+		t.Remove(&rows[i])
+	}
+	if err := storeError(t); err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+	*reply = "0 OK"
+}
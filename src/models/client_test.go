@@ -0,0 +1,164 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// fragmentOf returns the fragment of a table whose predicate admits the key.
+func fragmentOf(tableName string, key interface{}) string {
+	placement := c.currentPlacement()
+	for _, fragment := range placement.Fragments(tableName) {
+		if admitsKey(placement.Rule(fragment).Predicate, "sid", key, *studentTableSchema) {
+			return fragment
+		}
+	}
+	return ""
+}
+
+// setupClientRouting builds the student table partitioned by ranges of sid, and a client routing by itself.
+func setupClientRouting() *Client {
+	setupLab3()
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("sid", "<=", 1, "sid", "name", "age", "grade"),
+		"2|3": rangeFragment("sid", ">", 1, "sid", "name", "age", "grade"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules, "sid"}, &reply)
+	return NewClient(network, "ClientB", c.Name)
+}
+
+func TestClientRouting(t *testing.T) {
+	client := setupClientRouting()
+	for _, row := range studentRows {
+		if reply := client.Insert(studentTableName, row); reply != "0 OK" {
+			t.Fatalf("cannot insert %v: %v", row, reply)
+		}
+	}
+
+	// the point lookups do not go through the coordinator
+	before := network.GetCount(c.Name)
+	for _, row := range studentRows {
+		result := client.Get(studentTableName, row[0])
+		if len(result.Rows) != 1 || !result.Rows[0].Equals(&row) {
+			t.Errorf("expected %v, actual %v", row, result)
+		}
+	}
+	if result := client.Get(studentTableName, 7); result.Schema.TableName != studentTableName ||
+		len(result.Rows) != 0 {
+		t.Errorf("a missing key should be reported with no rows, actual %v", result)
+	}
+	if after := network.GetCount(c.Name); after != before {
+		t.Errorf("the coordinator should not be asked, %v calls", after-before)
+	}
+
+	// the coordinator knows the rows written directly
+	result := Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 2}, &result)
+	if len(result.Rows) != 1 || !result.Rows[0].Equals(&studentRows[2]) {
+		t.Errorf("expected %v, actual %v", studentRows[2], result)
+	}
+	result = Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName}, &result)
+	if !compareDataset(Dataset{Schema: *studentTableSchema, Rows: studentRows}, result) {
+		t.Errorf("Incorrect scan results, actual %v", result)
+	}
+
+	// a duplicate key is rejected, and not left on the nodes
+	if reply := client.Insert(studentTableName, Row{2, "Hana", 22, 3.0}); reply != "1 Duplicate Key" {
+		t.Errorf("a duplicate key should be rejected, actual %v", reply)
+	}
+	fragment := fragmentOf(studentTableName, 2)
+	for _, nodeId := range c.currentPlacement().Replicas(fragment) {
+		count := 0
+		c.nodeEnd(nodeId).Call("Node.RPCCountRows", FragmentArgs{Fragment: fragment}, &count)
+		if count != 1 {
+			t.Errorf("%v of %v should hold 1 row, actual %v", fragment, nodeId, count)
+		}
+	}
+}
+
+// a row is written by a client into all fragments admitting it or none, which must hold all columns between them
+func TestClientInsertAllOrNone(t *testing.T) {
+	setupLab3()
+	enrolment := TableSchema{TableName: "enrolment", ColumnSchemas: []ColumnSchema{
+		{Name: "room", DataType: TypeString}, {Name: "courseId", DataType: TypeInt32},
+		{Name: "sid", DataType: TypeInt32}}}
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0": rangeFragment("sid", ">=", 0, "sid", "courseId"),
+		"1": rangeFragment("sid", ">", 5, "room"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{enrolment, rules}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot build the table: %v", reply)
+	}
+	client := NewClient(network, "ClientB", c.Name)
+	placement := c.currentPlacement()
+	first, second := placement.Fragments("enrolment")[0], placement.Fragments("enrolment")[1]
+	if placement.Rule(first).Column[0] == "room" {
+		first, second = second, first
+	}
+
+	// the second fragment cannot be written, so the columns written into the first one are removed
+	setDraining(placement.Replicas(second)[0], true)
+	reply = client.Insert("enrolment", Row{"B202", 3, 6})
+	if !strings.HasPrefix(reply, "1 cannot write into "+second) {
+		t.Errorf("expected %v not to be written, actual %v", second, reply)
+	}
+	if size := fragmentSize(placement.Replicas(first)[0], first); size != 0 {
+		t.Errorf("expected no part of the row to be left, actual %v rows", size)
+	}
+	if rows := scanRows("enrolment"); len(rows) != 0 {
+		t.Errorf("expected the coordinator to forget the row, actual %v", rows)
+	}
+	setDraining(placement.Replicas(second)[0], false)
+	if reply := client.Insert("enrolment", Row{"B202", 3, 6}); reply != "0 OK" {
+		t.Errorf("expected the row to be written once the node is back, actual %v", reply)
+	}
+
+	// no fragment holds the room of the small sids
+	if reply := client.Insert("enrolment", Row{"A101", 1, 2}); reply != "1 Not Insert" {
+		t.Errorf("expected a row missing columns to be rejected, actual %v", reply)
+	}
+	if rows := scanRows("enrolment"); len(rows) != 1 || rows[0][0] != "B202" {
+		t.Errorf("expected only the row written, actual %v", rows)
+	}
+}
+
+// the clients notice that their partition maps are stale after a fragment is split
+func TestClientRoutingStaleMap(t *testing.T) {
+	client := setupClientRouting()
+	for _, row := range studentRows {
+		client.Insert(studentTableName, row)
+	}
+	stale := NewClient(network, "ClientC", c.Name)
+	stale.Refresh()
+
+	reply := ""
+	cli.Call("Cluster.SplitFragment", []interface{}{fragmentOf(studentTableName, 2), "sid", 2}, &reply)
+	if reply[0] != '0' {
+		t.Fatalf("cannot split: %v", reply)
+	}
+	newRow := Row{3, "Alice", 20, 3.9}
+	if reply := stale.Insert(studentTableName, newRow); reply != "0 OK" {
+		t.Fatalf("cannot insert through a stale partition map: %v", reply)
+	}
+	if result := client.Get(studentTableName, 3); len(result.Rows) != 1 || !result.Rows[0].Equals(&newRow) {
+		t.Errorf("expected %v, actual %v", newRow, result)
+	}
+
+	stale = NewClient(network, "ClientD", c.Name)
+	stale.Refresh()
+	cli.Call("Cluster.SplitFragment", []interface{}{fragmentOf(studentTableName, 3), "sid", 3}, &reply)
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{4, "Bob", 24, 2.8}}, &reply)
+	if result := stale.Get(studentTableName, 4); len(result.Rows) != 1 || result.Rows[0][1] != "Bob" {
+		t.Errorf("the row should be found with a stale partition map, actual %v", result)
+	}
+	for _, row := range studentRows {
+		if result := stale.Get(studentTableName, row[0]); len(result.Rows) != 1 || !result.Rows[0].Equals(&row) {
+			t.Errorf("expected %v, actual %v", row, result)
+		}
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"../labgob"
 	"../labrpc"
-	"github.com/google/uuid"
 )
 
 // Cluster consists of a group of nodes to manage distributed tables defined in models/table.go.
@@ -20,10 +22,52 @@ import (
 type Cluster struct {
 	// the identifiers of each node, we use simple numbers like "1,2,3" to register the nodes in the network
 	// needless to say, each identifier should be unique
-	nodeIds      []string
-	tableName2id map[string][]string
-	// how many rules does this table have (How many copies of this table can a node have at most)
-	tableName2num map[string]int
+	nodeIds []string
+	// the tables, with the ids of their rows, see Catalog
+	catalog *Catalog
+	// fragment name ("tableName|i") -> how many writes have been applied to the fragment, used to validate rowCache
+	fragmentVersions map[string]int
+	// fully reassembled rows of vertically fragmented tables
+	rowCache *RowCache
+	// which nodes hold a replica of each fragment, see Placement
+	placement *placementState
+	// serializes writes and changes of placement
+	writeMu sync.Mutex
+	// serializes the operations migrating rows between fragments or nodes, which may release writeMu while rows are
+	// copied, it is always acquired before writeMu
+	migrationMu sync.Mutex
+	// row id -> the nodes and fragments holding the row
+	rowIndex *RowIndex
+	// the disk of each node, which survives restarts of the node, see RestartNode
+	persisters map[string]*Persister
+	// the running instance of each node, only used to simulate crashes, see RestartNode
+	nodes map[string]*Node
+	// the simulated constraints set on each node, which are set again when the node restarts
+	nodeResources map[string]NodeResources
+	// node id -> the rate limit of the calls to the node and its last load, see SetNodeRateLimit, guarded by
+	// limiterMu as the queries call the nodes without holding writeMu
+	limiters map[string]*nodeLimiter
+	// the codec of the calls to the nodes, see SetCodec, guarded by limiterMu as well
+	codec     labrpc.Codec
+	limiterMu sync.Mutex
+	// the locality tags of each node the placement constraints refer to, see SetNodeLabels
+	nodeLabels map[string]NodeLabels
+	// admits queries by their priorities
+	scheduler *queryScheduler
+	// the lifecycle events of the cluster, see Subscribe
+	events *eventBus
+	// the replies of the requests executed lately, see Execute
+	requests *requestCache
+	// how often the nodes gossip, zero if they do not, see StartGossip
+	gossipInterval time.Duration
+	// which node the metadata is published to next
+	publishTurn int
+	// how often the nodes verify the rule predicates of their fragments, zero if they do not, see StartVerification
+	verifyInterval time.Duration
+	// closed to stop migrating the misplaced rows, nil if the coordinator does not migrate them
+	stopMigration chan struct{}
+	// the directory of the files of the disk-backed tables of the nodes, see SetDataDir
+	dataDir string
 	// the network that the cluster works on. It is not actually using the network interface, but a network simulator
 	// using SEDA (google it if you have not heard about it), which allows us (and you) to inject some network failures
 	// during tests. Do remember that network failures should always be concerned in a distributed environment.
@@ -48,14 +92,42 @@ func NewCluster(nodeNum int, network *labrpc.Network, clusterName string) *Clust
 	labgob.Register(Row{})
 	labgob.Register(Predicate{})
 	labgob.Register(json.Number(""))
-	tableName2id := make(map[string][]string)
-	tableName2num := make(map[string]int)
+	labgob.Register([]interface{}{})
+	labgob.Register(Dataset{})
+	labgob.Register(QueryHints{})
+	labgob.Register(Workload{})
+	labgob.Register(TableStorage{})
+	labgob.Register(NodeResources{})
+	labgob.Register(NodeLabels{})
+	labgob.Register([]RowLocation{})
+	labgob.Register(ColumnMask{})
+	labgob.Register(map[string]ColumnMask{})
+	labgob.Register(time.Duration(0))
+	labgob.Register(map[string]interface{}{})
+	labgob.Register(RateLimit{})
+	labgob.Register(QueryPlan{})
+	// the arguments of the RPCs changing the tables of the nodes are logged by the nodes, see walRecord
+	labgob.Register(CreateTableArgs{})
+	labgob.Register(InsertArgs{})
+	labgob.Register(AppendRowsArgs{})
+	labgob.Register(SetPredicateArgs{})
+	labgob.Register(FragmentArgs{})
+	labgob.Register(FragmentIdsArgs{})
+	labgob.Register(RenameTableArgs{})
+	labgob.Register(TombstoneRowsArgs{})
+	labgob.Register(PurgeTombstonesArgs{})
 	nodeIds := make([]string, nodeNum)
+	persisters := make(map[string]*Persister)
+	nodes := make(map[string]*Node)
 	nodeNamePrefix := "Node"
 	for i := 0; i < nodeNum; i++ {
 		// identify the nodes with "Node0", "Node1", ...
 		node := NewNode(nodeNamePrefix + strconv.Itoa(i))
 		nodeIds[i] = node.Identifier
+		node.persister = NewPersister()
+		node.gossip.network = network
+		nodes[node.Identifier] = node
+		persisters[node.Identifier] = node.persister
 		// use go reflection to extract the methods in a Node object and make them as a service.
 		// a service can be viewed as a list of methods that a server provides.
 		// due to the limitation of the framework, the extracted method must only have two parameters, and the first one
@@ -70,16 +142,60 @@ func NewCluster(nodeNum int, network *labrpc.Network, clusterName string) *Clust
 		network.AddServer(nodeIds[i], server)
 	}
 
+	return newCoordinator(nodeIds, persisters, nodes, network, clusterName)
+}
+
+// newCoordinator creates a coordinator of the given nodes, named coordinatorName in the network. More than one
+// coordinator may share the nodes as long as each of them owns different tables, see NewShardedCluster.
+func newCoordinator(nodeIds []string, persisters map[string]*Persister, nodes map[string]*Node,
+	network *labrpc.Network, coordinatorName string) *Cluster {
+	c := newCoordinatorState(nodeIds, persisters, nodes, network, coordinatorName)
+	network.AddServer(coordinatorName, c.server())
+	return c
+}
+
+// newCoordinatorState creates a coordinator of the given nodes as newCoordinator does, without serving it in the
+// network yet, see NewStandby.
+func newCoordinatorState(nodeIds []string, persisters map[string]*Persister, nodes map[string]*Node,
+	network *labrpc.Network, coordinatorName string) *Cluster {
 	// create a cluster with the nodes and the network
-	c := &Cluster{nodeIds: nodeIds, network: network, Name: clusterName, tableName2id: tableName2id, tableName2num: tableName2num}
-	// create a coordinator for the cluster to receive external requests, the steps are similar to those above.
-	// notice that we use the reference of the cluster as the name of the coordinator server,
-	// and the names can be more than strings.
+	return &Cluster{nodeIds: append([]string(nil), nodeIds...), network: network, Name: coordinatorName,
+		catalog: NewCatalog(), fragmentVersions: make(map[string]int),
+		rowCache: NewRowCache(defaultRowCacheCapacity), placement: newPlacementState(), rowIndex: NewRowIndex(),
+		persisters: persisters, nodes: nodes, nodeResources: make(map[string]NodeResources),
+		limiters: make(map[string]*nodeLimiter), codec: labrpc.GobCodec, nodeLabels: make(map[string]NodeLabels),
+		scheduler: newQueryScheduler(), events: newEventBus(), requests: newRequestCache()}
+}
+
+// Close stops the goroutines of the cluster and of its nodes and releases the stores of the nodes, e.g., removes the
+// files of their disk-backed tables, once the cluster is no longer used. The nodes shared with other coordinators, see
+// NewShardedCluster, are closed as well.
+func (c *Cluster) Close() {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.stopMigration != nil {
+		close(c.stopMigration)
+		c.stopMigration = nil
+	}
+	for _, nodeId := range c.nodeIds {
+		node := c.nodes[nodeId]
+		node.stopGossip()
+		node.stopVerification()
+		node.Close()
+	}
+}
+
+// server creates the server receiving the external requests of the coordinator.
+func (c *Cluster) server() *labrpc.Server {
+	// the steps are similar to those of the nodes above. notice that we use the reference of the cluster as the name
+	// of the coordinator server, and the names can be more than strings.
 	clusterService := labrpc.MakeService(c)
 	server := labrpc.MakeServer()
 	server.AddService(clusterService)
-	network.AddServer(clusterName, server)
-	return c
+	return server
 }
 
 // SayHello is an example to show how the coordinator communicates with other nodes in the cluster.
@@ -111,8 +227,46 @@ func (c *Cluster) SayHello(visitor string, reply *string) {
 }
 
 // Join all tables in the given list using NATURAL JOIN (join on the common columns), and return the joined result
-// as a list of rows and set it to reply.
+// as a list of rows and set it to reply. Three or more tables are joined in the order estimated to keep the
+// intermediate results small, see chooseJoinOrder.
+// The columns of the result are those of the first table in the order of its schema, followed by the columns of each
+// next table in the order of its schema but for the common columns, whichever way the join is executed. The hints may
+// reorder them, see QueryHints.Columns.
+// The rows of the fragments none of whose replicas answers are left out, the fragments being listed in the Unavailable
+// of the result, unless the hints require complete results, see QueryHints.Strictness.
 func (c *Cluster) Join(tableNames []string, reply *Dataset) {
+	c.join(tableNames, QueryHints{}, reply)
+}
+
+// JoinWithHints is Join executed in the way the hints ask for, see QueryHints.
+// params: tableNames []string, hints QueryHints
+func (c *Cluster) JoinWithHints(params []interface{}, reply *Dataset) {
+	c.join(params[0].([]string), params[1].(QueryHints), reply)
+}
+
+func (c *Cluster) join(tableNames []string, hints QueryHints, reply *Dataset) {
+	q := c.beginQuery(hints)
+	defer c.endQuery(q)
+	defer c.publishFailedQuery("Join", reply, tableNames...)
+	defer reorderColumns(reply, hints.Columns)
+	defer c.failRenamed(reply, tableNames...)
+	defer q.reportUnavailable(reply)
+
+	for _, tableName := range tableNames {
+		if _, err := q.wherePredicate(tableName); err != "" {
+			*reply = Dataset{Error: err}
+			return
+		}
+		if err := q.asOfError(tableName); err != "" {
+			*reply = Dataset{Error: err}
+			return
+		}
+	}
+	if q.hints.WithProvenance {
+		*reply = c.joinWithProvenance(q, tableNames)
+		reply.Columns = q.catalog.joinedColumns(tableNames)
+		return
+	}
 
 	// 开始根据节点连接数据
 	result_rows := make([]Row, 0)
@@ -121,88 +275,76 @@ func (c *Cluster) Join(tableNames []string, reply *Dataset) {
 	same_columns2 := make([]int, 0)
 	table1_columns := make([]ColumnSchema, 0)
 	table2_columns := make([]ColumnSchema, 0)
-	if len(tableNames) >= 2 {
+	if len(tableNames) >= 3 {
+		newColumns, result_rows = c.joinMany(q, tableNames)
+	} else if len(tableNames) == 2 {
 
 		// 获取完整的表头
+		// the logical schemas, so that the order of the columns does not depend on the nodes or the fragments
 		tableName1 := tableNames[0]
 		tableName2 := tableNames[1]
-		table1_ids := c.tableName2id[tableName1]
-		table2_ids := c.tableName2id[tableName2]
-		endNamePrefix := "InternalClient"
-		for _, nodeId := range c.nodeIds {
-			endName := endNamePrefix + nodeId
-			end := c.network.MakeEnd(endName)
-			c.network.Connect(endName, nodeId)
-			c.network.Enable(endName, true)
-			if len(table1_columns) != 0 && len(table2_columns) != 0 {
-				break
-			}
-			if len(table1_columns) == 0 {
-				for i := 0; i < c.tableName2num[tableName1]; i++ {
-					end.Call("Node.GetFullSchema", tableName1+"|"+strconv.Itoa(i), &table1_columns)
-				}
-			}
-			if len(table2_columns) == 0 {
-				for i := 0; i < c.tableName2num[tableName2]; i++ {
-					end.Call("Node.GetFullSchema", tableName2+"|"+strconv.Itoa(i), &table2_columns)
-				}
-			}
-		}
+		schema1, _ := q.catalog.Schema(tableName1)
+		schema2, _ := q.catalog.Schema(tableName2)
+		table1_columns = append(table1_columns, schema1.ColumnSchemas...)
+		table2_columns = append(table2_columns, schema2.ColumnSchemas...)
 
 		createJoinSchema([]interface{}{table1_columns, table2_columns}, &newColumns, &same_columns1, &same_columns2)
 
 		if len(same_columns1) != 0 {
-			need_join := true
-			for _, id1 := range table1_ids {
-				lineOfTable1 := getLineByid(c, tableName1, id1, table1_columns)
-				if lineOfTable1.Schema.TableName == "" {
-					continue
-				}
-				for _, id2 := range table2_ids {
-					lineOfTable2 := getLineByid(c, tableName2, id2, table2_columns)
-					if lineOfTable2.Schema.TableName == "" {
-						continue
-					}
-					subRow1 := lineOfTable1.Rows[0]
-					subRow2 := lineOfTable2.Rows[0]
-					join_data := true
-					for i := 0; i < len(same_columns1); i++ {
-						if subRow1[same_columns1[i]] != subRow2[same_columns2[i]] {
-							join_data = false
-							break
-						}
-					}
-					if join_data == false {
-						continue
-					}
-					ind := 0
-					for i, val := range subRow2 {
-						if i >= len(same_columns2) {
-							subRow1 = append(subRow1, subRow2[i:]...)
-							break
-						} else {
-							if i != same_columns2[ind] {
-								subRow1 = append(subRow1, val)
-							} else {
-								ind++
-							}
-						}
-					}
-					result_rows = append(result_rows, subRow1)
-				}
-				if need_join == false {
-					break
-				}
-			}
+			result_rows = c.executeJoin(q, tableName1, tableName2, table1_columns, table2_columns, same_columns1,
+				same_columns2)
 		}
 	}
 
 	result := Dataset{}
 	result.Schema = TableSchema{TableName: "", ColumnSchemas: newColumns}
 	result.Rows = result_rows
+	if columns := q.catalog.joinedColumns(tableNames); len(columns) == len(newColumns) {
+		result.Columns = columns
+	}
 	*reply = result
 }
 
+// matchRows returns the index pairs (i, j) such that rows1[i] and rows2[j] agree on the common columns.
+func matchRows(rows1 []Row, rows2 []Row, same_columns1 []int, same_columns2 []int) [][2]int {
+	pairs := make([][2]int, 0)
+	for i, subRow1 := range rows1 {
+		for j, subRow2 := range rows2 {
+			join_data := true
+			for k := 0; k < len(same_columns1); k++ {
+				if subRow1[same_columns1[k]] != subRow2[same_columns2[k]] {
+					join_data = false
+					break
+				}
+			}
+			if join_data {
+				pairs = append(pairs, [2]int{i, j})
+			}
+		}
+	}
+	return pairs
+}
+
+// mergeRows appends the columns of row2 that are not common columns to a copy of row1, following the schema built by
+// createJoinSchema.
+func mergeRows(row1 Row, subRow2 Row, same_columns2 []int) Row {
+	subRow1 := copyRow(row1)
+	ind := 0
+	for i, val := range subRow2 {
+		if i >= len(same_columns2) {
+			subRow1 = append(subRow1, subRow2[i:]...)
+			break
+		} else {
+			if i != same_columns2[ind] {
+				subRow1 = append(subRow1, val)
+			} else {
+				ind++
+			}
+		}
+	}
+	return subRow1
+}
+
 func createJoinSchema(args []interface{}, newColumns *[]ColumnSchema, same_columns1 *[]int, same_columns2 *[]int) {
 	table_schemas1 := args[0].([]ColumnSchema)
 	table_schemas2 := args[1].([]ColumnSchema)
@@ -237,116 +379,347 @@ func createJoinSchema(args []interface{}, newColumns *[]ColumnSchema, same_colum
 	*same_columns2 = sameColumns2
 }
 
-func getLineByid(c *Cluster, tableName string, id string, fullSchema []ColumnSchema) Dataset {
-	endNamePrefix := "InternalClient"
-
-	resultColumns := make([]ColumnSchema, 0)
-	var resultRow Row
-	Rows := make([]Row, 1)
-	ret_tablename := ""
-	for _, nodeId := range c.nodeIds {
-		endName := endNamePrefix + nodeId
-		end := c.network.MakeEnd(endName)
-		c.network.Connect(endName, nodeId)
-		c.network.Enable(endName, true)
+func getLineByid(c *Cluster, q *queryContext, tableName string, id string, fullSchema []ColumnSchema) Dataset {
+	versions := c.fragmentVersionKey(q.placement, tableName)
+	if q.useCache() {
+		if row, ok := c.rowCache.Get(tableName, id, versions); ok {
+			return Dataset{Schema: TableSchema{TableName: tableName, ColumnSchemas: fullSchema}, Rows: []Row{row}}
+		}
+	}
 
-		line := Dataset{}
-		find := false
-		for i := 0; i < c.tableName2num[tableName]; i++ {
-			end.Call("Node.ScanLineData", []interface{}{tableName+"|"+strconv.Itoa(i), id}, &line)
-			if line.Schema.TableName != "" && len(line.Rows) > 0 && len(line.Rows[0]) > 0 {
-				find = true
-				break
+	// only the nodes holding fragments of the row are contacted, and each fragment is read from one of its replicas
+	values := make(map[string]interface{})
+	for _, fragment := range c.rowIndex.Fragments(tableName, id) {
+		for _, nodeId := range c.readOrder(q.placement.Replicas(fragment)) {
+			line := Dataset{}
+			args := ScanLineDataArgs{Fragment: fragment, Id: id, Masks: q.columnMasks(tableName)}
+			ok := c.nodeEnd(nodeId).Call("Node.ScanLineData", args, &line)
+			if !ok || line.Schema.TableName == "" || len(line.Rows) == 0 || len(line.Rows[0]) == 0 {
+				continue
 			}
+			for j, cs := range line.Schema.ColumnSchemas[1:] {
+				values[cs.Name] = line.Rows[0][j+1]
+			}
+			break
 		}
-		if !find {
-			continue
+	}
+
+	row := make(Row, 0, len(fullSchema))
+	for _, cs := range fullSchema {
+		if val, exist := values[cs.Name]; exist {
+			row = append(row, val)
+		}
+	}
+	resultSet := Dataset{}
+	if len(values) > 0 {
+		resultSet.Schema = TableSchema{TableName: tableName, ColumnSchemas: fullSchema}
+		resultSet.Rows = []Row{row}
+		if len(row) == len(fullSchema) && q.useCache() {
+			c.rowCache.Put(tableName, id, versions, row)
+		}
+	}
+
+	return resultSet
+}
+
+// scanBatchSize is how many rows are fetched from a fragment in one RPCScanFragment call.
+const scanBatchSize = 256
+
+// getTableRows reassembles all rows of a table from whole-fragment batches and returns them in the order they were
+// written, each row following fullSchema. Rows that cannot be fully reassembled (e.g., a vertical fragment is
+// unreachable) are skipped. If every row of the table is cached under the current fragment versions, no RPC is sent.
+// Only the rows satisfying the Where hint of the query are returned, the fragments it prunes not being read.
+func getTableRows(c *Cluster, q *queryContext, tableName string, fullSchema []ColumnSchema) []Row {
+	rows, _ := tableRows(c, q, tableName, fullSchema)
+	return rows
+}
+
+// tableRows is getTableRows also returning the provenance of each row if the query asks for it (see
+// QueryHints.WithProvenance), nil otherwise.
+func tableRows(c *Cluster, q *queryContext, tableName string, fullSchema []ColumnSchema) ([]Row, [][]RowLocation) {
+	ids := q.catalog.Ids(tableName)
+	versions := c.fragmentVersionKey(q.placement, tableName)
+	rows := make([]Row, 0, len(ids))
+	for _, id := range ids {
+		if !q.useCache() {
+			break
+		}
+		row, ok := c.rowCache.Get(tableName, id, versions)
+		if !ok {
+			break
 		}
+		rows = append(rows, row)
+	}
+	if len(rows) == len(ids) {
+		return q.filterRows(tableName, fullSchema, rows, nil)
+	}
 
-		ret_tablename = tableName
-		resultColumns = append(resultColumns, line.Schema.ColumnSchemas[1:]...)
-		resultRow = append(resultRow, line.Rows[0][1:]...)
+	// row id -> column name -> value
+	values := make(map[string]map[string]interface{})
+	// row id -> the replicas the row is read from, only if the query asks for the provenance of the rows
+	var sources map[string][]RowLocation
+	var provenance [][]RowLocation
+	if q.hints.WithProvenance {
+		sources = make(map[string][]RowLocation)
+		provenance = make([][]RowLocation, 0, len(ids))
+	}
+	for _, fragment := range q.placement.Fragments(tableName) {
+		if q.prunes(tableName, fragment) {
+			continue
+		}
+		// each fragment is read from the first replica that answers all batches
+		read := false
+		for _, nodeId := range c.readOrder(q.placement.Replicas(fragment)) {
+			into := values
+			if sources != nil {
+				into = make(map[string]map[string]interface{})
+			}
+			if !c.readFragmentAt(q, nodeId, fragment, q.columnMasks(tableName), into) {
+				continue
+			}
+			read = true
+			if sources != nil {
+				for id, columns := range into {
+					sources[id] = append(sources[id], RowLocation{NodeId: nodeId, Fragment: fragment})
+					if _, ok := values[id]; !ok {
+						values[id] = make(map[string]interface{})
+					}
+					for name, val := range columns {
+						values[id][name] = val
+					}
+				}
+			}
+			break
+		}
+		if !read {
+			q.markUnavailable(fragment)
+		}
 	}
 
-	for _, col1 := range fullSchema {
-		for j, col2 := range resultColumns {
-			if col1 == col2 {
-				Rows[0] = append(Rows[0], resultRow[j])
-				break
+	if q.hints.AsOf != 0 {
+		ids = historicIds(ids, values)
+	}
+	rows = make([]Row, 0, len(ids))
+	for _, id := range ids {
+		columns, ok := values[id]
+		if !ok {
+			continue
+		}
+		row := make(Row, 0, len(fullSchema))
+		for _, cs := range fullSchema {
+			if val, exist := columns[cs.Name]; exist {
+				row = append(row, val)
 			}
 		}
+		if len(row) != len(fullSchema) {
+			continue
+		}
+		if q.useCache() {
+			c.rowCache.Put(tableName, id, versions, row)
+		}
+		rows = append(rows, row)
+		if provenance != nil {
+			provenance = append(provenance, sources[id])
+		}
 	}
-	resultSet := Dataset{}
-	if len(Rows) > 0 {
-		resultSet.Schema = TableSchema{TableName: ret_tablename, ColumnSchemas: fullSchema}
-		resultSet.Rows = Rows
+	return q.filterRows(tableName, fullSchema, rows, provenance)
+}
+
+// scanFragment reads a whole fragment through end with the masks, see readFragment, and merges its columns into values
+// (row id -> column name -> value). It returns false if the fragment could not be read completely.
+func scanFragment(end *nodeClient, fragment string, masks map[string]ColumnMask,
+	values map[string]map[string]interface{}) bool {
+	rows, ok := readFragment(end, fragment, masks)
+	if !ok {
+		return false
 	}
+	mergeColumns(rows, values)
+	return true
+}
 
-	return resultSet
+// mergeColumns merges the columns of the rows of a fragment, with their id column first, into values.
+func mergeColumns(rows Dataset, values map[string]map[string]interface{}) {
+	for _, row := range rows.Rows {
+		id := row[0].(string)
+		if _, exist := values[id]; !exist {
+			values[id] = make(map[string]interface{})
+		}
+		for j, cs := range rows.Schema.ColumnSchemas[1:] {
+			values[id][cs.Name] = row[j+1]
+		}
+	}
+}
+
+// nodeEnd returns a client end connected to the given node, keeping to its rate limit if any.
+func (c *Cluster) nodeEnd(nodeId string) *nodeClient {
+	endName := "InternalClient" + nodeId
+	end := c.network.MakeEnd(endName)
+	c.network.Connect(endName, nodeId)
+	c.network.Enable(endName, true)
+	c.limiterMu.Lock()
+	defer c.limiterMu.Unlock()
+	return &nodeClient{end: end, limiter: c.limiters[nodeId], codec: c.codec}
+}
+
+// fragmentVersionKey summarizes the versions of all fragments of a table, a cached row is only valid while the
+// summary stays the same.
+func (c *Cluster) fragmentVersionKey(placement *Placement, tableName string) string {
+	fragments := placement.Fragments(tableName)
+	versions := make([]string, len(fragments))
+	for i, fragment := range fragments {
+		versions[i] = fragment + ":" + strconv.Itoa(c.fragmentVersions[fragment])
+	}
+	return strings.Join(versions, ",")
 }
 
+// BuildTable creates a table with the given schema and fragmentation rules. The fragments are stored in memory, unless
+// the storage asks for them to be kept on disk, see TableStorage.
+// Building an existing table rebuilds it empty, unless ifNotExists is set, in which case the table is left as it is
+// and the reply is "0 Exists", so that a setup script or a retried request can build its tables again, or "1 Exists
+// With Different Schema" if the existing table does not have the same columns in the same order and the same primary
+// key, so that a changed setup does not pass silently. The definition of the existing table can be read by
+// DescribeTable.
+// The rules may carry placement constraints on the labels of their nodes, see PlacementConstraint; if one of them is
+// violated, the reply is "1 Placement Constraint Violated: <reason>" and nothing is built. A rule may instead ask for a
+// number of replicas, which BuildTable places on the least loaded of the nodes of its key, or of all nodes if the key
+// starts with "*", and keep the fragments of an anti-affinity group apart, see Rule; the nodes chosen are recorded in
+// the placement, where the reads and the writes find them, and shown by DescribeTable.
+// params: schema TableSchema, rules []byte, (optional) primary key column string ("" for none), (optional) storage
+// TableStorage, (optional) ifNotExists bool
 func (c *Cluster) BuildTable(params []interface{}, reply *string) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
 	schema := params[0].(TableSchema)
-	schema.ColumnSchemas = append(schema.ColumnSchemas, ColumnSchema{Name: "id", DataType: TypeString})
+	if existing, exists := c.catalog.Schema(schema.TableName); exists && len(params) > 4 && params[4].(bool) {
+		key := ""
+		if len(params) > 2 {
+			key = params[2].(string)
+		}
+		existingKey, _ := c.catalog.Key(schema.TableName)
+		if !reflect.DeepEqual(existing.ColumnSchemas, schema.ColumnSchemas) || existingKey != key {
+			*reply = "1 Exists With Different Schema"
+			return
+		}
+		*reply = "0 Exists"
+		return
+	}
+	if err := c.currentPlacement().readOnlyError(schema.TableName); err != "" {
+		*reply = "1 " + err
+		return
+	}
 	rules := make(map[string]Rule)
-	c.tableName2id[schema.TableName] = make([]string, 0)
-
 	decoder := json.NewDecoder(bytes.NewReader(params[1].([]byte)))
 	decoder.UseNumber()
 	decoder.Decode(&rules)
-	c.tableName2num[schema.TableName] = len(rules)
+	keys, nodes, err := c.placeRules(schema.TableName, rules)
+	if err != "" {
+		*reply = "1 " + err
+		return
+	}
+	// the fragments of a table rebuilt are numbered after the old ones, which are kept until the new ones are built
+	base := c.catalog.Num(schema.TableName)
+	// the table is added to the catalog together with its fragments, so that the queries do not see it until then
+	table := CatalogTable{Schema: TableSchema{TableName: schema.TableName,
+		ColumnSchemas: append([]ColumnSchema(nil), schema.ColumnSchemas...)}, Ids: make([]string, 0),
+		Num: base + len(rules)}
+	if len(params) > 2 {
+		table.Key = params[2].(string)
+	}
+	storage := TableStorage{}
+	if len(params) > 3 {
+		storage = params[3].(TableStorage)
+	}
+	table.Storage = storage
+	schema.ColumnSchemas = append(schema.ColumnSchemas, ColumnSchema{Name: "id", DataType: TypeString})
 
-	nodeNamePrefix := "Node"
-	endNamePrefix := "InternalClient"
-	i := 0
-	for key, value := range rules {
-		ts := &TableSchema{TableName: schema.TableName + "|" + strconv.Itoa(i), ColumnSchemas: make([]ColumnSchema, 0)}
-		i++
-		ts.ColumnSchemas = append(ts.ColumnSchemas, ColumnSchema{Name: "id", DataType: TypeString})
-		for _, columnName := range value.Column {
-			for _, cs := range schema.ColumnSchemas {
-				if cs.Name == columnName {
-					ts.ColumnSchemas = append(ts.ColumnSchemas, cs)
-					break
+	old := c.currentPlacement()
+	placement := old.clone()
+	oldFragments := placement.Fragments(schema.TableName)
+	// the old name of a renamed table names this table from now on
+	delete(placement.Renamed, schema.TableName)
+	placement.removeTable(schema.TableName)
+
+	for i, key := range keys {
+		value := rules[key]
+		ts := fragmentSchema(schema.TableName+"|"+strconv.Itoa(base+i), value, schema)
+		placement.FragmentRules[ts.TableName] = value
+
+		for _, nodeName := range nodes[key] {
+			msg := ""
+			c.nodeEnd(nodeName).Call("Node.RPCCreateTable", CreateTableArgs{Schema: *ts, Predicate: value.Predicate,
+				FullSchema: schema, Storage: storage}, &msg)
+			if !strings.HasPrefix(msg, "0") {
+				// the table is not installed, the replicas created so far are dropped as none of them will be used
+				for fragment, nodeIds := range placement.FragmentNodes {
+					if fragmentTable(fragment) != schema.TableName {
+						continue
+					}
+					for _, nodeId := range nodeIds {
+						dropped := ""
+						c.nodeEnd(nodeId).Call("Node.RPCDropTable", FragmentArgs{Fragment: fragment}, &dropped)
+					}
+				}
+				if msg == "" {
+					msg = "1 cannot create " + ts.TableName + " on " + nodeName
 				}
+				*reply = msg
+				return
 			}
+			placement.FragmentNodes[ts.TableName] = append(placement.FragmentNodes[ts.TableName], nodeName)
+		}
+	}
+
+	c.rowCache.Invalidate(schema.TableName)
+	c.rowIndex.DropTable(schema.TableName)
+	for _, fragment := range oldFragments {
+		delete(c.fragmentVersions, fragment)
+	}
+	c.installCatalog(placement, func(cat *Catalog) { cat.CreateTable(table) })
+	for _, fragment := range oldFragments {
+		for _, nodeId := range old.Replicas(fragment) {
+			dropped := ""
+			c.nodeEnd(nodeId).Call("Node.RPCDropTable", FragmentArgs{Fragment: fragment}, &dropped)
 		}
+	}
+	*reply = "0 OK"
+	c.publish(Event{Type: EventTableCreated, Tables: []string{schema.TableName}})
+}
 
-		nodeIds := strings.Split(key, "|")
-		for _, nodeId := range nodeIds {
-			nodeName := nodeNamePrefix + nodeId
-			endName := endNamePrefix + nodeName
-			end := c.network.MakeEnd(endName)
-			c.network.Connect(endName, nodeName)
-			c.network.Enable(endName, true)
-			end.Call("Node.RPCCreateTable", []interface{}{ts, value.Predicate, schema}, reply)
-			if (*reply)[0] != '0' {
-				return
+// fragmentSchema builds the schema of a fragment defined by the rule, the id column followed by the columns of the rule
+// in the order of the rule.
+func fragmentSchema(fragment string, rule Rule, fullSchema TableSchema) *TableSchema {
+	ts := &TableSchema{TableName: fragment, ColumnSchemas: make([]ColumnSchema, 0)}
+	ts.ColumnSchemas = append(ts.ColumnSchemas, ColumnSchema{Name: "id", DataType: TypeString})
+	for _, columnName := range rule.Column {
+		for _, cs := range fullSchema.ColumnSchemas {
+			if cs.Name == columnName {
+				ts.ColumnSchemas = append(ts.ColumnSchemas, cs)
+				break
 			}
 		}
 	}
+	return ts
 }
 
+// fullSchema returns the schema of a table as stored in the fragments, with the id column at the end.
+func (c *Cluster) fullSchema(tableName string) TableSchema {
+	schema, _ := c.catalog.Schema(tableName)
+	return TableSchema{TableName: tableName,
+		ColumnSchemas: append(append([]ColumnSchema(nil), schema.ColumnSchemas...),
+			ColumnSchema{Name: "id", DataType: TypeString})}
+}
+
+// FragmentWrite writes a row in the layout of the schema of a table into the fragments admitting it, all of them or
+// none, see writeRow.
+// params: tableName string, row Row
 func (c *Cluster) FragmentWrite(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
 	tableName := params[0].(string)
 	row := params[1].(Row)
-	uuid := uuid.New().String()
-	c.tableName2id[tableName] = append(c.tableName2id[tableName], uuid)
-	row = append(row, uuid)
-	*reply = "1 Not Insert"
-
-	endNamePrefix := "InternalClient"
-	for _, nodeId := range c.nodeIds {
-		endName := endNamePrefix + nodeId
-		end := c.network.MakeEnd(endName)
-		c.network.Connect(endName, nodeId)
-		c.network.Enable(endName, true)
-		replyMsg := ""
-		for i := 0; i < c.tableName2num[tableName]; i++ {
-			end.Call("Node.RPCInsert", []interface{}{tableName + "|" + strconv.Itoa(i), row}, &replyMsg)
-			if replyMsg[0] == '0' {
-				*reply = "0 OK"
-			}
-		}
-	}
+	*reply = c.writeRow(tableName, row)
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"../labrpc"
+)
+
+// SetCodec selects the codec encoding the calls of the coordinator to the nodes and their replies, see labrpc.Codec:
+// "gob", the default, which only encodes the types registered in NewCluster, "json", readable when debugging what is
+// sent, or "binary", compact for large datasets. The calls in flight finish with the codec they started with. The
+// calls of the clients to the coordinator are encoded with the codec the clients choose, see
+// labrpc.ClientEnd.CallCodec.
+// The RPCs of the nodes take typed arguments, see rpc_args.go, which the codecs encode with their types; those of
+// the coordinator keep the lists []interface{} of their params.
+// params: codec string
+func (c *Cluster) SetCodec(name string, reply *string) {
+	codec := labrpc.CodecByName(name)
+	if codec == nil {
+		*reply = "1 no such codec " + name
+		return
+	}
+	c.limiterMu.Lock()
+	defer c.limiterMu.Unlock()
+	c.codec = codec
+	*reply = "0 OK"
+}
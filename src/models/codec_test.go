@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// setupCodec builds the tables of lab3 with the calls to the nodes encoded with the given codec.
+func setupCodec(codec string) string {
+	setupLab3()
+	reply := ""
+	cli.Call("Cluster.SetCodec", codec, &reply)
+	if reply != "0 OK" {
+		return reply
+	}
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"2":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules, "sid"}, &reply)
+	rules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	cli.Call("Cluster.BuildTable", []interface{}{courseRegistrationTableSchema, rules}, &reply)
+	insertDataLab3(cli)
+	return reply
+}
+
+func TestCodec(t *testing.T) {
+	for _, codec := range []string{"json", "binary"} {
+		if reply := setupCodec(codec); reply != "0 OK" {
+			t.Fatalf("%v: cannot build the tables: %v", codec, reply)
+		}
+		results := Dataset{}
+		cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+		expected := Dataset{Schema: joinedTableSchema, Rows: joinedTableContent}
+		if !datasetDuplicateChecking(expected, results) {
+			t.Errorf("%v: expected the join %v, actual %v", codec, expected, results)
+		}
+		reply := ""
+		cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"grade": {{Op: ">", Val: 3.6}}}}, &reply)
+		if rows := scanRows(studentTableName); reply != "0 2" || len(rows) != 1 || rows[0][1] != "Smith" {
+			t.Errorf("%v: expected Smith left, actual %v %v", codec, reply, rows)
+		}
+	}
+
+	reply := ""
+	cli.Call("Cluster.SetCodec", "xml", &reply)
+	if reply != "1 no such codec xml" {
+		t.Errorf("expected an unknown codec, actual %v", reply)
+	}
+}
+
+func TestBinaryCodecIsCompact(t *testing.T) {
+	setupCodec("gob")
+	sizes := make(map[string]int64)
+	for _, codec := range []string{"gob", "binary"} {
+		reply := ""
+		cli.Call("Cluster.SetCodec", codec, &reply)
+		before := network.GetTotalBytes()
+		if rows := scanRows(studentTableName); len(rows) != 3 {
+			t.Fatalf("%v: expected 3 students, actual %v", codec, rows)
+		}
+		sizes[codec] = network.GetTotalBytes() - before
+	}
+	if sizes["binary"] >= sizes["gob"] {
+		t.Errorf("expected the scan to send fewer bytes with the binary codec, actual %v", sizes)
+	}
+}
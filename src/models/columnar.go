@@ -0,0 +1,291 @@
+package models
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"../labgob"
+)
+
+// columnarMagic starts every columnar file, so that other files are rejected early.
+const columnarMagic = "DDBMS-COLUMNAR"
+
+// columnarVersion is bumped whenever the layout of columnar files changes.
+const columnarVersion = 1
+
+// columnarHeader starts a columnar file, it is followed by one columnarColumn for each column of the schema.
+type columnarHeader struct {
+	Magic   string
+	Version int
+	Schema  TableSchema
+	Rows    int
+}
+
+// columnarColumn holds all values of a column, only the slice of the type of the column is filled, and a null is
+// stored as the zero value with Nulls set.
+type columnarColumn struct {
+	Nulls   []bool
+	Ints    []int64
+	Floats  []float64
+	Bools   []bool
+	Strings []string
+}
+
+// WriteColumnar writes rows following the schema in a simple columnar format: a header with the schema and the
+// number of rows, then the values of each column one column after another, so that a reader interested in some
+// columns can skip the others, and values of the same type are encoded together.
+func WriteColumnar(w io.Writer, schema TableSchema, rows []Row) error {
+	encoder := labgob.NewEncoder(w)
+	if err := encoder.Encode(columnarHeader{Magic: columnarMagic, Version: columnarVersion, Schema: schema,
+		Rows: len(rows)}); err != nil {
+		return err
+	}
+	for i, cs := range schema.ColumnSchemas {
+		column := columnarColumn{Nulls: make([]bool, len(rows))}
+		for j, row := range rows {
+			if i >= len(row) || row[i] == nil {
+				column.Nulls[j] = true
+			}
+			var value interface{}
+			if !column.Nulls[j] {
+				value = row[i]
+			}
+			if err := column.append(cs, value); err != nil {
+				return fmt.Errorf("row %v: %v", j, err)
+			}
+		}
+		if err := encoder.Encode(column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadColumnar reads the schema and the rows written by WriteColumnar. Integers are read as int and floating point
+// numbers as float64, as the rows written by the tests.
+func ReadColumnar(r io.Reader) (TableSchema, []Row, error) {
+	decoder := labgob.NewDecoder(r)
+	header := columnarHeader{}
+	if err := decoder.Decode(&header); err != nil {
+		return TableSchema{}, nil, err
+	}
+	if header.Magic != columnarMagic {
+		return TableSchema{}, nil, errors.New("not a columnar file")
+	}
+	if header.Version != columnarVersion {
+		return TableSchema{}, nil, fmt.Errorf("unsupported version %v", header.Version)
+	}
+	rows := make([]Row, header.Rows)
+	for j := range rows {
+		rows[j] = make(Row, len(header.Schema.ColumnSchemas))
+	}
+	for i, cs := range header.Schema.ColumnSchemas {
+		column := columnarColumn{}
+		if err := decoder.Decode(&column); err != nil {
+			return TableSchema{}, nil, fmt.Errorf("column %v: %v", cs.Name, err)
+		}
+		if len(column.Nulls) != header.Rows {
+			return TableSchema{}, nil, fmt.Errorf("column %v has %v values, expected %v", cs.Name,
+				len(column.Nulls), header.Rows)
+		}
+		for j := range rows {
+			if !column.Nulls[j] {
+				rows[j][i] = column.value(cs, j)
+			}
+		}
+	}
+	return header.Schema, rows, nil
+}
+
+// append adds a value of the column, nil being a null.
+func (column *columnarColumn) append(cs ColumnSchema, value interface{}) error {
+	switch cs.DataType {
+	case TypeInt32, TypeInt64:
+		v := 0.0
+		if value != nil {
+			f, ok := numberValue(value)
+			if !ok || f != float64(int64(f)) {
+				return fmt.Errorf("%v of %v is not an integer", value, cs.Name)
+			}
+			v = f
+		}
+		column.Ints = append(column.Ints, int64(v))
+	case TypeFloat, TypeDouble:
+		v := 0.0
+		if value != nil {
+			f, ok := numberValue(value)
+			if !ok {
+				return fmt.Errorf("%v of %v is not a number", value, cs.Name)
+			}
+			v = f
+		}
+		column.Floats = append(column.Floats, v)
+	case TypeBoolean:
+		v, ok := value.(bool)
+		if !ok && value != nil {
+			return fmt.Errorf("%v of %v is not a boolean", value, cs.Name)
+		}
+		column.Bools = append(column.Bools, v)
+	case TypeString:
+		v, ok := value.(string)
+		if !ok && value != nil {
+			return fmt.Errorf("%v of %v is not a string", value, cs.Name)
+		}
+		column.Strings = append(column.Strings, v)
+	default:
+		return fmt.Errorf("unknown type %v of %v", cs.DataType, cs.Name)
+	}
+	return nil
+}
+
+// value returns the j-th value of the column.
+func (column *columnarColumn) value(cs ColumnSchema, j int) interface{} {
+	switch cs.DataType {
+	case TypeInt32, TypeInt64:
+		return int(column.Ints[j])
+	case TypeFloat, TypeDouble:
+		return column.Floats[j]
+	case TypeBoolean:
+		return column.Bools[j]
+	case TypeString:
+		return column.Strings[j]
+	}
+	return nil
+}
+
+// ExportTable writes a table, or one of its fragments, to a columnar file on the coordinator, see WriteColumnar. A
+// table is written with all its columns, while a fragment ("tableName|i") is written with the columns it holds and
+// is read from the first of its replicas that answers.
+// params: name string (a table or a fragment), path string
+func (c *Cluster) ExportTable(params []interface{}, reply *string) {
+	name := params[0].(string)
+	path := params[1].(string)
+	q := c.beginRawQuery(QueryHints{})
+	defer c.endQuery(q)
+	tableName := name
+	if strings.Contains(name, "|") {
+		tableName = fragmentTable(name)
+	}
+	if err := q.placement.renamedError(tableName); err != "" {
+		*reply = "1 " + err
+		return
+	}
+
+	var schema TableSchema
+	var rows []Row
+	if strings.Contains(name, "|") {
+		var ok bool
+		if schema, rows, ok = c.fragmentRows(q, name); !ok {
+			*reply = "1 Cannot Read Fragment"
+			return
+		}
+	} else {
+		var ok bool
+		if schema, ok = q.catalog.Schema(name); !ok {
+			*reply = "1 No Such Table"
+			return
+		}
+		rows = getTableRows(c, q, name, schema.ColumnSchemas)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	if err := WriteColumnar(writer, schema, rows); err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+	if err := writer.Flush(); err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+	*reply = fmt.Sprintf("0 %v", len(rows))
+}
+
+// ImportTable inserts the rows of a columnar file into an existing table, as FragmentWrite does. The columns are
+// matched by name, so the file may have been exported from another cluster, but it must hold all columns of the
+// table. The reply tells how many rows were inserted, rows that cannot be inserted (e.g., a duplicate key) are
+// skipped and counted separately.
+// params: tableName string, path string
+func (c *Cluster) ImportTable(params []interface{}, reply *string) {
+	tableName := params[0].(string)
+	path := params[1].(string)
+	schema, ok := c.catalog.Schema(tableName)
+	if !ok {
+		if err := c.currentPlacement().renamedError(tableName); err != "" {
+			*reply = "1 " + err
+		} else {
+			*reply = "1 No Such Table"
+		}
+		return
+	}
+	if err := c.currentPlacement().readOnlyError(tableName); err != "" {
+		*reply = "1 " + err
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+	defer file.Close()
+	fileSchema, rows, err := ReadColumnar(bufio.NewReader(file))
+	if err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+
+	positions := make([]int, len(schema.ColumnSchemas))
+	for i, cs := range schema.ColumnSchemas {
+		positions[i] = -1
+		for j, column := range fileSchema.ColumnSchemas {
+			if column.Name == cs.Name {
+				positions[i] = j
+			}
+		}
+		if positions[i] < 0 {
+			*reply = "1 Missing Column " + cs.Name
+			return
+		}
+	}
+	inserted, skipped := 0, 0
+	for _, fileRow := range rows {
+		row := make(Row, len(positions))
+		for i, position := range positions {
+			row[i] = fileRow[position]
+		}
+		result := ""
+		c.FragmentWrite([]interface{}{tableName, row}, &result)
+		if len(result) > 0 && result[0] == '0' {
+			inserted++
+		} else {
+			skipped++
+		}
+	}
+	*reply = fmt.Sprintf("0 %v %v", inserted, skipped)
+}
+
+// fragmentRows reads all rows of a fragment from the first replica that answers all batches, without the id column.
+func (c *Cluster) fragmentRows(q *queryContext, fragment string) (TableSchema, []Row, bool) {
+	for _, nodeId := range c.readOrder(q.placement.Replicas(fragment)) {
+		fragmentRows, ok := readFragment(c.nodeEnd(nodeId), fragment, nil)
+		if !ok {
+			continue
+		}
+		schema := TableSchema{TableName: fragment, ColumnSchemas: fragmentRows.Schema.ColumnSchemas[1:]}
+		rows := make([]Row, 0, len(fragmentRows.Rows))
+		for _, row := range fragmentRows.Rows {
+			rows = append(rows, row[1:])
+		}
+		return schema, rows, true
+	}
+	return TableSchema{}, nil, false
+}
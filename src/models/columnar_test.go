@@ -0,0 +1,111 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"../labrpc"
+)
+
+func TestColumnarRoundTrip(t *testing.T) {
+	schema := TableSchema{TableName: "t", ColumnSchemas: []ColumnSchema{
+		{Name: "i", DataType: TypeInt64},
+		{Name: "f", DataType: TypeDouble},
+		{Name: "b", DataType: TypeBoolean},
+		{Name: "s", DataType: TypeString},
+	}}
+	rows := []Row{{1, 1.5, true, "a"}, {nil, nil, nil, nil}, {-3, 0.0, false, ""}}
+	buffer := bytes.Buffer{}
+	if err := WriteColumnar(&buffer, schema, rows); err != nil {
+		t.Fatal(err)
+	}
+	readSchema, readRows, err := ReadColumnar(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Dataset{Schema: schema, Rows: rows}
+	if !compareDataset(expected, Dataset{Schema: readSchema, Rows: readRows}) {
+		t.Errorf("expected %v, actual %v %v", expected, readSchema, readRows)
+	}
+
+	if err := WriteColumnar(&buffer, schema, []Row{{"x", 1.0, true, "a"}}); err == nil {
+		t.Error("a string should not be written to an integer column")
+	}
+	if _, _, err := ReadColumnar(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Error("garbage should not be read")
+	}
+}
+
+// a table is exported from one cluster and imported into another one fragmented differently
+func TestExportImportTable(t *testing.T) {
+	setupLab3()
+	dir := t.TempDir()
+
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"2":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+
+	path := filepath.Join(dir, "student.col")
+	reply := ""
+	cli.Call("Cluster.ExportTable", []interface{}{studentTableName, path}, &reply)
+	if reply != "0 3" {
+		t.Fatalf("expected 3 rows exported, actual %v", reply)
+	}
+	// fragments are numbered in no particular order, the one with grade > 3.6 is the one on Node2
+	fragment := ""
+	placement := c.currentPlacement()
+	for _, f := range placement.Fragments(studentTableName) {
+		if replicas := placement.Replicas(f); len(replicas) == 1 && replicas[0] == "Node2" {
+			fragment = f
+		}
+	}
+	fragmentPath := filepath.Join(dir, "fragment.col")
+	cli.Call("Cluster.ExportTable", []interface{}{fragment, fragmentPath}, &reply)
+	if reply != "0 2" {
+		t.Fatalf("expected 2 rows of the fragment exported, actual %v", reply)
+	}
+	file, _ := os.Open(fragmentPath)
+	schema, rows, err := ReadColumnar(file)
+	file.Close()
+	if err != nil || schema.TableName != fragment || len(rows) != 2 {
+		t.Errorf("unexpected fragment %v %v %v", schema, rows, err)
+	}
+
+	other := labrpc.MakeNetwork()
+	defer other.Cleanup()
+	NewCluster(2, other, "OtherCluster")
+	otherCli := other.MakeEnd("OtherClient")
+	other.Connect("OtherClient", "OtherCluster")
+	other.Enable("OtherClient", true)
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0": rangeFragment("age", "<", 22, "sid", "name", "age", "grade"),
+		"1": rangeFragment("age", ">=", 22, "sid", "name", "age", "grade"),
+	})
+	otherCli.Call("Cluster.BuildTable", []interface{}{*studentTableSchema, rules, "sid"}, &reply)
+	otherCli.Call("Cluster.ImportTable", []interface{}{studentTableName, path}, &reply)
+	if reply != "0 3 0" {
+		t.Fatalf("expected 3 rows imported, actual %v", reply)
+	}
+	otherCli.Call("Cluster.ImportTable", []interface{}{studentTableName, path}, &reply)
+	if reply != "0 0 3" {
+		t.Errorf("duplicate keys should be skipped, actual %v", reply)
+	}
+
+	for _, row := range studentRows {
+		result := Dataset{}
+		otherCli.Call("Cluster.Get", []interface{}{studentTableName, row[0]}, &result)
+		expected := Dataset{Schema: *studentTableSchema, Rows: []Row{row}}
+		if !compareDataset(expected, result) {
+			t.Errorf("expected %v, actual %v", expected, result)
+		}
+	}
+}
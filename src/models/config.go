@@ -0,0 +1,217 @@
+package models
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"../labrpc"
+)
+
+// ClusterConfig describes a whole cluster: its nodes, its tables and the initial data of the tables.
+// An example:
+//
+//	{
+//	  "name": "MyCluster",
+//	  "nodes": 3,
+//	  "replication": 2,
+//	  "labels": {"Node0": {"zone": "A"}, "Node1": {"zone": "B"}, "Node2": {"zone": "B"}},
+//	  "tables": [{
+//	    "name": "student",
+//	    "columns": [{"name": "sid", "type": "int32"}, {"name": "name", "type": "string"}],
+//	    "primaryKey": "sid",
+//	    "rules": {"0|1": {"predicate": {"sid": [{"op": "<", "val": 100}]}, "column": ["sid", "name"]}},
+//	    "data": "student.csv"
+//	  }]
+//	}
+type ClusterConfig struct {
+	// the name of the cluster, see NewCluster
+	Name string `json:"name"`
+	// the number of nodes
+	Nodes int `json:"nodes"`
+	// how many replicas each table without rules has, 1 if absent
+	Replication int `json:"replication"`
+	// the locality tags of the nodes by node id, see SetNodeLabels
+	Labels map[string]NodeLabels `json:"labels"`
+	Tables []TableConfig         `json:"tables"`
+}
+
+// TableConfig describes a table of a ClusterConfig.
+type TableConfig struct {
+	Name    string         `json:"name"`
+	Columns []ColumnConfig `json:"columns"`
+	// the primary key column, see BuildTable
+	PrimaryKey string `json:"primaryKey"`
+	// the fragmentation rules in the format BuildTable expects. If absent, the table is stored as one fragment with all
+	// columns, replicated on Replication nodes.
+	Rules json.RawMessage `json:"rules"`
+	// a CSV file holding the initial rows of the table, relative to the config file. The first line names the columns.
+	Data string `json:"data"`
+}
+
+// ColumnConfig describes a column of a TableConfig, the type is one of the keys of columnTypes.
+type ColumnConfig struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+var columnTypes = map[string]int{
+	"int32":  TypeInt32,
+	"int64":  TypeInt64,
+	"float":  TypeFloat,
+	"double": TypeDouble,
+	"bool":   TypeBoolean,
+	"string": TypeString,
+}
+
+// NewClusterFromConfig creates a cluster on the network as described by a JSON config file, see ClusterConfig, builds
+// its tables and inserts their initial data.
+func NewClusterFromConfig(path string, network *labrpc.Network) (*Cluster, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := ClusterConfig{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, err
+	}
+	if config.Nodes <= 0 {
+		return nil, errors.New("a cluster needs at least one node")
+	}
+	if config.Replication <= 0 {
+		config.Replication = 1
+	}
+	if config.Replication > config.Nodes {
+		return nil, errors.New("replication is larger than the number of nodes")
+	}
+
+	c := NewCluster(config.Nodes, network, config.Name)
+	for nodeId, labels := range config.Labels {
+		reply := ""
+		c.SetNodeLabels([]interface{}{nodeId, labels}, &reply)
+		if !strings.HasPrefix(reply, "0") {
+			return nil, fmt.Errorf("cannot label %v: %v", nodeId, reply)
+		}
+	}
+	for i, table := range config.Tables {
+		schema := TableSchema{TableName: table.Name, ColumnSchemas: make([]ColumnSchema, 0, len(table.Columns))}
+		for _, column := range table.Columns {
+			dataType, ok := columnTypes[column.Type]
+			if !ok {
+				return nil, fmt.Errorf("unknown type %v of %v.%v", column.Type, table.Name, column.Name)
+			}
+			schema.ColumnSchemas = append(schema.ColumnSchemas, ColumnSchema{Name: column.Name, DataType: dataType})
+		}
+		rules := []byte(table.Rules)
+		if len(rules) == 0 {
+			if rules, err = defaultRules(schema, i, config.Nodes, config.Replication); err != nil {
+				return nil, fmt.Errorf("cannot place %v: %v", table.Name, err)
+			}
+		}
+		params := []interface{}{schema, rules}
+		if table.PrimaryKey != "" {
+			params = append(params, table.PrimaryKey)
+		}
+		reply := ""
+		c.BuildTable(params, &reply)
+		if !strings.HasPrefix(reply, "0") {
+			return nil, fmt.Errorf("cannot build %v: %v", table.Name, reply)
+		}
+
+		if table.Data == "" {
+			continue
+		}
+		rows, err := readRows(filepath.Join(filepath.Dir(path), table.Data), schema)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read data of %v: %v", table.Name, err)
+		}
+		for _, row := range rows {
+			reply := ""
+			c.FragmentWrite([]interface{}{table.Name, row}, &reply)
+			if !strings.HasPrefix(reply, "0") {
+				return nil, fmt.Errorf("cannot insert %v into %v: %v", row, table.Name, reply)
+			}
+		}
+	}
+	return c, nil
+}
+
+// defaultRules places the i-th table as one fragment with all columns on replication nodes, starting from node i so
+// that the tables are spread over the nodes.
+func defaultRules(schema TableSchema, i int, nodes int, replication int) ([]byte, error) {
+	nodeIds := make([]int, replication)
+	for k := range nodeIds {
+		nodeIds[k] = (i + k) % nodes
+	}
+	return NewRuleSet(schema).AddHorizontalRule(Predicate{}, nodeIds...).Marshal()
+}
+
+// readRows reads the rows of a table from a CSV file whose first line names the columns, the rows are returned in the
+// order of the columns in the schema. An empty field of a non-string column is null.
+func readRows(path string, schema TableSchema) ([]Row, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no header")
+	}
+
+	// the position of each column of the schema in the records
+	positions := make([]int, len(schema.ColumnSchemas))
+	for i, cs := range schema.ColumnSchemas {
+		positions[i] = -1
+		for j, name := range records[0] {
+			if strings.TrimSpace(name) == cs.Name {
+				positions[i] = j
+			}
+		}
+		if positions[i] < 0 {
+			return nil, fmt.Errorf("no column %v", cs.Name)
+		}
+	}
+	rows := make([]Row, 0, len(records)-1)
+	for line, record := range records[1:] {
+		row := make(Row, len(positions))
+		for i, position := range positions {
+			value, err := parseValue(record[position], schema.ColumnSchemas[i].DataType)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", line+2, err)
+			}
+			row[i] = value
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseValue converts a field of a CSV file to a value of the type, in the Go types used by the rows of the tests.
+func parseValue(field string, dataType int) (interface{}, error) {
+	if dataType == TypeString {
+		return field, nil
+	}
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return nil, nil
+	}
+	switch dataType {
+	case TypeInt32, TypeInt64:
+		return strconv.Atoi(field)
+	case TypeFloat, TypeDouble:
+		return strconv.ParseFloat(field, 64)
+	case TypeBoolean:
+		return strconv.ParseBool(field)
+	}
+	return nil, fmt.Errorf("unknown type %v", dataType)
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"../labrpc"
+)
+
+// the tables of lab3 are built from a config file, student by its rules and courseRegistration by the default ones
+func TestNewClusterFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := `{
+	"name": "MyCluster",
+	"nodes": 3,
+	"replication": 2,
+	"tables": [{
+		"name": "student",
+		"columns": [{"name": "sid", "type": "int32"}, {"name": "name", "type": "string"},
+			{"name": "age", "type": "int32"}, {"name": "grade", "type": "float"}],
+		"primaryKey": "sid",
+		"rules": {
+			"0": {"predicate": {"grade": [{"op": "<=", "val": 3.6}]}, "column": ["sid", "name", "age", "grade"]},
+			"1|2": {"predicate": {"grade": [{"op": ">", "val": 3.6}]}, "column": ["sid", "name", "age", "grade"]}
+		},
+		"data": "student.csv"
+	}, {
+		"name": "courseRegistration",
+		"columns": [{"name": "sid", "type": "int32"}, {"name": "courseId", "type": "int32"}],
+		"data": "courseRegistration.csv"
+	}]
+}`
+	files := map[string]string{
+		"cluster.json":           config,
+		"student.csv":            "sid,name,age,grade\n0,John,22,4.0\n1,Smith,23,3.6\n2,Hana,21,4.0\n",
+		"courseRegistration.csv": "courseId,sid\n0,0\n1,0\n0,1\n2,2\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	network = labrpc.MakeNetwork()
+	defineTablesLab3()
+	var err error
+	c, err = NewClusterFromConfig(filepath.Join(dir, "cluster.json"), network)
+	if err != nil {
+		t.Fatalf("NewClusterFromConfig failed: %v", err)
+	}
+	cli = network.MakeEnd("ClientA")
+	network.Connect("ClientA", c.Name)
+	network.Enable("ClientA", true)
+
+	if nodeIds := c.currentPlacement().Replicas(courseRegistrationTableName + "|0"); len(nodeIds) != 2 {
+		t.Errorf("courseRegistration should have 2 replicas, actual %v", nodeIds)
+	}
+	results := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows:   joinedTableContent,
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, results)
+	}
+	results = Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 1}, &results)
+	if len(results.Rows) != 1 || results.Rows[0][1] != "Smith" {
+		t.Errorf("Incorrect lookup by primary key, actual %v", results)
+	}
+
+	files["cluster.json"] = `{"name": "Other", "nodes": 1, "replication": 2}`
+	ioutil.WriteFile(filepath.Join(dir, "cluster.json"), []byte(files["cluster.json"]), 0644)
+	if _, err := NewClusterFromConfig(filepath.Join(dir, "cluster.json"), labrpc.MakeNetwork()); err == nil {
+		t.Errorf("A replication larger than the number of nodes should be rejected")
+	}
+}
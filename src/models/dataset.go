@@ -3,4 +3,15 @@ package models
 type Dataset struct {
 	Schema TableSchema
 	Rows []Row
+	// the replicas of the fragments each row has been assembled from, in the order of Rows, only set if the query asks
+	// for it, see QueryHints.WithProvenance
+	Provenance [][]RowLocation
+	// the columns of Schema in the same order, with the tables they come from and whether they may hold null, set by
+	// the queries (Get, MultiGet, Scan and Join) that succeed
+	Columns []ResultColumn
+	// the fragments none of whose replicas answered, in the order of their names, whose rows are missing from Rows, see
+	// QueryHints.Strictness
+	Unavailable []string
+	// why the request failed, set only for the failures worth telling apart, e.g., the table has been renamed
+	Error string
 }
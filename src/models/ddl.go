@@ -0,0 +1,165 @@
+package models
+
+// TableDefinition is how a table has been built, as described by DescribeTable.
+type TableDefinition struct {
+	// the logical schema of the table, without the hidden id column
+	Schema TableSchema
+	// the primary key column, "" for none
+	Key     string
+	Storage TableStorage
+	// the fragments of the table in the order of their numbers
+	Fragments []FragmentDefinition
+}
+
+// FragmentDefinition is a fragment of a table and the nodes holding its replicas.
+type FragmentDefinition struct {
+	Fragment string
+	Rule     Rule
+	Nodes    []string
+}
+
+// definition describes a table, which must exist. The caller must hold writeMu.
+func (c *Cluster) definition(tableName string) TableDefinition {
+	placement := c.currentPlacement()
+	table, _ := c.catalog.Table(tableName)
+	definition := TableDefinition{Schema: table.Schema, Key: table.Key, Storage: table.Storage,
+		Fragments: make([]FragmentDefinition, 0)}
+	for _, fragment := range placement.Fragments(tableName) {
+		definition.Fragments = append(definition.Fragments, FragmentDefinition{Fragment: fragment,
+			Rule: placement.Rule(fragment), Nodes: append([]string(nil), placement.Replicas(fragment)...)})
+	}
+	return definition
+}
+
+// DescribeTable replies the definition of a table, e.g., to check the table left unchanged by a BuildTable with
+// ifNotExists. The schema of the definition has an empty table name if there is no such table.
+// params: tableName string
+func (c *Cluster) DescribeTable(tableName string, reply *TableDefinition) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if _, ok := c.catalog.Schema(tableName); !ok {
+		*reply = TableDefinition{}
+		return
+	}
+	*reply = c.definition(tableName)
+}
+
+// DropTable drops a table and all its fragments. The fragments are dropped by the nodes once the queries reading them
+// have finished. The reply is "1 No Such Table" if the table does not exist, unless ifExists is set, in which case it
+// is "0 Not Exists" and dropping the table again (e.g., a retried request) is harmless.
+// params: tableName string, (optional) ifExists bool
+func (c *Cluster) DropTable(params []interface{}, reply *string) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tableName := params[0].(string)
+	if _, ok := c.catalog.Schema(tableName); !ok {
+		if err := c.currentPlacement().renamedError(tableName); err != "" {
+			*reply = "1 " + err
+		} else if len(params) > 1 && params[1].(bool) {
+			*reply = "0 Not Exists"
+		} else {
+			*reply = "1 No Such Table"
+		}
+		return
+	}
+	if err := c.currentPlacement().readOnlyError(tableName); err != "" {
+		*reply = "1 " + err
+		return
+	}
+
+	previous := c.currentPlacement()
+	next := previous.clone()
+	next.removeTable(tableName)
+	delete(next.Masks, tableName)
+	c.installCatalog(next, func(cat *Catalog) { cat.DropTable(tableName) })
+	c.rowCache.Invalidate(tableName)
+	c.rowIndex.DropTable(tableName)
+
+	c.waitForReaders(next.Epoch)
+	for _, fragment := range previous.Fragments(tableName) {
+		delete(c.fragmentVersions, fragment)
+		for _, nodeId := range previous.Replicas(fragment) {
+			// a replica which cannot be dropped now is unreachable by the later queries anyway
+			msg := ""
+			c.nodeEnd(nodeId).Call("Node.RPCDropTable", FragmentArgs{Fragment: fragment}, &msg)
+		}
+	}
+	c.publish(Event{Type: EventTableDropped, Tables: []string{tableName}})
+	*reply = "0 OK"
+}
+
+// CreateIndex makes a column the primary key of an existing table without one, so that its rows can be looked up by
+// Get and a later write with a duplicate or null key is rejected. The rows already in the table must have distinct keys,
+// none of them null, or the reply is "1 Duplicate Key" ("1 Null Key") and nothing changes.
+// If the column is already the key, the reply is "1 Index Exists", unless ifNotExists is set, in which case it is
+// "0 Exists".
+// params: tableName string, column string, (optional) ifNotExists bool
+func (c *Cluster) CreateIndex(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tableName := params[0].(string)
+	column := params[1].(string)
+	schema, ok := c.catalog.Schema(tableName)
+	if !ok {
+		if err := c.currentPlacement().renamedError(tableName); err != "" {
+			*reply = "1 " + err
+		} else {
+			*reply = "1 No Such Table"
+		}
+		return
+	}
+	if err := c.currentPlacement().readOnlyError(tableName); err != "" {
+		*reply = "1 " + err
+		return
+	}
+	if key, ok := c.catalog.Key(tableName); ok {
+		if key != column {
+			*reply = "1 Table Already Has Key " + key
+		} else if len(params) > 2 && params[2].(bool) {
+			*reply = "0 Exists"
+		} else {
+			*reply = "1 Index Exists"
+		}
+		return
+	}
+	keyIndex := -1
+	for i, cs := range schema.ColumnSchemas {
+		if cs.Name == column {
+			keyIndex = i
+		}
+	}
+	if keyIndex < 0 {
+		*reply = "1 No Such Column"
+		return
+	}
+
+	// writes are blocked, so the rows read are all rows of the table, each following its id in the catalog
+	q := c.beginRawQuery(QueryHints{DisableCache: true})
+	rows := getTableRows(c, q, tableName, schema.ColumnSchemas)
+	c.endQuery(q)
+	ids := q.catalog.Ids(tableName)
+	if len(rows) != len(ids) {
+		*reply = "1 Cannot Read Table"
+		return
+	}
+	for i, row := range rows {
+		if row[keyIndex] == nil {
+			c.rowIndex.DropKeys(tableName)
+			*reply = "1 Null Key"
+			return
+		}
+		if !c.rowIndex.SetKey(tableName, row[keyIndex], ids[i]) {
+			c.rowIndex.DropKeys(tableName)
+			*reply = "1 Duplicate Key"
+			return
+		}
+	}
+	// a new epoch lets the nodes and the clients learn about the key
+	c.installCatalog(c.currentPlacement().clone(), func(cat *Catalog) { cat.SetKey(tableName, column) })
+	*reply = "0 OK"
+}
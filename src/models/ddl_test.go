@@ -0,0 +1,151 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// setupDDL builds and fills the tables of lab3, the student table being replicated on two nodes
+func setupDDL() {
+	setupLab3()
+	defineDDLRules()
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+}
+
+// defineDDLRules fragments student by grade on Node0 and Node1, and on Node2 and Node3, and puts courseRegistration on
+// Node4.
+func defineDDLRules() {
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"2|3": rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"4": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+}
+
+// building the tables again with ifNotExists changes nothing
+func TestBuildTableIfNotExists(t *testing.T) {
+	setupDDL()
+	before := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", studentTableName, &before)
+	if before.Schema.TableName != studentTableName || len(before.Fragments) == 0 {
+		t.Fatalf("unexpected definition %v", before)
+	}
+
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, studentTablePartitionRules, "", TableStorage{},
+		true}, &reply)
+	if reply != "0 Exists" {
+		t.Errorf("expected the table to exist, actual %v", reply)
+	}
+	// a changed schema or key does not pass for the existing table
+	changed := TableSchema{TableName: studentTableName, ColumnSchemas: studentTableSchema.ColumnSchemas[:3]}
+	cli.Call("Cluster.BuildTable", []interface{}{changed, studentTablePartitionRules, "", TableStorage{}, true}, &reply)
+	if reply != "1 Exists With Different Schema" {
+		t.Errorf("expected the changed schema to be rejected, actual %v", reply)
+	}
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, studentTablePartitionRules, "sid", TableStorage{},
+		true}, &reply)
+	if reply != "1 Exists With Different Schema" {
+		t.Errorf("expected the changed key to be rejected, actual %v", reply)
+	}
+	after := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", studentTableName, &after)
+	if len(after.Fragments) != len(before.Fragments) || after.Fragments[0].Fragment != before.Fragments[0].Fragment {
+		t.Errorf("expected %v, actual %v", before, after)
+	}
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{}}, &result)
+	if len(result.Rows) != len(studentRows) {
+		t.Errorf("expected the rows to be kept, actual %v", result.Rows)
+	}
+
+	unknown := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", "unknown", &unknown)
+	if unknown.Schema.TableName != "" {
+		t.Errorf("an unknown table should not be described, actual %v", unknown)
+	}
+}
+
+func TestDropTable(t *testing.T) {
+	setupDDL()
+	definition := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", studentTableName, &definition)
+
+	reply := ""
+	cli.Call("Cluster.DropTable", []interface{}{studentTableName}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot drop the table: %v", reply)
+	}
+	for _, fragment := range definition.Fragments {
+		for _, nodeId := range fragment.Nodes {
+			batch := Dataset{}
+			c.nodeEnd(nodeId).Call("Node.RPCScanFragment", ScanFragmentArgs{Fragment: fragment.Fragment,
+				Limit: scanBatchSize}, &batch)
+			if batch.Schema.TableName != "" {
+				t.Errorf("%v should be dropped from %v", fragment.Fragment, nodeId)
+			}
+		}
+	}
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{}}, &result)
+	if result.Schema.TableName != "" {
+		t.Errorf("a dropped table should not be scanned, actual %v", result)
+	}
+
+	cli.Call("Cluster.DropTable", []interface{}{studentTableName}, &reply)
+	if reply != "1 No Such Table" {
+		t.Errorf("expected no such table, actual %v", reply)
+	}
+	cli.Call("Cluster.DropTable", []interface{}{studentTableName, true}, &reply)
+	if reply != "0 Not Exists" {
+		t.Errorf("expected the table not to exist, actual %v", reply)
+	}
+
+	// the table can be built again
+	setupDDL()
+	result = Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{}}, &result)
+	if len(result.Rows) != len(studentRows) {
+		t.Errorf("expected %v rows, actual %v", len(studentRows), result.Rows)
+	}
+}
+
+func TestCreateIndex(t *testing.T) {
+	setupDDL()
+
+	reply := ""
+	cli.Call("Cluster.CreateIndex", []interface{}{courseRegistrationTableName, "sid"}, &reply)
+	if reply != "1 Duplicate Key" {
+		t.Errorf("expected a duplicate key, actual %v", reply)
+	}
+	cli.Call("Cluster.CreateIndex", []interface{}{studentTableName, "unknown"}, &reply)
+	if reply != "1 No Such Column" {
+		t.Errorf("expected no such column, actual %v", reply)
+	}
+
+	cli.Call("Cluster.CreateIndex", []interface{}{studentTableName, "sid"}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot create the index: %v", reply)
+	}
+	result := Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 1}, &result)
+	if len(result.Rows) != 1 || !result.Rows[0].Equals(&studentRows[1]) {
+		t.Errorf("expected %v, actual %v", studentRows[1], result.Rows)
+	}
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{1, "Bob", 20, 3.0}}, &reply)
+	if reply != "1 Duplicate Key" {
+		t.Errorf("expected a duplicate key, actual %v", reply)
+	}
+
+	cli.Call("Cluster.CreateIndex", []interface{}{studentTableName, "sid"}, &reply)
+	if reply != "1 Index Exists" {
+		t.Errorf("expected the index to exist, actual %v", reply)
+	}
+	cli.Call("Cluster.CreateIndex", []interface{}{studentTableName, "sid", true}, &reply)
+	if reply != "0 Exists" {
+		t.Errorf("expected the index to exist, actual %v", reply)
+	}
+}
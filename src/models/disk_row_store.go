@@ -0,0 +1,337 @@
+package models
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"../labgob"
+)
+
+// enumeration of storage tiers of a table, see TableStorage
+const (
+	// all rows are kept in memory
+	TierMemory = iota
+	// rows are kept in a file, and recently read blocks of rows in memory
+	TierDisk
+)
+
+// defaultBlockRows is how many rows a block of a disk-backed table holds.
+const defaultBlockRows = 64
+
+// defaultCacheBlocks is how many blocks of a disk-backed table are cached in memory if not set.
+const defaultCacheBlocks = 16
+
+// TableStorage tells how the fragments of a table are stored by the nodes, it can be given to BuildTable. The zero
+// value keeps the table in memory.
+type TableStorage struct {
+	// one of the tiers above
+	Tier int
+	// how many blocks of rows each replica of a disk-backed fragment caches in memory, defaultCacheBlocks if not
+	// positive
+	CacheBlocks int
+	// whether Cluster.Delete hides the rows it deletes behind tombstones instead of removing them, so that they can be
+	// brought back by Cluster.Undelete
+	SoftDelete bool
+	// how long the rows soft-deleted are kept, they are purged by a later Delete once they have been deleted for
+	// longer. They are kept until Cluster.PurgeTombstones if not positive.
+	TombstoneRetention time.Duration
+	// how far back the nodes keep the versions of the rows, so that the table can be read as of an earlier time, see
+	// QueryHints.AsOf. No history is kept if not positive.
+	History time.Duration
+}
+
+// newRowStore creates the RowStore of a fragment in the tier of the storage, the files of a disk-backed one in the
+// directory, see NewDiskRowStore.
+func newRowStore(storage TableStorage, dir string) (RowStore, error) {
+	if storage.Tier == TierDisk {
+		return NewDiskRowStore(dir, defaultBlockRows, storage.CacheBlocks)
+	}
+	return NewSnapshotRowStore(), nil
+}
+
+// SetDataDir sets the directory the nodes keep the files of the disk-backed tables in, instead of that of the
+// temporary files, for the fragments created afterwards.
+// params: dir string
+func (c *Cluster) SetDataDir(dir string, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.dataDir = dir
+	for _, nodeId := range c.nodeIds {
+		node := c.nodes[nodeId]
+		node.mu.Lock()
+		node.dataDir = dir
+		node.mu.Unlock()
+	}
+	*reply = "0 OK"
+}
+
+// failingStore is a RowStore which may fail to read or write its rows, e.g., a DiskRowStore.
+type failingStore interface {
+	Err() error
+}
+
+// storeError returns why the store of a table has failed, nil if it has not or cannot fail.
+func storeError(t *Table) error {
+	if s, ok := t.rowStore.(failingStore); ok {
+		return s.Err()
+	}
+	return nil
+}
+
+// DiskRowStore stores rows in a temporary file, in blocks of a fixed number of rows, and caches the most recently
+// used blocks in memory, so that a large table only holds a few blocks in memory. Rows are appended to an in-memory
+// tail block, which is written to the file once full. Removing a row rewrites its block at the end of the file, the
+// space of the old block is not reused.
+// The store may be read concurrently, but not written concurrently with anything else, as the other stores.
+// Once the file cannot be read or written, the store fails: it ignores the writes, its iterators stop at the blocks
+// which cannot be read, and Err tells why.
+type DiskRowStore struct {
+	file      *os.File
+	blockRows int
+	// the blocks written to the file, in the order of the rows
+	blocks []diskBlock
+	// the size of the file
+	size int64
+	// the rows not yet written to the file
+	tail []Row
+	// the number of rows
+	length int
+
+	// guards the cache and err, which are used by concurrent readers
+	mu sync.Mutex
+	// the first error reading or writing the file
+	err      error
+	capacity int
+	// most recently used blocks are at the front
+	lru *list.List
+	// block number -> element in lru
+	cached map[int]*list.Element
+}
+
+type diskBlock struct {
+	offset int64
+	length int
+	rows   int
+}
+
+type cachedBlock struct {
+	number int
+	rows   []Row
+}
+
+// NewDiskRowStore creates an empty DiskRowStore in a new file of the directory, or of the directory of temporary files
+// if empty, with blocks of blockRows rows and a cache of cacheBlocks blocks, or defaultCacheBlocks if not positive.
+func NewDiskRowStore(dir string, blockRows int, cacheBlocks int) (*DiskRowStore, error) {
+	if cacheBlocks <= 0 {
+		cacheBlocks = defaultCacheBlocks
+	}
+	file, err := ioutil.TempFile(dir, "rowstore")
+	if err != nil {
+		return nil, err
+	}
+	return &DiskRowStore{file: file, blockRows: blockRows, capacity: cacheBlocks, lru: list.New(),
+		cached: make(map[int]*list.Element)}, nil
+}
+
+func (s *DiskRowStore) count() int {
+	return s.length
+}
+
+func (s *DiskRowStore) iterator() RowIterator {
+	return &diskRowIterator{store: s, blocks: len(s.blocks), tail: s.tail, block: -1}
+}
+
+func (s *DiskRowStore) insert(row *Row) {
+	if s.Err() != nil {
+		return
+	}
+	if len(s.tail)+1 < s.blockRows {
+		s.tail = append(s.tail, copyRow(*row))
+		s.length++
+		return
+	}
+	block := append(s.tail[:len(s.tail):len(s.tail)], copyRow(*row))
+	s.blocks = append(s.blocks, diskBlock{})
+	if err := s.writeBlock(len(s.blocks)-1, block); err != nil {
+		s.blocks = s.blocks[:len(s.blocks)-1]
+		s.fail(err)
+		return
+	}
+	s.length++
+	s.tail = nil
+}
+
+func (s *DiskRowStore) remove(row *Row) {
+	if s.Err() != nil {
+		return
+	}
+	for i := range s.blocks {
+		rows, err := s.readBlock(i)
+		if err != nil {
+			s.fail(err)
+			return
+		}
+		for j, r := range rows {
+			if r.Equals(row) {
+				err := s.writeBlock(i, append(append(make([]Row, 0, len(rows)-1), rows[:j]...), rows[j+1:]...))
+				if err != nil {
+					s.fail(err)
+					return
+				}
+				s.length--
+				return
+			}
+		}
+	}
+	for j, r := range s.tail {
+		if r.Equals(row) {
+			s.tail = append(append(make([]Row, 0, len(s.tail)-1), s.tail[:j]...), s.tail[j+1:]...)
+			s.length--
+			return
+		}
+	}
+}
+
+// Close removes the file of the store, which cannot be used afterwards.
+func (s *DiskRowStore) Close() error {
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
+
+// Err returns the first error reading or writing the file of the store, after which the store has failed, nil if
+// none.
+func (s *DiskRowStore) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// fail records the error reading or writing the file, unless another has been recorded before.
+func (s *DiskRowStore) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// CachedBlocks returns how many blocks are cached in memory.
+func (s *DiskRowStore) CachedBlocks() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// writeBlock writes the rows of the i-th block at the end of the file and caches them. The block is left as it was if
+// the rows cannot be written.
+func (s *DiskRowStore) writeBlock(i int, rows []Row) error {
+	buffer := bytes.Buffer{}
+	if err := labgob.NewEncoder(&buffer).Encode(rows); err != nil {
+		return fmt.Errorf("cannot encode a block of %v: %v", s.file.Name(), err)
+	}
+	if _, err := s.file.WriteAt(buffer.Bytes(), s.size); err != nil {
+		return fmt.Errorf("cannot write %v: %v", s.file.Name(), err)
+	}
+	s.blocks[i] = diskBlock{offset: s.size, length: buffer.Len(), rows: len(rows)}
+	s.size += int64(buffer.Len())
+	s.cache(i, rows)
+	return nil
+}
+
+// readBlock returns the rows of the i-th block, from the cache if possible.
+func (s *DiskRowStore) readBlock(i int) ([]Row, error) {
+	s.mu.Lock()
+	if elem, ok := s.cached[i]; ok {
+		s.lru.MoveToFront(elem)
+		s.mu.Unlock()
+		return elem.Value.(*cachedBlock).rows, nil
+	}
+	s.mu.Unlock()
+
+	rows, err := s.readFile(s.blocks[i])
+	if err != nil {
+		return nil, err
+	}
+	s.cache(i, rows)
+	return rows, nil
+}
+
+// readFile reads the rows of a block from the file.
+func (s *DiskRowStore) readFile(block diskBlock) ([]Row, error) {
+	content := make([]byte, block.length)
+	if _, err := s.file.ReadAt(content, block.offset); err != nil {
+		return nil, fmt.Errorf("cannot read %v: %v", s.file.Name(), err)
+	}
+	rows := make([]Row, 0, block.rows)
+	if err := labgob.NewDecoder(bytes.NewReader(content)).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("cannot decode a block of %v: %v", s.file.Name(), err)
+	}
+	return rows, nil
+}
+
+// cache puts the rows of the i-th block into the cache, evicting the least recently used block if the cache is full.
+func (s *DiskRowStore) cache(i int, rows []Row) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.cached[i]; ok {
+		elem.Value.(*cachedBlock).rows = rows
+		s.lru.MoveToFront(elem)
+		return
+	}
+	s.cached[i] = s.lru.PushFront(&cachedBlock{number: i, rows: rows})
+	for s.lru.Len() > s.capacity {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.cached, oldest.Value.(*cachedBlock).number)
+	}
+}
+
+// diskRowIterator iterates the blocks written when it was created, then the tail, one block in memory at a time. It
+// stops at a block which cannot be read, the store failing.
+type diskRowIterator struct {
+	store  *DiskRowStore
+	blocks int
+	tail   []Row
+	// the block being iterated, -1 before the first one and blocks for the tail
+	block int
+	rows  []Row
+	next  int
+}
+
+func (iter *diskRowIterator) HasNext() bool {
+	for iter.next >= len(iter.rows) {
+		if iter.block >= iter.blocks {
+			return false
+		}
+		iter.block++
+		if iter.block < iter.blocks {
+			rows, err := iter.store.readBlock(iter.block)
+			if err != nil {
+				iter.store.fail(err)
+				iter.block = iter.blocks
+				iter.rows = nil
+				return false
+			}
+			iter.rows = rows
+		} else {
+			iter.rows = iter.tail
+		}
+		iter.next = 0
+	}
+	return true
+}
+
+func (iter *diskRowIterator) Next() *Row {
+	if !iter.HasNext() {
+		return nil
+	}
+	row := iter.rows[iter.next]
+	iter.next++
+	return &row
+}
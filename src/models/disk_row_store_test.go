@@ -0,0 +1,135 @@
+package models
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiskRowStore(t *testing.T) {
+	s, err := NewDiskRowStore(t.TempDir(), 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := func(i int) *Row { return &Row{i, "row" + strconv.Itoa(i), nil} }
+	for i := 0; i < 30; i++ {
+		s.insert(row(i))
+	}
+	if s.count() != 30 {
+		t.Fatalf("expected 30 rows, actual %v", s.count())
+	}
+	// a row of a block in the file, a row of the tail, and a row that does not exist
+	s.remove(row(5))
+	s.remove(row(29))
+	s.remove(row(100))
+
+	expected := make([]Row, 0)
+	for i := 0; i < 30; i++ {
+		if i != 5 && i != 29 {
+			expected = append(expected, *row(i))
+		}
+	}
+	actual := make([]Row, 0)
+	for iter := s.iterator(); iter.HasNext(); {
+		actual = append(actual, *iter.Next())
+	}
+	if s.count() != len(expected) || len(actual) != len(expected) {
+		t.Fatalf("expected %v rows, actual %v (count %v)", len(expected), len(actual), s.count())
+	}
+	for i := range expected {
+		if !actual[i].Equals(&expected[i]) {
+			t.Fatalf("rows are not in the order of insertion, expected %v, actual %v", expected, actual)
+		}
+	}
+	if s.CachedBlocks() > 2 {
+		t.Errorf("at most 2 blocks should be cached, actual %v", s.CachedBlocks())
+	}
+
+	name := s.file.Name()
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("the file of the store should be removed")
+	}
+}
+
+// a store whose file cannot be written fails, and the node reports it
+func TestDiskRowStoreFailure(t *testing.T) {
+	s, err := NewDiskRowStore(t.TempDir(), 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i := 0; i < 4; i++ {
+		if i == 2 {
+			s.file.Close()
+		}
+		s.insert(&Row{i})
+	}
+	if s.Err() == nil || s.count() != 3 {
+		t.Errorf("expected the store to fail at the second block, actual %v with %v rows", s.Err(), s.count())
+	}
+
+	n := NewNode("Node0")
+	n.dataDir = t.TempDir()
+	defer n.Close()
+	schema := TableSchema{TableName: "t", ColumnSchemas: []ColumnSchema{{Name: "id", DataType: TypeString},
+		{Name: "v", DataType: TypeInt32}}}
+	fullSchema := TableSchema{TableName: "t", ColumnSchemas: []ColumnSchema{{Name: "v", DataType: TypeInt32},
+		{Name: "id", DataType: TypeString}}}
+	reply := ""
+	n.RPCCreateTable(CreateTableArgs{Schema: schema, Predicate: Predicate{}, FullSchema: fullSchema,
+		Storage: TableStorage{Tier: TierDisk}}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot create a disk-backed table: %v", reply)
+	}
+	n.TableMap["t"].rowStore.(*DiskRowStore).file.Close()
+	rows := Dataset{Schema: schema}
+	for i := 0; i < defaultBlockRows; i++ {
+		rows.Rows = append(rows.Rows, Row{strconv.Itoa(i), i})
+	}
+	n.RPCAppendRows(AppendRowsArgs{Fragment: "t", Rows: rows}, &reply)
+	if !strings.HasPrefix(reply, "1 cannot write") {
+		t.Errorf("expected the write to fail, actual %v", reply)
+	}
+	dataset := Dataset{}
+	n.RPCScanFragment(ScanFragmentArgs{Fragment: "t", Limit: scanBatchSize}, &dataset)
+	if dataset.Schema.TableName != "" {
+		t.Errorf("a failed store should not be read, actual %v", dataset)
+	}
+}
+
+func TestDiskBackedTable(t *testing.T) {
+	setupLab3()
+	reply := ""
+	cli.Call("Cluster.SetDataDir", t.TempDir(), &reply)
+
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"2":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	storage := TableStorage{Tier: TierDisk, CacheBlocks: 1}
+	cli.Call("Cluster.BuildTable", []interface{}{courseRegistrationTableSchema, courseRegistrationTablePartitionRules,
+		"", storage}, &reply)
+	if reply[0] != '0' {
+		t.Fatalf("cannot build a disk-backed table: %v", reply)
+	}
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, studentTablePartitionRules}, &reply)
+	insertDataLab3(cli)
+
+	results := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows:   joinedTableContent,
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, results)
+	}
+}
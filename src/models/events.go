@@ -0,0 +1,179 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// enumeration of event types
+const (
+	// a node is back after a restart, see Cluster.RestartNode
+	EventNodeJoined = "NodeJoined"
+	// a node has crashed (see Cluster.RestartNode) or has been decommissioned (see Cluster.DecommissionNode)
+	EventNodeLeft = "NodeLeft"
+	// a replica of a fragment has been moved from a node to another, e.g., by Cluster.Rebalance
+	EventFragmentMoved = "FragmentMoved"
+	// a table has been built, see Cluster.BuildTable
+	EventTableCreated = "TableCreated"
+	// a table has been dropped, see Cluster.DropTable
+	EventTableDropped = "TableDropped"
+	// a query (Get, MultiGet, Scan or Join) has failed
+	EventQueryFailed = "QueryFailed"
+	// a standby has taken over the coordinator, see NewStandby
+	EventCoordinatorPromoted = "CoordinatorPromoted"
+)
+
+// eventHistory is how many of the latest events a coordinator keeps for Cluster.Events.
+const eventHistory = 1024
+
+// Event is something that happened in the lifecycle of a cluster. Only the fields relevant to the type are set.
+type Event struct {
+	// the events of a coordinator are numbered from 1 in the order they happened
+	Seq  int
+	Type string
+	// when the event happened, in Unix nanoseconds
+	Time int64
+	// the coordinator the event happened in
+	Coordinator string
+	// the node that joined or left
+	NodeId string
+	// the table created or dropped, the table of the fragment moved, or the tables of the query failed
+	Tables []string
+	// the fragment moved, from node From to node To
+	Fragment string
+	From     string
+	To       string
+	// the query that failed, e.g., "Scan", and why it failed if known
+	Query string
+	Error string
+}
+
+// eventBus delivers the events of a coordinator to its subscribers and keeps the latest ones.
+type eventBus struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	seq     int
+	// the latest events, at most eventHistory of them
+	history     []Event
+	subscribers map[*Subscription]bool
+}
+
+func newEventBus() *eventBus {
+	bus := &eventBus{subscribers: make(map[*Subscription]bool)}
+	bus.changed = sync.NewCond(&bus.mu)
+	return bus
+}
+
+// Subscription receives the events of the types it subscribed to through Events, in the order they happened. The
+// events are never waited for: those arriving while the channel is full are dropped, so that a slow subscriber does
+// not slow the cluster down, and counted by Dropped.
+type Subscription struct {
+	Events <-chan Event
+	events chan Event
+	// event type -> true, every type if empty
+	types   map[string]bool
+	dropped int
+	bus     *eventBus
+}
+
+// Subscribe subscribes to the events of the given types, or of every type if none is given, the events being buffered
+// up to buffer of them. Close must be called once the events are no longer read.
+func (c *Cluster) Subscribe(buffer int, types ...string) *Subscription {
+	s := &Subscription{events: make(chan Event, buffer), types: make(map[string]bool), bus: c.events}
+	s.Events = s.events
+	for _, t := range types {
+		s.types[t] = true
+	}
+	c.events.mu.Lock()
+	c.events.subscribers[s] = true
+	c.events.mu.Unlock()
+	return s
+}
+
+// Close stops the subscription and closes Events.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if s.bus.subscribers[s] {
+		delete(s.bus.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Dropped returns how many events have been dropped because Events was full.
+func (s *Subscription) Dropped() int {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.dropped
+}
+
+// publish numbers an event and delivers it to the subscribers.
+func (c *Cluster) publish(event Event) {
+	bus := c.events
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.seq++
+	event.Seq = bus.seq
+	event.Time = time.Now().UnixNano()
+	event.Coordinator = c.Name
+	bus.history = append(bus.history, event)
+	if len(bus.history) > eventHistory {
+		bus.history = bus.history[len(bus.history)-eventHistory:]
+	}
+	for s := range bus.subscribers {
+		if len(s.types) > 0 && !s.types[event.Type] {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+			s.dropped++
+		}
+	}
+	bus.changed.Broadcast()
+}
+
+// publishFailedQuery publishes an EventQueryFailed if the reply of a query tells it has failed, i.e., it has an error
+// or, for the queries other than Join whose results have no table name, an empty schema. It is deferred by the
+// queries before failRenamed, so that it runs after it.
+func (c *Cluster) publishFailedQuery(query string, reply *Dataset, tableNames ...string) {
+	if reply.Error != "" || (query != "Join" && reply.Schema.TableName == "") {
+		c.publish(Event{Type: EventQueryFailed, Query: query, Tables: tableNames, Error: reply.Error})
+	}
+}
+
+// Events sets reply to the events numbered after the given one that the coordinator still keeps (the latest
+// eventHistory events), waiting at most wait for one if there is none yet, so that the tools outside the process can
+// follow the events by long polling. The events of each coordinator are numbered on their own.
+// params: after int, (optional) wait time.Duration
+func (c *Cluster) Events(params []interface{}, reply *[]Event) {
+	after := params[0].(int)
+	var wait time.Duration
+	if len(params) > 1 {
+		wait = params[1].(time.Duration)
+	}
+
+	bus := c.events
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if bus.seq <= after && wait > 0 {
+		expired := false
+		timer := time.AfterFunc(wait, func() {
+			bus.mu.Lock()
+			expired = true
+			bus.changed.Broadcast()
+			bus.mu.Unlock()
+		})
+		for bus.seq <= after && !expired {
+			bus.changed.Wait()
+		}
+		timer.Stop()
+	}
+	events := make([]Event, 0)
+	for _, event := range bus.history {
+		if event.Seq > after {
+			events = append(events, event)
+		}
+	}
+	*reply = events
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event of the subscription, failing the test if none arrives in time.
+func nextEvent(t *testing.T, s *Subscription) Event {
+	select {
+	case event := <-s.Events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+		return Event{}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	setupLab3()
+	s := c.Subscribe(16)
+	defer s.Close()
+	defineDDLRules()
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+	for _, tableName := range []string{courseRegistrationTableName, studentTableName} {
+		if event := nextEvent(t, s); event.Type != EventTableCreated || event.Tables[0] != tableName {
+			t.Errorf("expected %v created, actual %v", tableName, event)
+		}
+	}
+
+	reply := ""
+	cli.Call("Cluster.RestartNode", "Node1", &reply)
+	if event := nextEvent(t, s); event.Type != EventNodeLeft || event.NodeId != "Node1" {
+		t.Errorf("expected Node1 to leave, actual %v", event)
+	}
+	if event := nextEvent(t, s); event.Type != EventNodeJoined || event.NodeId != "Node1" {
+		t.Errorf("expected Node1 to join, actual %v", event)
+	}
+
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{"unknown"}, &result)
+	if event := nextEvent(t, s); event.Type != EventQueryFailed || event.Query != "Scan" ||
+		event.Tables[0] != "unknown" {
+		t.Errorf("expected the scan to fail, actual %v", event)
+	}
+	// a row that does not exist is not a failure
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 7}, &result)
+	cli.Call("Cluster.DropTable", []interface{}{courseRegistrationTableName}, &reply)
+	if event := nextEvent(t, s); event.Type != EventTableDropped || event.Tables[0] != courseRegistrationTableName {
+		t.Errorf("expected %v dropped, actual %v", courseRegistrationTableName, event)
+	}
+
+	// the events are numbered in order, and kept for the tools polling them
+	events := make([]Event, 0)
+	cli.Call("Cluster.Events", []interface{}{0}, &events)
+	if len(events) != 6 {
+		t.Fatalf("expected 6 events, actual %v", events)
+	}
+	for i, event := range events {
+		if event.Seq != i+1 || event.Coordinator != c.Name {
+			t.Errorf("unexpected event %v", event)
+		}
+	}
+	cli.Call("Cluster.Events", []interface{}{events[3].Seq}, &events)
+	if len(events) != 2 || events[0].Type != EventQueryFailed {
+		t.Errorf("expected the last 2 events, actual %v", events)
+	}
+}
+
+// the subscriptions to some types receive only those
+func TestEventTypes(t *testing.T) {
+	setupDDL()
+	s := c.Subscribe(16, EventFragmentMoved, EventNodeLeft)
+	defer s.Close()
+	full := c.Subscribe(0)
+	defer full.Close()
+
+	reply := ""
+	cli.Call("Cluster.DecommissionNode", "Node0", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("DecommissionNode failed: %v", reply)
+	}
+	s.Close()
+	moved := 0
+	for event := range s.Events {
+		switch event.Type {
+		case EventFragmentMoved:
+			if event.From != "Node0" || event.To == "" || fragmentTable(event.Fragment) != event.Tables[0] {
+				t.Errorf("unexpected move %v", event)
+			}
+			moved++
+		case EventNodeLeft:
+			if event.NodeId != "Node0" || moved == 0 {
+				t.Errorf("expected Node0 to leave after its fragments moved, actual %v", event)
+			}
+		default:
+			t.Errorf("unexpected event %v", event)
+		}
+	}
+	if moved == 0 {
+		t.Errorf("expected the fragments of Node0 to move")
+	}
+	if full.Dropped() != moved+1 {
+		t.Errorf("expected %v events dropped, actual %v", moved+1, full.Dropped())
+	}
+}
+
+// Events waits for the next event if there is none yet
+func TestEventsLongPolling(t *testing.T) {
+	setupLab3()
+	events := make([]Event, 0)
+	start := time.Now()
+	cli.Call("Cluster.Events", []interface{}{0, 50 * time.Millisecond}, &events)
+	if len(events) != 0 || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("expected to wait for nothing, actual %v", events)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		defineDDLRules()
+		buildTablesLab3(cli)
+	}()
+	cli.Call("Cluster.Events", []interface{}{0, 5 * time.Second}, &events)
+	if len(events) == 0 || events[0].Type != EventTableCreated {
+		t.Errorf("expected a table created, actual %v", events)
+	}
+}
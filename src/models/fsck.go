@@ -0,0 +1,201 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// the kinds of Inconsistency found by Fsck
+const (
+	// a replica cannot be read
+	UnreadableReplica = "UnreadableReplica"
+	// the row should be in the fragment by its rule but is not
+	MissingFromFragment = "MissingFromFragment"
+	// the row is in the fragment but should not be by its rule
+	UnexpectedInFragment = "UnexpectedInFragment"
+	// the row is in the fragment more than once
+	DuplicateInFragment = "DuplicateInFragment"
+	// two fragments holding the same column of the row hold different values
+	ColumnConflict = "ColumnConflict"
+	// some columns of the row are not held by any fragment, so the rules cannot be checked for it
+	IncompleteRow = "IncompleteRow"
+	// a replica of the fragment differs from the first replica for the row
+	ReplicaMismatch = "ReplicaMismatch"
+	// the coordinator knows about the row but no fragment holds it
+	LostRow = "LostRow"
+	// a fragment holds a row the coordinator does not know about
+	UnknownRow = "UnknownRow"
+)
+
+// Inconsistency is something wrong with a row of a table found by Fsck.
+type Inconsistency struct {
+	// one of the kinds above, e.g., MissingFromFragment
+	Kind  string
+	RowId string
+	// the fragment and its replica which are wrong, empty if the inconsistency is not about one of them
+	Fragment string
+	NodeId   string
+	// what is wrong in words
+	Detail string
+}
+
+// FsckReport is what Fsck found in a table.
+type FsckReport struct {
+	TableName string
+	// the number of distinct row ids found in the fragments
+	Rows            int
+	Inconsistencies []Inconsistency
+	// why the table could not be checked, "" if it has been
+	Error string
+}
+
+// Fsck checks the consistency of the fragments of a table: every row must be held by exactly the fragments whose
+// rules it satisfies, the fragments holding the same column of a row must agree on its value, and every replica of a
+// fragment must hold the same rows as the first one. The inconsistencies found are reported in the order of the row
+// ids (those about no row first), so that they can be repaired, e.g., by removing a row from a fragment it should not
+// be in. Writes and migrations wait until the check finishes, so that it does not report the changes in progress.
+// params: tableName string
+func (c *Cluster) Fsck(tableName string, reply *FsckReport) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	schema, ok := c.catalog.Schema(tableName)
+	if !ok {
+		err := c.currentPlacement().renamedError(tableName)
+		if err == "" {
+			err = "No Such Table"
+		}
+		*reply = FsckReport{TableName: tableName, Error: err}
+		return
+	}
+	q := c.beginRawQuery(QueryHints{DisableCache: true})
+	defer c.endQuery(q)
+
+	report := FsckReport{TableName: tableName, Inconsistencies: make([]Inconsistency, 0)}
+	found := func(kind string, id string, fragment string, nodeId string, detail string) {
+		report.Inconsistencies = append(report.Inconsistencies, Inconsistency{Kind: kind, RowId: id,
+			Fragment: fragment, NodeId: nodeId, Detail: detail})
+	}
+
+	// row id -> column name -> value, from the first readable replica of each fragment
+	values := make(map[string]map[string]interface{})
+	// fragment -> the ids of the rows in its first readable replica, nil if no replica can be read
+	held := make(map[string]map[string]bool)
+	for _, fragment := range q.placement.Fragments(tableName) {
+		var first map[string]Row
+		var firstNode string
+		for _, nodeId := range q.placement.Replicas(fragment) {
+			dataset, ok := readFragment(c.nodeEnd(nodeId), fragment, nil)
+			if !ok {
+				found(UnreadableReplica, "", fragment, nodeId, "the replica cannot be read")
+				continue
+			}
+			rows := make(map[string]Row)
+			for _, row := range dataset.Rows {
+				id := row[0].(string)
+				if _, ok := rows[id]; ok {
+					found(DuplicateInFragment, id, fragment, nodeId, "the row is held more than once")
+				}
+				rows[id] = row
+			}
+			if first != nil {
+				compareReplicas(fragment, firstNode, first, nodeId, rows, found)
+				continue
+			}
+			first, firstNode = rows, nodeId
+			held[fragment] = make(map[string]bool)
+			for id, row := range rows {
+				held[fragment][id] = true
+				if _, ok := values[id]; !ok {
+					values[id] = make(map[string]interface{})
+				}
+				for j, cs := range dataset.Schema.ColumnSchemas[1:] {
+					if value, ok := values[id][cs.Name]; ok && value != row[j+1] {
+						found(ColumnConflict, id, fragment, nodeId,
+							fmt.Sprintf("%v is %v here but %v in another fragment", cs.Name, row[j+1], value))
+						continue
+					}
+					values[id][cs.Name] = row[j+1]
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		row := make(Row, 0, len(schema.ColumnSchemas))
+		for _, cs := range schema.ColumnSchemas {
+			if value, ok := values[id][cs.Name]; ok {
+				row = append(row, value)
+			}
+		}
+		if len(row) != len(schema.ColumnSchemas) {
+			found(IncompleteRow, id, "", "", fmt.Sprintf("only %v of %v columns are held", len(row),
+				len(schema.ColumnSchemas)))
+			continue
+		}
+		for _, fragment := range q.placement.Fragments(tableName) {
+			if held[fragment] == nil {
+				continue
+			}
+			expected := admitsRow(q.placement.Rule(fragment).Predicate, row, schema)
+			if expected && !held[fragment][id] {
+				found(MissingFromFragment, id, fragment, "", "the row satisfies the rule of the fragment")
+			} else if !expected && held[fragment][id] {
+				found(UnexpectedInFragment, id, fragment, "", "the row does not satisfy the rule of the fragment")
+			}
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, id := range c.catalog.Ids(tableName) {
+		known[id] = true
+		if _, ok := values[id]; !ok {
+			found(LostRow, id, "", "", "no fragment holds the row")
+		}
+	}
+	for _, id := range ids {
+		if !known[id] {
+			found(UnknownRow, id, "", "", "the coordinator does not know about the row")
+		}
+	}
+	sort.SliceStable(report.Inconsistencies, func(i, j int) bool {
+		return report.Inconsistencies[i].RowId < report.Inconsistencies[j].RowId
+	})
+	report.Rows = len(ids)
+	*reply = report
+}
+
+// compareReplicas reports the rows which differ between the first replica of a fragment and another one.
+func compareReplicas(fragment string, firstNode string, first map[string]Row, nodeId string, rows map[string]Row,
+	found func(kind string, id string, fragment string, nodeId string, detail string)) {
+	ids := make([]string, 0, len(first)+len(rows))
+	for id := range first {
+		ids = append(ids, id)
+	}
+	for id := range rows {
+		if _, ok := first[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		expected, inFirst := first[id]
+		actual, inReplica := rows[id]
+		switch {
+		case !inReplica:
+			found(ReplicaMismatch, id, fragment, nodeId, "the row is missing but held by "+firstNode)
+		case !inFirst:
+			found(ReplicaMismatch, id, fragment, nodeId, "the row is not held by "+firstNode)
+		case !expected.Equals(&actual):
+			found(ReplicaMismatch, id, fragment, nodeId, fmt.Sprintf("the row is %v here but %v on %v", actual,
+				expected, firstNode))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// fsckKinds returns the kinds of the inconsistencies of each row id in the report.
+func fsckKinds(report FsckReport) map[string]map[string]bool {
+	kinds := make(map[string]map[string]bool)
+	for _, inconsistency := range report.Inconsistencies {
+		if kinds[inconsistency.RowId] == nil {
+			kinds[inconsistency.RowId] = make(map[string]bool)
+		}
+		kinds[inconsistency.RowId][inconsistency.Kind] = true
+	}
+	return kinds
+}
+
+func TestFsck(t *testing.T) {
+	setupDDL()
+	report := FsckReport{}
+	cli.Call("Cluster.Fsck", studentTableName, &report)
+	if report.Error != "" || report.Rows != len(studentRows) || len(report.Inconsistencies) != 0 {
+		t.Fatalf("expected a consistent table, actual %v", report)
+	}
+
+	// the fragment with grade <= 3.6 is held by Node0 and Node1, the other one by Node2 and Node3
+	definition := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", studentTableName, &definition)
+	low, high := definition.Fragments[0].Fragment, definition.Fragments[1].Fragment
+	if definition.Fragments[0].Nodes[0] != "Node0" {
+		low, high = high, low
+	}
+	// a row only on one replica, and a row in both replicas of the wrong fragment
+	c.nodes["Node0"].Insert(low, &Row{"only-node0", 5, "Eve", 20, 3.0})
+	c.nodes["Node2"].Insert(high, &Row{"wrong-fragment", 6, "Tom", 20, 3.0})
+	c.nodes["Node3"].Insert(high, &Row{"wrong-fragment", 6, "Tom", 20, 3.0})
+
+	report = FsckReport{}
+	cli.Call("Cluster.Fsck", studentTableName, &report)
+	kinds := fsckKinds(report)
+	if !kinds["only-node0"][ReplicaMismatch] || !kinds["only-node0"][UnknownRow] || len(kinds["only-node0"]) != 2 {
+		t.Errorf("expected a replica mismatch of only-node0, actual %v", report.Inconsistencies)
+	}
+	if !kinds["wrong-fragment"][UnexpectedInFragment] || !kinds["wrong-fragment"][MissingFromFragment] ||
+		!kinds["wrong-fragment"][UnknownRow] || len(kinds["wrong-fragment"]) != 3 {
+		t.Errorf("expected wrong-fragment to be in the wrong fragment, actual %v", report.Inconsistencies)
+	}
+	if report.Rows != len(studentRows)+2 || len(kinds) != 2 {
+		t.Errorf("unexpected report %v", report)
+	}
+	for i := 1; i < len(report.Inconsistencies); i++ {
+		if report.Inconsistencies[i-1].RowId > report.Inconsistencies[i].RowId {
+			t.Errorf("the inconsistencies are not ordered by row ids: %v", report.Inconsistencies)
+		}
+	}
+
+	report = FsckReport{}
+	cli.Call("Cluster.Fsck", "unknown", &report)
+	if report.Error != "No Such Table" {
+		t.Errorf("an unknown table should not be checked, actual %v", report)
+	}
+}
+
+// the vertical fragments of a row disagree on a column they share
+func TestFsckVerticalFragments(t *testing.T) {
+	setupLab3()
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0": rangeFragment("sid", ">=", 0, "sid", "name"),
+		"1": rangeFragment("sid", ">=", 0, "sid", "age", "grade"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules}, &reply)
+	for _, row := range studentRows {
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, row}, &reply)
+	}
+	definition := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", studentTableName, &definition)
+	names, ages := definition.Fragments[0].Fragment, definition.Fragments[1].Fragment
+	if definition.Fragments[0].Nodes[0] != "Node0" {
+		names, ages = ages, names
+	}
+	c.nodes["Node0"].Insert(names, &Row{"conflict", 5, "Eve"})
+	c.nodes["Node1"].Insert(ages, &Row{"conflict", 6, 20, 3.0})
+	c.nodes["Node0"].Insert(names, &Row{"incomplete", 7, "Tom"})
+
+	report := FsckReport{}
+	cli.Call("Cluster.Fsck", studentTableName, &report)
+	kinds := fsckKinds(report)
+	if !kinds["conflict"][ColumnConflict] || !kinds["incomplete"][IncompleteRow] || len(kinds) != 2 {
+		t.Errorf("unexpected inconsistencies %v", report.Inconsistencies)
+	}
+}
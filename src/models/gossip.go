@@ -0,0 +1,363 @@
+package models
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"../labrpc"
+)
+
+// a node is suspected to be down if its heartbeat has not increased for this many gossip intervals
+const suspectIntervals = 10
+
+// CoordinatorMetadata is the metadata of the tables of a coordinator published to the nodes, see Cluster.StartGossip.
+type CoordinatorMetadata struct {
+	Coordinator string
+	// the epoch of the placement the metadata was taken from, the metadata of a larger epoch replaces the rest
+	Epoch int
+	// the logical schema and the primary key column (if any) of each table
+	Schemas map[string]TableSchema
+	Keys    map[string]string
+	// the fragments of the tables, see Placement
+	FragmentNodes map[string][]string
+	FragmentRules map[string]Rule
+	// the read-only tables, "" standing for the whole cluster, see Cluster.SetReadOnly
+	ReadOnly map[string]bool
+	// the masked columns of the tables, see Cluster.MaskColumn
+	Masks map[string]map[string]ColumnMask
+}
+
+// GossipState is what the nodes gossip among themselves: the latest metadata of each coordinator, and the heartbeat of
+// each node. The heartbeat of a node is increased by the node itself each time it answers a gossip, so it stops
+// increasing once the node cannot be reached, even if the node can still send its own gossips.
+type GossipState struct {
+	Metadata   map[string]CoordinatorMetadata
+	Heartbeats map[string]Heartbeat
+}
+
+// Heartbeat counts the gossips a node has answered since it started, the node starting at a larger Incarnation each
+// time it restarts so that its heartbeats are newer than those it sent before.
+type Heartbeat struct {
+	Incarnation int64
+	Count       int
+}
+
+// newerThan tells whether the heartbeat is newer than another one of the same node.
+func (h Heartbeat) newerThan(other Heartbeat) bool {
+	return h.Incarnation > other.Incarnation || (h.Incarnation == other.Incarnation && h.Count > other.Count)
+}
+
+// GossipConfig tells a node whom to gossip with and how often, see Node.RPCStartGossip.
+type GossipConfig struct {
+	Peers    []string
+	Interval time.Duration
+}
+
+// KeyLocation tells where a row of a table may live, see Node.RPCLocate. An empty TableName means the table is not
+// known to the node.
+type KeyLocation struct {
+	TableName string
+	// the fragments that may hold the row -> the nodes holding a replica of the fragment that are believed to be up
+	Fragments map[string][]string
+}
+
+// gossiper is the gossip state of a node.
+type gossiper struct {
+	mu    sync.Mutex
+	state GossipState
+	// the incarnation of the heartbeats of the node, see Heartbeat
+	incarnation int64
+	// node id -> when its heartbeat last increased
+	lastSeen map[string]time.Time
+	// the network the node sends its gossips through, set by the cluster creating the node
+	network  *labrpc.Network
+	peers    []string
+	interval time.Duration
+	// closed to stop the gossiping, nil if the node is not gossiping
+	stop chan struct{}
+}
+
+func newGossiper() *gossiper {
+	return &gossiper{state: GossipState{Metadata: make(map[string]CoordinatorMetadata),
+		Heartbeats: make(map[string]Heartbeat)}, incarnation: time.Now().UnixNano(), lastSeen: make(map[string]time.Time)}
+}
+
+// snapshot copies the state so that it can be sent while the gossiper keeps merging, the metadata being replaced
+// instead of modified once merged. The caller must hold mu.
+func (g *gossiper) snapshot() GossipState {
+	state := GossipState{Metadata: make(map[string]CoordinatorMetadata, len(g.state.Metadata)),
+		Heartbeats: make(map[string]Heartbeat, len(g.state.Heartbeats))}
+	for coordinator, metadata := range g.state.Metadata {
+		state.Metadata[coordinator] = metadata
+	}
+	for nodeId, heartbeat := range g.state.Heartbeats {
+		state.Heartbeats[nodeId] = heartbeat
+	}
+	return state
+}
+
+// merge keeps the newer metadata and heartbeats of both states. The caller must hold mu.
+func (g *gossiper) merge(state GossipState) {
+	for coordinator, metadata := range state.Metadata {
+		if current, ok := g.state.Metadata[coordinator]; !ok || metadata.Epoch > current.Epoch {
+			g.state.Metadata[coordinator] = metadata
+		}
+	}
+	now := time.Now()
+	for nodeId, heartbeat := range state.Heartbeats {
+		if current, ok := g.state.Heartbeats[nodeId]; !ok || heartbeat.newerThan(current) {
+			g.state.Heartbeats[nodeId] = heartbeat
+			g.lastSeen[nodeId] = now
+		}
+	}
+}
+
+// alive tells whether the node is believed to be up. Every node is believed to be up until the gossiping starts.
+// The caller must hold mu.
+func (g *gossiper) alive(self string, nodeId string) bool {
+	if nodeId == self || g.interval <= 0 {
+		return true
+	}
+	seen, ok := g.lastSeen[nodeId]
+	return ok && time.Since(seen) < suspectIntervals*g.interval
+}
+
+// RPCStartGossip makes this node gossip with a random peer every interval, or changes the peers and the interval if
+// the node is gossiping already.
+func (n *Node) RPCStartGossip(config GossipConfig, reply *string) {
+	defer n.admit()()
+	g := n.gossip
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.peers = make([]string, 0, len(config.Peers))
+	for _, peer := range config.Peers {
+		if peer != n.Identifier {
+			g.peers = append(g.peers, peer)
+		}
+	}
+	if g.stop != nil {
+		close(g.stop)
+	}
+	g.interval = config.Interval
+	g.stop = make(chan struct{})
+	go n.gossipLoop(g.stop, config.Interval)
+	*reply = "0 OK"
+}
+
+// RPCStopGossip stops this node gossiping.
+func (n *Node) RPCStopGossip(args interface{}, reply *string) {
+	defer n.admit()()
+	n.stopGossip()
+	*reply = "0 OK"
+}
+
+func (n *Node) stopGossip() {
+	g := n.gossip
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stop != nil {
+		close(g.stop)
+		g.stop = nil
+	}
+}
+
+func (n *Node) gossipLoop(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// a peer that is down may take long to time out, which should not delay the next rounds
+			go n.gossipOnce()
+		}
+	}
+}
+
+// gossipOnce exchanges the gossip state with a random peer.
+func (n *Node) gossipOnce() {
+	g := n.gossip
+	g.mu.Lock()
+	if len(g.peers) == 0 || g.network == nil {
+		g.mu.Unlock()
+		return
+	}
+	peer := g.peers[rand.Intn(len(g.peers))]
+	state := g.snapshot()
+	g.mu.Unlock()
+
+	endName := "Gossip" + n.Identifier + "->" + peer
+	end := g.network.MakeEnd(endName)
+	g.network.Connect(endName, peer)
+	g.network.Enable(endName, true)
+	reply := GossipState{}
+	if end.Call("Node.RPCGossip", state, &reply) {
+		g.mu.Lock()
+		g.merge(reply)
+		g.mu.Unlock()
+	}
+}
+
+// RPCGossip merges the gossip state of a peer into the state of this node, and replies the merged state.
+func (n *Node) RPCGossip(state GossipState, reply *GossipState) {
+	defer n.admit()()
+	g := n.gossip
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	heartbeat := g.state.Heartbeats[n.Identifier]
+	if heartbeat.Incarnation != g.incarnation {
+		heartbeat = Heartbeat{Incarnation: g.incarnation}
+	}
+	heartbeat.Count++
+	g.state.Heartbeats[n.Identifier] = heartbeat
+	g.lastSeen[n.Identifier] = time.Now()
+	g.merge(state)
+	*reply = g.snapshot()
+}
+
+// RPCPublishMetadata gives this node the metadata of a coordinator, which it then gossips to the other nodes.
+func (n *Node) RPCPublishMetadata(metadata CoordinatorMetadata, reply *string) {
+	defer n.admit()()
+	g := n.gossip
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.merge(GossipState{Metadata: map[string]CoordinatorMetadata{metadata.Coordinator: metadata}})
+	*reply = "0 OK"
+}
+
+// RPCLiveNodes replies the nodes this node believes to be up, in the order of their names.
+func (n *Node) RPCLiveNodes(args interface{}, reply *[]string) {
+	defer n.admit()()
+	g := n.gossip
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	nodeIds := []string{n.Identifier}
+	for nodeId := range g.state.Heartbeats {
+		if nodeId != n.Identifier && g.alive(n.Identifier, nodeId) {
+			nodeIds = append(nodeIds, nodeId)
+		}
+	}
+	sort.Strings(nodeIds)
+	*reply = nodeIds
+}
+
+// RPCLocate tells where the row of a table with the given primary key (or row id if the table has no primary key)
+// may live, by the metadata this node has learned from the gossips: the fragments whose predicates admit the key, and
+// the replicas of them on the nodes believed to be up. Any node can answer, whether it holds the table or not.
+func (n *Node) RPCLocate(args LocateArgs, reply *KeyLocation) {
+	defer n.admit()()
+	tableName := args.TableName
+	key := args.Key
+	g := n.gossip
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	*reply = KeyLocation{}
+	for _, metadata := range g.state.Metadata {
+		schema, ok := metadata.Schemas[tableName]
+		if !ok {
+			continue
+		}
+		keyColumn := metadata.Keys[tableName]
+		location := KeyLocation{TableName: tableName, Fragments: make(map[string][]string)}
+		for fragment, rule := range metadata.FragmentRules {
+			if fragmentTable(fragment) != tableName || !admitsKey(rule.Predicate, keyColumn, key, schema) {
+				continue
+			}
+			nodeIds := make([]string, 0)
+			for _, nodeId := range metadata.FragmentNodes[fragment] {
+				if g.alive(n.Identifier, nodeId) {
+					nodeIds = append(nodeIds, nodeId)
+				}
+			}
+			location.Fragments[fragment] = nodeIds
+		}
+		*reply = location
+		return
+	}
+}
+
+// admitsKey tells whether a row whose key column has the value may satisfy the predicate, the other columns being
+// unknown. Every row may satisfy it if there is no key column.
+func admitsKey(predicate Predicate, keyColumn string, value interface{}, schema TableSchema) bool {
+	atoms, ok := predicate[keyColumn]
+	if keyColumn == "" || !ok {
+		return true
+	}
+	typed := Predicate{keyColumn: append([]Atom(nil), atoms...)}
+	if typePredicate(typed, schema) != "" {
+		return true
+	}
+	for _, atom := range typed[keyColumn] {
+		if !atom.Check(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// StartGossip makes the nodes gossip the metadata of the tables of this coordinator and their liveness among
+// themselves every interval, so that any node can tell where a key lives, see Node.RPCLocate. The metadata is
+// published to one of the nodes now and each time the placement changes.
+func (c *Cluster) StartGossip(interval time.Duration, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if interval <= 0 {
+		*reply = "1 interval must be positive"
+		return
+	}
+	c.gossipInterval = interval
+	for _, nodeId := range c.nodeIds {
+		msg := ""
+		c.nodeEnd(nodeId).Call("Node.RPCStartGossip", GossipConfig{Peers: c.nodeIds, Interval: interval}, &msg)
+	}
+	c.publishMetadata(c.currentPlacement())
+	*reply = "0 OK"
+}
+
+// StopGossip makes the nodes stop gossiping.
+func (c *Cluster) StopGossip(args interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.gossipInterval = 0
+	for _, nodeId := range c.nodeIds {
+		msg := ""
+		c.nodeEnd(nodeId).Call("Node.RPCStopGossip", "", &msg)
+	}
+	*reply = "0 OK"
+}
+
+// metadata collects the metadata of the tables in the placement. The caller must hold writeMu.
+func (c *Cluster) metadata(p *Placement) CoordinatorMetadata {
+	metadata := CoordinatorMetadata{Coordinator: c.Name, Epoch: p.Epoch, Schemas: make(map[string]TableSchema),
+		Keys: make(map[string]string), FragmentNodes: p.FragmentNodes, FragmentRules: p.FragmentRules,
+		ReadOnly: p.ReadOnly, Masks: p.Masks}
+	for fragment := range p.FragmentRules {
+		tableName := fragmentTable(fragment)
+		metadata.Schemas[tableName], _ = c.catalog.Schema(tableName)
+		if key, ok := c.catalog.Key(tableName); ok {
+			metadata.Keys[tableName] = key
+		}
+	}
+	return metadata
+}
+
+// publishMetadata sends the metadata of the tables in the placement to the first node that accepts it, the nodes
+// taking turns. The caller must hold writeMu.
+func (c *Cluster) publishMetadata(p *Placement) {
+	metadata := c.metadata(p)
+	for i := range c.nodeIds {
+		nodeId := c.nodeIds[(c.publishTurn+i)%len(c.nodeIds)]
+		msg := ""
+		if c.nodeEnd(nodeId).Call("Node.RPCPublishMetadata", metadata, &msg) && msg == "0 OK" {
+			break
+		}
+	}
+	c.publishTurn++
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// eventually waits until cond holds, failing the test if it does not hold within a few seconds.
+func eventually(t *testing.T, cond func() bool, format string, args ...interface{}) {
+	for start := time.Now(); time.Since(start) < 3*time.Second; time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf(format, args...)
+}
+
+// locate asks a node where the row of a table with the key lives.
+func locate(nodeId string, tableName string, key interface{}) KeyLocation {
+	location := KeyLocation{}
+	end := network.MakeEnd("ClientA" + nodeId)
+	network.Connect("ClientA"+nodeId, nodeId)
+	network.Enable("ClientA"+nodeId, true)
+	end.Call("Node.RPCLocate", LocateArgs{TableName: tableName, Key: key}, &location)
+	return location
+}
+
+// replicasOf returns the replicas in a location if it has a single fragment, nil otherwise.
+func replicasOf(location KeyLocation) []string {
+	if len(location.Fragments) != 1 {
+		return nil
+	}
+	for _, nodeIds := range location.Fragments {
+		return nodeIds
+	}
+	return nil
+}
+
+func TestGossip(t *testing.T) {
+	setupLab3()
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("sid", "<=", 1, "sid", "name", "age", "grade"),
+		"2":   rangeFragment("sid", ">", 1, "sid", "name", "age", "grade"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules, "sid"}, &reply)
+	cli.Call("Cluster.StartGossip", 10*time.Millisecond, &reply)
+	defer cli.Call("Cluster.StopGossip", "", new(string))
+	if reply != "0 OK" {
+		t.Fatalf("cannot start gossiping: %v", reply)
+	}
+
+	// node4 holds no fragment but learns where the keys live
+	eventually(t, func() bool {
+		return reflect.DeepEqual(replicasOf(locate("Node4", studentTableName, 2)), []string{"Node2"})
+	}, "node4 should locate key 2 on node2, actual %v", locate("Node4", studentTableName, 2))
+	eventually(t, func() bool {
+		return reflect.DeepEqual(replicasOf(locate("Node4", studentTableName, 0)), []string{"Node0", "Node1"})
+	}, "node4 should locate key 0 on node0 and node1, actual %v", locate("Node4", studentTableName, 0))
+	if location := locate("Node4", courseRegistrationTableName, 0); location.TableName != "" {
+		t.Errorf("an unknown table should not be located, actual %v", location)
+	}
+
+	// tables built later are gossiped too
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	cli.Call("Cluster.BuildTable", []interface{}{courseRegistrationTableSchema,
+		courseRegistrationTablePartitionRules}, &reply)
+	eventually(t, func() bool {
+		return len(locate("Node3", courseRegistrationTableName, "id").Fragments) == 1
+	}, "node3 should locate courseRegistration, actual %v", locate("Node3", courseRegistrationTableName, "id"))
+}
+
+func TestGossipLiveness(t *testing.T) {
+	setupLab3()
+	rules, _ := json.Marshal(map[string]interface{}{
+		"1|2": rangeFragment("sid", ">=", 0, "sid", "name", "age", "grade"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules, "sid"}, &reply)
+	cli.Call("Cluster.StartGossip", 10*time.Millisecond, &reply)
+	defer cli.Call("Cluster.StopGossip", "", new(string))
+
+	liveNodes := func(nodeId string) []string {
+		nodeIds := make([]string, 0)
+		end := network.MakeEnd("ClientA" + nodeId)
+		network.Connect("ClientA"+nodeId, nodeId)
+		network.Enable("ClientA"+nodeId, true)
+		end.Call("Node.RPCLiveNodes", "", &nodeIds)
+		return nodeIds
+	}
+	all := []string{"Node0", "Node1", "Node2", "Node3", "Node4"}
+	eventually(t, func() bool { return reflect.DeepEqual(liveNodes("Node0"), all) },
+		"node0 should see every node up, actual %v", liveNodes("Node0"))
+
+	// node1 cannot be reached, though it keeps sending gossips
+	network.DeleteServer("Node1")
+	eventually(t, func() bool {
+		return reflect.DeepEqual(liveNodes("Node0"), []string{"Node0", "Node2", "Node3", "Node4"})
+	}, "node0 should suspect node1, actual %v", liveNodes("Node0"))
+	if replicas := replicasOf(locate("Node0", studentTableName, 2)); !reflect.DeepEqual(replicas, []string{"Node2"}) {
+		t.Errorf("only node2 should be located, actual %v", replicas)
+	}
+
+	cli.Call("Cluster.RestartNode", "Node1", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot restart node1: %v", reply)
+	}
+	eventually(t, func() bool { return reflect.DeepEqual(liveNodes("Node3"), all) },
+		"node3 should see node1 up again, actual %v", liveNodes("Node3"))
+	eventually(t, func() bool { return len(locate("Node1", studentTableName, 2).Fragments) == 1 },
+		"the restarted node1 should learn the metadata again")
+}
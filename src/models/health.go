@@ -0,0 +1,230 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// the severities of the findings of HealthCheck, from the most severe
+const (
+	// the results of the queries cannot be trusted, e.g., a node cannot be reached or a replica is missing
+	HealthCritical = "Critical"
+	// the results can be trusted, but something needs looking at, e.g., a replica lags behind the others
+	HealthWarning = "Warning"
+	// for the record only
+	HealthInfo = "Info"
+)
+
+// the checks of HealthCheck
+const (
+	// every node answers
+	CheckPing = "Ping"
+	// every node answers quickly
+	CheckRoundTrip = "RoundTrip"
+	// no node signals that it is overloaded, see NodeLoad
+	CheckLoad = "Load"
+	// the nodes hold the fragments of the tables in the catalog where the placement says, with their columns
+	CheckCatalog = "Catalog"
+	// the replicas of each fragment hold as many rows
+	CheckReplicaLag = "ReplicaLag"
+)
+
+// slowRoundTrip is how long a node may take to answer a ping before HealthCheck warns about it.
+const slowRoundTrip = 50 * time.Millisecond
+
+// HealthFinding is something HealthCheck has found.
+type HealthFinding struct {
+	// one of the severities above
+	Severity string
+	// one of the checks above
+	Check string
+	// the node and the fragment the finding is about, empty if it is not about one of them
+	NodeId   string
+	Fragment string
+	// what has been found in words
+	Detail string
+}
+
+// NodeHealth is the state of a node as seen by HealthCheck.
+type NodeHealth struct {
+	NodeId    string
+	Reachable bool
+	// how long the node took to answer the ping, zero if it did not
+	RoundTrip time.Duration
+	Load      NodeLoad
+	// how many fragments the node holds
+	Fragments int
+}
+
+// HealthReport is what HealthCheck found.
+type HealthReport struct {
+	// whether nothing critical has been found
+	Healthy bool
+	// the nodes in the order of their ids
+	Nodes []NodeHealth
+	// the findings, the most severe first, then by check, node and fragment
+	Findings []HealthFinding
+}
+
+// FragmentInfo describes a fragment held by a node, see Node.RPCListFragments.
+type FragmentInfo struct {
+	Name string
+	// the columns of the fragment without its id column
+	Columns []string
+	// how many rows the fragment stores, including those soft-deleted
+	Rows int
+}
+
+// RPCListFragments replies the fragments held by this node in the order of their names.
+func (n *Node) RPCListFragments(args interface{}, reply *[]FragmentInfo) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fragments := make([]FragmentInfo, 0, len(n.TableMap))
+	for name, t := range n.TableMap {
+		columns := make([]string, 0, len(t.schema.ColumnSchemas))
+		for _, cs := range t.schema.ColumnSchemas[1:] {
+			columns = append(columns, cs.Name)
+		}
+		fragments = append(fragments, FragmentInfo{Name: name, Columns: columns, Rows: t.Count()})
+	}
+	sort.Slice(fragments, func(i, j int) bool { return fragments[i].Name < fragments[j].Name })
+	*reply = fragments
+}
+
+// HealthCheck diagnoses the cluster: it pings every node and measures how long it takes to answer, then checks that
+// the nodes hold the fragments of the tables in the catalog where the placement says with the columns of their rules,
+// and that the replicas of each fragment hold as many rows, a replica holding fewer lagging behind. It is the call to
+// make before trusting the results of the queries, which cannot be trusted if the report is not Healthy. Writes and
+// migrations wait until the check finishes, so that it does not report the changes in progress.
+func (c *Cluster) HealthCheck(args interface{}, reply *HealthReport) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	report := HealthReport{Nodes: make([]NodeHealth, 0, len(c.nodeIds)), Findings: make([]HealthFinding, 0)}
+	found := func(severity string, check string, nodeId string, fragment string, detail string) {
+		report.Findings = append(report.Findings, HealthFinding{Severity: severity, Check: check, NodeId: nodeId,
+			Fragment: fragment, Detail: detail})
+	}
+
+	// node id -> fragment -> what the node holds, absent if the node cannot be reached
+	held := make(map[string]map[string]FragmentInfo)
+	for _, nodeId := range c.nodeIds {
+		health := NodeHealth{NodeId: nodeId}
+		// the ping does not wait for the rate limit of the node, so that it measures the node only
+		nc := c.nodeEnd(nodeId)
+		start := time.Now()
+		load := NodeLoad{}
+		if !nc.end.CallCodec(nc.codec, "Node.RPCLoad", "", &load) {
+			found(HealthCritical, CheckPing, nodeId, "", "the node does not answer")
+			report.Nodes = append(report.Nodes, health)
+			continue
+		}
+		health.Reachable, health.RoundTrip, health.Load = true, time.Since(start), load
+		if health.RoundTrip > slowRoundTrip {
+			found(HealthWarning, CheckRoundTrip, nodeId, "", fmt.Sprintf("the node took %v to answer",
+				health.RoundTrip))
+		}
+		if load.Overloaded {
+			found(HealthWarning, CheckLoad, nodeId, "", fmt.Sprintf("the node is overloaded with %v RPCs queued "+
+				"and %v rows stored", load.Queued, load.StoredRows))
+		}
+		fragments := make([]FragmentInfo, 0)
+		if !nc.end.CallCodec(nc.codec, "Node.RPCListFragments", "", &fragments) {
+			found(HealthCritical, CheckPing, nodeId, "", "the node does not list its fragments")
+			report.Nodes = append(report.Nodes, health)
+			continue
+		}
+		health.Fragments = len(fragments)
+		held[nodeId] = make(map[string]FragmentInfo, len(fragments))
+		for _, fragment := range fragments {
+			held[nodeId][fragment.Name] = fragment
+		}
+		report.Nodes = append(report.Nodes, health)
+	}
+
+	placement := c.currentPlacement()
+	catalog := c.catalog.Snapshot()
+	placed := make(map[string]map[string]bool)
+	for _, tableName := range catalog.TableNames() {
+		for _, fragment := range placement.Fragments(tableName) {
+			placed[fragment] = make(map[string]bool)
+			rule := placement.Rule(fragment)
+			// the most rows held by a replica, and by which
+			most, mostNode := -1, ""
+			for _, nodeId := range placement.Replicas(fragment) {
+				placed[fragment][nodeId] = true
+				fragments, reachable := held[nodeId]
+				if !reachable {
+					continue
+				}
+				info, ok := fragments[fragment]
+				if !ok {
+					found(HealthCritical, CheckCatalog, nodeId, fragment, "the replica is missing")
+					continue
+				}
+				if !sameColumns(info.Columns, rule.Column) {
+					found(HealthCritical, CheckCatalog, nodeId, fragment, fmt.Sprintf("the replica holds %v "+
+						"instead of %v", info.Columns, rule.Column))
+				}
+				if info.Rows > most {
+					most, mostNode = info.Rows, nodeId
+				}
+			}
+			for _, nodeId := range placement.Replicas(fragment) {
+				if info, ok := held[nodeId][fragment]; ok && info.Rows < most {
+					found(HealthWarning, CheckReplicaLag, nodeId, fragment, fmt.Sprintf("the replica is %v rows "+
+						"behind %v", most-info.Rows, mostNode))
+				}
+			}
+		}
+	}
+	for _, nodeId := range c.nodeIds {
+		for fragment := range held[nodeId] {
+			if placed[fragment] == nil {
+				found(HealthWarning, CheckCatalog, nodeId, fragment, "the fragment is of no table in the catalog")
+			} else if !placed[fragment][nodeId] {
+				found(HealthInfo, CheckCatalog, nodeId, fragment, "the node still holds a replica retired by the "+
+					"placement")
+			}
+		}
+	}
+
+	rank := map[string]int{HealthCritical: 0, HealthWarning: 1, HealthInfo: 2}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.Severity != b.Severity {
+			return rank[a.Severity] < rank[b.Severity]
+		}
+		if a.Check != b.Check {
+			return a.Check < b.Check
+		}
+		if a.NodeId != b.NodeId {
+			return a.NodeId < b.NodeId
+		}
+		return a.Fragment < b.Fragment
+	})
+	report.Healthy = len(report.Findings) == 0 || report.Findings[0].Severity != HealthCritical
+	*reply = report
+}
+
+// sameColumns tells whether two lists hold the same columns in any order.
+func sameColumns(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	columns := make(map[string]bool, len(a))
+	for _, column := range a {
+		columns[column] = true
+	}
+	for _, column := range b {
+		if !columns[column] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"testing"
+)
+
+// findings returns the findings of a report of the given check.
+func findings(report HealthReport, check string) []HealthFinding {
+	result := make([]HealthFinding, 0)
+	for _, finding := range report.Findings {
+		if finding.Check == check {
+			result = append(result, finding)
+		}
+	}
+	return result
+}
+
+func TestHealthCheck(t *testing.T) {
+	setupSoftDelete(0)
+	report := HealthReport{}
+	cli.Call("Cluster.HealthCheck", "", &report)
+	if !report.Healthy || len(report.Findings) != 0 || len(report.Nodes) != 5 {
+		t.Fatalf("expected a healthy cluster, actual %v", report)
+	}
+	for _, node := range report.Nodes {
+		if !node.Reachable || node.RoundTrip <= 0 {
+			t.Errorf("expected %v to answer, actual %v", node.NodeId, node)
+		}
+	}
+	if report.Nodes[2].Fragments != 1 || report.Nodes[4].Fragments != 0 {
+		t.Errorf("expected node2 to hold a fragment and node4 none, actual %v", report.Nodes)
+	}
+
+	// a row missing from the replica of Smith on node1
+	n := c.nodes["Node1"]
+	n.mu.Lock()
+	for _, t := range n.TableMap {
+		if iterator := t.RowIterator(); iterator.HasNext() {
+			t.Remove(iterator.Next())
+		}
+	}
+	n.mu.Unlock()
+	report = HealthReport{}
+	cli.Call("Cluster.HealthCheck", "", &report)
+	if lag := findings(report, CheckReplicaLag); !report.Healthy || len(lag) != 1 || lag[0].NodeId != "Node1" ||
+		lag[0].Severity != HealthWarning {
+		t.Errorf("expected node1 to lag behind, actual %v", report)
+	}
+
+	network.DeleteServer("Node3")
+	report = HealthReport{}
+	cli.Call("Cluster.HealthCheck", "", &report)
+	if ping := findings(report, CheckPing); report.Healthy || len(ping) != 1 || ping[0].NodeId != "Node3" ||
+		report.Findings[0].Severity != HealthCritical || report.Nodes[3].Reachable {
+		t.Errorf("expected node3 not to answer, actual %v", report)
+	}
+}
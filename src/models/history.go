@@ -0,0 +1,180 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// rowHistory keeps what a fragment needs to tell its rows as they were at an earlier time within the retention, see
+// TableStorage.History: when its rows were inserted, and the rows it has removed. The soft-deleted rows are told by
+// their tombstones.
+type rowHistory struct {
+	retention time.Duration
+	// the time of the change being made, see Node.now
+	clock func() int64
+	// row id -> when the row was inserted, forgotten once older than the retention, as the row was there at any time
+	// the queries may ask for
+	inserted map[string]int64
+	// the rows removed within the retention
+	removed []removedRow
+	// when the history is pruned next
+	nextPrune int64
+}
+
+// removedRow is a row removed from a fragment, with when it was inserted (0 if before the history kept) and removed.
+type removedRow struct {
+	row       Row
+	inserted  int64
+	removedAt int64
+}
+
+func newRowHistory(retention time.Duration, clock func() int64) *rowHistory {
+	return &rowHistory{retention: retention, clock: clock, inserted: make(map[string]int64),
+		removed: make([]removedRow, 0)}
+}
+
+func (h *rowHistory) insert(row Row) {
+	now := h.clock()
+	if id, ok := row[0].(string); ok {
+		h.inserted[id] = now
+	}
+	h.prune(now)
+}
+
+// remove records a row removed from the fragment, a soft-deleted row being removed as of its tombstone.
+func (h *rowHistory) remove(row Row, tombstones map[string]int64) {
+	now := h.clock()
+	id, _ := row[0].(string)
+	removedAt := now
+	if at, ok := tombstones[id]; ok {
+		removedAt = at
+	}
+	h.removed = append(h.removed, removedRow{row: copyRow(row), inserted: h.inserted[id], removedAt: removedAt})
+	delete(h.inserted, id)
+	h.prune(now)
+}
+
+// prune forgets what is older than the retention, every tenth of the retention at most.
+func (h *rowHistory) prune(now int64) {
+	if now < h.nextPrune {
+		return
+	}
+	h.nextPrune = now + int64(h.retention)/10
+	cutoff := now - int64(h.retention)
+	for id, at := range h.inserted {
+		if at < cutoff {
+			delete(h.inserted, id)
+		}
+	}
+	kept := make([]removedRow, 0, len(h.removed))
+	for _, removed := range h.removed {
+		if removed.removedAt >= cutoff {
+			kept = append(kept, removed)
+		}
+	}
+	h.removed = kept
+}
+
+// visibleAt tells whether a row inserted and removed at the given times (0 for before the history kept and for not
+// removed) was in the fragment at asOf.
+func visibleAt(inserted int64, removedAt int64, asOf int64) bool {
+	return inserted <= asOf && (removedAt == 0 || removedAt > asOf)
+}
+
+// now returns the time of the change the node is making: the time it was logged if the node is replaying its log, so
+// that a restarted node rebuilds the same history, the current time otherwise.
+func (n *Node) now() int64 {
+	if n.replayAt != 0 {
+		return n.replayAt
+	}
+	return time.Now().UnixNano()
+}
+
+// RPCScanAsOf returns the rows of a fragment as they were at the given time (in nanoseconds since the Unix epoch),
+// together with the schema of the fragment: the rows inserted by then and neither removed nor soft-deleted by then.
+// The history of a replica starts when it is created, so the rows it received later, e.g., when it was moved, are
+// taken as inserted then. A dataset with an empty table name is returned if the fragment does not exist on this node
+// or keeps no history.
+func (n *Node) RPCScanAsOf(args ScanAsOfArgs, dataset *Dataset) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fragment := args.Fragment
+	asOf := args.AsOf
+	t, ok := n.TableMap[fragment]
+	if !ok || t.history == nil {
+		*dataset = Dataset{}
+		return
+	}
+	result := Dataset{Schema: *t.schema, Rows: make([]Row, 0)}
+	for iterator := n.scanIterator(t.rowStore.iterator()); iterator.HasNext(); {
+		row := *iterator.Next()
+		id, _ := row[0].(string)
+		if visibleAt(t.history.inserted[id], t.tombstones[id], asOf) {
+			result.Rows = append(result.Rows, row)
+		}
+	}
+	for _, removed := range t.history.removed {
+		if visibleAt(removed.inserted, removed.removedAt, asOf) {
+			result.Rows = append(result.Rows, removed.row)
+		}
+	}
+	result.Rows = maskRows(result.Schema, result.Rows, args.Masks)
+	*dataset = result
+}
+
+// asOfError tells why a table cannot be read as of the time the query asks for, see QueryHints.AsOf, "" if it can.
+func (q *queryContext) asOfError(tableName string) string {
+	if q.hints.AsOf == 0 {
+		return ""
+	}
+	table, ok := q.catalog.Table(tableName)
+	if !ok {
+		return ""
+	}
+	if table.Storage.History <= 0 {
+		return "Not Versioned"
+	}
+	if q.hints.AsOf < time.Now().Add(-table.Storage.History).UnixNano() {
+		return "History Expired"
+	}
+	return ""
+}
+
+// readFragmentAt reads a whole fragment from a replica as of the time the query asks for, if any, with the masks,
+// and merges its columns into values (row id -> column name -> value), see scanFragment.
+func (c *Cluster) readFragmentAt(q *queryContext, nodeId string, fragment string, masks map[string]ColumnMask,
+	values map[string]map[string]interface{}) bool {
+	if q.hints.AsOf == 0 {
+		return scanFragment(c.nodeEnd(nodeId), fragment, masks, values)
+	}
+	rows := Dataset{}
+	args := ScanAsOfArgs{Fragment: fragment, AsOf: q.hints.AsOf, Masks: masks}
+	if ok := c.nodeEnd(nodeId).Call("Node.RPCScanAsOf", args, &rows); !ok || rows.Schema.TableName == "" {
+		return false
+	}
+	mergeColumns(rows, values)
+	return true
+}
+
+// historicIds orders the ids of the rows read as of an earlier time: the ids of the rows the table still holds in
+// the order they were written, followed by those of the rows removed since in order.
+func historicIds(ids []string, values map[string]map[string]interface{}) []string {
+	ordered := make([]string, 0, len(values))
+	current := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		current[id] = true
+		if _, ok := values[id]; ok {
+			ordered = append(ordered, id)
+		}
+	}
+	removed := make([]string, 0)
+	for id := range values {
+		if !current[id] {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+	return append(ordered, removed...)
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// setupHistory builds the tables of lab3 keeping the versions of their rows for a minute.
+func setupHistory() {
+	setupLab3()
+	storage := TableStorage{History: time.Minute}
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"2":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules, "sid", storage}, &reply)
+	rules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	cli.Call("Cluster.BuildTable", []interface{}{courseRegistrationTableSchema, rules, "", storage}, &reply)
+	insertDataLab3(cli)
+}
+
+// scanAsOf returns the rows of a table as they were at the given time.
+func scanAsOf(tableName string, asOf int64) Dataset {
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{tableName, QueryHints{AsOf: asOf}}, &result)
+	return result
+}
+
+func TestAsOf(t *testing.T) {
+	before := time.Now().UnixNano()
+	setupHistory()
+	written := time.Now().UnixNano()
+	reply := ""
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"grade": {{Op: ">", Val: 3.6}}}}, &reply)
+	if reply != "0 2" {
+		t.Fatalf("expected 2 rows deleted, actual %v", reply)
+	}
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Eve", 20, 3.0}}, &reply)
+	changed := time.Now().UnixNano()
+
+	if rows := scanAsOf(studentTableName, written).Rows; len(rows) != 3 || rows[0][1] != "Smith" {
+		t.Errorf("expected the students as written, actual %v", rows)
+	}
+	if rows := scanAsOf(studentTableName, changed).Rows; len(rows) != 2 || !names(rows)["Smith"] ||
+		!names(rows)["Eve"] {
+		t.Errorf("expected Smith and Eve, actual %v", rows)
+	}
+	if rows := scanAsOf(studentTableName, before).Rows; len(rows) != 0 {
+		t.Errorf("expected no student before the table was built, actual %v", rows)
+	}
+	results := Dataset{}
+	cli.Call("Cluster.JoinWithHints", []interface{}{[]string{studentTableName, courseRegistrationTableName},
+		QueryHints{AsOf: written}}, &results)
+	if expected := (Dataset{Schema: joinedTableSchema, Rows: joinedTableContent}); !datasetDuplicateChecking(expected,
+		results) {
+		t.Errorf("expected the join as written %v, actual %v", expected, results)
+	}
+
+	// a restarted node rebuilds the history from its log
+	cli.Call("Cluster.RestartNode", "Node2", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot restart node2: %v", reply)
+	}
+	if rows := scanAsOf(studentTableName, written).Rows; len(rows) != 3 {
+		t.Errorf("expected the students as written after the restart, actual %v", rows)
+	}
+	if rows := scanAsOf(studentTableName, changed).Rows; len(rows) != 2 {
+		t.Errorf("expected the deleted students hidden after the restart, actual %v", rows)
+	}
+
+	expired := time.Now().Add(-2 * time.Minute).UnixNano()
+	if result := scanAsOf(studentTableName, expired); result.Error != "History Expired" {
+		t.Errorf("expected the history to be expired, actual %v", result)
+	}
+	scores := TableSchema{TableName: "score", ColumnSchemas: []ColumnSchema{{Name: "sid", DataType: TypeInt32}}}
+	rules, _ := NewRuleSet(scores).AddHorizontalRule(Predicate{}, 4).Marshal()
+	cli.Call("Cluster.BuildTable", []interface{}{scores, rules}, &reply)
+	if result := scanAsOf("score", written); result.Error != "Not Versioned" {
+		t.Errorf("expected a table without history, actual %v", result)
+	}
+}
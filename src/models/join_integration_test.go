@@ -0,0 +1,137 @@
+package models_test
+
+import (
+	"reflect"
+	"testing"
+
+	"../models"
+	"../testsupport"
+)
+
+// setupJoin builds the student table with the rows with grade <= 3.6 on Node0 and Node1 and the others on Node2, and
+// courseRegistration on Node3, and loads their rows.
+func setupJoin(t *testing.T, studentParams ...interface{}) (*testsupport.Harness, testsupport.Fixture,
+	testsupport.Fixture) {
+	students, courses := testsupport.Students(), testsupport.CourseRegistrations()
+	h := testsupport.New(t, 5).
+		Build(students, models.NewRuleSet(students.Schema).
+			AddHorizontalRule(models.Predicate{"grade": {{Op: "<=", Val: 3.6}}}, 0, 1).
+			AddHorizontalRule(models.Predicate{"grade": {{Op: ">", Val: 3.6}}}, 2), studentParams...).
+		Build(courses, models.NewRuleSet(courses.Schema).
+			AddHorizontalRule(models.Predicate{"courseId": {{Op: ">=", Val: 0}}}, 3)).
+		Load(students, courses)
+	return h, students, courses
+}
+
+// every strategy should produce the same join result
+func TestJoinWithHints(t *testing.T) {
+	hintsList := []models.QueryHints{
+		{JoinStrategy: models.JoinAuto},
+		{JoinStrategy: models.JoinAtCoordinator, DisableCache: true},
+		{JoinStrategy: models.JoinAtCoordinator, DrivingTable: "courseRegistration"},
+		{JoinStrategy: models.JoinBroadcast},
+		{JoinStrategy: models.JoinBroadcast, DrivingTable: "courseRegistration"},
+		{JoinStrategy: models.JoinSemi},
+		{JoinStrategy: models.JoinSemi, DrivingTable: "courseRegistration", DisableCache: true},
+	}
+
+	for _, hints := range hintsList {
+		students, courses := testsupport.Students(), testsupport.CourseRegistrations()
+		h := testsupport.New(t, 5).
+			Build(students, models.NewRuleSet(students.Schema).
+				AddHorizontalRule(models.Predicate{"grade": {{Op: "<=", Val: 3.6}}}, 0, 1).
+				AddHorizontalRule(models.Predicate{"grade": {{Op: ">", Val: 3.6}}}, 1, 2)).
+			Build(courses, models.NewRuleSet(courses.Schema).
+				AddHorizontalRule(models.Predicate{"courseId": {{Op: "<=", Val: 1}}}, 0, 3).
+				AddHorizontalRule(models.Predicate{"courseId": {{Op: ">", Val: 1}}}, 3, 2)).
+			Load(students, courses)
+
+		// join twice so that the second join may be served by the cache
+		tableNames := []string{students.Schema.TableName, courses.Schema.TableName}
+		for i := 0; i < 2; i++ {
+			h.Join(tableNames, hints).ExpectDataset(testsupport.StudentCourses())
+		}
+	}
+}
+
+// a join left to the coordinator broadcasts a table small enough to the nodes holding a larger one
+func TestAutoBroadcastJoin(t *testing.T) {
+	// the calls node3 receives: with 4 registrations over the threshold, the fragments are counted and the 3 students
+	// are broadcast to node3, otherwise the registrations are only read by the coordinator
+	for threshold, calls := range map[int]int{3: 2, 4: 1, -1: 1} {
+		h, students, courses := setupJoin(t, "sid", models.TableStorage{SoftDelete: true})
+		hints := models.QueryHints{BroadcastThreshold: threshold}
+		count := h.Network.GetCount("Node3")
+		h.Join([]string{students.Schema.TableName, courses.Schema.TableName}, hints).
+			ExpectDataset(testsupport.StudentCourses())
+		if actual := h.Network.GetCount("Node3") - count; actual != calls {
+			t.Errorf("expected %v calls to node3 with hints %v, actual %v", calls, hints, actual)
+		}
+	}
+}
+
+// the student fragment on Node2 cannot be read, which is reported or fails the query as the hints ask
+func TestJoinStrictness(t *testing.T) {
+	h, students, courses := setupJoin(t, "sid", models.TableStorage{SoftDelete: true})
+	h.Crash("Node2")
+	tableNames := []string{students.Schema.TableName, courses.Schema.TableName}
+	unavailable := students.Schema.TableName + "|1"
+	smith := testsupport.StudentCourses()
+	smith.Rows = smith.Rows[2:3]
+
+	lenient := models.QueryHints{DisableCache: true}
+	h.Join(tableNames, lenient).ExpectDataset(smith).ExpectUnavailable(unavailable)
+	h.Scan(students.Schema.TableName, lenient).ExpectRows(students.Rows[1]).ExpectUnavailable(unavailable)
+
+	strict := models.QueryHints{DisableCache: true, Strictness: models.RequireComplete}
+	result := h.Join(tableNames, strict).ExpectError("Fragments Unavailable: " + unavailable).
+		ExpectUnavailable(unavailable)
+	if len(result.Rows) != 0 {
+		t.Errorf("expected no rows of the failed join, actual %v", result.Rows)
+	}
+	query := models.Dataset{}
+	h.Call("Cluster.Query", []interface{}{students.Schema.TableName,
+		models.QueryPlan{Aggregates: []models.Aggregate{{Func: models.AggregateCount}}}, strict}, &query)
+	if query.Error != "Fragments Unavailable: "+unavailable {
+		t.Errorf("expected the query to fail, actual %v", query)
+	}
+
+	// nothing is missing from the tables that can be read
+	h.Scan(courses.Schema.TableName, strict).ExpectRows(courses.Rows...).ExpectUnavailable()
+}
+
+func TestJoinThreeTables(t *testing.T) {
+	h, students, courses := setupJoin(t)
+	titles := testsupport.Fixture{
+		Schema: models.TableSchema{TableName: "course", ColumnSchemas: []models.ColumnSchema{
+			{Name: "courseId", DataType: models.TypeInt32},
+			{Name: "title", DataType: models.TypeString},
+		}},
+		Rows: []models.Row{{0, "Databases"}, {1, "Networks"}},
+	}
+	h.Build(titles, models.NewRuleSet(titles.Schema).
+		AddHorizontalRule(models.Predicate{"courseId": {{Op: ">=", Val: 0}}}, 4)).
+		Load(titles)
+
+	expected := testsupport.StudentCourses()
+	expected.Schema.ColumnSchemas = append(expected.Schema.ColumnSchemas,
+		models.ColumnSchema{Name: "title", DataType: models.TypeString})
+	expected.Rows = []models.Row{
+		{0, "John", 22, 4.0, 0, "Databases"},
+		{0, "John", 22, 4.0, 1, "Networks"},
+		{1, "Smith", 23, 3.6, 0, "Databases"},
+	}
+	result := h.Join([]string{students.Schema.TableName, courses.Schema.TableName, titles.Schema.TableName}).
+		ExpectDataset(expected)
+	// the columns follow the given order of the tables
+	if !reflect.DeepEqual(result.Schema.ColumnSchemas, expected.Schema.ColumnSchemas) {
+		t.Errorf("expected columns %v, actual %v", expected.Schema.ColumnSchemas, result.Schema.ColumnSchemas)
+	}
+}
+
+func TestJoinWithMemoryBudget(t *testing.T) {
+	h, students, courses := setupJoin(t)
+	h.Join([]string{students.Schema.TableName, courses.Schema.TableName},
+		models.QueryHints{JoinStrategy: models.JoinAtCoordinator, MemoryBudget: 2}).
+		ExpectDataset(testsupport.StudentCourses())
+}
@@ -0,0 +1,237 @@
+package models
+
+import "math"
+
+// joinInput is a table or an intermediate result of a multi-way join, with the statistics used to estimate the sizes
+// of the results of joining it.
+type joinInput struct {
+	columns []ColumnSchema
+	rows    []Row
+	// the estimated number of rows and of distinct values of each column
+	size     float64
+	distinct map[ColumnSchema]float64
+}
+
+// joinMany joins three or more tables at the coordinator. The order in which the tables are joined is chosen by
+// chooseJoinOrder from the statistics estimated before any row is read (see estimateInput), each table being read
+// only when it is joined, while the joined rows follow the schema of joining the tables in the given order, so that
+// the order does not change the result. Of the hints, only the row cache and the memory budget are followed.
+func (c *Cluster) joinMany(q *queryContext, tableNames []string) ([]ColumnSchema, []Row) {
+	schemas := make([]TableSchema, len(tableNames))
+	estimates := make([]joinInput, len(tableNames))
+	for i, tableName := range tableNames {
+		schema, ok := q.catalog.Schema(tableName)
+		if !ok {
+			return make([]ColumnSchema, 0), make([]Row, 0)
+		}
+		schemas[i] = schema
+		estimates[i] = c.estimateInput(q, tableName, schema)
+	}
+	return joinInOrder(q, estimates, func(i int) joinInput {
+		return newJoinInput(schemas[i], getTableRows(c, q, tableNames[i], schemas[i].ColumnSchemas))
+	})
+}
+
+// estimateInput estimates the statistics of a table from the numbers of rows of its fragments, see countRows, without
+// reading any row: each column is taken to have as many distinct values as the table has rows, the most it can have.
+// The number of rows the coordinator records for the table is taken if some fragment cannot be counted.
+func (c *Cluster) estimateInput(q *queryContext, tableName string, schema TableSchema) joinInput {
+	size, ok := c.countRows(q, tableName, math.MaxInt32)
+	if !ok {
+		size = len(q.catalog.Ids(tableName))
+	}
+	input := joinInput{columns: schema.ColumnSchemas, size: float64(size), distinct: make(map[ColumnSchema]float64)}
+	for _, cs := range schema.ColumnSchemas {
+		input.distinct[cs] = float64(size)
+	}
+	return input
+}
+
+// joinTables joins the rows of two or more tables at the coordinator as joinMany does, the rows having been read.
+func joinTables(q *queryContext, inputs []joinInput) ([]ColumnSchema, []Row) {
+	return joinInOrder(q, inputs, func(i int) joinInput {
+		return inputs[i]
+	})
+}
+
+// joinInOrder joins two or more tables at the coordinator in the order chosen by chooseJoinOrder from the estimated
+// statistics of the tables, fetch returning the rows of the i-th table with their statistics when it is joined. The
+// tables after an intermediate result without rows are not fetched at all.
+func joinInOrder(q *queryContext, estimates []joinInput, fetch func(i int) joinInput) ([]ColumnSchema, []Row) {
+	resultColumns := estimates[0].columns
+	for _, input := range estimates[1:] {
+		resultColumns, _, _ = joinSchema(resultColumns, input.columns)
+	}
+
+	order := chooseJoinOrder(estimates)
+	if len(order) < len(estimates) {
+		// some table has no common column with the others, which joins no row as in a join of two tables
+		return resultColumns, make([]Row, 0)
+	}
+	result := fetch(order[0])
+	for _, next := range order[1:] {
+		if len(result.rows) == 0 {
+			return resultColumns, make([]Row, 0)
+		}
+		result = joinInputs(q, result, fetch(next))
+	}
+	return resultColumns, projectRows(result.columns, result.rows, resultColumns)
+}
+
+// newJoinInput computes the statistics of the rows of a table.
+func newJoinInput(schema TableSchema, rows []Row) joinInput {
+	input := joinInput{columns: schema.ColumnSchemas, rows: rows, size: float64(len(rows)),
+		distinct: make(map[ColumnSchema]float64)}
+	for i, stats := range columnStatistics(schema, rows) {
+		input.distinct[schema.ColumnSchemas[i]] = float64(stats.Distinct)
+	}
+	return input
+}
+
+// chooseJoinOrder greedily orders the inputs of a multi-way join so that the intermediate results stay small: it
+// starts with the pair of inputs whose join is estimated to be the smallest, then repeatedly adds the input whose
+// join with the intermediate result is estimated to be the smallest. Only inputs having common columns with the
+// intermediate result are joined, so the order is shorter than the inputs if some of them cannot be joined. Ties are
+// broken by the given order.
+func chooseJoinOrder(inputs []joinInput) []int {
+	first, second := -1, -1
+	best := 0.0
+	for i := range inputs {
+		for j := i + 1; j < len(inputs); j++ {
+			if len(commonColumns(inputs[i].columns, inputs[j].columns)) == 0 {
+				continue
+			}
+			if size := estimateJoin(inputs[i], inputs[j]).size; first < 0 || size < best {
+				first, second, best = i, j, size
+			}
+		}
+	}
+	if first < 0 {
+		return []int{}
+	}
+	// the smaller input drives the first join
+	if inputs[second].size < inputs[first].size {
+		first, second = second, first
+	}
+
+	order := []int{first, second}
+	joined := map[int]bool{first: true, second: true}
+	result := estimateJoin(inputs[first], inputs[second])
+	for len(order) < len(inputs) {
+		next := -1
+		var nextResult joinInput
+		for i := range inputs {
+			if joined[i] || len(commonColumns(result.columns, inputs[i].columns)) == 0 {
+				continue
+			}
+			if estimate := estimateJoin(result, inputs[i]); next < 0 || estimate.size < nextResult.size {
+				next, nextResult = i, estimate
+			}
+		}
+		if next < 0 {
+			break
+		}
+		order = append(order, next)
+		joined[next] = true
+		result = nextResult
+	}
+	return order
+}
+
+// estimateJoin estimates the size and the distinct values of the result of joining two inputs, assuming that the
+// values of each common column are uniformly distributed and that the values of the input with fewer distinct values
+// appear in the other input. No row is joined.
+func estimateJoin(a joinInput, b joinInput) joinInput {
+	size := a.size * b.size
+	common := commonColumns(a.columns, b.columns)
+	for _, cs := range common {
+		if d := math.Max(a.distinct[cs], b.distinct[cs]); d > 1 {
+			size /= d
+		}
+	}
+	result := joinInput{size: size, distinct: make(map[ColumnSchema]float64)}
+	result.columns, _, _ = joinSchema(a.columns, b.columns)
+	for _, cs := range result.columns {
+		d, ok := a.distinct[cs]
+		if other, exist := b.distinct[cs]; exist && (!ok || other < d) {
+			d = other
+		}
+		result.distinct[cs] = math.Min(d, size)
+	}
+	return result
+}
+
+// joinInputs joins the rows of two inputs at the coordinator, spilling them to disk if they exceed the memory budget
+// of the hints. The statistics of the result are estimated.
+func joinInputs(q *queryContext, a joinInput, b joinInput) joinInput {
+	result := estimateJoin(a, b)
+	_, same_columns1, same_columns2 := joinSchema(a.columns, b.columns)
+	common := make(map[int]bool)
+	for _, index := range same_columns2 {
+		common[index] = true
+	}
+	// mergeRows expects the common columns of b to come first, which may not hold for an intermediate result
+	merge := func(row1 Row, row2 Row) Row {
+		row := copyRow(row1)
+		for i, val := range row2 {
+			if !common[i] {
+				row = append(row, val)
+			}
+		}
+		return row
+	}
+	rows, ok := spillRows(q, a.rows, b.rows, same_columns1, same_columns2, merge)
+	if !ok {
+		rows = make([]Row, 0)
+		for _, pair := range matchRows(a.rows, b.rows, same_columns1, same_columns2) {
+			rows = append(rows, merge(a.rows[pair[0]], b.rows[pair[1]]))
+		}
+	}
+	result.rows = rows
+	result.size = float64(len(result.rows))
+	return result
+}
+
+// joinSchema calls createJoinSchema on a copy of the columns of a, so that the results of joining the same input with
+// different inputs do not share their columns.
+func joinSchema(a []ColumnSchema, b []ColumnSchema) ([]ColumnSchema, []int, []int) {
+	columns := append(make([]ColumnSchema, 0, len(a)+len(b)), a...)
+	same_columns1, same_columns2 := make([]int, 0), make([]int, 0)
+	createJoinSchema([]interface{}{columns, b}, &columns, &same_columns1, &same_columns2)
+	return columns, same_columns1, same_columns2
+}
+
+// commonColumns returns the columns of a that are also columns of b.
+func commonColumns(a []ColumnSchema, b []ColumnSchema) []ColumnSchema {
+	common := make([]ColumnSchema, 0)
+	for _, col1 := range a {
+		for _, col2 := range b {
+			if col1 == col2 {
+				common = append(common, col1)
+				break
+			}
+		}
+	}
+	return common
+}
+
+// projectRows reorders the columns of rows following columns into the order of target, which has the same columns.
+func projectRows(columns []ColumnSchema, rows []Row, target []ColumnSchema) []Row {
+	positions := make([]int, len(target))
+	for i, cs := range target {
+		for j, col := range columns {
+			if cs == col {
+				positions[i] = j
+				break
+			}
+		}
+	}
+	projected := make([]Row, len(rows))
+	for i, row := range rows {
+		projected[i] = make(Row, len(positions))
+		for j, position := range positions {
+			projected[i][j] = row[position]
+		}
+	}
+	return projected
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// joining the two large tables first would produce far more rows than joining the small table with one of them
+func TestChooseJoinOrder(t *testing.T) {
+	column := func(name string) ColumnSchema { return ColumnSchema{Name: name, DataType: TypeInt32} }
+	input := func(size float64, distinct map[string]float64, columns ...string) joinInput {
+		in := joinInput{size: size, distinct: make(map[ColumnSchema]float64)}
+		for _, name := range columns {
+			in.columns = append(in.columns, column(name))
+			in.distinct[column(name)] = distinct[name]
+		}
+		return in
+	}
+	inputs := []joinInput{
+		input(1000, map[string]float64{"k": 10, "x": 1000}, "k", "x"),
+		input(1000, map[string]float64{"k": 10, "y": 1000}, "k", "y"),
+		input(1, map[string]float64{"x": 1}, "x"),
+	}
+	order := chooseJoinOrder(inputs)
+	if len(order) != 3 || order[0] != 2 || order[1] != 0 || order[2] != 1 {
+		t.Errorf("expected order [2 0 1], actual %v", order)
+	}
+
+	// a table without common columns cannot be joined
+	inputs = append(inputs, input(10, map[string]float64{"z": 10}, "z"))
+	if order := chooseJoinOrder(inputs); len(order) != 3 {
+		t.Errorf("the last table should not be joined, actual order %v", order)
+	}
+}
+
+// the order is chosen from the counted rows before any table is read, and no table is read after an empty result
+func TestJoinOrderEstimated(t *testing.T) {
+	setupLab3()
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"2":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+	courseSchema := TableSchema{TableName: "course", ColumnSchemas: []ColumnSchema{
+		{Name: "courseId", DataType: TypeInt32},
+		{Name: "title", DataType: TypeString},
+	}}
+	courseRules, _ := json.Marshal(map[string]interface{}{
+		"4": rangeFragment("courseId", ">=", 0, "courseId", "title"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{courseSchema, courseRules}, &reply)
+
+	q := c.beginQuery(QueryHints{})
+	defer c.endQuery(q)
+	tableNames := []string{studentTableName, courseRegistrationTableName, "course"}
+	estimates := make([]joinInput, len(tableNames))
+	for i, tableName := range tableNames {
+		schema, _ := q.catalog.Schema(tableName)
+		estimates[i] = c.estimateInput(q, tableName, schema)
+	}
+	if estimates[0].size != 3 || estimates[1].size != 4 || estimates[2].size != 0 {
+		t.Errorf("expected 3, 4 and 0 rows, actual %v, %v and %v", estimates[0].size, estimates[1].size,
+			estimates[2].size)
+	}
+	fetched := make([]string, 0)
+	_, rows := joinInOrder(q, estimates, func(i int) joinInput {
+		fetched = append(fetched, tableNames[i])
+		schema, _ := q.catalog.Schema(tableNames[i])
+		return newJoinInput(schema, getTableRows(c, q, tableNames[i], schema.ColumnSchemas))
+	})
+	if len(rows) != 0 || len(fetched) != 1 || fetched[0] != "course" {
+		t.Errorf("expected only the empty course table to be read, actual %v joining %v", fetched, rows)
+	}
+}
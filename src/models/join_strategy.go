@@ -0,0 +1,261 @@
+package models
+
+// executeJoin joins two tables with the strategy asked by the hints, and falls back to joining at the coordinator if
+// the strategy cannot be applied, if the query sees a column of the tables masked, the nodes joining the raw values,
+// if the query filters the rows, the fragments it prunes not being read at all, or if it reads the tables as of an
+// earlier time. The joined rows follow the schema
+// built by createJoinSchema from the full schemas of the two tables, no matter which table drives the join.
+func (c *Cluster) executeJoin(q *queryContext, tableName1 string, tableName2 string, table1_columns []ColumnSchema,
+	table2_columns []ColumnSchema, same_columns1 []int, same_columns2 []int) []Row {
+	drivingFirst := q.hints.DrivingTable != tableName2
+
+	strategy := q.hints.JoinStrategy
+	if q.masked(tableName1, tableName2) || len(q.hints.Where) > 0 || q.hints.AsOf != 0 {
+		strategy = JoinAtCoordinator
+	}
+	switch strategy {
+	case JoinAuto:
+		if rows, ok := c.localJoin(q, tableName1, tableName2); ok {
+			// the join has been done by the nodes holding both tables
+			return rows
+		}
+		if small := c.broadcastSide(q, tableName1, tableName2); small != "" {
+			if rows, ok := c.broadcastJoin(q, tableName1, tableName2, table1_columns, table2_columns,
+				small == tableName2); ok {
+				return rows
+			}
+		}
+	case JoinBroadcast:
+		if rows, ok := c.broadcastJoin(q, tableName1, tableName2, table1_columns, table2_columns,
+			drivingFirst); ok {
+			return rows
+		}
+	case JoinSemi:
+		if rows, ok := c.semiJoin(q, tableName1, tableName2, table1_columns, table2_columns, same_columns1,
+			same_columns2, drivingFirst); ok {
+			return rows
+		}
+	}
+	if rows, _, ok := c.spillJoin(q, tableName1, tableName2, table1_columns, table2_columns, same_columns1,
+		same_columns2, func(row1 Row, row2 Row) Row {
+			return mergeRows(row1, row2, same_columns2)
+		}); ok {
+		return rows
+	}
+	table1_rows := getTableRows(c, q, tableName1, table1_columns)
+	table2_rows := getTableRows(c, q, tableName2, table2_columns)
+	return joinAtCoordinator(table1_rows, table2_rows, same_columns1, same_columns2, drivingFirst)
+}
+
+// joinAtCoordinator joins rows of two tables pulled to the coordinator. If drivingFirst is false, the rows of the
+// second table form the outer loop.
+func joinAtCoordinator(table1_rows []Row, table2_rows []Row, same_columns1 []int, same_columns2 []int,
+	drivingFirst bool) []Row {
+	result_rows := make([]Row, 0)
+	if drivingFirst {
+		for _, pair := range matchRows(table1_rows, table2_rows, same_columns1, same_columns2) {
+			result_rows = append(result_rows, mergeRows(table1_rows[pair[0]], table2_rows[pair[1]], same_columns2))
+		}
+	} else {
+		for _, pair := range matchRows(table2_rows, table1_rows, same_columns2, same_columns1) {
+			result_rows = append(result_rows, mergeRows(table1_rows[pair[1]], table2_rows[pair[0]], same_columns2))
+		}
+	}
+	return result_rows
+}
+
+// broadcastSide returns which of two tables a join left to the coordinator broadcasts to the nodes holding the other:
+// the tiny one when the other is larger than the threshold (see QueryHints.BroadcastThreshold), "" if they are both
+// small or both large, or if some fragment cannot be counted.
+func (c *Cluster) broadcastSide(q *queryContext, tableName1 string, tableName2 string) string {
+	threshold := q.hints.BroadcastThreshold
+	if threshold == 0 {
+		threshold = defaultBroadcastThreshold
+	}
+	// neither table can be large if the coordinator has not recorded that many rows for them
+	if threshold < 0 || (len(q.catalog.Ids(tableName1)) <= threshold && len(q.catalog.Ids(tableName2)) <= threshold) {
+		return ""
+	}
+	size1, ok1 := c.countRows(q, tableName1, threshold)
+	size2, ok2 := c.countRows(q, tableName2, threshold)
+	if !ok1 || !ok2 {
+		return ""
+	}
+	if size1 <= threshold && size2 > threshold {
+		return tableName1
+	} else if size2 <= threshold && size1 > threshold {
+		return tableName2
+	}
+	return ""
+}
+
+// countRows counts the rows of a table from the row counts of the fragments holding its first column, each read from
+// one of its replicas, stopping once more than limit rows have been counted. It returns false if some fragment cannot
+// be counted.
+func (c *Cluster) countRows(q *queryContext, tableName string, limit int) (int, bool) {
+	schema, ok := q.catalog.Schema(tableName)
+	if !ok || len(schema.ColumnSchemas) == 0 {
+		return 0, false
+	}
+	total := 0
+	for _, fragment := range q.placement.Fragments(tableName) {
+		if !contains(q.placement.Rule(fragment).Column, schema.ColumnSchemas[0].Name) {
+			continue
+		}
+		counted := false
+		for _, nodeId := range c.readOrder(q.placement.Replicas(fragment)) {
+			cnt := -1
+			args := FragmentArgs{Fragment: fragment}
+			if ok := c.nodeEnd(nodeId).Call("Node.RPCCountRows", args, &cnt); ok && cnt >= 0 {
+				total += cnt
+				counted = true
+				break
+			}
+		}
+		if !counted {
+			return 0, false
+		}
+		if total > limit {
+			break
+		}
+	}
+	return total, true
+}
+
+// broadcastJoin pulls the table that does not drive the join to the coordinator, sends it to one replica of each
+// fragment of the driving table, and lets the nodes join it with their fragments. It returns false if the driving
+// table is vertically fragmented or some node does not answer.
+func (c *Cluster) broadcastJoin(q *queryContext, tableName1 string, tableName2 string, table1_columns []ColumnSchema,
+	table2_columns []ColumnSchema, drivingFirst bool) ([]Row, bool) {
+	driving, shipped, shippedColumns := tableName1, tableName2, table2_columns
+	if !drivingFirst {
+		driving, shipped, shippedColumns = tableName2, tableName1, table1_columns
+	}
+	fragments, ok := c.completeFragments(q, driving)
+	if !ok {
+		return nil, false
+	}
+	units, ok := planBroadcastLocalJoin(q, fragments, nil)
+	if !ok {
+		return nil, false
+	}
+	shippedRows := Dataset{
+		Schema: TableSchema{TableName: shipped, ColumnSchemas: shippedColumns},
+		Rows:   getTableRows(c, q, shipped, shippedColumns),
+	}
+
+	rows := make([]Row, 0)
+	// a row of the driving table may be in more than one fragment, the joined rows are deduplicated by the id of the
+	// driving row and the index of the shipped row, which are the last two columns of the rows returned by the nodes
+	type joinedPair struct {
+		id    string
+		index int
+	}
+	joined := make(map[joinedPair]bool)
+	for _, unit := range units {
+		result := Dataset{}
+		ok := c.nodeEnd(unit.nodeId).Call("Node.RPCBroadcastJoin",
+			BroadcastJoinArgs{Fragments: unit.fragments1, Shipped: shippedRows, ShippedFirst: !drivingFirst}, &result)
+		if !ok || result.Schema.TableName == "" {
+			return nil, false
+		}
+		for _, row := range result.Rows {
+			pair := joinedPair{row[len(row)-2].(string), row[len(row)-1].(int)}
+			if joined[pair] {
+				continue
+			}
+			joined[pair] = true
+			rows = append(rows, row[:len(row)-2])
+		}
+	}
+	return rows, true
+}
+
+// semiJoin pulls the driving table to the coordinator and sends the distinct values of its common columns to the
+// fragments of the other table containing these columns, which tell the rows that may be joined. Only those rows of
+// the other table are then pulled to be joined at the coordinator. It returns false if the common columns of the
+// other table are spread over different fragments, or some rows cannot be read.
+func (c *Cluster) semiJoin(q *queryContext, tableName1 string, tableName2 string, table1_columns []ColumnSchema,
+	table2_columns []ColumnSchema, same_columns1 []int, same_columns2 []int, drivingFirst bool) ([]Row, bool) {
+	driving, other := tableName1, tableName2
+	drivingColumns, drivingSame, otherColumns, otherSame := table1_columns, same_columns1, table2_columns, same_columns2
+	if !drivingFirst {
+		driving, other = tableName2, tableName1
+		drivingColumns, drivingSame, otherColumns, otherSame = table2_columns, same_columns2, table1_columns, same_columns1
+	}
+
+	// the fragments of the other table that are used to filter the rows. A fragment having some of the common
+	// columns must have all of them, otherwise the common columns of a row may be spread over several fragments and
+	// no fragment can tell whether the row matches.
+	filters := make([]string, 0)
+	for _, fragment := range q.placement.Fragments(other) {
+		columns := make(map[string]bool)
+		for _, column := range q.placement.Rule(fragment).Column {
+			columns[column] = true
+		}
+		found := 0
+		for _, index := range otherSame {
+			if columns[otherColumns[index].Name] {
+				found++
+			}
+		}
+		if found == len(otherSame) {
+			filters = append(filters, fragment)
+		} else if found > 0 {
+			return nil, false
+		}
+	}
+	if len(filters) == 0 {
+		return nil, false
+	}
+
+	drivingRows := getTableRows(c, q, driving, drivingColumns)
+	keys := Dataset{Schema: TableSchema{TableName: driving, ColumnSchemas: make([]ColumnSchema, 0)}, Rows: make([]Row, 0)}
+	for _, index := range drivingSame {
+		keys.Schema.ColumnSchemas = append(keys.Schema.ColumnSchemas, drivingColumns[index])
+	}
+	seen := make(map[string]bool)
+	for _, row := range drivingRows {
+		key := make(Row, len(drivingSame))
+		for i, index := range drivingSame {
+			key[i] = row[index]
+		}
+		if k := keyString(key); !seen[k] {
+			seen[k] = true
+			keys.Rows = append(keys.Rows, key)
+		}
+	}
+
+	ids := make([]string, 0)
+	matched := make(map[string]bool)
+	for _, filter := range filters {
+		read := false
+		for _, nodeId := range q.placement.Replicas(filter) {
+			result := Dataset{}
+			ok := c.nodeEnd(nodeId).Call("Node.RPCSemiJoinIds", SemiJoinIdsArgs{Fragment: filter, Keys: keys}, &result)
+			if !ok || result.Schema.TableName == "" {
+				continue
+			}
+			for _, row := range result.Rows {
+				if id := row[0].(string); !matched[id] {
+					matched[id] = true
+					ids = append(ids, id)
+				}
+			}
+			read = true
+			break
+		}
+		if !read {
+			return nil, false
+		}
+	}
+	otherRows, ok := c.fetchRows(q, other, ids)
+	if !ok {
+		return nil, false
+	}
+
+	if drivingFirst {
+		return joinAtCoordinator(drivingRows, otherRows, same_columns1, same_columns2, true), true
+	}
+	return joinAtCoordinator(otherRows, drivingRows, same_columns1, same_columns2, false), true
+}
@@ -72,6 +72,10 @@ func defineTablesLab3() {
 
 
 func setupLab3() {
+	// release the cluster of the previous test
+	if c != nil {
+		c.Close()
+	}
 	// set up a network and a cluster
 	clusterName := "MyCluster"
 	network = labrpc.MakeNetwork()
@@ -0,0 +1,180 @@
+package models
+
+import "reflect"
+
+// localJoinUnit asks a node to join some fragments of the first table with some fragments of the second one.
+type localJoinUnit struct {
+	nodeId     string
+	fragments1 []string
+	fragments2 []string
+}
+
+// localJoin delegates the join of two tables to the nodes holding both of them, if the placement of the fragments
+// allows it, and collects the joined rows. It returns false if the join cannot be done by the nodes, in which case
+// the coordinator should pull the tables and join them itself.
+func (c *Cluster) localJoin(q *queryContext, tableName1 string, tableName2 string) ([]Row, bool) {
+	units, ok := c.planLocalJoin(q, tableName1, tableName2)
+	if !ok {
+		return nil, false
+	}
+
+	rows := make([]Row, 0)
+	// a pair of rows may be joined by more than one unit if fragments overlap, so the pairs are deduplicated by the
+	// ids of the two rows, which are the last two columns of the rows returned by the nodes
+	joined := make(map[[2]string]bool)
+	for _, unit := range units {
+		result := Dataset{}
+		ok := c.nodeEnd(unit.nodeId).Call("Node.RPCLocalJoin", LocalJoinArgs{Fragments1: unit.fragments1,
+			Fragments2: unit.fragments2}, &result)
+		if !ok || result.Schema.TableName == "" {
+			return nil, false
+		}
+		for _, row := range result.Rows {
+			pair := [2]string{row[len(row)-2].(string), row[len(row)-1].(string)}
+			if joined[pair] {
+				continue
+			}
+			joined[pair] = true
+			rows = append(rows, row[:len(row)-2])
+		}
+	}
+	return rows, true
+}
+
+// planLocalJoin finds a set of nodes that can join the two tables without shipping fragments between nodes.
+// Every pair of rows that can be joined must meet on at least one of the chosen nodes, which is the case when
+//   - each fragment of one table is placed on a node that holds the whole other table, or
+//   - the tables are fragmented by the same predicates on their common columns (derived fragmentation), and each pair
+//     of fragments with the same predicate is placed on a common node.
+//
+// Only tables whose fragments contain all columns are considered, as a node cannot join partial rows.
+func (c *Cluster) planLocalJoin(q *queryContext, tableName1 string, tableName2 string) ([]localJoinUnit, bool) {
+	fragments1, ok1 := c.completeFragments(q, tableName1)
+	fragments2, ok2 := c.completeFragments(q, tableName2)
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+	if units, ok := planBroadcastLocalJoin(q, fragments1, fragments2); ok {
+		return units, true
+	}
+	if units, ok := planBroadcastLocalJoin(q, fragments2, fragments1); ok {
+		for i := range units {
+			units[i].fragments1, units[i].fragments2 = units[i].fragments2, units[i].fragments1
+		}
+		return units, true
+	}
+	return c.planCoPartitionedLocalJoin(q, tableName1, tableName2, fragments1, fragments2)
+}
+
+// planBroadcastLocalJoin assigns each fragment in driving to a node which also holds all fragments in others.
+func planBroadcastLocalJoin(q *queryContext, driving []string, others []string) ([]localJoinUnit, bool) {
+	units := make([]localJoinUnit, 0)
+	// node id -> index in units, so that a node receives one request only
+	unitOfNode := make(map[string]int)
+	for _, fragment := range driving {
+		candidate := ""
+		for _, nodeId := range q.placement.Replicas(fragment) {
+			if !nodeHoldsAll(q.placement, nodeId, others) {
+				continue
+			}
+			if _, ok := unitOfNode[nodeId]; ok || candidate == "" {
+				candidate = nodeId
+			}
+		}
+		if candidate == "" {
+			return nil, false
+		}
+		if _, ok := unitOfNode[candidate]; !ok {
+			unitOfNode[candidate] = len(units)
+			units = append(units, localJoinUnit{nodeId: candidate, fragments2: others})
+		}
+		unit := &units[unitOfNode[candidate]]
+		unit.fragments1 = append(unit.fragments1, fragment)
+	}
+	return units, true
+}
+
+// planCoPartitionedLocalJoin pairs each fragment of the first table with a fragment of the second table which is
+// defined by the same predicate on the common columns and shares a node with it.
+func (c *Cluster) planCoPartitionedLocalJoin(q *queryContext, tableName1 string, tableName2 string,
+	fragments1 []string, fragments2 []string) ([]localJoinUnit, bool) {
+	common := make(map[string]bool)
+	schema1, _ := q.catalog.Schema(tableName1)
+	schema2, _ := q.catalog.Schema(tableName2)
+	for _, cs1 := range schema1.ColumnSchemas {
+		for _, cs2 := range schema2.ColumnSchemas {
+			if cs1 == cs2 {
+				common[cs1.Name] = true
+			}
+		}
+	}
+
+	units := make([]localJoinUnit, 0)
+	for _, fragment1 := range fragments1 {
+		predicate := q.placement.Rule(fragment1).Predicate
+		for column := range predicate {
+			if !common[column] {
+				return nil, false
+			}
+		}
+		found := false
+		for _, fragment2 := range fragments2 {
+			if !reflect.DeepEqual(predicate, q.placement.Rule(fragment2).Predicate) {
+				continue
+			}
+			for _, nodeId := range q.placement.Replicas(fragment1) {
+				if nodeHoldsAll(q.placement, nodeId, []string{fragment2}) {
+					units = append(units, localJoinUnit{nodeId: nodeId, fragments1: []string{fragment1},
+						fragments2: []string{fragment2}})
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return units, true
+}
+
+// completeFragments returns the fragments of a table, or false if some fragment does not contain all columns.
+func (c *Cluster) completeFragments(q *queryContext, tableName string) ([]string, bool) {
+	schema, ok := q.catalog.Schema(tableName)
+	if !ok {
+		return nil, false
+	}
+	fragments := q.placement.Fragments(tableName)
+	for _, fragment := range fragments {
+		columns := make(map[string]bool)
+		for _, column := range q.placement.Rule(fragment).Column {
+			columns[column] = true
+		}
+		for _, cs := range schema.ColumnSchemas {
+			if !columns[cs.Name] {
+				return nil, false
+			}
+		}
+	}
+	return fragments, true
+}
+
+// nodeHoldsAll tells whether the node holds a replica of each of the fragments.
+func nodeHoldsAll(placement *Placement, nodeId string, fragments []string) bool {
+	for _, fragment := range fragments {
+		held := false
+		for _, id := range placement.Replicas(fragment) {
+			if id == nodeId {
+				held = true
+				break
+			}
+		}
+		if !held {
+			return false
+		}
+	}
+	return true
+}
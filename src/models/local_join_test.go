@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// both tables are fragmented by sid in the same way, so that each node can join its own fragments
+func TestLocalJoinCoPartitioned(t *testing.T) {
+	setupLab3()
+
+	fragment := func(op string, columns ...string) map[string]interface{} {
+		return map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"sid": [...]map[string]interface{}{{
+					"op":  op,
+					"val": 0,
+				},
+				},
+			},
+			"column": columns,
+		}
+	}
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0":   fragment("<=", "sid", "name", "age", "grade"),
+		"1|2": fragment(">", "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|3": fragment("<=", "sid", "courseId"),
+		"2":   fragment(">", "sid", "courseId"),
+	})
+
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+
+	q := c.beginQuery(QueryHints{})
+	units, ok := c.planLocalJoin(q, studentTableName, courseRegistrationTableName)
+	c.endQuery(q)
+	if !ok || len(units) != 2 {
+		t.Fatalf("the join should be done by two nodes, actual plan %v", units)
+	}
+
+	results := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows:   joinedTableContent,
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, results)
+	}
+}
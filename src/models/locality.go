@@ -0,0 +1,254 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NodeLabels are the locality tags of a node, e.g., {"zone": "A", "rack": "3"}, which the placement constraints of
+// the fragmentation rules refer to.
+type NodeLabels map[string]string
+
+// PlacementConstraint restricts the nodes holding the replicas of a fragment by their labels, to model the latency
+// and the failure domains of the nodes. The constraints of a fragment are given with its rule, e.g.,
+//
+//	{"predicate": ..., "column": ..., "constraints": [{"label": "zone", "spread": true}, {"label": "rack", "value": "3"}]}
+//
+// places every replica on a node of rack 3, each in a different zone. BuildTable refuses the rules whose nodes
+// violate their constraints, and Rebalance and DecommissionNode only move the replicas to nodes that keep them
+// satisfied.
+type PlacementConstraint struct {
+	// the label of the nodes the constraint is about, e.g., "zone"
+	Label string
+	// if not empty, every replica must be on a node whose label has this value, e.g., "A"
+	Value string
+	// whether the replicas must be on nodes with pairwise different values of the label
+	Spread bool
+}
+
+// SetNodeLabels sets the locality tags of a node, replacing those set before. The replicas already placed are not
+// moved, even if they no longer satisfy their constraints, until the next Rebalance.
+// params: nodeId string, labels NodeLabels
+func (c *Cluster) SetNodeLabels(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	nodeId := params[0].(string)
+	if !contains(c.nodeIds, nodeId) {
+		*reply = "1 no such node"
+		return
+	}
+	labels := make(NodeLabels)
+	for label, value := range params[1].(NodeLabels) {
+		labels[label] = value
+	}
+	c.nodeLabels[nodeId] = labels
+	*reply = "0 OK"
+}
+
+// placementViolations describes how placing the replicas of a fragment on the nodes violates the constraints of its
+// rule, one reason for each replica to move, so that each move can fix at most one of them.
+func (c *Cluster) placementViolations(rule Rule, nodes []string) []string {
+	violations := make([]string, 0)
+	for _, constraint := range rule.Constraints {
+		// label value -> the first node having it
+		seen := make(map[string]string)
+		for _, nodeId := range nodes {
+			value, ok := c.nodeLabels[nodeId][constraint.Label]
+			switch {
+			case constraint.Value != "" && value != constraint.Value:
+				violations = append(violations, fmt.Sprintf("%v is not in %v %v", nodeId, constraint.Label,
+					constraint.Value))
+			case constraint.Spread && !ok:
+				violations = append(violations, fmt.Sprintf("%v has no %v", nodeId, constraint.Label))
+			case constraint.Spread && seen[value] != "":
+				violations = append(violations, fmt.Sprintf("%v is in the same %v %v as %v", nodeId, constraint.Label,
+					value, seen[value]))
+			case constraint.Spread:
+				seen[value] = nodeId
+			}
+		}
+	}
+	return violations
+}
+
+// keyNodes returns the nodes of the key of a rule given to BuildTable, e.g., Node0 and Node1 for "0|1", or every node
+// for a key starting with "*", the rest of which only tells the rule from the others, e.g., "*low".
+func (c *Cluster) keyNodes(key string) []string {
+	if strings.HasPrefix(key, "*") {
+		return append([]string(nil), c.nodeIds...)
+	}
+	nodes := make([]string, 0)
+	for _, nodeId := range strings.Split(key, "|") {
+		nodes = append(nodes, "Node"+nodeId)
+	}
+	return nodes
+}
+
+// placeRules chooses the nodes of the rules given to BuildTable for a table, keyed by their node lists. A rule without
+// replica count is placed on every node of its key; a rule with one on as many nodes of its key, the least loaded
+// first, after the others so that it avoids their nodes. No node holds two replicas of a fragment or replicas of two
+// fragments of the same anti-affinity group, and the nodes satisfy the placement constraints of the rules. It returns
+// the keys in the order of the fragments and the nodes of each key, or the reason of the failure.
+func (c *Cluster) placeRules(tableName string, rules map[string]Rule) ([]string, map[string][]string, string) {
+	keys := make([]string, 0, len(rules))
+	for key := range rules {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, constraint := range rules[key].Constraints {
+			if constraint.Label == "" {
+				return nil, nil, "Invalid Placement Constraint: no label"
+			}
+		}
+		if rules[key].Replicas < 0 {
+			return nil, nil, fmt.Sprintf("Invalid Placement Constraint: %v replicas of %v", rules[key].Replicas, key)
+		}
+	}
+
+	// the replicas held by each node, but those of the table being rebuilt
+	load := make(map[string]int)
+	for fragment, replicas := range c.currentPlacement().FragmentNodes {
+		if fragmentTable(fragment) != tableName {
+			for _, nodeId := range replicas {
+				load[nodeId]++
+			}
+		}
+	}
+	nodes := make(map[string][]string, len(rules))
+	// anti-affinity group -> node -> the key of the rule having a replica there
+	groups := make(map[string]map[string]string)
+	conflict := func(key string, nodeId string) string {
+		group := rules[key].AntiAffinity
+		switch {
+		case contains(nodes[key], nodeId):
+			return fmt.Sprintf("%v holds two replicas of %v", nodeId, key)
+		case group != "" && groups[group][nodeId] != "":
+			return fmt.Sprintf("%v holds replicas of %v and %v of anti-affinity group %v", nodeId,
+				groups[group][nodeId], key, group)
+		}
+		return ""
+	}
+	place := func(key string, nodeId string) {
+		nodes[key] = append(nodes[key], nodeId)
+		load[nodeId]++
+		if group := rules[key].AntiAffinity; group != "" {
+			if groups[group] == nil {
+				groups[group] = make(map[string]string)
+			}
+			groups[group][nodeId] = key
+		}
+	}
+
+	for _, key := range keys {
+		if rules[key].Replicas > 0 {
+			continue
+		}
+		for _, nodeId := range c.keyNodes(key) {
+			if reason := conflict(key, nodeId); reason != "" {
+				return nil, nil, "Placement Constraint Violated: " + reason
+			}
+			place(key, nodeId)
+		}
+		if violations := c.placementViolations(rules[key], nodes[key]); len(violations) > 0 {
+			return nil, nil, "Placement Constraint Violated: " + violations[0]
+		}
+	}
+	for _, key := range keys {
+		rule := rules[key]
+		if rule.Replicas == 0 {
+			continue
+		}
+		candidates := c.keyNodes(key)
+		sort.SliceStable(candidates, func(i, j int) bool { return load[candidates[i]] < load[candidates[j]] })
+		for _, nodeId := range candidates {
+			if len(nodes[key]) == rule.Replicas {
+				break
+			}
+			placed := append(append([]string(nil), nodes[key]...), nodeId)
+			if conflict(key, nodeId) == "" && len(c.placementViolations(rule, placed)) == 0 {
+				place(key, nodeId)
+			}
+		}
+		if len(nodes[key]) < rule.Replicas {
+			return nil, nil, fmt.Sprintf("Placement Constraint Violated: cannot place %v replicas of %v, only %v",
+				rule.Replicas, key, len(nodes[key]))
+		}
+	}
+	return keys, nodes, ""
+}
+
+// antiAffine returns a fragment of the same anti-affinity group as the fragment, see Rule.AntiAffinity, having a
+// replica on the node, or "" if none has.
+func antiAffine(placement *Placement, fragment string, nodeId string) string {
+	group := placement.Rule(fragment).AntiAffinity
+	if group == "" {
+		return ""
+	}
+	for _, other := range placement.Fragments(fragmentTable(fragment)) {
+		if other != fragment && placement.Rule(other).AntiAffinity == group &&
+			contains(placement.Replicas(other), nodeId) {
+			return other
+		}
+	}
+	return ""
+}
+
+// keepsConstraints tells whether moving the replica of a fragment from a node to another one violates the
+// constraints of the fragment no more than before, and keeps it apart from the fragments of its anti-affinity group.
+func (c *Cluster) keepsConstraints(placement *Placement, fragment string, from string, to string) bool {
+	if antiAffine(placement, fragment, to) != "" {
+		return false
+	}
+	replicas := placement.Replicas(fragment)
+	moved := make([]string, len(replicas))
+	for i, nodeId := range replicas {
+		moved[i] = nodeId
+		if nodeId == from {
+			moved[i] = to
+		}
+	}
+	rule := placement.Rule(fragment)
+	return len(c.placementViolations(rule, moved)) <= len(c.placementViolations(rule, replicas))
+}
+
+// repairConstraints moves the replicas of the fragments violating their placement constraints, e.g., because the
+// labels of their nodes have changed, each time to the least loaded node fixing one violation, until none is left.
+// The caller must hold writeMu.
+func (c *Cluster) repairConstraints(sizes map[string]int) error {
+	for _, fragment := range sortedKeys(sizes) {
+		for {
+			placement := c.currentPlacement()
+			rule := placement.Rule(fragment)
+			replicas := placement.Replicas(fragment)
+			violations := len(c.placementViolations(rule, replicas))
+			if violations == 0 {
+				break
+			}
+			load := nodeLoads(placement, sizes)
+			from, to := "", ""
+			for i, source := range replicas {
+				for _, target := range c.nodeIds {
+					if contains(replicas, target) || (to != "" && load[target] >= load[to]) ||
+						antiAffine(placement, fragment, target) != "" {
+						continue
+					}
+					moved := append(append(append([]string(nil), replicas[:i]...), target), replicas[i+1:]...)
+					if len(c.placementViolations(rule, moved)) < violations {
+						from, to = source, target
+					}
+				}
+			}
+			if to == "" {
+				return fmt.Errorf("cannot satisfy the placement constraints of %v: %v", fragment,
+					c.placementViolations(rule, replicas)[0])
+			}
+			if err := c.moveReplica(fragment, from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setupZones labels Node0 and Node1 as zone A, Node2 and Node3 as zone B, and Node4 as zone C.
+func setupZones(t *testing.T) {
+	setupLab3()
+	for nodeId, zone := range map[string]string{"Node0": "A", "Node1": "A", "Node2": "B", "Node3": "B", "Node4": "C"} {
+		reply := ""
+		cli.Call("Cluster.SetNodeLabels", []interface{}{nodeId, NodeLabels{"zone": zone}}, &reply)
+		if reply != "0 OK" {
+			t.Fatalf("cannot label %v: %v", nodeId, reply)
+		}
+	}
+}
+
+// buildZonedTables builds the student table replicated on the given nodes in different zones, and the
+// courseRegistration table on Node4 which must stay in zone C.
+func buildZonedTables(t *testing.T, studentNodes ...int) string {
+	var err error
+	studentTablePartitionRules, err = NewRuleSet(*studentTableSchema).
+		AddHorizontalRule(Predicate{}, studentNodes...).
+		Constrain(PlacementConstraint{Label: "zone", Spread: true}).
+		Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	courseRegistrationTablePartitionRules, err = NewRuleSet(*courseRegistrationTableSchema).
+		AddHorizontalRule(Predicate{}, 4).
+		Constrain(PlacementConstraint{Label: "zone", Value: "C"}).
+		Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, studentTablePartitionRules}, &reply)
+	if reply != "0 OK" {
+		return reply
+	}
+	cli.Call("Cluster.BuildTable", []interface{}{courseRegistrationTableSchema, courseRegistrationTablePartitionRules},
+		&reply)
+	insertDataLab3(cli)
+	return reply
+}
+
+// checkZones fails the test if some fragment of the table violates its placement constraints.
+func checkZones(t *testing.T, tableName string) {
+	placement := c.currentPlacement()
+	for _, fragment := range placement.Fragments(tableName) {
+		violations := c.placementViolations(placement.Rule(fragment), placement.Replicas(fragment))
+		if len(violations) > 0 {
+			t.Errorf("%v on %v violates its constraints: %v", fragment, placement.Replicas(fragment), violations)
+		}
+	}
+}
+
+func TestPlacementConstraints(t *testing.T) {
+	setupZones(t)
+	if reply := buildZonedTables(t, 0, 1); reply != "1 Placement Constraint Violated: Node1 is in the same zone A as Node0" {
+		t.Errorf("the replicas should not be in the same zone, actual %v", reply)
+	}
+	definition := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", studentTableName, &definition)
+	if definition.Schema.TableName != "" {
+		t.Errorf("the table should not be built, actual %v", definition)
+	}
+
+	if reply := buildZonedTables(t, 0, 2); reply != "0 OK" {
+		t.Fatalf("cannot build the tables: %v", reply)
+	}
+	cli.Call("Cluster.DescribeTable", studentTableName, &definition)
+	if len(definition.Fragments) != 1 || len(definition.Fragments[0].Rule.Constraints) != 1 {
+		t.Errorf("expected the constraints in the definition, actual %v", definition)
+	}
+
+	// Node1 is in the same zone as Node0, and Node4 holds more rows than Node3
+	reply := ""
+	cli.Call("Cluster.DecommissionNode", "Node2", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("DecommissionNode failed: %v", reply)
+	}
+	placement := c.currentPlacement()
+	if replicas := placement.Replicas(placement.Fragments(studentTableName)[0]); !contains(replicas, "Node3") {
+		t.Errorf("expected the replica to move to Node3, actual %v", replicas)
+	}
+	checkZones(t, studentTableName)
+
+	// no other node is in zone C
+	cli.Call("Cluster.DecommissionNode", "Node4", &reply)
+	if !strings.Contains(reply, "placement constraints of "+courseRegistrationTableName) {
+		t.Errorf("courseRegistration should not leave zone C, actual %v", reply)
+	}
+	result := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &result)
+	if !datasetDuplicateChecking(Dataset{Schema: joinedTableSchema, Rows: joinedTableContent}, result) {
+		t.Errorf("unexpected join results %v", result)
+	}
+}
+
+// Rebalance moves the replicas whose nodes no longer satisfy their constraints
+func TestRebalanceRepairsConstraints(t *testing.T) {
+	setupZones(t)
+	if reply := buildZonedTables(t, 0, 2); reply != "0 OK" {
+		t.Fatalf("cannot build the tables: %v", reply)
+	}
+	reply := ""
+	cli.Call("Cluster.SetNodeLabels", []interface{}{"Node2", NodeLabels{"zone": "A"}}, &reply)
+	cli.Call("Cluster.Rebalance", "", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("Rebalance failed: %v", reply)
+	}
+	checkZones(t, studentTableName)
+	checkZones(t, courseRegistrationTableName)
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{DisableCache: true}}, &result)
+	if len(result.Rows) != len(studentRows) {
+		t.Errorf("expected %v rows, actual %v", len(studentRows), result.Rows)
+	}
+
+	for _, nodeId := range c.nodeIds {
+		cli.Call("Cluster.SetNodeLabels", []interface{}{nodeId, NodeLabels{"zone": "A"}}, &reply)
+	}
+	cli.Call("Cluster.Rebalance", "", &reply)
+	if !strings.HasPrefix(reply, "1 cannot satisfy the placement constraints") {
+		t.Errorf("the constraints cannot be satisfied in one zone, actual %v", reply)
+	}
+}
+
+// BuildTable places the replicas asked for on the least loaded nodes, keeping the fragments of the student table apart
+func TestReplicaPlacement(t *testing.T) {
+	setupZones(t)
+	build := func(replicas int) string {
+		rules, err := NewRuleSet(*studentTableSchema).
+			AddHorizontalRule(Predicate{"grade": {{Op: "<=", Val: 3.6}}}).Replicate(replicas).AntiAffinity("student").
+			Constrain(PlacementConstraint{Label: "zone", Spread: true}).
+			AddHorizontalRule(Predicate{"grade": {{Op: ">", Val: 3.6}}}).Replicate(2).AntiAffinity("student").
+			Marshal()
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		reply := ""
+		cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules}, &reply)
+		return reply
+	}
+	if reply := build(4); !strings.HasPrefix(reply, "1 Placement Constraint Violated: cannot place 4 replicas") {
+		t.Errorf("there are only 3 zones, actual %v", reply)
+	}
+	if reply := build(2); reply != "0 OK" {
+		t.Fatalf("cannot build the table: %v", reply)
+	}
+	definition := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", studentTableName, &definition)
+	if len(definition.Fragments) != 2 || definition.Fragments[0].Rule.Replicas != 2 ||
+		!reflect.DeepEqual(definition.Fragments[0].Nodes, []string{"Node0", "Node2"}) ||
+		!reflect.DeepEqual(definition.Fragments[1].Nodes, []string{"Node1", "Node3"}) {
+		t.Errorf("expected the fragments on Node0, Node2 and Node1, Node3, actual %v", definition)
+	}
+	checkZones(t, studentTableName)
+	insertDataLab3(cli)
+
+	// the fragment of Node0 goes to Node4, the only node holding no fragment of the student table
+	reply := ""
+	cli.Call("Cluster.DecommissionNode", "Node0", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("DecommissionNode failed: %v", reply)
+	}
+	placement := c.currentPlacement()
+	if replicas := placement.Replicas(studentTableName + "|0"); !contains(replicas, "Node4") {
+		t.Errorf("expected the replica to move to Node4, actual %v", replicas)
+	}
+	cli.Call("Cluster.DecommissionNode", "Node1", &reply)
+	if !strings.Contains(reply, "placement constraints of "+studentTableName+"|1") {
+		t.Errorf("the fragments of the student table should stay apart, actual %v", reply)
+	}
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{DisableCache: true}}, &result)
+	if len(result.Rows) != len(studentRows) {
+		t.Errorf("expected %v rows, actual %v", len(studentRows), result.Rows)
+	}
+}
@@ -0,0 +1,219 @@
+package models
+
+// Get looks up a single row by its primary key (or by its row id if the table has no primary key), and sets the full
+// row to reply. Only the nodes holding fragments of the row are contacted.
+// A row that does not exist is reported with the schema of the table and no rows, while a failure (an unknown table,
+// or a fragment of the row cannot be read from any of its replicas) is reported with an empty schema.
+// params: tableName string, key interface{}, (optional) hints QueryHints
+func (c *Cluster) Get(params []interface{}, reply *Dataset) {
+	tableName := params[0].(string)
+	key := params[1]
+	q := c.beginQuery(queryHints(params, 2))
+	defer c.endQuery(q)
+	defer c.publishFailedQuery("Get", reply, tableName)
+	defer reorderColumns(reply, q.hints.Columns)
+	defer c.failRenamed(reply, tableName)
+
+	schema, ok := q.catalog.Schema(tableName)
+	if !ok {
+		*reply = Dataset{}
+		return
+	}
+	notFound := Dataset{Schema: schema, Rows: make([]Row, 0), Columns: q.catalog.tableColumns(tableName)}
+
+	id, ok := c.lookupId(q, tableName, key)
+	if !ok {
+		*reply = notFound
+		return
+	}
+	*reply = c.getRow(q, tableName, id)
+	if reply.Schema.TableName != "" {
+		reply.Columns = notFound.Columns
+	}
+}
+
+// lookupId resolves a key of a table to the id of a row stored in the cluster.
+func (c *Cluster) lookupId(q *queryContext, tableName string, key interface{}) (string, bool) {
+	if _, ok := q.catalog.Key(tableName); ok {
+		return c.rowIndex.KeyToId(tableName, key)
+	}
+	id, ok := key.(string)
+	if !ok || c.rowIndex.Locations(tableName, id) == nil {
+		return "", false
+	}
+	return id, true
+}
+
+// getRow reassembles the row with the given id, which is known to exist, and returns an empty dataset if it cannot
+// be read completely.
+func (c *Cluster) getRow(q *queryContext, tableName string, id string) Dataset {
+	schema, _ := q.catalog.Schema(tableName)
+	line := getLineByid(c, q, tableName, id, schema.ColumnSchemas)
+	if line.Schema.TableName == "" || len(line.Rows) == 0 || len(line.Rows[0]) != len(schema.ColumnSchemas) {
+		return Dataset{}
+	}
+	return line
+}
+
+// MultiGet looks up a batch of rows by their keys (see Get) and sets them to reply in the order of the keys, an empty
+// row marks a key that does not exist. If some row cannot be read from any of the replicas, reply is a dataset with an
+// empty schema.
+// params: tableName string, keys []interface{}, (optional) hints QueryHints
+func (c *Cluster) MultiGet(params []interface{}, reply *Dataset) {
+	tableName := params[0].(string)
+	keys := params[1].([]interface{})
+	q := c.beginQuery(queryHints(params, 2))
+	defer c.endQuery(q)
+	defer c.publishFailedQuery("MultiGet", reply, tableName)
+	defer reorderColumns(reply, q.hints.Columns)
+	defer c.failRenamed(reply, tableName)
+
+	schema, ok := q.catalog.Schema(tableName)
+	if !ok {
+		*reply = Dataset{}
+		return
+	}
+	ids := make([]string, 0, len(keys))
+	exists := make([]bool, len(keys))
+	for i, key := range keys {
+		if id, ok := c.lookupId(q, tableName, key); ok {
+			ids = append(ids, id)
+			exists[i] = true
+		}
+	}
+	found, ok := c.fetchRows(q, tableName, ids)
+	if !ok {
+		*reply = Dataset{}
+		return
+	}
+
+	rows := make([]Row, len(keys))
+	for i := range keys {
+		rows[i] = Row{}
+		if exists[i] {
+			rows[i] = found[0]
+			found = found[1:]
+		}
+	}
+	*reply = Dataset{Schema: schema, Rows: rows, Columns: q.catalog.tableColumns(tableName)}
+}
+
+// fetchRows reassembles the rows with the given ids, which are known to exist, and returns them in the order of the
+// ids. The lookups are grouped by node so that each node receives a single RPC, and the lookups sent to a node that
+// does not answer are retried on other replicas. It returns false if some row cannot be read completely.
+func (c *Cluster) fetchRows(q *queryContext, tableName string, ids []string) ([]Row, bool) {
+	schema, _ := q.catalog.Schema(tableName)
+	versions := c.fragmentVersionKey(q.placement, tableName)
+
+	// a lookup of a row in a fragment, together with the replicas of the fragment that have not been tried
+	type lookup struct {
+		fragment, id string
+		replicas     []string
+	}
+	rows := make([]Row, len(ids))
+	// row id -> column name -> value, for the rows that are not cached
+	values := make(map[string]map[string]interface{})
+	todo := make([]lookup, 0)
+	for i, id := range ids {
+		if q.useCache() {
+			if row, ok := c.rowCache.Get(tableName, id, versions); ok {
+				rows[i] = row
+				continue
+			}
+		}
+		if _, ok := values[id]; ok {
+			continue
+		}
+		values[id] = make(map[string]interface{})
+		for _, fragment := range c.rowIndex.Fragments(tableName, id) {
+			todo = append(todo, lookup{fragment: fragment, id: id, replicas: q.placement.Replicas(fragment)})
+		}
+	}
+
+	for len(todo) > 0 {
+		// group the lookups by the first replica that has not been tried
+		batches := make(map[string][]lookup)
+		for _, l := range todo {
+			if len(l.replicas) == 0 {
+				return nil, false
+			}
+			batches[l.replicas[0]] = append(batches[l.replicas[0]], l)
+		}
+		todo = make([]lookup, 0)
+		for nodeId, batch := range batches {
+			fragments := make([]string, len(batch))
+			batchIds := make([]string, len(batch))
+			for j, l := range batch {
+				fragments[j] = l.fragment
+				batchIds[j] = l.id
+			}
+			var result []Dataset
+			args := ScanLinesArgs{Fragments: fragments, Ids: batchIds, Masks: q.columnMasks(tableName)}
+			ok := c.nodeEnd(nodeId).Call("Node.RPCScanLines", args, &result)
+			for j, l := range batch {
+				if !ok || j >= len(result) || result[j].Schema.TableName == "" {
+					l.replicas = l.replicas[1:]
+					todo = append(todo, l)
+					continue
+				}
+				if len(result[j].Rows) == 0 || len(result[j].Rows[0]) == 0 {
+					continue
+				}
+				for k, cs := range result[j].Schema.ColumnSchemas[1:] {
+					values[l.id][cs.Name] = result[j].Rows[0][k+1]
+				}
+			}
+		}
+	}
+
+	for i, id := range ids {
+		if rows[i] != nil {
+			continue
+		}
+		row := make(Row, 0, len(schema.ColumnSchemas))
+		for _, cs := range schema.ColumnSchemas {
+			if val, exist := values[id][cs.Name]; exist {
+				row = append(row, val)
+			}
+		}
+		if len(row) != len(schema.ColumnSchemas) {
+			return nil, false
+		}
+		if q.useCache() {
+			c.rowCache.Put(tableName, id, versions, row)
+		}
+		rows[i] = row
+	}
+	return rows, true
+}
+
+// Scan reads all rows of a table and sets them to reply in the order they were written. Rows that cannot be fully
+// reassembled are skipped, and the fragments that cannot be read are reported, as in Join, while an unknown table is
+// reported with an empty schema. The hints may filter the rows, the fragments that cannot hold any of them not being
+// read, see QueryHints.Where.
+// params: tableName string, (optional) hints QueryHints
+func (c *Cluster) Scan(params []interface{}, reply *Dataset) {
+	tableName := params[0].(string)
+	q := c.beginQuery(queryHints(params, 1))
+	defer c.endQuery(q)
+	defer c.publishFailedQuery("Scan", reply, tableName)
+	defer reorderColumns(reply, q.hints.Columns)
+	defer c.failRenamed(reply, tableName)
+	defer q.reportUnavailable(reply)
+
+	schema, ok := q.catalog.Schema(tableName)
+	if !ok {
+		*reply = Dataset{}
+		return
+	}
+	if _, err := q.wherePredicate(tableName); err != "" {
+		*reply = Dataset{Error: err}
+		return
+	}
+	if err := q.asOfError(tableName); err != "" {
+		*reply = Dataset{Error: err}
+		return
+	}
+	rows, provenance := tableRows(c, q, tableName, schema.ColumnSchemas)
+	*reply = Dataset{Schema: schema, Rows: rows, Provenance: provenance, Columns: q.catalog.tableColumns(tableName)}
+}
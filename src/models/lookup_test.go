@@ -0,0 +1,145 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	setupLab3()
+
+	m := map[string]interface{}{
+		"0|1": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  "<=",
+					"val": 3.6,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "name",
+			},
+		},
+		"2": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  "<=",
+					"val": 3.6,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "age", "grade",
+			},
+		},
+		"3": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  ">",
+					"val": 3.6,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "name", "age", "grade",
+			},
+		},
+	}
+	studentTablePartitionRules, _ = json.Marshal(m)
+
+	replyMsg := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, studentTablePartitionRules, "sid"}, &replyMsg)
+	for _, row := range studentRows {
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, row}, &replyMsg)
+	}
+
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Ann", 20, 3.0}}, &replyMsg)
+	replyMsg = ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{1, "Smith", 23, 3.6}}, &replyMsg)
+	if replyMsg[0] == '0' {
+		t.Errorf("duplicate key should be rejected")
+	}
+
+	expected := Dataset{Schema: *studentTableSchema, Rows: []Row{studentRows[1]}}
+	result := Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 1}, &result)
+	if !compareDataset(expected, result) {
+		t.Errorf("Incorrect lookup result, expected %v, actual %v", expected, result)
+	}
+
+	result = Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 10}, &result)
+	if result.Schema.TableName != studentTableName || len(result.Rows) != 0 {
+		t.Errorf("missing key should be reported as not found, actual %v", result)
+	}
+
+	// both replicas of the fragment holding the name of student 3 are down
+	network.DeleteServer("Node0")
+	network.DeleteServer("Node1")
+	result = Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 3}, &result)
+	if result.Schema.TableName != "" {
+		t.Errorf("lookup should fail when a fragment is unreachable, actual %v", result)
+	}
+
+	// student 2 is stored in node3 only
+	result = Dataset{}
+	expected.Rows = []Row{studentRows[2]}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 2}, &result)
+	if !compareDataset(expected, result) {
+		t.Errorf("Incorrect lookup result, expected %v, actual %v", expected, result)
+	}
+}
+
+func TestMultiGet(t *testing.T) {
+	setupLab3()
+
+	m := map[string]interface{}{
+		"0|1": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  "<=",
+					"val": 3.6,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "name", "age", "grade",
+			},
+		},
+		"1|2": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  ">",
+					"val": 3.6,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "name", "age", "grade",
+			},
+		},
+	}
+	studentTablePartitionRules, _ = json.Marshal(m)
+
+	replyMsg := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, studentTablePartitionRules, "sid"}, &replyMsg)
+	for _, row := range studentRows {
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, row}, &replyMsg)
+	}
+
+	// node1 holds replicas of both fragments, the lookups sent to it should be retried on the others
+	network.DeleteServer("Node1")
+	result := Dataset{}
+	cli.Call("Cluster.MultiGet", []interface{}{studentTableName, []interface{}{2, 7, 0, 1}}, &result)
+	if len(result.Rows) != 4 {
+		t.Fatalf("expected 4 rows, actual %v", result)
+	}
+	expected := []Row{studentRows[2], {}, studentRows[0], studentRows[1]}
+	for i, row := range result.Rows {
+		if !row.Equals(&expected[i]) {
+			t.Errorf("Incorrect row %d, expected %v, actual %v", i, expected[i], row)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"../labrpc"
+)
+
+// Mapper converts between the values of a Go struct type and the rows of a table, so that application code need not
+// juggle []interface{}. Each exported field is a column named by its `column` tag, or by the name of the field if it
+// has no tag, in the order of the fields. The tag may also give the type of the column, which is otherwise derived
+// from the type of the field, and "-" skips the field:
+//
+//	type Student struct {
+//		Sid   int     `column:"sid"`
+//		Name  string  `column:"name"`
+//		Grade float64 `column:"grade,float"`
+//		Note  string  `column:"-"`
+//	}
+//
+// A pointer field holds a nullable column, nil being null.
+type Mapper struct {
+	schema TableSchema
+	typ    reflect.Type
+	// the index of the field of each column
+	fields []int
+}
+
+// fieldTypes are the types of the columns of the fields without a type in their tags.
+var fieldTypes = map[reflect.Kind]int{
+	reflect.Int:     TypeInt32,
+	reflect.Int8:    TypeInt32,
+	reflect.Int16:   TypeInt32,
+	reflect.Int32:   TypeInt32,
+	reflect.Int64:   TypeInt64,
+	reflect.Float32: TypeFloat,
+	reflect.Float64: TypeDouble,
+	reflect.Bool:    TypeBoolean,
+	reflect.String:  TypeString,
+}
+
+// NewMapper creates a Mapper of a table for the struct type of prototype, which may be a struct or a pointer to one.
+func NewMapper(tableName string, prototype interface{}) (*Mapper, error) {
+	typ := reflect.TypeOf(prototype)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, errors.New("a mapper needs a struct")
+	}
+	m := &Mapper{schema: TableSchema{TableName: tableName, ColumnSchemas: make([]ColumnSchema, 0)}, typ: typ}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, typeName := field.Name, ""
+		if tag, ok := field.Tag.Lookup("column"); ok {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.SplitN(tag, ",", 2)
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			if len(parts) > 1 {
+				typeName = parts[1]
+			}
+		}
+		kind := field.Type.Kind()
+		if kind == reflect.Ptr {
+			kind = field.Type.Elem().Kind()
+		}
+		dataType, ok := fieldTypes[kind]
+		if !ok {
+			return nil, fmt.Errorf("field %v has unsupported type %v", field.Name, field.Type)
+		}
+		if typeName != "" {
+			if dataType, ok = columnTypes[typeName]; !ok {
+				return nil, fmt.Errorf("field %v has unknown column type %v", field.Name, typeName)
+			}
+		}
+		m.schema.ColumnSchemas = append(m.schema.ColumnSchemas, ColumnSchema{Name: name, DataType: dataType})
+		m.fields = append(m.fields, i)
+	}
+	if len(m.fields) == 0 {
+		return nil, errors.New("a mapper needs at least one column")
+	}
+	return m, nil
+}
+
+// Schema returns the schema of the table, which can be given to BuildTable.
+func (m *Mapper) Schema() TableSchema {
+	return TableSchema{TableName: m.schema.TableName,
+		ColumnSchemas: append([]ColumnSchema(nil), m.schema.ColumnSchemas...)}
+}
+
+// Row converts a struct, or a pointer to one, to a row of the table. Integers are converted to int and floating point
+// numbers to float64, as the rows written by the tests.
+func (m *Mapper) Row(value interface{}) (Row, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Type() != m.typ {
+		return nil, fmt.Errorf("expected %v, actual %v", m.typ, v.Type())
+	}
+	row := make(Row, len(m.fields))
+	for i, index := range m.fields {
+		field := v.Field(index)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			row[i] = int(field.Int())
+		case reflect.Float32, reflect.Float64:
+			row[i] = field.Float()
+		default:
+			row[i] = field.Interface()
+		}
+	}
+	return row, nil
+}
+
+// Decode converts the rows of a dataset into the slice pointed by out, whose elements are structs of the type of the
+// Mapper. The columns are matched by name, so the dataset may be a join holding more columns than the table, and the
+// fields of the columns absent from the dataset are left zero.
+func (m *Mapper) Decode(dataset Dataset, out interface{}) error {
+	slice := reflect.ValueOf(out)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice || slice.Elem().Type().Elem() != m.typ {
+		return fmt.Errorf("expected *[]%v, actual %T", m.typ, out)
+	}
+	// the position of each column of the Mapper in the dataset
+	positions := make([]int, len(m.fields))
+	for i, cs := range m.schema.ColumnSchemas {
+		positions[i] = -1
+		for j, column := range dataset.Schema.ColumnSchemas {
+			if column.Name == cs.Name {
+				positions[i] = j
+				break
+			}
+		}
+	}
+
+	result := reflect.MakeSlice(slice.Elem().Type(), 0, len(dataset.Rows))
+	for _, row := range dataset.Rows {
+		v := reflect.New(m.typ).Elem()
+		for i, index := range m.fields {
+			if positions[i] < 0 || positions[i] >= len(row) {
+				continue
+			}
+			if err := setField(v.Field(index), row[positions[i]]); err != nil {
+				return fmt.Errorf("column %v: %v", m.schema.ColumnSchemas[i].Name, err)
+			}
+		}
+		result = reflect.Append(result, v)
+	}
+	slice.Elem().Set(result)
+	return nil
+}
+
+// Insert writes a struct as a row of the table through a client end connected to the cluster.
+func (m *Mapper) Insert(end *labrpc.ClientEnd, value interface{}) error {
+	row, err := m.Row(value)
+	if err != nil {
+		return err
+	}
+	reply := ""
+	if !end.Call("Cluster.FragmentWrite", []interface{}{m.schema.TableName, row}, &reply) {
+		return errors.New("the cluster does not answer")
+	}
+	if len(reply) == 0 || reply[0] != '0' {
+		return errors.New(reply)
+	}
+	return nil
+}
+
+// setField sets a value of a row to a field, converting numbers to the type of the field.
+func setField(field reflect.Value, value interface{}) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setField(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// the integers are set as they are, so that the large ones do not lose precision through float64
+		i, ok := integerValue(value)
+		if !ok {
+			f, isNumber := numberValue(value)
+			if !isNumber || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return fmt.Errorf("%v is not an integer", value)
+			}
+			i = int64(f)
+		}
+		if field.OverflowInt(i) {
+			return fmt.Errorf("%v overflows %v", value, field.Type())
+		}
+		field.SetInt(i)
+	case reflect.Float32, reflect.Float64:
+		f, ok := numberValue(value)
+		if !ok {
+			return fmt.Errorf("%v is not a number", value)
+		}
+		field.SetFloat(f)
+	case reflect.Bool, reflect.String:
+		v := reflect.ValueOf(value)
+		if v.Kind() != field.Kind() {
+			return fmt.Errorf("%v is not a %v", value, field.Kind())
+		}
+		field.Set(v.Convert(field.Type()))
+	}
+	return nil
+}
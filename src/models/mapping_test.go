@@ -0,0 +1,103 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type mappedStudent struct {
+	Sid   int      `column:"sid"`
+	Name  string   `column:"name"`
+	Age   int      `column:"age"`
+	Grade float64  `column:"grade,float"`
+	Club  *string  `column:"club"`
+	Note  string   `column:"-"`
+	score *float64 // unexported fields are not columns
+}
+
+func TestMapper(t *testing.T) {
+	setupLab3()
+
+	m, err := NewMapper(studentTableName, mappedStudent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := m.Schema()
+	expectedColumns := append(append([]ColumnSchema(nil), studentTableSchema.ColumnSchemas...),
+		ColumnSchema{Name: "club", DataType: TypeString})
+	if compareDatasetSchema(schema, TableSchema{ColumnSchemas: expectedColumns}) == nil {
+		t.Fatalf("expected columns %v, actual %v", expectedColumns, schema.ColumnSchemas)
+	}
+
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade", "club"),
+		"2":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade", "club"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{schema, rules, "sid"}, &reply)
+	if reply[0] != '0' {
+		t.Fatalf("cannot build the table: %v", reply)
+	}
+	chess := "chess"
+	students := []mappedStudent{
+		{Sid: 0, Name: "John", Age: 22, Grade: 4.0, Club: &chess, Note: "not stored"},
+		{Sid: 1, Name: "Smith", Age: 23, Grade: 3.6},
+	}
+	for _, s := range students {
+		if err := m.Insert(cli, &s); err != nil {
+			t.Fatalf("cannot insert %v: %v", s, err)
+		}
+	}
+	if err := m.Insert(cli, students[0]); err == nil {
+		t.Error("a duplicate key should not be inserted")
+	}
+
+	result := Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 0}, &result)
+	decoded := make([]mappedStudent, 0)
+	if err := m.Decode(result, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0].Name != "John" || decoded[0].Grade != 4.0 || decoded[0].Club == nil ||
+		*decoded[0].Club != "chess" || decoded[0].Note != "" {
+		t.Errorf("expected %v, actual %v", students[0], decoded)
+	}
+
+	result = Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 1}, &result)
+	if err := m.Decode(result, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0].Sid != 1 || decoded[0].Age != 23 || decoded[0].Club != nil {
+		t.Errorf("expected %v, actual %v", students[1], decoded)
+	}
+
+	if err := m.Decode(result, &[]int{}); err == nil {
+		t.Error("decoding into a slice of another type should fail")
+	}
+	if _, err := NewMapper(studentTableName, 0); err == nil {
+		t.Error("a mapper of a non-struct type should fail")
+	}
+}
+
+// the integers beyond the precision of float64 are set as they are
+func TestSetLargeIntegers(t *testing.T) {
+	large := int64(1)<<62 + 1
+	var i64 int64
+	for _, value := range []interface{}{large, json.Number("4611686018427387905")} {
+		if err := setField(reflect.ValueOf(&i64).Elem(), value); err != nil || i64 != large {
+			t.Errorf("expected %v from %v, actual %v %v", large, value, i64, err)
+		}
+	}
+	var i32 int32
+	if err := setField(reflect.ValueOf(&i32).Elem(), large); err == nil {
+		t.Errorf("expected %v to overflow int32, actual %v", large, i32)
+	}
+	if err := setField(reflect.ValueOf(&i32).Elem(), 7.0); err != nil || i32 != 7 {
+		t.Errorf("expected 7 from a float, actual %v %v", i32, err)
+	}
+	if err := setField(reflect.ValueOf(&i32).Elem(), 7.5); err == nil {
+		t.Errorf("expected 7.5 not to be an integer")
+	}
+}
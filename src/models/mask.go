@@ -0,0 +1,184 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// enumeration of masking methods
+const (
+	// replace all characters but the last Keep ones with '*'
+	MaskRedact = "redact"
+	// replace the value with the hex SHA-256 of it, so that equal values are still equal once masked
+	MaskHash = "hash"
+)
+
+// ColumnMask tells how the values of a string column are masked for the users who are not privileged, see
+// Cluster.MaskColumn.
+type ColumnMask struct {
+	// one of the masking methods above
+	Method string
+	// how many trailing characters a redacted value keeps
+	Keep int
+}
+
+// apply returns the masked value.
+func (m ColumnMask) apply(value interface{}) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	if m.Method == MaskHash {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	runes := []rune(s)
+	hidden := len(runes) - m.Keep
+	if hidden < 0 {
+		hidden = 0
+	}
+	return strings.Repeat("*", hidden) + string(runes[hidden:])
+}
+
+// MaskColumn masks a string column of a table in the results of the queries (Get, MultiGet, Scan, Query and Join) of
+// every user who is not privileged (see SetPrivileged), including the queries without a user (see QueryHints.User).
+// The values are masked by the nodes scanning the fragments, so that the raw values of a masked column never leave
+// the nodes for those users, and such queries neither read nor fill the row cache. A join of a masked table is
+// executed at the coordinator on the masked values. A mask with an empty method unmasks the column.
+// The values are stored as they are, and the migrations, indexes and exports still see them unmasked.
+// params: tableName string, column string, mask ColumnMask
+func (c *Cluster) MaskColumn(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tableName := params[0].(string)
+	column := params[1].(string)
+	mask := params[2].(ColumnMask)
+	schema, ok := c.catalog.Schema(tableName)
+	if !ok {
+		if err := c.currentPlacement().renamedError(tableName); err != "" {
+			*reply = "1 " + err
+		} else {
+			*reply = "1 No Such Table"
+		}
+		return
+	}
+	dataType := -1
+	for _, cs := range schema.ColumnSchemas {
+		if cs.Name == column {
+			dataType = cs.DataType
+		}
+	}
+	if dataType < 0 {
+		*reply = "1 No Such Column " + column
+		return
+	}
+	if dataType != TypeString {
+		*reply = "1 TypeError"
+		return
+	}
+	if mask.Method != "" && mask.Method != MaskRedact && mask.Method != MaskHash || mask.Keep < 0 {
+		*reply = "1 Invalid Mask"
+		return
+	}
+
+	// the masks of a table are replaced rather than modified, as the placements installed before share them
+	next := c.currentPlacement().clone()
+	masks := make(map[string]ColumnMask, len(next.Masks[tableName])+1)
+	for name, m := range next.Masks[tableName] {
+		masks[name] = m
+	}
+	if mask.Method == "" {
+		delete(masks, column)
+	} else {
+		masks[column] = mask
+	}
+	if len(masks) == 0 {
+		delete(next.Masks, tableName)
+	} else {
+		next.Masks[tableName] = masks
+	}
+	c.installPlacement(next)
+	*reply = "0 OK"
+}
+
+// SetPrivileged makes a user see the masked columns unmasked, or masked again, see MaskColumn.
+// params: user string, privileged bool
+func (c *Cluster) SetPrivileged(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	user := params[0].(string)
+	next := c.currentPlacement().clone()
+	if params[1].(bool) {
+		next.Privileged[user] = true
+	} else {
+		delete(next.Privileged, user)
+	}
+	c.installPlacement(next)
+	*reply = "0 OK"
+}
+
+// masksFor returns the masks of the columns (table name -> column name -> mask) a user has to see masked, nil if the
+// user is privileged.
+func (p *Placement) masksFor(user string) map[string]map[string]ColumnMask {
+	if p.Privileged[user] || len(p.Masks) == 0 {
+		return nil
+	}
+	return p.Masks
+}
+
+// columnMasks returns the masks the nodes apply to the rows of a table read by the query.
+func (q *queryContext) columnMasks(tableName string) map[string]ColumnMask {
+	return q.masks[tableName]
+}
+
+// masked tells whether the query sees some column of the tables masked.
+func (q *queryContext) masked(tableNames ...string) bool {
+	for _, tableName := range tableNames {
+		if len(q.masks[tableName]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// maskRows returns the rows of a fragment with the masked columns masked. The rows are copied before being masked, as
+// they may be those stored by the node.
+func maskRows(schema TableSchema, rows []Row, masks map[string]ColumnMask) []Row {
+	if len(masks) == 0 {
+		return rows
+	}
+	columns := make(map[int]ColumnMask)
+	for i, cs := range schema.ColumnSchemas {
+		if mask, ok := masks[cs.Name]; ok {
+			columns[i] = mask
+		}
+	}
+	if len(columns) == 0 {
+		return rows
+	}
+	masked := make([]Row, len(rows))
+	for i, row := range rows {
+		masked[i] = copyRow(row)
+		for j, mask := range columns {
+			if j < len(row) {
+				masked[i][j] = mask.apply(row[j])
+			}
+		}
+	}
+	return masked
+}
+
+// MaskColumn masks a column through the owner of the table, see Cluster.MaskColumn.
+// params: the same as Cluster.MaskColumn
+func (r *Router) MaskColumn(params []interface{}, reply *string) {
+	r.forward(params[0].(string), "MaskColumn", params, reply)
+}
+
+// SetPrivileged sets whether a user is privileged through every coordinator, see Cluster.SetPrivileged.
+// params: the same as Cluster.SetPrivileged
+func (r *Router) SetPrivileged(params []interface{}, reply *string) {
+	r.broadcast("SetPrivileged", params, reply)
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"testing"
+)
+
+// names returns the set of the names of the student rows, or of the joined rows.
+func names(rows []Row) map[interface{}]bool {
+	result := make(map[interface{}]bool)
+	for _, row := range rows {
+		result[row[1]] = true
+	}
+	return result
+}
+
+func TestMaskColumn(t *testing.T) {
+	setupSoftDelete(0)
+	// the rows are cached by a query before the column is masked
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName}, &result)
+	reply := ""
+	cli.Call("Cluster.MaskColumn", []interface{}{studentTableName, "name", ColumnMask{Method: MaskRedact, Keep: 1}},
+		&reply)
+	if reply != "0 OK" {
+		t.Fatalf("MaskColumn failed: %v", reply)
+	}
+
+	masked := map[interface{}]bool{"***n": true, "****h": true, "***a": true}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName}, &result)
+	if got := names(result.Rows); len(result.Rows) != 3 || len(got) != 3 || !got["***n"] || !got["****h"] ||
+		!got["***a"] {
+		t.Errorf("expected the names masked, actual %v", result.Rows)
+	}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 0}, &result)
+	if len(result.Rows) != 1 || result.Rows[0][1] != "***n" || result.Rows[0][3] != 4.0 {
+		t.Errorf("expected the name of John masked, actual %v", result.Rows)
+	}
+	cli.Call("Cluster.MultiGet", []interface{}{studentTableName, []interface{}{1, 2}}, &result)
+	if len(result.Rows) != 2 || result.Rows[0][1] != "****h" || result.Rows[1][1] != "***a" {
+		t.Errorf("expected the names masked, actual %v", result.Rows)
+	}
+	client := NewClient(network, "ClientB", c.Name)
+	if result := client.Get(studentTableName, 1); len(result.Rows) != 1 || result.Rows[0][1] != "****h" {
+		t.Errorf("the rows read by the client directly should be masked, actual %v", result.Rows)
+	}
+	for _, strategy := range []int{JoinAuto, JoinBroadcast, JoinSemi} {
+		cli.Call("Cluster.JoinWithHints", []interface{}{[]string{studentTableName, courseRegistrationTableName},
+			QueryHints{JoinStrategy: strategy}}, &result)
+		if len(result.Rows) != len(joinedTableContent) {
+			t.Errorf("expected %v joined rows, actual %v", len(joinedTableContent), result.Rows)
+		}
+		for name := range names(result.Rows) {
+			if !masked[name] {
+				t.Errorf("strategy %v: expected the names masked, actual %v", strategy, result.Rows)
+			}
+		}
+	}
+
+	// the values sent by the nodes are masked already
+	placement := c.currentPlacement()
+	for _, fragment := range placement.Fragments(studentTableName) {
+		dataset, ok := readFragment(c.nodeEnd(placement.Replicas(fragment)[0]), fragment,
+			placement.Masks[studentTableName])
+		if !ok {
+			t.Fatalf("cannot read %v", fragment)
+		}
+		for _, row := range dataset.Rows {
+			if !masked[row[2]] {
+				t.Errorf("%v should be masked by the node, actual %v", fragment, row)
+			}
+		}
+	}
+
+	// the privileged users and the coordinator itself see the raw values
+	cli.Call("Cluster.SetPrivileged", []interface{}{"admin", true}, &reply)
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{User: "admin"}}, &result)
+	if !datasetDuplicateChecking(Dataset{Schema: *studentTableSchema, Rows: studentRows}, result) {
+		t.Errorf("expected the raw rows, actual %v", result.Rows)
+	}
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"name": {{Op: "==", Val: "John"}}}}, &reply)
+	if reply != "0 1" {
+		t.Errorf("the predicate should see the raw names, actual %v", reply)
+	}
+
+	cli.Call("Cluster.MaskColumn", []interface{}{studentTableName, "name", ColumnMask{}}, &reply)
+	cli.Call("Cluster.Scan", []interface{}{studentTableName}, &result)
+	if got := names(result.Rows); len(result.Rows) != 2 || !got["Smith"] || !got["Hana"] {
+		t.Errorf("the column should be unmasked, actual %v", result.Rows)
+	}
+}
+
+func TestMaskColumnHash(t *testing.T) {
+	setupSoftDelete(0)
+	reply := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "John", 20, 3.0}}, &reply)
+	cli.Call("Cluster.MaskColumn", []interface{}{studentTableName, "name", ColumnMask{Method: MaskHash}}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("MaskColumn failed: %v", reply)
+	}
+	result := Dataset{}
+	cli.Call("Cluster.MultiGet", []interface{}{studentTableName, []interface{}{0, 1, 3}}, &result)
+	if len(result.Rows) != 3 {
+		t.Fatalf("expected 3 rows, actual %v", result.Rows)
+	}
+	john, _ := result.Rows[0][1].(string)
+	if len(john) != 64 || john != result.Rows[2][1] || john == result.Rows[1][1] {
+		t.Errorf("the equal names should have equal hashes, actual %v", result.Rows)
+	}
+
+	for mask, expected := range map[ColumnMask]string{
+		{Method: "shuffle"}:            "1 Invalid Mask",
+		{Method: MaskRedact, Keep: -1}: "1 Invalid Mask",
+	} {
+		cli.Call("Cluster.MaskColumn", []interface{}{studentTableName, "name", mask}, &reply)
+		if reply != expected {
+			t.Errorf("%v: expected %v, actual %v", mask, expected, reply)
+		}
+	}
+	cli.Call("Cluster.MaskColumn", []interface{}{studentTableName, "age", ColumnMask{Method: MaskHash}}, &reply)
+	if reply != "1 TypeError" {
+		t.Errorf("only a string column can be masked, actual %v", reply)
+	}
+	cli.Call("Cluster.MaskColumn", []interface{}{studentTableName, "x", ColumnMask{Method: MaskHash}}, &reply)
+	if reply != "1 No Such Column x" {
+		t.Errorf("expected an unknown column, actual %v", reply)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"sync"
+	"time"
 )
 
 // Node manages some tables defined in models/table.go
@@ -12,17 +15,50 @@ type Node struct {
 	Identifier string
 	// tableName -> table
 	TableMap map[string]*Table
+	// guards TableMap and the tables in it, as RPCs are served concurrently
+	mu sync.RWMutex
+	// a draining node rejects writes, see RPCDrain
+	draining bool
+	// when the change being replayed was logged, zero if the node is not replaying its log, see now
+	replayAt int64
+	// the disk of the node, which logs the changes of the tables, nil if the node is not persisted
+	persister *Persister
+	// the directory of the files of the disk-backed tables, that of the temporary files if empty, see
+	// Cluster.SetDataDir
+	dataDir string
+	// the simulated constraints of the node, see NodeResources, guarded by resourceMu instead of mu so that they can be
+	// checked before mu is taken
+	resources  NodeResources
+	resourceMu sync.Mutex
+	// holds a token for each RPC being served if the number of concurrent RPCs is limited, nil otherwise
+	slots chan struct{}
+	// how many RPCs wait for a slot and how many are being served, see RPCLoad, guarded by resourceMu
+	queued  int
+	serving int
+	// the metadata and the liveness of the nodes learned from the gossips, see RPCStartGossip
+	gossip *gossiper
+	// the rows found misplaced by the background verification of the rule predicates, see RPCStartVerification
+	verifier *verifier
+	// snapshot id -> the snapshots of fragments being read, see RPCSnapshotFragment, guarded by snapshotMu so that
+	// they can be taken while holding mu for reading
+	snapshots   map[string]*fragmentSnapshot
+	snapshotNum int
+	// how long a snapshot which is not scanned is kept, see RPCSetSnapshotLease
+	snapshotLease time.Duration
+	snapshotMu    sync.Mutex
 }
 
 // NewNode creates a new node with the given name and an empty set of tables
 func NewNode(id string) *Node {
-	return &Node{TableMap: make(map[string]*Table), Identifier: id}
+	return &Node{TableMap: make(map[string]*Table), Identifier: id, gossip: newGossiper(), verifier: newVerifier(),
+		snapshots: make(map[string]*fragmentSnapshot), snapshotLease: defaultSnapshotLease}
 }
 
 // SayHello is an example about how to create a method that can be accessed by RPC (remote procedure call, methods that
 // can be called through network from another node). RPC methods should have exactly two arguments, the first one is the
 // actual argument (or an argument list), while the second one is a reference to the result.
 func (n *Node) SayHello(args interface{}, reply *string) {
+	defer n.admit()()
 	// NOTICE: use reply (the second parameter) to pass the return value instead of "return" statements.
 	*reply = fmt.Sprintf("Hello %s, I am Node %s", args, n.Identifier)
 }
@@ -43,22 +79,40 @@ func (n *Node) CreateTable(schema *TableSchema) error {
 	return nil
 }
 
-// Insert inserts a row into the specified table, and returns nil if succeeds or an error if the table does not exist.
+// createTableIn creates a Table as CreateTable does, its rows being stored in the tier of the storage.
+func (n *Node) createTableIn(schema *TableSchema, storage TableStorage) error {
+	if _, ok := n.TableMap[schema.TableName]; ok {
+		return errors.New("table already exists")
+	}
+	rowStore, err := newRowStore(storage, n.dataDir)
+	if err != nil {
+		return err
+	}
+	n.TableMap[schema.TableName] = NewTable(schema, rowStore)
+	n.TableMap[schema.TableName].storage = storage
+	if storage.History > 0 {
+		n.TableMap[schema.TableName].history = newRowHistory(storage.History, n.now)
+	}
+	return nil
+}
+
+// Insert inserts a row into the specified table, and returns nil if succeeds or an error if the table does not exist
+// or its store has failed, see storeError.
 func (n *Node) Insert(tableName string, row *Row) error {
 	if t, ok := n.TableMap[tableName]; ok {
 		t.Insert(row)
-		return nil
+		return storeError(t)
 	} else {
 		return errors.New("no such table")
 	}
 }
 
-// Remove removes a row from the specified table, and returns nil if succeeds or an error if the table does not exist.
-// It does not concern whether the provided row exists in the table.
+// Remove removes a row from the specified table, and returns nil if succeeds or an error if the table does not exist
+// or its store has failed. It does not concern whether the provided row exists in the table.
 func (n *Node) Remove(tableName string, row *Row) error {
 	if t, ok := n.TableMap[tableName]; ok {
 		t.Remove(row)
-		return nil
+		return storeError(t)
 	} else {
 		return errors.New("no such table")
 	}
@@ -92,12 +146,13 @@ func (n *Node) count(tableName string) (int, error) {
 // table through network all at once, so sending a whole table in one RPC is very impractical. One recommended way is to
 // fetch a batch of Rows a time.
 func (n *Node) ScanTable(tableName string, dataset *Dataset) {
+	defer n.admit()()
 	if t, ok := n.TableMap[tableName]; ok {
 		resultSet := Dataset{}
 
 		tableRows := make([]Row, t.Count())
 		i := 0
-		iterator := t.RowIterator()
+		iterator := n.rowIterator(t)
 		for iterator.HasNext() {
 			tableRows[i] = *iterator.Next()
 			i = i + 1
@@ -110,17 +165,20 @@ func (n *Node) ScanTable(tableName string, dataset *Dataset) {
 }
 
 // return a row which has id in tableName
-// args: tableName string, id string
-func (n *Node) ScanLineData(args []interface{}, dataset *Dataset) {
-	tableName := args[0].(string)
-	id := args[1].(string)
+func (n *Node) ScanLineData(args ScanLineDataArgs, dataset *Dataset) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	tableName := args.Fragment
+	id := args.Id
 
 	if t, ok := n.TableMap[tableName]; ok {
 		resultSet := Dataset{}
 
 		tableRows := make([]Row, 1)
 
-		iterator := t.RowIterator()
+		iterator := n.rowIterator(t)
 		for iterator.HasNext() {
 			row := *iterator.Next()
 			if row[0] == id {
@@ -131,13 +189,270 @@ func (n *Node) ScanLineData(args []interface{}, dataset *Dataset) {
 
 		resultSet.Rows = tableRows
 		resultSet.Schema = *t.schema
+		if tableRows[0] != nil {
+			resultSet.Rows = maskRows(resultSet.Schema, tableRows, args.Masks)
+		}
 		*dataset = resultSet
 
 	}
 }
 
+// RPCScanFragment returns at most limit rows of a fragment starting from the offset-th row, together with the schema
+// of the fragment, so that a whole fragment can be fetched with a few RPCs instead of one RPC per row.
+// A dataset with an empty table name is returned if the fragment does not exist on this node, or its store has failed.
+// The columns of the masks, if any, are masked, see Cluster.MaskColumn.
+func (n *Node) RPCScanFragment(args ScanFragmentArgs, dataset *Dataset) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	tableName := args.Fragment
+	offset := args.Offset
+	limit := args.Limit
+
+	if t, ok := n.TableMap[tableName]; ok {
+		resultSet := Dataset{Schema: *t.schema, Rows: make([]Row, 0)}
+		i := 0
+		iterator := n.rowIterator(t)
+		for iterator.HasNext() && len(resultSet.Rows) < limit {
+			row := iterator.Next()
+			if i >= offset {
+				resultSet.Rows = append(resultSet.Rows, *row)
+			}
+			i++
+		}
+		if storeError(t) != nil {
+			*dataset = Dataset{}
+			return
+		}
+		resultSet.Rows = maskRows(resultSet.Schema, resultSet.Rows, args.Masks)
+		*dataset = resultSet
+	}
+}
+
+// RPCScanLines is the batched version of ScanLineData. The i-th lookup asks for the row with ids[i] in fragments[i],
+// and the i-th dataset of the reply holds the schema of that fragment and the row if it is found. Each fragment is
+// scanned only once no matter how many of its rows are asked for, and the datasets of a fragment whose store has
+// failed have an empty table name, as those of a missing one. The columns of the masks, if any, are masked.
+func (n *Node) RPCScanLines(args ScanLinesArgs, reply *[]Dataset) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fragments := args.Fragments
+	ids := args.Ids
+
+	result := make([]Dataset, len(fragments))
+	// fragment -> row id -> indexes of the lookups
+	lookups := make(map[string]map[string][]int)
+	for i, fragment := range fragments {
+		if _, ok := lookups[fragment]; !ok {
+			lookups[fragment] = make(map[string][]int)
+		}
+		lookups[fragment][ids[i]] = append(lookups[fragment][ids[i]], i)
+	}
+	for fragment, wanted := range lookups {
+		t, ok := n.TableMap[fragment]
+		if !ok {
+			continue
+		}
+		for _, indexes := range wanted {
+			for _, i := range indexes {
+				result[i] = Dataset{Schema: *t.schema, Rows: make([]Row, 0)}
+			}
+		}
+		iterator := n.rowIterator(t)
+		for iterator.HasNext() {
+			row := *iterator.Next()
+			id, _ := row[0].(string)
+			for _, i := range wanted[id] {
+				result[i].Rows = []Row{row}
+			}
+		}
+		if storeError(t) != nil {
+			for _, indexes := range wanted {
+				for _, i := range indexes {
+					result[i] = Dataset{}
+				}
+			}
+		}
+	}
+	masks := args.Masks
+	for i := range result {
+		result[i].Rows = maskRows(result[i].Schema, result[i].Rows, masks)
+	}
+	*reply = result
+}
+
+// RPCLocalJoin joins fragments of two tables stored on this node using NATURAL JOIN, so that the coordinator does not
+// need to pull them. The joined rows follow the schema built by createJoinSchema, and each of them is followed by the
+// ids of the two rows it is joined from. A dataset with an empty table name is returned if some fragment does not
+// exist on this node.
+func (n *Node) RPCLocalJoin(args LocalJoinArgs, dataset *Dataset) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fragments1 := args.Fragments1
+	fragments2 := args.Fragments2
+
+	columns1, rows1, ids1, ok1 := n.assembleRows(fragments1)
+	columns2, rows2, ids2, ok2 := n.assembleRows(fragments2)
+	if !ok1 || !ok2 {
+		return
+	}
+	newColumns := make([]ColumnSchema, 0)
+	same_columns1 := make([]int, 0)
+	same_columns2 := make([]int, 0)
+	createJoinSchema([]interface{}{columns1, columns2}, &newColumns, &same_columns1, &same_columns2)
+
+	rows := make([]Row, 0)
+	for _, pair := range matchRows(rows1, rows2, same_columns1, same_columns2) {
+		row := mergeRows(rows1[pair[0]], rows2[pair[1]], same_columns2)
+		rows = append(rows, append(row, ids1[pair[0]], ids2[pair[1]]))
+	}
+	*dataset = Dataset{Schema: TableSchema{TableName: n.Identifier, ColumnSchemas: newColumns}, Rows: rows}
+}
+
+// RPCBroadcastJoin joins fragments of a table stored on this node with the rows of another table sent by the
+// coordinator using NATURAL JOIN. The joined rows follow the schema built by createJoinSchema, with the columns of the
+// sent table first if shippedFirst is true, and each of them is followed by the id of the local row and the index of
+// the sent row. A dataset with an empty table name is returned if some fragment does not exist on this node.
+func (n *Node) RPCBroadcastJoin(args BroadcastJoinArgs, dataset *Dataset) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fragments := args.Fragments
+	shipped := args.Shipped
+	shippedFirst := args.ShippedFirst
+
+	columns, rows, ids, ok := n.assembleRows(fragments)
+	if !ok {
+		return
+	}
+	columns1, rows1, columns2, rows2 := columns, rows, shipped.Schema.ColumnSchemas, shipped.Rows
+	if shippedFirst {
+		columns1, rows1, columns2, rows2 = columns2, rows2, columns1, rows1
+	}
+	newColumns := make([]ColumnSchema, 0)
+	same_columns1 := make([]int, 0)
+	same_columns2 := make([]int, 0)
+	createJoinSchema([]interface{}{columns1, columns2}, &newColumns, &same_columns1, &same_columns2)
+
+	result := make([]Row, 0)
+	for _, pair := range matchRows(rows1, rows2, same_columns1, same_columns2) {
+		row := mergeRows(rows1[pair[0]], rows2[pair[1]], same_columns2)
+		if shippedFirst {
+			row = append(row, ids[pair[1]], pair[0])
+		} else {
+			row = append(row, ids[pair[0]], pair[1])
+		}
+		result = append(result, row)
+	}
+	*dataset = Dataset{Schema: TableSchema{TableName: n.Identifier, ColumnSchemas: newColumns}, Rows: result}
+}
+
+// RPCSemiJoinIds returns the ids of the rows in a fragment whose values of the key columns equal one of the keys, each
+// as a row of the reply. A dataset with an empty table name is returned if the fragment does not exist on this node.
+func (n *Node) RPCSemiJoinIds(args SemiJoinIdsArgs, dataset *Dataset) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fragment := args.Fragment
+	keys := args.Keys
+
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		return
+	}
+	// the position of each key column in the fragment
+	positions := make([]int, len(keys.Schema.ColumnSchemas))
+	for i, key := range keys.Schema.ColumnSchemas {
+		positions[i] = -1
+		for j, cs := range t.schema.ColumnSchemas {
+			if cs.Name == key.Name {
+				positions[i] = j
+				break
+			}
+		}
+		if positions[i] < 0 {
+			return
+		}
+	}
+	wanted := make(map[string]bool)
+	for _, key := range keys.Rows {
+		wanted[keyString(key)] = true
+	}
+
+	result := Dataset{Schema: TableSchema{TableName: fragment, ColumnSchemas: t.schema.ColumnSchemas[0:1]}, Rows: make([]Row, 0)}
+	iterator := n.rowIterator(t)
+	for iterator.HasNext() {
+		row := *iterator.Next()
+		key := make(Row, len(positions))
+		for i, position := range positions {
+			key[i] = row[position]
+		}
+		if wanted[keyString(key)] {
+			result.Rows = append(result.Rows, Row{row[0]})
+		}
+	}
+	*dataset = result
+}
+
+// assembleRows rebuilds the full rows of a table from some of its fragments on this node. It returns the full schema
+// (without the id column), the rows that have all columns, and their ids, or false if some fragment does not exist.
+func (n *Node) assembleRows(fragments []string) ([]ColumnSchema, []Row, []string, bool) {
+	columns := make([]ColumnSchema, 0)
+	ids := make([]string, 0)
+	// row id -> column name -> value
+	values := make(map[string]map[string]interface{})
+	for i, fragment := range fragments {
+		t, ok := n.TableMap[fragment]
+		if !ok {
+			return nil, nil, nil, false
+		}
+		if i == 0 {
+			columns = t.fullSchema.ColumnSchemas[0 : len(t.fullSchema.ColumnSchemas)-1]
+		}
+		iterator := n.rowIterator(t)
+		for iterator.HasNext() {
+			row := *iterator.Next()
+			id := row[0].(string)
+			if _, exist := values[id]; !exist {
+				values[id] = make(map[string]interface{})
+				ids = append(ids, id)
+			}
+			for j, cs := range t.schema.ColumnSchemas[1:] {
+				values[id][cs.Name] = row[j+1]
+			}
+		}
+	}
+
+	rows := make([]Row, 0, len(ids))
+	rowIds := make([]string, 0, len(ids))
+	for _, id := range ids {
+		row := make(Row, 0, len(columns))
+		for _, cs := range columns {
+			if val, exist := values[id][cs.Name]; exist {
+				row = append(row, val)
+			}
+		}
+		if len(row) == len(columns) {
+			rows = append(rows, row)
+			rowIds = append(rowIds, id)
+		}
+	}
+	return columns, rows, rowIds, true
+}
+
 // return a full schema of TableName
 func (n *Node) GetFullSchema(tableName string, schema *[]ColumnSchema) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
 	res := make([]ColumnSchema, 0)
 	if t, ok := n.TableMap[tableName]; ok {
 		res = t.fullSchema.ColumnSchemas[0 : len(t.fullSchema.ColumnSchemas)-1]
@@ -145,21 +460,24 @@ func (n *Node) GetFullSchema(tableName string, schema *[]ColumnSchema) {
 	*schema = res
 }
 
-func (n *Node) RPCCreateTable(args []interface{}, reply *string) {
-	schema := args[0].(TableSchema)
-	predicate := args[1].(Predicate)
-	fullSchema := args[2].(TableSchema)
+// typePredicate fills the values of the predicate in the types of the columns of the full schema. It returns "" if
+// succeeds, or the reply of the failure.
+func typePredicate(predicate Predicate, fullSchema TableSchema) string {
 	for k, v := range predicate {
 		for _, cs := range fullSchema.ColumnSchemas {
 			if cs.Name == k {
 				for i, value := range v {
+					// the value of a partition atom is the partition, not a value of the column
+					if value.Op == PartitionOp {
+						predicate[k][i].RealType = cs.DataType
+						continue
+					}
 					if value.Val == nil {
 						if OpIsEqualOrNotEqual(value.Op) {
 							predicate[k][i].RealType = cs.DataType
 							continue
 						} else {
-							*reply = "1 Operator Not Suitable For null"
-							return
+							return "1 Operator Not Suitable For null"
 						}
 					}
 					var ok bool
@@ -179,8 +497,7 @@ func (n *Node) RPCCreateTable(args []interface{}, reply *string) {
 						predicate[k][i].StringValue, ok = value.Val.(string)
 					}
 					if !ok {
-						*reply = "1 TypeError"
-						return
+						return "1 TypeError"
 					}
 					predicate[k][i].RealType = cs.DataType
 				}
@@ -188,7 +505,28 @@ func (n *Node) RPCCreateTable(args []interface{}, reply *string) {
 			}
 		}
 	}
-	if err := n.CreateTable(&schema); err != nil {
+	return ""
+}
+
+func (n *Node) RPCCreateTable(args CreateTableArgs, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer n.logIfOk("RPCCreateTable", args, reply)
+
+	if n.draining {
+		*reply = "1 Node Draining"
+		return
+	}
+	schema := args.Schema
+	predicate := args.Predicate
+	fullSchema := args.FullSchema
+	storage := args.Storage
+	if msg := typePredicate(predicate, fullSchema); msg != "" {
+		*reply = msg
+		return
+	}
+	if err := n.createTableIn(&schema, storage); err != nil {
 		*reply = fmt.Sprintf("1 %v", err)
 	} else {
 		if t, ok := n.TableMap[schema.TableName]; ok {
@@ -201,10 +539,19 @@ func (n *Node) RPCCreateTable(args []interface{}, reply *string) {
 	}
 }
 
-func (n *Node) RPCInsert(args []interface{}, reply *string) {
-	tableName := args[0].(string)
+func (n *Node) RPCInsert(args InsertArgs, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer n.logIfOk("RPCInsert", args, reply)
+
+	if n.draining {
+		*reply = "1 Node Draining"
+		return
+	}
+	tableName := args.Fragment
 	if t, ok := n.TableMap[tableName]; ok {
-		row := args[1].(Row)
+		row := args.Row
 		var subRow Row
 		for i, v := range row {
 			if atoms, exist := (*t.predicate)[t.fullSchema.ColumnSchemas[i].Name]; exist {
@@ -224,6 +571,10 @@ func (n *Node) RPCInsert(args []interface{}, reply *string) {
 				}
 			}
 		}
+		if n.storageFull(1) {
+			*reply = "1 Storage Full"
+			return
+		}
 		if err := n.Insert(tableName, &subRow); err != nil {
 			*reply = fmt.Sprintf("1 %v", err)
 			return
@@ -232,14 +583,157 @@ func (n *Node) RPCInsert(args []interface{}, reply *string) {
 	*reply = "0 OK"
 }
 
+// RPCAppendRows appends rows copied from another fragment, or another replica of the same fragment, in the layout of
+// the schema of this fragment. Rows whose id is already in the fragment, and rows that do not satisfy the predicate of
+// the fragment, are skipped, so that rows can be copied while they are also being written.
+func (n *Node) RPCAppendRows(args AppendRowsArgs, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer n.logIfOk("RPCAppendRows", args, reply)
+
+	if n.draining {
+		*reply = "1 Node Draining"
+		return
+	}
+	fragment := args.Fragment
+	rows := args.Rows
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		*reply = "1 no such table"
+		return
+	}
+	existing := make(map[interface{}]bool)
+	iterator := n.rowIterator(t)
+	for iterator.HasNext() {
+		existing[(*iterator.Next())[0]] = true
+	}
+	added := make([]int, 0)
+	for i := range rows.Rows {
+		if !existing[rows.Rows[i][0]] && t.satisfies(rows.Rows[i]) {
+			existing[rows.Rows[i][0]] = true
+			added = append(added, i)
+		}
+	}
+	if n.storageFull(len(added)) {
+		*reply = "1 Storage Full"
+		return
+	}
+	for _, i := range added {
+		if err := n.Insert(fragment, &rows.Rows[i]); err != nil {
+			*reply = fmt.Sprintf("1 %v", err)
+			return
+		}
+	}
+	*reply = "0 OK"
+}
+
+// RPCSetPredicate replaces the predicate of a fragment and removes the rows that do not satisfy the new one.
+func (n *Node) RPCSetPredicate(args SetPredicateArgs, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer n.logIfOk("RPCSetPredicate", args, reply)
+
+	if n.draining {
+		*reply = "1 Node Draining"
+		return
+	}
+	fragment := args.Fragment
+	predicate := args.Predicate
+	fullSchema := args.FullSchema
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		*reply = "1 no such table"
+		return
+	}
+	if msg := typePredicate(predicate, fullSchema); msg != "" {
+		*reply = msg
+		return
+	}
+	t.predicate = &predicate
+	removed := make([]Row, 0)
+	iterator := n.rowIterator(t)
+	for iterator.HasNext() {
+		if row := *iterator.Next(); !t.satisfies(row) {
+			removed = append(removed, row)
+		}
+	}
+	for i := range removed {
+		t.Remove(&removed[i])
+	}
+	if err := storeError(t); err != nil {
+		*reply = fmt.Sprintf("1 %v", err)
+		return
+	}
+	*reply = "0 OK"
+}
+
+// RPCDrain stops the node from accepting writes, while reads are still served. The reply is "0 OK" once the writes in
+// progress have finished, after which the node holds no state that is not visible to readers and can be stopped.
+// args: ignored
+func (n *Node) RPCDrain(args interface{}, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.draining = true
+	*reply = "0 OK"
+}
+
+// RPCCountRows returns the number of rows in a fragment, or -1 if the fragment does not exist on this node.
+func (n *Node) RPCCountRows(args FragmentArgs, reply *int) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	cnt, _ := n.count(args.Fragment)
+	*reply = cnt
+}
+
+// RPCDropTable drops a replica of a fragment from this node.
+func (n *Node) RPCDropTable(args FragmentArgs, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer n.logIfOk("RPCDropTable", args, reply)
+
+	fragment := args.Fragment
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		*reply = "1 no such table"
+		return
+	}
+	n.releaseSnapshots(fragment)
+	if closer, ok := t.rowStore.(io.Closer); ok {
+		closer.Close()
+	}
+	delete(n.TableMap, fragment)
+	*reply = "0 OK"
+}
+
+// Close releases the stores of the tables of the node, e.g., removes the files of the disk-backed ones, once the node
+// is no longer used, e.g., it has been replaced by a restarted one. The node holds no table afterwards.
+func (n *Node) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, t := range n.TableMap {
+		if closer, ok := t.rowStore.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+	n.TableMap = make(map[string]*Table)
+}
+
 func OpIsEqualOrNotEqual(op string) bool {
 	return op == "==" || op == "=" || op == "!=" || op == "<>" || op == ">=" || op == "<="
 }
 
-func (n *Node) RPCJoin(args []interface{}, reply *string) {
-	tableName := args[0].(string)
+func (n *Node) RPCJoin(args InsertArgs, reply *string) {
+	defer n.admit()()
+	tableName := args.Fragment
 	if t, ok := n.TableMap[tableName]; ok {
-		row := args[1].(Row)
+		row := args.Row
 		var subRow Row
 		for i, v := range row {
 			if !CheckType(v, t.fullSchema.ColumnSchemas[i].DataType) {
@@ -263,6 +757,10 @@ func (n *Node) RPCJoin(args []interface{}, reply *string) {
 				}
 			}
 		}
+		if n.storageFull(1) {
+			*reply = "1 Storage Full"
+			return
+		}
 		if err := n.Insert(tableName, &subRow); err != nil {
 			*reply = fmt.Sprintf("1 %v", err)
 			return
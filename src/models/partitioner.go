@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// PartitionOp is the operator of the atoms satisfied by the values a named Partitioner maps to a partition: the
+// atom {"op": "partition", "val": 1, "partitioner": "hash", "partitions": 3} is satisfied by the values the "hash"
+// partitioner maps to the second of 3 partitions. A table is partitioned by giving each partition to a fragment.
+const PartitionOp = "partition"
+
+// Partitioner maps the values of a column to partitions, for the fragmentation rules which cannot be written as
+// comparisons with constants, e.g., partitioning the student ids by the prefix of their department. Partition must
+// be deterministic and safe for concurrent use, as it decides where the rows are written and looked up by the
+// coordinator, the nodes and the clients alike.
+type Partitioner interface {
+	// Partition returns the partition of a value in [0, partitions). The value may be nil.
+	Partition(value interface{}, partitions int) int
+}
+
+// PartitionerFunc lets an ordinary function be a Partitioner.
+type PartitionerFunc func(value interface{}, partitions int) int
+
+func (f PartitionerFunc) Partition(value interface{}, partitions int) int {
+	return f(value, partitions)
+}
+
+var (
+	partitionersMu sync.RWMutex
+	partitioners   = map[string]Partitioner{"hash": PartitionerFunc(hashPartition)}
+)
+
+// RegisterPartitioner registers a partitioner under the name the rules refer to it by, replacing the one registered
+// under the name before. The partitioners must be registered before the tables using them are built, and must not be
+// replaced while the tables exist, or their rows would no longer be found in their fragments. "hash" is registered
+// by default, and partitions the values by the FNV hash of their textual form.
+func RegisterPartitioner(name string, partitioner Partitioner) {
+	partitionersMu.Lock()
+	defer partitionersMu.Unlock()
+	partitioners[name] = partitioner
+}
+
+// lookupPartitioner returns the partitioner registered under the name.
+func lookupPartitioner(name string) (Partitioner, bool) {
+	partitionersMu.RLock()
+	defer partitionersMu.RUnlock()
+	partitioner, ok := partitioners[name]
+	return partitioner, ok
+}
+
+func hashPartition(value interface{}, partitions int) int {
+	h := fnv.New32a()
+	h.Write([]byte(keyString(value)))
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// RangePartitioner partitions the values by the ascending bounds between the partitions, in the order of a
+// comparator: the values less than Bounds[0] are in the first partition, those not less than Bounds[i-1] but less
+// than Bounds[i] in partition i, and those not less than the last bound in the last one. It is used with as many
+// partitions as there are bounds plus one; extra bounds are merged into the last partition.
+type RangePartitioner struct {
+	Bounds []interface{}
+	// Less compares two values, comparing numbers by their values and strings lexicographically if nil
+	Less func(a interface{}, b interface{}) bool
+}
+
+func (rp RangePartitioner) Partition(value interface{}, partitions int) int {
+	less := rp.Less
+	if less == nil {
+		less = lessValue
+	}
+	partition := 0
+	for partition < len(rp.Bounds) && !less(value, rp.Bounds[partition]) {
+		partition++
+	}
+	if partition >= partitions {
+		return partitions - 1
+	}
+	return partition
+}
+
+// lessValue compares two numbers by their values, and any other values by their textual forms. nil is less than
+// every other value.
+func lessValue(a interface{}, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+	if x, ok := numberValue(a); ok {
+		if y, ok := numberValue(b); ok {
+			return x < y
+		}
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// checkPartition tells whether the partitioner of the atom maps the value to the partition of the atom.
+func (n *Atom) checkPartition(value interface{}) bool {
+	partitioner, ok := lookupPartitioner(n.Partitioner)
+	partition, isNumber := numberValue(n.Val)
+	if !ok || !isNumber || n.Partitions <= 0 {
+		return false
+	}
+	return partitioner.Partition(value, n.Partitions) == int(partition)
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+)
+
+// the students of department d have the ids d00 to d99
+var departmentRows = []Row{
+	{101, "John", 22, 4.0},
+	{102, "Smith", 23, 3.6},
+	{205, "Hana", 21, 4.0},
+	{310, "Eve", 20, 3.0},
+}
+
+func departmentPartition(value interface{}, partitions int) int {
+	sid, _ := numberValue(value)
+	return (int(sid)/100 - 1) % partitions
+}
+
+// setupDepartments builds the student table partitioned by department, the first department on Node0 and Node1, the
+// second one on Node2 and the third one on Node3, and a client routing by itself.
+func setupDepartments(t *testing.T) *Client {
+	setupLab3()
+	RegisterPartitioner("department", PartitionerFunc(departmentPartition))
+	rules, err := NewRuleSet(*studentTableSchema).
+		AddPartitionRules("sid", "department", []int{0, 1}, []int{2}, []int{3}).
+		Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules, "sid"}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot build the table: %v", reply)
+	}
+	return NewClient(network, "ClientB", c.Name)
+}
+
+func TestCustomPartitioner(t *testing.T) {
+	client := setupDepartments(t)
+	for _, row := range departmentRows {
+		if reply := client.Insert(studentTableName, row); reply != "0 OK" {
+			t.Fatalf("cannot insert %v: %v", row, reply)
+		}
+	}
+
+	// every row is held by the replicas of the fragment of its department only
+	placement := c.currentPlacement()
+	for _, row := range departmentRows {
+		fragment := fragmentOf(studentTableName, row[0])
+		expected := map[int][]string{0: {"Node0", "Node1"}, 1: {"Node2"}, 2: {"Node3"}}[departmentPartition(row[0], 3)]
+		if replicas := placement.Replicas(fragment); fmt.Sprint(replicas) != fmt.Sprint(expected) {
+			t.Errorf("expected %v on %v, actual %v on %v", row, expected, fragment, replicas)
+		}
+	}
+	for _, fragment := range placement.Fragments(studentTableName) {
+		for _, nodeId := range placement.Replicas(fragment) {
+			dataset, _ := readFragment(c.nodeEnd(nodeId), fragment, nil)
+			for _, row := range dataset.Rows {
+				if fragmentOf(studentTableName, row[1]) != fragment {
+					t.Errorf("%v should not hold %v", fragment, row)
+				}
+			}
+		}
+	}
+
+	// the point lookups are routed by the partitioner as well
+	for _, row := range departmentRows {
+		result := client.Get(studentTableName, row[0])
+		if len(result.Rows) != 1 || !result.Rows[0].Equals(&row) {
+			t.Errorf("expected %v, actual %v", row, result)
+		}
+	}
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{}}, &result)
+	if len(result.Rows) != len(departmentRows) {
+		t.Errorf("expected %v rows, actual %v", len(departmentRows), result.Rows)
+	}
+
+	// a partition is split by a range and merged back, but two partitions cannot be merged
+	reply := ""
+	first := fragmentOf(studentTableName, 101)
+	cli.Call("Cluster.SplitFragment", []interface{}{first, "sid", 101}, &reply)
+	if reply[0] != '0' {
+		t.Fatalf("cannot split %v: %v", first, reply)
+	}
+	if fragmentOf(studentTableName, 101) != first || fragmentOf(studentTableName, 102) != reply[2:] {
+		t.Errorf("expected 101 in %v and 102 in %v", first, reply[2:])
+	}
+	cli.Call("Cluster.MergeFragments", []interface{}{first, reply[2:]}, &reply)
+	if reply != "0 OK" {
+		t.Errorf("cannot merge the partition back: %v", reply)
+	}
+	cli.Call("Cluster.MergeFragments", []interface{}{first, fragmentOf(studentTableName, 205)}, &reply)
+	if reply == "0 OK" {
+		t.Errorf("two partitions should not be merged")
+	}
+	result = Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{DisableCache: true}}, &result)
+	if len(result.Rows) != len(departmentRows) {
+		t.Errorf("expected %v rows, actual %v", len(departmentRows), result.Rows)
+	}
+}
+
+func TestRangePartitioner(t *testing.T) {
+	partitioner := RangePartitioner{Bounds: []interface{}{10, 20}}
+	for value, expected := range map[interface{}]int{nil: 0, 5: 0, 10: 1, 19.5: 1, 20: 2, 100: 2} {
+		if actual := partitioner.Partition(value, 3); actual != expected {
+			t.Errorf("expected %v in partition %v, actual %v", value, expected, actual)
+		}
+	}
+	if actual := partitioner.Partition(100, 2); actual != 1 {
+		t.Errorf("the values above the last partition should be in the last one, actual %v", actual)
+	}
+
+	invalid := map[string]*RuleSet{
+		"unknown partitioner": NewRuleSet(*studentTableSchema).AddPartitionRules("sid", "unknown", []int{0}),
+		"partition out of range": NewRuleSet(*studentTableSchema).AddHorizontalRule(Predicate{"sid": {{
+			Op: PartitionOp, Val: 2, Partitioner: "hash", Partitions: 2}}}, 0),
+	}
+	for name, rs := range invalid {
+		if err := rs.Validate(); err == nil {
+			t.Errorf("Validate should fail for %v", name)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"../labgob"
+)
+
+// Persister models the disk of a node: it survives restarts of the node, see Cluster.RestartNode. A node appends a
+// record to its write-ahead log for every change of its tables, and a restarted node rehydrates its tables by
+// replaying the log. Once the log holds checkpointRecords records, the node writes a snapshot of its tables and the
+// log is truncated, a restarted node loading the snapshot before replaying the records appended since. The records
+// and the snapshot are kept encoded, so that they do not share memory with the tables.
+type Persister struct {
+	mu       sync.Mutex
+	snapshot []byte
+	log      [][]byte
+}
+
+// loggedMethods are the RPCs changing the tables of a node, which log their calls, see Node.logIfOk.
+var loggedMethods = map[string]bool{"RPCCreateTable": true, "RPCInsert": true, "RPCAppendRows": true,
+	"RPCSetPredicate": true, "RPCDropTable": true, "RPCRemoveRows": true, "RPCRenameTable": true,
+	"RPCTombstoneRows": true, "RPCUndeleteRows": true, "RPCPurgeTombstones": true}
+
+// checkpointRecords is how many records the log of a node holds before the node checkpoints, see Node.checkpoint.
+const checkpointRecords = 1024
+
+// walRecord is a change of the tables of a node, i.e., a successful call of one of the RPCs changing them.
+type walRecord struct {
+	Method string
+	// the arguments of the RPC, e.g., InsertArgs for RPCInsert
+	Args interface{}
+	// when the change was made, in nanoseconds since the Unix epoch
+	At int64
+}
+
+// NewPersister creates an empty Persister.
+func NewPersister() *Persister {
+	return &Persister{log: make([][]byte, 0)}
+}
+
+// Append adds an encoded record to the log.
+func (p *Persister) Append(record []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = append(p.log, record)
+}
+
+// Checkpoint replaces the snapshot by a new one holding every change logged so far, and truncates the log.
+func (p *Persister) Checkpoint(snapshot []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.snapshot = snapshot
+	p.log = make([][]byte, 0)
+}
+
+// Snapshot returns the encoded snapshot of the last checkpoint, nil if there has been none.
+func (p *Persister) Snapshot() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.snapshot
+}
+
+// Len returns how many records the log holds.
+func (p *Persister) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.log)
+}
+
+// Records returns the encoded records of the log in the order they were appended.
+func (p *Persister) Records() [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]byte(nil), p.log...)
+}
+
+// Size returns how many bytes the snapshot and the log hold.
+func (p *Persister) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	size := len(p.snapshot)
+	for _, record := range p.log {
+		size += len(record)
+	}
+	return size
+}
+
+// logIfOk appends a call of method to the log of the node if the reply tells it succeeded. The RPCs changing the
+// tables defer it while holding the lock of the node, so that the log follows the order of the changes.
+func (n *Node) logIfOk(method string, args interface{}, reply *string) {
+	if n.persister == nil || len(*reply) == 0 || (*reply)[0] != '0' {
+		return
+	}
+	buffer := bytes.Buffer{}
+	if err := labgob.NewEncoder(&buffer).Encode(walRecord{Method: method, Args: args, At: n.now()}); err != nil {
+		// a change that cannot be logged would be lost at the next restart, which the caller must know
+		*reply = fmt.Sprintf("1 cannot log %v: %v", method, err)
+		return
+	}
+	n.persister.Append(buffer.Bytes())
+	if n.persister.Len() >= checkpointRecords {
+		n.checkpoint()
+	}
+}
+
+// nodeSnapshot is the state of the tables of a node written by a checkpoint.
+type nodeSnapshot struct {
+	Fragments []fragmentSnapshotState
+}
+
+// fragmentSnapshotState is the state of a fragment in a nodeSnapshot.
+type fragmentSnapshotState struct {
+	Schema     TableSchema
+	FullSchema *TableSchema
+	Predicate  *Predicate
+	Storage    TableStorage
+	// the rows of the fragment, including those soft-deleted
+	Rows       []Row
+	Tombstones map[string]int64
+	// the history of the fragment if it keeps one, see rowHistory
+	Inserted map[string]int64
+	Removed  []removedRowState
+}
+
+// removedRowState is a removedRow in a fragmentSnapshotState.
+type removedRowState struct {
+	Row       Row
+	Inserted  int64
+	RemovedAt int64
+}
+
+// checkpoint writes a snapshot of the tables of the node to its persister, which truncates the log, so that the log
+// does not grow forever and a restart does not replay every change ever made. The caller must hold mu, so that the
+// snapshot holds every change logged. The log is kept if the snapshot cannot be encoded.
+func (n *Node) checkpoint() {
+	snapshot := nodeSnapshot{Fragments: make([]fragmentSnapshotState, 0, len(n.TableMap))}
+	for _, t := range n.TableMap {
+		state := fragmentSnapshotState{Schema: *t.schema, FullSchema: t.fullSchema, Predicate: t.predicate,
+			Storage: t.storage, Rows: make([]Row, 0, t.Count()), Tombstones: t.tombstones}
+		for iterator := t.rowStore.iterator(); iterator.HasNext(); {
+			state.Rows = append(state.Rows, *iterator.Next())
+		}
+		if t.history != nil {
+			state.Inserted = t.history.inserted
+			for _, removed := range t.history.removed {
+				state.Removed = append(state.Removed, removedRowState{Row: removed.row, Inserted: removed.inserted,
+					RemovedAt: removed.removedAt})
+			}
+		}
+		snapshot.Fragments = append(snapshot.Fragments, state)
+	}
+	buffer := bytes.Buffer{}
+	if err := labgob.NewEncoder(&buffer).Encode(snapshot); err != nil {
+		return
+	}
+	n.persister.Checkpoint(buffer.Bytes())
+}
+
+// restore rebuilds the tables of a fresh node from the snapshot of a checkpoint.
+func (n *Node) restore(content []byte) error {
+	snapshot := nodeSnapshot{}
+	if err := labgob.NewDecoder(bytes.NewReader(content)).Decode(&snapshot); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+	for _, state := range snapshot.Fragments {
+		schema := state.Schema
+		if err := n.createTableIn(&schema, state.Storage); err != nil {
+			return fmt.Errorf("snapshot of %v: %v", schema.TableName, err)
+		}
+		t := n.TableMap[schema.TableName]
+		t.fullSchema, t.predicate = state.FullSchema, state.Predicate
+		for i := range state.Rows {
+			t.rowStore.insert(&state.Rows[i])
+		}
+		if len(state.Tombstones) > 0 {
+			t.tombstones = state.Tombstones
+		}
+		if t.history != nil {
+			if state.Inserted != nil {
+				t.history.inserted = state.Inserted
+			}
+			for _, removed := range state.Removed {
+				t.history.removed = append(t.history.removed, removedRow{row: removed.Row, inserted: removed.Inserted,
+					removedAt: removed.RemovedAt})
+			}
+		}
+	}
+	return nil
+}
+
+// rehydrate rebuilds the tables of a fresh node from the snapshot of its persister, if any, then by replaying the log.
+func (n *Node) rehydrate() error {
+	persister := n.persister
+	// the replayed changes are already in the log
+	n.persister = nil
+	defer func() {
+		n.persister = persister
+		n.replayAt = 0
+	}()
+
+	if snapshot := persister.Snapshot(); snapshot != nil {
+		if err := n.restore(snapshot); err != nil {
+			return err
+		}
+	}
+	for i, content := range persister.Records() {
+		record := walRecord{}
+		if err := labgob.NewDecoder(bytes.NewReader(content)).Decode(&record); err != nil {
+			return fmt.Errorf("record %v: %v", i, err)
+		}
+		reply := ""
+		n.replayAt = record.At
+		method := reflect.ValueOf(n).MethodByName(record.Method)
+		if !loggedMethods[record.Method] || !method.IsValid() {
+			return fmt.Errorf("record %v has unknown method %v", i, record.Method)
+		}
+		if record.Args == nil || reflect.TypeOf(record.Args) != method.Type().In(0) {
+			return fmt.Errorf("record %v (%v) has arguments of type %T", i, record.Method, record.Args)
+		}
+		method.Call([]reflect.Value{reflect.ValueOf(record.Args), reflect.ValueOf(&reply)})
+		if len(reply) == 0 || reply[0] != '0' {
+			return fmt.Errorf("record %v (%v) cannot be replayed: %v", i, record.Method, reply)
+		}
+	}
+	return nil
+}
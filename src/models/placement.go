@@ -0,0 +1,231 @@
+package models
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Placement tells which fragments each table has, the rule defining each fragment, and which nodes hold a replica of
+// it. A Placement is never modified once installed, a change of placement (creating a table, moving a replica,
+// splitting a fragment, ...) installs a new Placement with a larger epoch instead.
+// A query pins the Placement installed when it starts and reads from it only, so that it sees either the placement
+// before a change or the one after it, never a mix of them. Replicas retired by a change are kept on their nodes
+// until no query pinning an earlier epoch is running.
+type Placement struct {
+	Epoch int
+	// fragment name -> the nodes holding a replica of the fragment
+	FragmentNodes map[string][]string
+	// fragment name -> the rule defining the fragment
+	FragmentRules map[string]Rule
+	// old table name -> the name the table has been renamed to, see Cluster.RenameTable
+	Renamed map[string]string
+	// table name ("" for the whole cluster) -> true if its writes are rejected, see Cluster.SetReadOnly
+	ReadOnly map[string]bool
+	// table name -> column name -> how the column is masked, see Cluster.MaskColumn
+	Masks map[string]map[string]ColumnMask
+	// the users seeing the masked columns unmasked, see Cluster.SetPrivileged
+	Privileged map[string]bool
+}
+
+// placementState guards the installed placement and counts the queries pinning each epoch.
+type placementState struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	current *Placement
+	// epoch -> how many running queries pinned it
+	readers map[int]int
+}
+
+func newPlacementState() *placementState {
+	ps := &placementState{
+		current: &Placement{FragmentNodes: make(map[string][]string), FragmentRules: make(map[string]Rule)},
+		readers: make(map[int]int),
+	}
+	ps.changed = sync.NewCond(&ps.mu)
+	return ps
+}
+
+// Replicas returns the nodes holding a replica of the fragment.
+func (p *Placement) Replicas(fragment string) []string {
+	return p.FragmentNodes[fragment]
+}
+
+// Rule returns the rule defining the fragment.
+func (p *Placement) Rule(fragment string) Rule {
+	return p.FragmentRules[fragment]
+}
+
+// Fragments returns the fragments of a table ordered by their numbers. The numbers need not be contiguous, as merged
+// fragments are removed.
+func (p *Placement) Fragments(tableName string) []string {
+	fragments := make([]string, 0)
+	for fragment := range p.FragmentRules {
+		if fragmentTable(fragment) == tableName {
+			fragments = append(fragments, fragment)
+		}
+	}
+	sort.Slice(fragments, func(i, j int) bool {
+		return fragmentNumber(fragments[i]) < fragmentNumber(fragments[j])
+	})
+	return fragments
+}
+
+// removeTable removes all fragments of a table.
+func (p *Placement) removeTable(tableName string) {
+	for _, fragment := range p.Fragments(tableName) {
+		delete(p.FragmentNodes, fragment)
+		delete(p.FragmentRules, fragment)
+	}
+}
+
+// clone copies the placement with the next epoch, so that the copy can be modified and installed.
+func (p *Placement) clone() *Placement {
+	next := &Placement{Epoch: p.Epoch + 1, FragmentNodes: make(map[string][]string, len(p.FragmentNodes)),
+		FragmentRules: make(map[string]Rule, len(p.FragmentRules)), Renamed: make(map[string]string, len(p.Renamed)),
+		ReadOnly: make(map[string]bool, len(p.ReadOnly)), Masks: make(map[string]map[string]ColumnMask, len(p.Masks)),
+		Privileged: make(map[string]bool, len(p.Privileged))}
+	for fragment, nodeIds := range p.FragmentNodes {
+		next.FragmentNodes[fragment] = append([]string(nil), nodeIds...)
+	}
+	for fragment, rule := range p.FragmentRules {
+		next.FragmentRules[fragment] = rule
+	}
+	for from, to := range p.Renamed {
+		next.Renamed[from] = to
+	}
+	for tableName := range p.ReadOnly {
+		next.ReadOnly[tableName] = true
+	}
+	for tableName, masks := range p.Masks {
+		next.Masks[tableName] = masks
+	}
+	for user := range p.Privileged {
+		next.Privileged[user] = true
+	}
+	return next
+}
+
+// fragmentTable returns the table of a fragment named "tableName|i".
+func fragmentTable(fragment string) string {
+	return fragment[:strings.LastIndex(fragment, "|")]
+}
+
+// fragmentNumber returns i of a fragment named "tableName|i".
+func fragmentNumber(fragment string) int {
+	i, _ := strconv.Atoi(fragment[strings.LastIndex(fragment, "|")+1:])
+	return i
+}
+
+// currentPlacement returns the installed placement without pinning it, for writers which hold writeMu.
+func (c *Cluster) currentPlacement() *Placement {
+	c.placement.mu.Lock()
+	defer c.placement.mu.Unlock()
+	return c.placement.current
+}
+
+// installPlacement makes the placement visible to the queries starting from now on, and publishes it to the nodes if
+// they gossip. The caller must hold writeMu.
+func (c *Cluster) installPlacement(p *Placement) {
+	c.placement.mu.Lock()
+	c.placement.current = p
+	c.placement.mu.Unlock()
+	if c.gossipInterval > 0 {
+		c.publishMetadata(p)
+	}
+}
+
+// waitForReaders blocks until no running query pins an epoch earlier than the given one.
+func (c *Cluster) waitForReaders(epoch int) {
+	c.placement.mu.Lock()
+	defer c.placement.mu.Unlock()
+	for {
+		busy := false
+		for e, n := range c.placement.readers {
+			if e < epoch && n > 0 {
+				busy = true
+				break
+			}
+		}
+		if !busy {
+			return
+		}
+		c.placement.changed.Wait()
+	}
+}
+
+// queryContext is the state of a running query shared by the steps executing it.
+type queryContext struct {
+	hints QueryHints
+	// the placement the query reads from
+	placement *Placement
+	// the tables the query reads, as of the placement
+	catalog *CatalogSnapshot
+	// the masks of the columns the query sees masked, see Placement.masksFor
+	masks map[string]map[string]ColumnMask
+	// the fragments none of whose replicas answered the query
+	unavailable map[string]bool
+}
+
+// beginQuery waits for the scheduler to admit a query and pins the installed placement for it, together with a snapshot
+// of the catalog, endQuery must be called when the query finishes.
+func (c *Cluster) beginQuery(hints QueryHints) *queryContext {
+	c.scheduler.acquire(schedulingPriority(hints))
+	c.placement.mu.Lock()
+	defer c.placement.mu.Unlock()
+	q := &queryContext{hints: hints, placement: c.placement.current, catalog: c.catalog.Snapshot()}
+	q.masks = q.placement.masksFor(hints.User)
+	c.placement.readers[q.placement.Epoch]++
+	return q
+}
+
+// beginRawQuery is beginQuery for the reads of the coordinator itself (e.g., building an index), which see the masked
+// columns unmasked whatever the user.
+func (c *Cluster) beginRawQuery(hints QueryHints) *queryContext {
+	q := c.beginQuery(hints)
+	q.masks = nil
+	return q
+}
+
+func (c *Cluster) endQuery(q *queryContext) {
+	c.placement.mu.Lock()
+	c.placement.readers[q.placement.Epoch]--
+	if c.placement.readers[q.placement.Epoch] == 0 {
+		delete(c.placement.readers, q.placement.Epoch)
+	}
+	c.placement.changed.Broadcast()
+	c.placement.mu.Unlock()
+	c.scheduler.release(schedulingPriority(q.hints))
+}
+
+// markUnavailable records that none of the replicas of a fragment answered the query.
+func (q *queryContext) markUnavailable(fragment string) {
+	if q.unavailable == nil {
+		q.unavailable = make(map[string]bool)
+	}
+	q.unavailable[fragment] = true
+}
+
+// reportUnavailable lists in the result the fragments that could not be read, or fails the query if the hints require
+// complete results, see QueryHints.Strictness.
+func (q *queryContext) reportUnavailable(reply *Dataset) {
+	if len(q.unavailable) == 0 || reply.Error != "" {
+		return
+	}
+	fragments := make([]string, 0, len(q.unavailable))
+	for fragment := range q.unavailable {
+		fragments = append(fragments, fragment)
+	}
+	sort.Strings(fragments)
+	if q.hints.Strictness == RequireComplete {
+		*reply = Dataset{Error: "Fragments Unavailable: " + strings.Join(fragments, ", ")}
+	}
+	reply.Unavailable = fragments
+}
+
+// useCache tells whether the query reads and fills the row cache, the rows of the cache neither telling the replicas
+// they have been read from nor being masked.
+func (q *queryContext) useCache() bool {
+	return !q.hints.DisableCache && !q.hints.WithProvenance && len(q.masks) == 0 && q.hints.AsOf == 0
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// provenanceColumnPrefix names the hidden columns carrying the provenance of the rows of each table through a join.
+// They are distinct for each table, so that they are never common columns of the tables joined.
+const provenanceColumnPrefix = "#provenance"
+
+// joinWithProvenance joins the tables at the coordinator as joinMany does, each joined row being tagged with the
+// replicas the rows it is joined from have been read from.
+func (c *Cluster) joinWithProvenance(q *queryContext, tableNames []string) Dataset {
+	tables := make([]Dataset, len(tableNames))
+	for i, tableName := range tableNames {
+		schema, ok := q.catalog.Schema(tableName)
+		if !ok {
+			return Dataset{Schema: TableSchema{ColumnSchemas: make([]ColumnSchema, 0)}, Rows: make([]Row, 0)}
+		}
+		rows, provenance := tableRows(c, q, tableName, schema.ColumnSchemas)
+		tables[i] = Dataset{Schema: schema, Rows: rows, Provenance: provenance}
+	}
+	return joinDatasets(q, tables)
+}
+
+// joinDatasets joins the rows of tables read with their provenance (see QueryHints.WithProvenance), the provenance of
+// a joined row being that of the rows it is joined from in the order of the tables. The provenance is carried through
+// the join by a hidden column added to each table, which is moved out of the joined rows.
+func joinDatasets(q *queryContext, tables []Dataset) Dataset {
+	result := Dataset{Schema: TableSchema{ColumnSchemas: make([]ColumnSchema, 0)}, Rows: make([]Row, 0),
+		Provenance: make([][]RowLocation, 0)}
+	if len(tables) < 2 {
+		return result
+	}
+	inputs := make([]joinInput, len(tables))
+	for i, table := range tables {
+		columns := append(append([]ColumnSchema(nil), table.Schema.ColumnSchemas...),
+			ColumnSchema{Name: provenanceColumnPrefix + strconv.Itoa(i), DataType: TypeString})
+		rows := make([]Row, len(table.Rows))
+		for j, row := range table.Rows {
+			var provenance []RowLocation
+			if j < len(table.Provenance) {
+				provenance = table.Provenance[j]
+			}
+			rows[j] = append(copyRow(row), provenance)
+		}
+		inputs[i] = newJoinInput(TableSchema{TableName: table.Schema.TableName, ColumnSchemas: columns}, rows)
+	}
+	columns, rows := joinTables(q, inputs)
+
+	hidden := make([]bool, len(columns))
+	for i, cs := range columns {
+		hidden[i] = strings.HasPrefix(cs.Name, provenanceColumnPrefix)
+		if !hidden[i] {
+			result.Schema.ColumnSchemas = append(result.Schema.ColumnSchemas, cs)
+		}
+	}
+	for _, row := range rows {
+		joined := make(Row, 0, len(result.Schema.ColumnSchemas))
+		provenance := make([]RowLocation, 0)
+		for i, val := range row {
+			if !hidden[i] {
+				joined = append(joined, val)
+			} else if locations, ok := val.([]RowLocation); ok {
+				provenance = append(provenance, locations...)
+			}
+		}
+		result.Rows = append(result.Rows, joined)
+		result.Provenance = append(result.Provenance, provenance)
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// the fragment of student holding a row of the given grade, and its first replica
+func studentFragmentOf(definition TableDefinition, grade float64) RowLocation {
+	for _, fragment := range definition.Fragments {
+		if admitsRow(fragment.Rule.Predicate, Row{0, "", 0, grade}, *studentTableSchema) {
+			return RowLocation{NodeId: fragment.Nodes[0], Fragment: fragment.Fragment}
+		}
+	}
+	return RowLocation{}
+}
+
+func TestScanWithProvenance(t *testing.T) {
+	setupDDL()
+	definition := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", studentTableName, &definition)
+
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{WithProvenance: true}}, &result)
+	if len(result.Rows) != len(studentRows) || len(result.Provenance) != len(result.Rows) {
+		t.Fatalf("expected the provenance of %v rows, actual %v", len(studentRows), result)
+	}
+	for i, row := range result.Rows {
+		expected := studentFragmentOf(definition, row[3].(float64))
+		if len(result.Provenance[i]) != 1 || result.Provenance[i][0] != expected {
+			t.Errorf("expected %v to be read from %v, actual %v", row, expected, result.Provenance[i])
+		}
+	}
+
+	result = Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{}}, &result)
+	if result.Provenance != nil {
+		t.Errorf("the provenance should only be told if asked, actual %v", result.Provenance)
+	}
+}
+
+func TestJoinWithProvenance(t *testing.T) {
+	setupDDL()
+	definition := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", studentTableName, &definition)
+	courseRegistration := RowLocation{NodeId: "Node4", Fragment: courseRegistrationTableName + "|0"}
+
+	result := Dataset{}
+	cli.Call("Cluster.JoinWithHints", []interface{}{[]string{studentTableName, courseRegistrationTableName},
+		QueryHints{WithProvenance: true}}, &result)
+	expected := Dataset{Schema: joinedTableSchema, Rows: joinedTableContent}
+	if !datasetDuplicateChecking(expected, result) || len(result.Provenance) != len(result.Rows) {
+		t.Fatalf("expected %v, actual %v", expected, result)
+	}
+	for i, row := range result.Rows {
+		student := studentFragmentOf(definition, row[3].(float64))
+		if len(result.Provenance[i]) != 2 || result.Provenance[i][0] != student ||
+			result.Provenance[i][1] != courseRegistration {
+			t.Errorf("expected %v to be joined from %v and %v, actual %v", row, student, courseRegistration,
+				result.Provenance[i])
+		}
+	}
+}
+
+// a row of a vertically fragmented table is assembled from all its fragments
+func TestProvenanceOfVerticalFragments(t *testing.T) {
+	setupLab3()
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0": rangeFragment("sid", ">=", 0, "sid", "name"),
+		"1": rangeFragment("sid", ">=", 0, "sid", "age", "grade"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules}, &reply)
+	for _, row := range studentRows {
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, row}, &reply)
+	}
+
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{WithProvenance: true}}, &result)
+	if len(result.Rows) != len(studentRows) || len(result.Provenance) != len(result.Rows) {
+		t.Fatalf("expected the provenance of %v rows, actual %v", len(studentRows), result)
+	}
+	for i, provenance := range result.Provenance {
+		if len(provenance) != 2 || provenance[0].Fragment == provenance[1].Fragment {
+			t.Errorf("expected %v to be assembled from two fragments, actual %v", result.Rows[i], provenance)
+		}
+	}
+}
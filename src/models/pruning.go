@@ -0,0 +1,166 @@
+package models
+
+import "strconv"
+
+// bound is an end of the range of values the atoms on a column admit, a number or a string.
+type bound struct {
+	set       bool
+	value     interface{}
+	inclusive bool
+}
+
+// contradicts tells whether no row can satisfy both predicates, e.g., a query asking for grade > 3.6 and the rule of
+// a fragment holding the rows with grade <= 3.0, so that the fragment holds no row of the query. Both predicates must
+// have their numbers as the rules have them, see predicateValue. The check is conservative: the atoms it cannot
+// reason about (null values, "!=", the partitions of different partitioners, ...) are taken as satisfiable.
+func contradicts(p1 Predicate, p2 Predicate, schema TableSchema) bool {
+	for _, cs := range schema.ColumnSchemas {
+		atoms := append(append([]Atom(nil), p1[cs.Name]...), p2[cs.Name]...)
+		if unsatisfiable(atoms, cs.DataType) {
+			return true
+		}
+	}
+	return false
+}
+
+// unsatisfiable tells whether no value of the type can satisfy all atoms on a column.
+func unsatisfiable(atoms []Atom, dataType int) bool {
+	var low, high bound
+	// the partitioner and the number of partitions -> the partition the value must be mapped to
+	partitions := make(map[string]float64)
+	for _, atom := range atoms {
+		if atom.Op == PartitionOp {
+			partition, ok := numberValue(atom.Val)
+			if !ok {
+				continue
+			}
+			key := atom.Partitioner + "/" + strconv.Itoa(atom.Partitions)
+			if other, exists := partitions[key]; exists && other != partition {
+				return true
+			}
+			partitions[key] = partition
+			continue
+		}
+		value, ok := rangeValue(atom.Val, dataType)
+		if !ok {
+			continue
+		}
+		switch atom.Op {
+		case ">", ">=":
+			low = tighterBound(low, bound{set: true, value: value, inclusive: atom.Op == ">="}, 1)
+		case "<", "<=":
+			high = tighterBound(high, bound{set: true, value: value, inclusive: atom.Op == "<="}, -1)
+		case "==", "=":
+			low = tighterBound(low, bound{set: true, value: value, inclusive: true}, 1)
+			high = tighterBound(high, bound{set: true, value: value, inclusive: true}, -1)
+		}
+	}
+	if !low.set || !high.set {
+		return false
+	}
+	order := compareRangeValues(low.value, high.value)
+	return order > 0 || (order == 0 && !(low.inclusive && high.inclusive))
+}
+
+// rangeValue returns the value of an atom on a column of the type in a form the bounds are compared in, false if the
+// atom cannot be reasoned about.
+func rangeValue(val interface{}, dataType int) (interface{}, bool) {
+	switch dataType {
+	case TypeInt32, TypeInt64, TypeFloat, TypeDouble:
+		return numberValue(val)
+	case TypeString:
+		s, ok := val.(string)
+		return s, ok
+	}
+	return nil, false
+}
+
+// tighterBound returns the tighter of two lower bounds if direction is 1, of two upper bounds if it is -1.
+func tighterBound(current bound, next bound, direction int) bound {
+	if !current.set {
+		return next
+	}
+	order := compareRangeValues(next.value, current.value) * direction
+	if order > 0 || (order == 0 && !next.inclusive) {
+		return next
+	}
+	return current
+}
+
+// compareRangeValues compares two numbers or two strings returned by rangeValue.
+func compareRangeValues(a interface{}, b interface{}) int {
+	if x, ok := a.(float64); ok {
+		y := b.(float64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	}
+	x, y := a.(string), b.(string)
+	if x < y {
+		return -1
+	} else if x > y {
+		return 1
+	}
+	return 0
+}
+
+// wherePredicate returns the atoms of the Where hint of the query on the columns of a table, with their numbers as
+// the rules have them, or why the table cannot be filtered by them, e.g., "TypeError".
+func (q *queryContext) wherePredicate(tableName string) (Predicate, string) {
+	schema, _ := q.catalog.Schema(tableName)
+	predicate := make(Predicate)
+	for _, cs := range schema.ColumnSchemas {
+		for _, atom := range q.hints.Where[cs.Name] {
+			atom.Val = predicateValue(atom.Val)
+			predicate[cs.Name] = append(predicate[cs.Name], atom)
+		}
+	}
+	// the predicate is typed on a copy, as admitsRow types it by itself
+	typed := make(Predicate, len(predicate))
+	for column, atoms := range predicate {
+		typed[column] = append([]Atom(nil), atoms...)
+	}
+	if msg := typePredicate(typed, schema); msg != "" {
+		return nil, msg[2:]
+	}
+	return predicate, ""
+}
+
+// prunes tells whether the rule of a fragment contradicts the Where hint of the query, in which case the fragment is
+// not read.
+func (q *queryContext) prunes(tableName string, fragment string) bool {
+	predicate, err := q.wherePredicate(tableName)
+	if err != "" || len(predicate) == 0 {
+		return false
+	}
+	schema, _ := q.catalog.Schema(tableName)
+	return contradicts(predicate, q.placement.Rule(fragment).Predicate, schema)
+}
+
+// filterRows keeps the rows of a table in the layout of the columns which satisfy the Where hint of the query,
+// together with their provenance if any.
+func (q *queryContext) filterRows(tableName string, columns []ColumnSchema, rows []Row,
+	provenance [][]RowLocation) ([]Row, [][]RowLocation) {
+	predicate, _ := q.wherePredicate(tableName)
+	if len(predicate) == 0 {
+		return rows, provenance
+	}
+	schema := TableSchema{TableName: tableName, ColumnSchemas: columns}
+	kept := make([]Row, 0, len(rows))
+	var keptProvenance [][]RowLocation
+	if provenance != nil {
+		keptProvenance = make([][]RowLocation, 0, len(rows))
+	}
+	for i, row := range rows {
+		if admitsRow(predicate, row, schema) {
+			kept = append(kept, row)
+			if provenance != nil {
+				keptProvenance = append(keptProvenance, provenance[i])
+			}
+		}
+	}
+	return kept, keptProvenance
+}
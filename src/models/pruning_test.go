@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestContradicts(t *testing.T) {
+	schema := TableSchema{TableName: "t", ColumnSchemas: []ColumnSchema{
+		{Name: "grade", DataType: TypeFloat}, {Name: "name", DataType: TypeString}}}
+	atom := func(op string, val interface{}) Atom { return Atom{Op: op, Val: val} }
+	cases := []struct {
+		p1, p2   Predicate
+		expected bool
+	}{
+		{Predicate{"grade": {atom(">", json.Number("3.6"))}}, Predicate{"grade": {atom("<=", json.Number("3"))}}, true},
+		{Predicate{"grade": {atom(">", json.Number("3.6"))}}, Predicate{"grade": {atom("<=", json.Number("3.6"))}}, true},
+		{Predicate{"grade": {atom(">=", json.Number("3.6"))}}, Predicate{"grade": {atom("<=", json.Number("3.6"))}},
+			false},
+		{Predicate{"grade": {atom("==", json.Number("4"))}}, Predicate{"grade": {atom(">", json.Number("3.6")),
+			atom("<", json.Number("5"))}}, false},
+		{Predicate{"grade": {atom("!=", json.Number("4"))}}, Predicate{"grade": {atom(">=", json.Number("4")),
+			atom("<=", json.Number("4"))}}, false},
+		{Predicate{"name": {atom(">", "m")}}, Predicate{"name": {atom("<", "k")}}, true},
+		{Predicate{"name": {atom(">", "m")}}, Predicate{"grade": {atom("<", json.Number("3"))}}, false},
+		{Predicate{"name": {{Op: PartitionOp, Val: 0, Partitioner: "hash", Partitions: 2}}},
+			Predicate{"name": {{Op: PartitionOp, Val: 1, Partitioner: "hash", Partitions: 2}}}, true},
+	}
+	for _, tc := range cases {
+		if actual := contradicts(tc.p1, tc.p2, schema); actual != tc.expected {
+			t.Errorf("expected %v for %v and %v, actual %v", tc.expected, tc.p1, tc.p2, actual)
+		}
+	}
+}
+
+// the fragments whose rules contradict the predicate of a query are not read
+func TestPartitionPruning(t *testing.T) {
+	setupDDL()
+	hints := QueryHints{DisableCache: true, Where: Predicate{"grade": {{Op: ">", Val: 3.7}}}}
+	before := network.GetCount("Node0") + network.GetCount("Node1")
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, hints}, &result)
+	if names := names(result.Rows); len(names) != 2 || !names["John"] || !names["Hana"] {
+		t.Errorf("expected John and Hana, actual %v", result)
+	}
+	result = Dataset{}
+	cli.Call("Cluster.JoinWithHints", []interface{}{[]string{studentTableName, courseRegistrationTableName}, hints},
+		&result)
+	if len(result.Rows) != 3 {
+		t.Errorf("expected the 3 courses of John and Hana, actual %v", result)
+	}
+	if after := network.GetCount("Node0") + network.GetCount("Node1"); after != before {
+		t.Errorf("the fragment of the lower grades should not be read, %v RPCs sent", after-before)
+	}
+
+	// the rows are filtered even if no fragment can be pruned
+	hints.Where = Predicate{"courseId": {{Op: ">=", Val: 2}}}
+	result = Dataset{}
+	cli.Call("Cluster.JoinWithHints", []interface{}{[]string{studentTableName, courseRegistrationTableName}, hints},
+		&result)
+	if len(result.Rows) != 1 || result.Rows[0][1] != "Hana" {
+		t.Errorf("expected the course of Hana, actual %v", result)
+	}
+	hints.Where = Predicate{"grade": {{Op: ">", Val: "high"}}}
+	result = Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, hints}, &result)
+	if result.Error != "TypeError" {
+		t.Errorf("expected a type error, actual %v", result)
+	}
+}
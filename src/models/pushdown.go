@@ -0,0 +1,594 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the aggregate functions of a QueryPlan
+const (
+	// how many rows a group has, or how many of them are not null on the column if one is given
+	AggregateCount = "count"
+	// the sum of the values of a number column, an int64 for an integer column and a float64 otherwise
+	AggregateSum = "sum"
+	AggregateMin = "min"
+	AggregateMax = "max"
+	// the mean of the values of a number column as a float64
+	AggregateAvg = "avg"
+)
+
+// Aggregate is an aggregate function of the values of a column in a group of rows, see QueryPlan. The null values
+// are left out, and an aggregate of no value is null, but for count which is 0.
+type Aggregate struct {
+	// one of the aggregate functions above
+	Func string
+	// the column aggregated, which only count can leave empty to count the rows
+	Column string
+}
+
+// name returns the name of the column of the aggregate in the result, e.g., "sum(grade)" or "count(*)".
+func (a Aggregate) name() string {
+	column := a.Column
+	if column == "" {
+		column = "*"
+	}
+	return a.Func + "(" + column + ")"
+}
+
+// SortKey orders the rows of the result of a QueryPlan by one of its columns, see lessValue.
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+// QueryPlan is a query of a single table the nodes evaluate on the fragments they hold, see Cluster.Query: the rows
+// of a fragment are scanned, filtered, then projected on Columns or grouped by GroupBy and aggregated, sorted by
+// OrderBy and cut to Limit, all by the node holding the fragment in one RPC, see Node.RPCExecutePlan.
+type QueryPlan struct {
+	// the columns of the result in order, all columns of the table in the order of its schema if empty. It must be
+	// empty if the rows are grouped.
+	Columns []string
+	// the columns the rows are grouped by, the result holding a row per group: the values of these columns followed
+	// by those of the aggregates
+	GroupBy []string
+	// the aggregates of each group, all rows forming a single group if there is no GroupBy
+	Aggregates []Aggregate
+	// the order of the rows of the result by its columns, an aggregate being named as in "sum(grade)". The rows are
+	// in no particular order if empty.
+	OrderBy []SortKey
+	// how many rows the result holds at most, all if not positive
+	Limit int
+}
+
+// grouped tells whether the plan groups the rows instead of projecting them.
+func (p QueryPlan) grouped() bool {
+	return len(p.GroupBy) > 0 || len(p.Aggregates) > 0
+}
+
+// tableColumns returns the names of the columns of a schema but the id column, in their order, the columns projected
+// by a plan without Columns.
+func tableColumns(schema TableSchema) []string {
+	columns := make([]string, 0, len(schema.ColumnSchemas))
+	for _, cs := range schema.ColumnSchemas {
+		if cs.Name != "id" {
+			columns = append(columns, cs.Name)
+		}
+	}
+	return columns
+}
+
+// boundPlan is a QueryPlan bound to the schema of the rows it is evaluated on.
+type boundPlan struct {
+	QueryPlan
+	// the columns of the result
+	columns []ColumnSchema
+	// the partial columns a node returns, see partialAggregates: the grouped columns followed by the states of the
+	// aggregates, the same as columns if the rows are not grouped
+	partialColumns []ColumnSchema
+	// the positions in the schema of the projected or grouped columns
+	keys []int
+	// the positions in the schema of the aggregated columns, -1 for count(*)
+	aggregated []int
+	// the positions in the result of the sort keys
+	order []int
+}
+
+// bind binds the plan to a schema. It returns the Error of the result if the plan does not fit the schema.
+func (p QueryPlan) bind(schema TableSchema) (*boundPlan, string) {
+	position := func(column string) int {
+		for i, cs := range schema.ColumnSchemas {
+			if cs.Name == column {
+				return i
+			}
+		}
+		return -1
+	}
+	b := &boundPlan{QueryPlan: p, columns: make([]ColumnSchema, 0), keys: make([]int, 0),
+		aggregated: make([]int, 0, len(p.Aggregates))}
+	keys := p.Columns
+	if p.grouped() {
+		if len(p.Columns) > 0 {
+			return nil, "Columns Not Grouped"
+		}
+		keys = p.GroupBy
+	} else if len(keys) == 0 {
+		keys = tableColumns(schema)
+	}
+	for _, column := range keys {
+		i := position(column)
+		if i < 0 {
+			return nil, "No Such Column " + column
+		}
+		b.keys = append(b.keys, i)
+		b.columns = append(b.columns, schema.ColumnSchemas[i])
+	}
+	b.partialColumns = append([]ColumnSchema(nil), b.columns...)
+
+	for _, aggregate := range p.Aggregates {
+		i := -1
+		dataType := TypeInt64
+		if aggregate.Column != "" || aggregate.Func != AggregateCount {
+			if i = position(aggregate.Column); i < 0 {
+				return nil, "No Such Column " + aggregate.Column
+			}
+			dataType = schema.ColumnSchemas[i].DataType
+		}
+		numeric := dataType == TypeInt32 || dataType == TypeInt64 || dataType == TypeFloat || dataType == TypeDouble
+		name := aggregate.name()
+		switch aggregate.Func {
+		case AggregateCount:
+			b.columns = append(b.columns, ColumnSchema{Name: name, DataType: TypeInt64})
+			b.partialColumns = append(b.partialColumns, ColumnSchema{Name: name, DataType: TypeInt64})
+		case AggregateSum:
+			if !numeric {
+				return nil, "TypeError"
+			}
+			if dataType == TypeInt32 {
+				dataType = TypeInt64
+			} else if dataType == TypeFloat {
+				dataType = TypeDouble
+			}
+			b.columns = append(b.columns, ColumnSchema{Name: name, DataType: dataType})
+			b.partialColumns = append(b.partialColumns, ColumnSchema{Name: name, DataType: dataType})
+		case AggregateMin, AggregateMax:
+			b.columns = append(b.columns, ColumnSchema{Name: name, DataType: dataType})
+			b.partialColumns = append(b.partialColumns, ColumnSchema{Name: name, DataType: dataType})
+		case AggregateAvg:
+			if !numeric {
+				return nil, "TypeError"
+			}
+			b.columns = append(b.columns, ColumnSchema{Name: name, DataType: TypeDouble})
+			// the mean is merged from the sums and the counts of the fragments
+			b.partialColumns = append(b.partialColumns, ColumnSchema{Name: "sum(" + aggregate.Column + ")",
+				DataType: TypeDouble}, ColumnSchema{Name: "count(" + aggregate.Column + ")", DataType: TypeInt64})
+		default:
+			return nil, "No Such Aggregate " + aggregate.Func
+		}
+		b.aggregated = append(b.aggregated, i)
+	}
+
+	for _, key := range p.OrderBy {
+		i := -1
+		for j, cs := range b.columns {
+			if cs.Name == key.Column {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return nil, "No Such Column " + key.Column
+		}
+		b.order = append(b.order, i)
+	}
+	return b, ""
+}
+
+// aggregateState is the state of an aggregate of a group, which the states of the other fragments are merged into.
+type aggregateState struct {
+	// how many values have been aggregated
+	count int64
+	// the sum of the values of an integer column, or of any other number column
+	intSum   int64
+	floatSum float64
+	// the least or the greatest value, nil if there is none yet
+	value interface{}
+}
+
+// add aggregates a value of a column of the given type.
+func (s *aggregateState) add(function string, value interface{}, dataType int) {
+	if value == nil {
+		return
+	}
+	s.count++
+	switch function {
+	case AggregateSum, AggregateAvg:
+		if i, ok := integerValue(value); ok && (dataType == TypeInt32 || dataType == TypeInt64) {
+			s.intSum += i
+			s.floatSum += float64(i)
+		} else if f, ok := numberValue(value); ok {
+			s.floatSum += f
+		}
+	case AggregateMin:
+		if s.value == nil || lessValue(value, s.value) {
+			s.value = value
+		}
+	case AggregateMax:
+		if s.value == nil || lessValue(s.value, value) {
+			s.value = value
+		}
+	}
+}
+
+// integerValue returns the value of an integer, false if the value is not one.
+func integerValue(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// group is a group of rows being aggregated.
+type group struct {
+	keys   Row
+	states []aggregateState
+}
+
+// groups keeps the groups in the order they are met.
+type groups struct {
+	byKey map[string]*group
+	order []*group
+}
+
+func newGroups() *groups {
+	return &groups{byKey: make(map[string]*group)}
+}
+
+// get returns the group of the values of the grouped columns, creating it if it is new.
+func (gs *groups) get(keys Row, aggregates int) *group {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		// the numbers are grouped by their values whichever their types, e.g., json.Number or int
+		if f, ok := numberValue(key); ok {
+			parts[i] = "n" + strconv.FormatFloat(f, 'g', -1, 64)
+		} else {
+			parts[i] = fmt.Sprintf("%T:%v", key, key)
+		}
+	}
+	key := strings.Join(parts, "\x00")
+	g, ok := gs.byKey[key]
+	if !ok {
+		g = &group{keys: keys, states: make([]aggregateState, aggregates)}
+		gs.byKey[key] = g
+		gs.order = append(gs.order, g)
+	}
+	return g
+}
+
+// partial evaluates the plan on the rows of a fragment in the layout of the bound schema, the rows having been
+// filtered. Projected rows are projected, sorted and cut to the limit, as the rows of no other fragment can come
+// before them; grouped rows are returned as the partial aggregates of the groups, see partialAggregates, which the
+// coordinator merges with those of the other fragments before sorting and cutting them.
+func (b *boundPlan) partial(schema TableSchema, rows []Row) []Row {
+	if !b.grouped() {
+		projected := make([]Row, len(rows))
+		for i, row := range rows {
+			projected[i] = make(Row, len(b.keys))
+			for j, k := range b.keys {
+				projected[i][j] = row[k]
+			}
+		}
+		return b.sortAndLimit(projected)
+	}
+	gs := newGroups()
+	for _, row := range rows {
+		keys := make(Row, len(b.keys))
+		for j, k := range b.keys {
+			keys[j] = row[k]
+		}
+		g := gs.get(keys, len(b.Aggregates))
+		for j, aggregate := range b.Aggregates {
+			if b.aggregated[j] < 0 {
+				// count(*) counts the rows, null or not
+				g.states[j].count++
+				continue
+			}
+			g.states[j].add(aggregate.Func, row[b.aggregated[j]], schema.ColumnSchemas[b.aggregated[j]].DataType)
+		}
+	}
+	return b.partialAggregates(gs)
+}
+
+// partialAggregates returns a row per group: the values of the grouped columns followed by the state of each
+// aggregate, its count for count, its sum for sum, its value for min and max, and its sum and count for avg.
+func (b *boundPlan) partialAggregates(gs *groups) []Row {
+	rows := make([]Row, 0, len(gs.order))
+	for _, g := range gs.order {
+		row := append(make(Row, 0, len(b.partialColumns)), g.keys...)
+		for j, aggregate := range b.Aggregates {
+			s := g.states[j]
+			switch aggregate.Func {
+			case AggregateCount:
+				row = append(row, s.count)
+			case AggregateSum:
+				row = append(row, b.sum(j, s))
+			case AggregateMin, AggregateMax:
+				row = append(row, s.value)
+			case AggregateAvg:
+				row = append(row, s.floatSum, s.count)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// sum returns the value of the j-th aggregate of the plan if it is a sum, in the type of its column.
+func (b *boundPlan) sum(j int, s aggregateState) interface{} {
+	if s.count == 0 {
+		return nil
+	}
+	if b.columns[len(b.keys)+j].DataType == TypeInt64 {
+		return s.intSum
+	}
+	return s.floatSum
+}
+
+// merge merges the partial results of the fragments into the result of the plan.
+func (b *boundPlan) merge(partials [][]Row) []Row {
+	rows := make([]Row, 0)
+	if !b.grouped() {
+		for _, partial := range partials {
+			rows = append(rows, partial...)
+		}
+		return b.sortAndLimit(rows)
+	}
+
+	gs := newGroups()
+	for _, partial := range partials {
+		for _, row := range partial {
+			g := gs.get(row[:len(b.keys)], len(b.Aggregates))
+			i := len(b.keys)
+			for j, aggregate := range b.Aggregates {
+				s := &g.states[j]
+				switch aggregate.Func {
+				case AggregateCount:
+					count, _ := integerValue(row[i])
+					s.count += count
+				case AggregateSum:
+					if row[i] != nil {
+						s.add(AggregateSum, row[i], b.columns[len(b.keys)+j].DataType)
+					}
+				case AggregateMin, AggregateMax:
+					if row[i] != nil {
+						s.add(aggregate.Func, row[i], b.columns[len(b.keys)+j].DataType)
+					}
+				case AggregateAvg:
+					sum, _ := numberValue(row[i])
+					count, _ := integerValue(row[i+1])
+					s.floatSum += sum
+					s.count += count
+					i++
+				}
+				i++
+			}
+		}
+	}
+	// a plan aggregating all rows has a single group, even if there is no row
+	if len(b.GroupBy) == 0 && len(gs.order) == 0 {
+		gs.get(Row{}, len(b.Aggregates))
+	}
+	for _, g := range gs.order {
+		row := append(make(Row, 0, len(b.columns)), g.keys...)
+		for j, aggregate := range b.Aggregates {
+			s := g.states[j]
+			switch aggregate.Func {
+			case AggregateCount:
+				row = append(row, s.count)
+			case AggregateSum:
+				row = append(row, b.sum(j, s))
+			case AggregateMin, AggregateMax:
+				row = append(row, s.value)
+			case AggregateAvg:
+				if s.count == 0 {
+					row = append(row, nil)
+				} else {
+					row = append(row, s.floatSum/float64(s.count))
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return b.sortAndLimit(rows)
+}
+
+// sortAndLimit sorts rows in the layout of the result by the sort keys of the plan and cuts them to its limit.
+func (b *boundPlan) sortAndLimit(rows []Row) []Row {
+	if len(b.order) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for k, position := range b.order {
+				x, y := rows[i][position], rows[j][position]
+				if lessValue(x, y) {
+					return !b.OrderBy[k].Desc
+				}
+				if lessValue(y, x) {
+					return b.OrderBy[k].Desc
+				}
+			}
+			return false
+		})
+	}
+	if b.Limit > 0 && len(rows) > b.Limit {
+		rows = rows[:b.Limit]
+	}
+	return rows
+}
+
+// RPCExecutePlan evaluates a plan on a fragment, see QueryPlan, in one RPC: the rows of the fragment are masked with
+// the masks, if any, filtered by the predicate, then projected, sorted and cut to the limit, or grouped into their
+// partial aggregates, which the coordinator merges with those of the other fragments, see boundPlan.partial.
+// A dataset with an empty table name is returned if the fragment does not exist on this node or its store has failed,
+// and one with an Error if the plan does not fit the fragment.
+func (n *Node) RPCExecutePlan(args ExecutePlanArgs, dataset *Dataset) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fragment := args.Fragment
+	plan := args.Plan
+	where := args.Where
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		*dataset = Dataset{}
+		return
+	}
+	b, err := plan.bind(*t.schema)
+	if err != "" {
+		*dataset = Dataset{Error: err}
+		return
+	}
+	rows := make([]Row, 0)
+	for iterator := n.rowIterator(t); iterator.HasNext(); {
+		rows = append(rows, *iterator.Next())
+	}
+	if storeError(t) != nil {
+		*dataset = Dataset{}
+		return
+	}
+	kept := make([]Row, 0, len(rows))
+	for _, row := range maskRows(*t.schema, rows, args.Masks) {
+		if admitsRow(where, row, *t.schema) {
+			kept = append(kept, row)
+		}
+	}
+	*dataset = Dataset{Schema: TableSchema{TableName: fragment, ColumnSchemas: b.partialColumns},
+		Rows: b.partial(*t.schema, kept)}
+}
+
+// pushesDown tells whether the nodes can evaluate a plan on the fragments of a table: each row must be held whole by
+// a single fragment, that is, every fragment holds all columns of the table and the rules of no two fragments admit
+// the same row, and the query must read the current rows without their provenance.
+func pushesDown(q *queryContext, tableName string, schema TableSchema) bool {
+	if q.hints.AsOf != 0 || q.hints.WithProvenance {
+		return false
+	}
+	fragments := q.placement.Fragments(tableName)
+	for i, fragment := range fragments {
+		rule := q.placement.Rule(fragment)
+		if !sameColumns(rule.Column, columnNames(schema.ColumnSchemas)) {
+			return false
+		}
+		for _, other := range fragments[:i] {
+			if !contradicts(rule.Predicate, q.placement.Rule(other).Predicate, schema) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// columnNames returns the names of the columns.
+func columnNames(columns []ColumnSchema) []string {
+	names := make([]string, len(columns))
+	for i, cs := range columns {
+		names[i] = cs.Name
+	}
+	return names
+}
+
+// Query evaluates a plan on a table, see QueryPlan, and sets the result to reply. The rows are filtered by the Where
+// hint as in Scan, the fragments that cannot hold any of them not being read. If each row of the table is held whole
+// by a single fragment, the plan is pushed down to the nodes: a replica of each fragment evaluates it in one RPC and
+// returns the partial aggregates of its groups, or its rows projected, sorted and cut to the limit, which the
+// coordinator merges. Otherwise the rows are reassembled by the coordinator as in Scan and the plan is evaluated
+// there. A fragment none of whose replicas answers is left out and reported as in Scan, see QueryHints.Strictness.
+// The Error of the result is "No Such Column <name>" if the plan refers to an unknown column, "No Such Aggregate
+// <name>" for an unknown aggregate function, "TypeError" if a column summed or averaged is not a number or a value of
+// the Where hint does not fit its column, and "Columns Not Grouped" if the plan both projects and groups the rows.
+// params: tableName string, plan QueryPlan, (optional) hints QueryHints
+func (c *Cluster) Query(params []interface{}, reply *Dataset) {
+	tableName := params[0].(string)
+	plan := params[1].(QueryPlan)
+	q := c.beginQuery(queryHints(params, 2))
+	defer c.endQuery(q)
+	defer c.publishFailedQuery("Query", reply, tableName)
+	defer c.failRenamed(reply, tableName)
+	defer q.reportUnavailable(reply)
+
+	schema, ok := q.catalog.Schema(tableName)
+	if !ok {
+		*reply = Dataset{}
+		return
+	}
+	where, err := q.wherePredicate(tableName)
+	if err != "" {
+		*reply = Dataset{Error: err}
+		return
+	}
+	if err := q.asOfError(tableName); err != "" {
+		*reply = Dataset{Error: err}
+		return
+	}
+	b, err := plan.bind(schema)
+	if err != "" {
+		*reply = Dataset{Error: err}
+		return
+	}
+	// the nodes bind the plan to their fragments, whose columns may be in another order, so the default projection is
+	// spelled out in the order of the schema
+	if !plan.grouped() && len(plan.Columns) == 0 {
+		plan.Columns = tableColumns(schema)
+	}
+
+	var rows []Row
+	if pushesDown(q, tableName, schema) {
+		partials := make([][]Row, 0)
+		args := ExecutePlanArgs{Plan: plan, Where: where, Masks: q.columnMasks(tableName)}
+		for _, fragment := range q.placement.Fragments(tableName) {
+			if q.prunes(tableName, fragment) {
+				continue
+			}
+			args.Fragment = fragment
+			read := false
+			for _, nodeId := range c.readOrder(q.placement.Replicas(fragment)) {
+				partial := Dataset{}
+				if ok := c.nodeEnd(nodeId).Call("Node.RPCExecutePlan", args, &partial); !ok ||
+					partial.Schema.TableName == "" {
+					continue
+				}
+				partials = append(partials, partial.Rows)
+				read = true
+				break
+			}
+			if !read {
+				q.markUnavailable(fragment)
+			}
+		}
+		rows = b.merge(partials)
+	} else {
+		tableRows, _ := tableRows(c, q, tableName, schema.ColumnSchemas)
+		rows = b.merge([][]Row{b.partial(schema, tableRows)})
+	}
+
+	tableColumns := q.catalog.tableColumns(tableName)
+	columns := make([]ResultColumn, len(b.columns))
+	for i, cs := range b.columns {
+		if i < len(b.keys) {
+			columns[i] = tableColumns[b.keys[i]]
+		} else {
+			columns[i] = ResultColumn{Name: cs.Name, DataType: cs.DataType, Table: tableName, Alias: cs.Name,
+				Nullable: true}
+		}
+	}
+	*reply = Dataset{Schema: TableSchema{TableName: tableName, ColumnSchemas: b.columns}, Rows: rows, Columns: columns}
+}
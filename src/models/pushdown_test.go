@@ -0,0 +1,126 @@
+package models
+
+import (
+	"testing"
+)
+
+// query evaluates a plan on a table with the hints.
+func query(tableName string, plan QueryPlan, hints QueryHints) Dataset {
+	result := Dataset{}
+	cli.Call("Cluster.Query", []interface{}{tableName, plan, hints}, &result)
+	return result
+}
+
+func TestQueryPushdown(t *testing.T) {
+	setupSoftDelete(0)
+
+	// each fragment is evaluated by a single RPC to one of its replicas
+	before := map[string]int{}
+	for _, nodeId := range []string{"Node0", "Node1", "Node2"} {
+		before[nodeId] = network.GetCount(nodeId)
+	}
+	plan := QueryPlan{Aggregates: []Aggregate{{Func: AggregateCount}, {Func: AggregateSum, Column: "age"},
+		{Func: AggregateAvg, Column: "grade"}, {Func: AggregateMin, Column: "name"},
+		{Func: AggregateMax, Column: "age"}}}
+	result := query(studentTableName, plan, QueryHints{})
+	if len(result.Rows) != 1 || result.Rows[0][0] != int64(3) || result.Rows[0][1] != int64(66) ||
+		result.Rows[0][3] != "Hana" || result.Rows[0][4] != 23 {
+		t.Fatalf("expected the aggregates of the students, actual %v", result)
+	}
+	if avg := result.Rows[0][2].(float64); avg < 3.866 || avg > 3.867 {
+		t.Errorf("expected the mean grade, actual %v", avg)
+	}
+	if result.Schema.ColumnSchemas[1] != (ColumnSchema{Name: "sum(age)", DataType: TypeInt64}) {
+		t.Errorf("expected sum(age) to be an int64, actual %v", result.Schema)
+	}
+	if calls := network.GetCount("Node0") + network.GetCount("Node1") - before["Node0"] - before["Node1"]; calls != 1 ||
+		network.GetCount("Node2")-before["Node2"] != 1 {
+		t.Errorf("expected one RPC per fragment, actual %v to node0|1", calls)
+	}
+
+	// groups merged over the fragments, sorted by their counts
+	plan = QueryPlan{GroupBy: []string{"grade"}, Aggregates: []Aggregate{{Func: AggregateCount, Column: "name"}},
+		OrderBy: []SortKey{{Column: "count(name)", Desc: true}}}
+	if rows := query(studentTableName, plan, QueryHints{}).Rows; len(rows) != 2 || rows[0][0] != 4.0 ||
+		rows[0][1] != int64(2) || rows[1][1] != int64(1) {
+		t.Errorf("expected two groups of grades, actual %v", rows)
+	}
+
+	// the projected rows are sorted and cut by each node, then by the coordinator
+	plan = QueryPlan{Columns: []string{"name"}, OrderBy: []SortKey{{Column: "age", Desc: true}}, Limit: 2}
+	if result := query(studentTableName, plan, QueryHints{}); result.Error != "No Such Column age" {
+		t.Errorf("expected the sort key to be a column of the result, actual %v", result)
+	}
+	plan = QueryPlan{Columns: []string{"name", "age"}, OrderBy: []SortKey{{Column: "age", Desc: true}}, Limit: 2}
+	if rows := query(studentTableName, plan, QueryHints{}).Rows; len(rows) != 2 || rows[0][0] != "Smith" ||
+		rows[1][0] != "John" {
+		t.Errorf("expected the two oldest students, actual %v", rows)
+	}
+
+	// the fragment of node0|1 cannot hold a grade above 3.6
+	count0, count1 := network.GetCount("Node0"), network.GetCount("Node1")
+	plan = QueryPlan{Aggregates: []Aggregate{{Func: AggregateCount}}}
+	where := QueryHints{Where: Predicate{"grade": {{Op: ">", Val: 3.6}}}}
+	if rows := query(studentTableName, plan, where).Rows; len(rows) != 1 || rows[0][0] != int64(2) {
+		t.Errorf("expected 2 students above 3.6, actual %v", rows)
+	}
+	if network.GetCount("Node0") != count0 || network.GetCount("Node1") != count1 {
+		t.Errorf("expected the fragment of node0|1 to be pruned")
+	}
+	where = QueryHints{Where: Predicate{"grade": {{Op: ">", Val: 5}}}}
+	if rows := query(studentTableName, plan, where).Rows; len(rows) != 1 || rows[0][0] != int64(0) {
+		t.Errorf("expected no student counted, actual %v", rows)
+	}
+}
+
+func TestQueryAtCoordinator(t *testing.T) {
+	setupLab3()
+	rules, _ := NewRuleSet(*studentTableSchema).AddVerticalRule([]string{"sid", "name"}, 0).
+		AddVerticalRule([]string{"sid", "age", "grade"}, 1).Marshal()
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules}, &reply)
+	insertDataLab3(cli)
+
+	// the fragments hold parts of the rows, which the coordinator reassembles
+	plan := QueryPlan{GroupBy: []string{"grade"}, Aggregates: []Aggregate{{Func: AggregateMax, Column: "name"}},
+		OrderBy: []SortKey{{Column: "grade"}}}
+	if rows := query(studentTableName, plan, QueryHints{}).Rows; len(rows) != 2 || rows[0][1] != "Smith" ||
+		rows[1][1] != "John" {
+		t.Errorf("expected the students by grade, actual %v", rows)
+	}
+
+	for _, c := range []struct {
+		plan QueryPlan
+		err  string
+	}{
+		{QueryPlan{Columns: []string{"nickname"}}, "No Such Column nickname"},
+		{QueryPlan{Columns: []string{"name"}, GroupBy: []string{"grade"}}, "Columns Not Grouped"},
+		{QueryPlan{Aggregates: []Aggregate{{Func: AggregateSum, Column: "name"}}}, "TypeError"},
+		{QueryPlan{Aggregates: []Aggregate{{Func: "median", Column: "age"}}}, "No Such Aggregate median"},
+	} {
+		if result := query(studentTableName, c.plan, QueryHints{}); result.Error != c.err {
+			t.Errorf("expected %v for %v, actual %v", c.err, c.plan, result)
+		}
+	}
+}
+
+// a plan without columns projects those of the table in the order of its schema, whatever the order of the fragments
+func TestQueryDefaultProjection(t *testing.T) {
+	setupLab3()
+	rules, _ := NewRuleSet(*studentTableSchema).
+		AddRule(Predicate{"grade": {{Op: "<=", Val: 3.6}}}, []string{"grade", "sid", "name", "age"}, 0).
+		AddRule(Predicate{"grade": {{Op: ">", Val: 3.6}}}, []string{"grade", "sid", "name", "age"}, 1).Marshal()
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules}, &reply)
+	insertDataLab3(cli)
+
+	result := query(studentTableName, QueryPlan{}, QueryHints{})
+	if !datasetDuplicateChecking(Dataset{Schema: *studentTableSchema, Rows: studentRows}, result) {
+		t.Errorf("expected the rows of the students, actual %v", result)
+	}
+	for _, row := range result.Rows {
+		if len(row) != len(studentTableSchema.ColumnSchemas) {
+			t.Errorf("expected the columns of the table only, actual %v", row)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package models
+
+// enumeration of join strategies
+const (
+	// let the coordinator decide, the nodes join co-located fragments by themselves when possible, and a tiny table is
+	// broadcast to the nodes holding a large one, see QueryHints.BroadcastThreshold
+	JoinAuto = iota
+	// pull both tables to the coordinator and join them there
+	JoinAtCoordinator
+	// keep the fragments of the driving table where they are and send the other table to the nodes holding them
+	JoinBroadcast
+	// send the join keys of the driving table to the other table, and pull only the matching rows of it
+	JoinSemi
+)
+
+// what a query does when none of the replicas of a fragment it reads answers, see QueryHints.Strictness
+const (
+	// return the rows of the other fragments, the fragments left out being listed in Dataset.Unavailable
+	AllowPartial = iota
+	// fail the query, its Error being "Fragments Unavailable: <fragments>" and the fragments listed in
+	// Dataset.Unavailable
+	RequireComplete
+)
+
+// QueryHints lets a client choose how a query is executed, so that execution strategies can be compared without
+// code changes. The zero value leaves every decision to the coordinator.
+// A hint that cannot be followed, e.g., a broadcast join of a vertically fragmented table, is ignored and the query
+// is executed at the coordinator.
+type QueryHints struct {
+	// one of the join strategies above
+	JoinStrategy int
+	// the table driving the join, the first table of the join if empty
+	DrivingTable string
+	// how many rows a table may have to be broadcast by a join left to the coordinator (JoinAuto) to the nodes holding
+	// the other table, when that one has more, see broadcastSide. defaultBroadcastThreshold if zero, no table is
+	// broadcast if negative.
+	BroadcastThreshold int
+	// neither read nor fill the row cache
+	DisableCache bool
+	// how many rows a join at the coordinator may hold in memory, larger joins are spilled to temporary files, see
+	// graceHashJoin. There is no limit if not positive.
+	MemoryBudget int
+	// one of the query priorities, which tells the coordinator which of the waiting queries to execute first when
+	// it executes too many queries at the same time, see SetMaxConcurrentQueries
+	Priority int
+	// tag each row of the result of Scan or Join with the replicas of the fragments it has been assembled from, see
+	// Dataset.Provenance. Such a join is executed at the coordinator, so that the rows of every table are read by
+	// the coordinator itself, and the row cache is not used.
+	WithProvenance bool
+	// the user executing the query, who sees the masked columns masked unless privileged, see Cluster.MaskColumn
+	User string
+	// the columns of the result in the order they are returned, each named by its alias (see ResultColumn.Alias) or by
+	// its name if no other column has it; the columns left out are not returned. All columns are returned in the order
+	// of the schema if empty. A result cannot be reordered if a column is unknown, in which case its Error is
+	// "No Such Column <name>".
+	Columns []string
+	// only the rows satisfying the predicate are returned by Scan and Join, each table being filtered by the atoms on
+	// its columns (the atoms on the columns a table does not have are ignored for it, as the nodes ignore those on
+	// the columns their fragments do not hold). The fragments whose rules contradict the predicate are not read at
+	// all, see contradicts. The Error of the result is "TypeError" if a value does not fit its column.
+	Where Predicate
+	// read the tables as they were at that time (in nanoseconds since the Unix epoch, see time.Time.UnixNano) instead
+	// of now, which Scan and Join follow, a join being then executed at the coordinator. The rows are read from the
+	// fragments of the current placement, from the versions their nodes keep (see TableStorage.History), with the
+	// current schemas. The Error of the result is "Not Versioned" if a table keeps no history, and "History Expired"
+	// if it does not go back that far. The current rows are read if zero.
+	AsOf int64
+	// one of the strictness options above, which Scan, Join and Query follow when some fragment cannot be read
+	Strictness int
+}
+
+// defaultBroadcastThreshold is the default QueryHints.BroadcastThreshold.
+const defaultBroadcastThreshold = 1000
+
+// queryHints extracts the optional hints at params[i].
+func queryHints(params []interface{}, i int) QueryHints {
+	if len(params) > i {
+		if hints, ok := params[i].(QueryHints); ok {
+			return hints
+		}
+	}
+	return QueryHints{}
+}
@@ -0,0 +1,56 @@
+package models
+
+// SetReadOnly makes a table, or the whole cluster if the table name is "", read-only or writable again. The writes to
+// a read-only table are rejected with "1 Read Only Table", and all writes with "1 Read Only Cluster" while the cluster
+// is read-only, so that its content can be backed up or snapshotted while the reads continue. The writes rejected are
+// those of rows (FragmentWrite, ImportTable, Delete, Undelete, PurgeTombstones and the direct writes of the clients)
+// and of definitions (BuildTable, DropTable, RenameTable and CreateIndex), while the migrations moving rows (e.g.,
+// Rebalance) still run.
+// Once the reply is received, the writes which started before have finished.
+// params: tableName string ("" for the whole cluster), readOnly bool
+func (c *Cluster) SetReadOnly(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tableName := params[0].(string)
+	readOnly := params[1].(bool)
+	if _, ok := c.catalog.Schema(tableName); !ok && tableName != "" {
+		if err := c.currentPlacement().renamedError(tableName); err != "" {
+			*reply = "1 " + err
+		} else {
+			*reply = "1 No Such Table"
+		}
+		return
+	}
+	// the clients routing by a partition map taken before see the change as a new epoch
+	next := c.currentPlacement().clone()
+	if readOnly {
+		next.ReadOnly[tableName] = true
+	} else {
+		delete(next.ReadOnly, tableName)
+	}
+	c.installPlacement(next)
+	*reply = "0 OK"
+}
+
+// readOnlyError returns why a write to a table is rejected if the table or the cluster is read-only, "" if it is not.
+func (p *Placement) readOnlyError(tableName string) string {
+	if p.ReadOnly[""] {
+		return "Read Only Cluster"
+	}
+	if p.ReadOnly[tableName] {
+		return "Read Only Table"
+	}
+	return ""
+}
+
+// SetReadOnly sets the read-only flag of a table through its owner, or of the whole cluster through every
+// coordinator, see Cluster.SetReadOnly.
+// params: the same as Cluster.SetReadOnly
+func (r *Router) SetReadOnly(params []interface{}, reply *string) {
+	if params[0].(string) == "" {
+		r.broadcast("SetReadOnly", params, reply)
+		return
+	}
+	r.forward(params[0].(string), "SetReadOnly", params, reply)
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOnlyTable(t *testing.T) {
+	setupDDL()
+	client := NewClient(network, "ClientB", c.Name)
+	client.Refresh()
+	reply := ""
+	cli.Call("Cluster.SetReadOnly", []interface{}{studentTableName, true}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("SetReadOnly failed: %v", reply)
+	}
+
+	row := Row{5, "Eve", 20, 3.0}
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, row}, &reply)
+	if reply != "1 Read Only Table" {
+		t.Errorf("expected a read-only table, actual %v", reply)
+	}
+	// the client routed by a partition map taken before the table became read-only
+	if reply := client.Insert(studentTableName, row); reply != "1 Read Only Table" {
+		t.Errorf("expected a read-only table, actual %v", reply)
+	}
+	for method, params := range map[string][]interface{}{
+		"DropTable":   {studentTableName},
+		"RenameTable": {studentTableName, "pupil"},
+		"CreateIndex": {studentTableName, "sid"},
+		"BuildTable":  {studentTableSchema, studentTablePartitionRules},
+		"ImportTable": {studentTableName, filepath.Join(t.TempDir(), "student.col")},
+	} {
+		cli.Call("Cluster."+method, params, &reply)
+		if reply != "1 Read Only Table" {
+			t.Errorf("%v should be rejected, actual %v", method, reply)
+		}
+	}
+
+	// the reads continue, and the other tables can be written
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{DisableCache: true}}, &result)
+	if len(result.Rows) != len(studentRows) {
+		t.Errorf("expected %v rows, actual %v", len(studentRows), result.Rows)
+	}
+	cli.Call("Cluster.FragmentWrite", []interface{}{courseRegistrationTableName, Row{2, 2}}, &reply)
+	if reply != "0 OK" {
+		t.Errorf("courseRegistration should be writable, actual %v", reply)
+	}
+
+	cli.Call("Cluster.SetReadOnly", []interface{}{studentTableName, false}, &reply)
+	if reply := client.Insert(studentTableName, row); reply != "0 OK" {
+		t.Errorf("the table should be writable again, actual %v", reply)
+	}
+	cli.Call("Cluster.SetReadOnly", []interface{}{"unknown", true}, &reply)
+	if reply != "1 No Such Table" {
+		t.Errorf("an unknown table cannot be read-only, actual %v", reply)
+	}
+}
+
+func TestReadOnlyCluster(t *testing.T) {
+	setupDDL()
+	reply := ""
+	cli.Call("Cluster.SetReadOnly", []interface{}{"", true}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("SetReadOnly failed: %v", reply)
+	}
+	for _, tableName := range []string{studentTableName, courseRegistrationTableName} {
+		cli.Call("Cluster.FragmentWrite", []interface{}{tableName, Row{5, 5, 5, 5.0}}, &reply)
+		if reply != "1 Read Only Cluster" {
+			t.Errorf("%v should not be written, actual %v", tableName, reply)
+		}
+	}
+	cli.Call("Cluster.BuildTable", []interface{}{TableSchema{TableName: "new", ColumnSchemas: []ColumnSchema{
+		{Name: "a", DataType: TypeInt32}}}, studentTablePartitionRules}, &reply)
+	if reply != "1 Read Only Cluster" {
+		t.Errorf("no table should be built, actual %v", reply)
+	}
+
+	// the migrations still run
+	cli.Call("Cluster.Rebalance", "", &reply)
+	if reply != "0 OK" {
+		t.Errorf("Rebalance failed: %v", reply)
+	}
+	result := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &result)
+	if !datasetDuplicateChecking(Dataset{Schema: joinedTableSchema, Rows: joinedTableContent}, result) {
+		t.Errorf("unexpected join results %v", result)
+	}
+
+	cli.Call("Cluster.SetReadOnly", []interface{}{"", false}, &reply)
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{5, "Eve", 20, 3.0}}, &reply)
+	if reply != "0 OK" {
+		t.Errorf("the cluster should be writable again, actual %v", reply)
+	}
+}
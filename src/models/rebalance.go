@@ -0,0 +1,289 @@
+package models
+
+import (
+	"errors"
+	"sort"
+)
+
+// Rebalance moves replicas of fragments from the nodes holding the most rows to the nodes holding the fewest, until no
+// move makes the load more even. Queries keep running while replicas are moved, see Placement, while writes wait until
+// the rebalancing finishes.
+// The replicas violating the placement constraints of their fragments are moved first, see PlacementConstraint, and
+// no replica is then moved to a node violating them.
+// The reply is "0 OK" if the rebalancing succeeds, or "1 <reason>" if some replica cannot be moved, in which case the
+// replicas moved before are kept in their new places.
+func (c *Cluster) Rebalance(args interface{}, reply *string) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	sizes, err := c.fragmentSizes()
+	if err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+	if err := c.repairConstraints(sizes); err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+	for {
+		placement := c.currentPlacement()
+		load := nodeLoads(placement, sizes)
+		most, least := c.nodeIds[0], c.nodeIds[0]
+		for _, nodeId := range c.nodeIds {
+			if load[nodeId] > load[most] {
+				most = nodeId
+			}
+			if load[nodeId] < load[least] {
+				least = nodeId
+			}
+		}
+
+		// the largest fragment whose move narrows the gap between the two nodes, which makes every move strictly
+		// decrease the sum of squared loads so that the loop terminates
+		candidate := ""
+		for fragment, size := range sizes {
+			if size == 0 || size >= load[most]-load[least] || (candidate != "" && size <= sizes[candidate]) {
+				continue
+			}
+			if nodeHoldsAll(placement, most, []string{fragment}) && !nodeHoldsAll(placement, least, []string{fragment}) &&
+				c.keepsConstraints(placement, fragment, most, least) {
+				candidate = fragment
+			}
+		}
+		if candidate == "" {
+			break
+		}
+		if err := c.moveReplica(candidate, most, least); err != nil {
+			*reply = "1 " + err.Error()
+			return
+		}
+	}
+	*reply = "0 OK"
+}
+
+// DecommissionNode moves every replica held by a node to the other nodes, drains the node and removes it from the
+// cluster, after which the node can be stopped. A replica is dropped instead of moved if every other node already
+// holds the fragment. The replicas are only moved to the nodes satisfying the placement constraints of their
+// fragments. The reply is "0 OK" if the node has been decommissioned, or "1 <reason>" otherwise.
+// params: nodeId string, e.g., "Node3"
+func (c *Cluster) DecommissionNode(nodeId string, reply *string) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	others := make([]string, 0, len(c.nodeIds))
+	for _, id := range c.nodeIds {
+		if id != nodeId {
+			others = append(others, id)
+		}
+	}
+	if len(others) == len(c.nodeIds) {
+		*reply = "1 no such node"
+		return
+	}
+	if len(others) == 0 {
+		*reply = "1 cannot decommission the last node"
+		return
+	}
+	sizes, err := c.fragmentSizes()
+	if err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+
+	for _, fragment := range sortedKeys(sizes) {
+		placement := c.currentPlacement()
+		if !nodeHoldsAll(placement, nodeId, []string{fragment}) {
+			continue
+		}
+		load := nodeLoads(placement, sizes)
+		target, constrained := "", false
+		for _, id := range others {
+			if nodeHoldsAll(placement, id, []string{fragment}) {
+				continue
+			}
+			if !c.keepsConstraints(placement, fragment, nodeId, id) {
+				constrained = true
+			} else if target == "" || load[id] < load[target] {
+				target = id
+			}
+		}
+		switch {
+		case target != "":
+			err = c.moveReplica(fragment, nodeId, target)
+		case constrained:
+			err = errors.New("no node satisfies the placement constraints of " + fragment)
+		default:
+			err = c.dropReplica(fragment, nodeId)
+		}
+		if err != nil {
+			*reply = "1 " + err.Error()
+			return
+		}
+	}
+
+	msg := ""
+	if ok := c.nodeEnd(nodeId).Call("Node.RPCDrain", "", &msg); !ok || msg[0] != '0' {
+		*reply = "1 cannot drain " + nodeId
+		return
+	}
+	c.nodeIds = others
+	c.publish(Event{Type: EventNodeLeft, NodeId: nodeId})
+	*reply = "0 OK"
+}
+
+// dropReplica drops the replica of a fragment on a node, which must not be the only replica. The caller must hold
+// writeMu.
+func (c *Cluster) dropReplica(fragment string, nodeId string) error {
+	next := c.currentPlacement().clone()
+	kept := make([]string, 0)
+	for _, id := range next.FragmentNodes[fragment] {
+		if id != nodeId {
+			kept = append(kept, id)
+		}
+	}
+	if len(kept) == 0 {
+		return errors.New("cannot drop the only replica of " + fragment)
+	}
+	next.FragmentNodes[fragment] = kept
+	c.installPlacement(next)
+	c.rowIndex.RemoveNodeFragment(fragmentTable(fragment), nodeId, fragment)
+
+	c.waitForReaders(next.Epoch)
+	reply := ""
+	c.nodeEnd(nodeId).Call("Node.RPCDropTable", FragmentArgs{Fragment: fragment}, &reply)
+	return nil
+}
+
+// fragmentSizes counts the rows of every fragment, which does not change while writes are blocked.
+func (c *Cluster) fragmentSizes() (map[string]int, error) {
+	sizes := make(map[string]int)
+	for fragment := range c.currentPlacement().FragmentRules {
+		size, ok := c.fragmentSize(fragment)
+		if !ok {
+			return nil, errors.New("cannot count rows of " + fragment)
+		}
+		sizes[fragment] = size
+	}
+	return sizes, nil
+}
+
+// nodeLoads sums the sizes of the replicas held by each node.
+func nodeLoads(placement *Placement, sizes map[string]int) map[string]int {
+	load := make(map[string]int)
+	for fragment, size := range sizes {
+		for _, nodeId := range placement.Replicas(fragment) {
+			load[nodeId] += size
+		}
+	}
+	return load
+}
+
+// sortedKeys returns the fragments in a fixed order, so that decisions do not depend on the order of map iteration.
+func sortedKeys(sizes map[string]int) []string {
+	keys := make([]string, 0, len(sizes))
+	for fragment := range sizes {
+		keys = append(keys, fragment)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fragmentSize counts the rows of a fragment on the first replica that answers.
+func (c *Cluster) fragmentSize(fragment string) (int, bool) {
+	for _, nodeId := range c.currentPlacement().Replicas(fragment) {
+		cnt := -1
+		if ok := c.nodeEnd(nodeId).Call("Node.RPCCountRows", FragmentArgs{Fragment: fragment}, &cnt); ok && cnt >= 0 {
+			return cnt, true
+		}
+	}
+	return 0, false
+}
+
+// moveReplica moves the replica of a fragment on node from to node to. The caller must hold writeMu.
+// The replica is copied to the new node before a placement using it is installed, and the old replica is dropped only
+// after the queries that may read it have finished, so a query reads each row exactly once whichever placement it
+// pinned.
+func (c *Cluster) moveReplica(fragment string, from string, to string) error {
+	tableName := fragmentTable(fragment)
+	rule := c.currentPlacement().Rule(fragment)
+	fullSchema := c.fullSchema(tableName)
+
+	reply := ""
+	c.nodeEnd(to).Call("Node.RPCCreateTable", CreateTableArgs{Schema: *fragmentSchema(fragment, rule, fullSchema),
+		Predicate: rule.Predicate, FullSchema: fullSchema, Storage: c.catalog.Storage(tableName)}, &reply)
+	if len(reply) == 0 || reply[0] != '0' {
+		return errors.New("cannot create " + fragment + " on " + to)
+	}
+	_, ok := c.copyRows(fragment, from, fragment, []string{to}, 0)
+	ids, listed := c.fragmentIds(to, fragment)
+	if !ok || !listed {
+		reply = ""
+		c.nodeEnd(to).Call("Node.RPCDropTable", FragmentArgs{Fragment: fragment}, &reply)
+		return errors.New("cannot copy " + fragment + " from " + from + " to " + to)
+	}
+
+	next := c.currentPlacement().clone()
+	for i, nodeId := range next.FragmentNodes[fragment] {
+		if nodeId == from {
+			next.FragmentNodes[fragment][i] = to
+		}
+	}
+	c.installPlacement(next)
+	for _, id := range ids {
+		c.rowIndex.RemoveLocation(tableName, id, RowLocation{NodeId: from, Fragment: fragment})
+		c.rowIndex.Add(tableName, id, RowLocation{NodeId: to, Fragment: fragment})
+	}
+
+	c.waitForReaders(next.Epoch)
+	// the old replica is no longer used by any query, failing to drop it only wastes space on the node
+	reply = ""
+	c.nodeEnd(from).Call("Node.RPCDropTable", FragmentArgs{Fragment: fragment}, &reply)
+	c.publish(Event{Type: EventFragmentMoved, Tables: []string{tableName}, Fragment: fragment, From: from, To: to})
+	return nil
+}
+
+// copyRows copies the rows of fragment source, from the offset-th row on, from node from to fragment dest on each of
+// the target nodes in batches. The target nodes skip the rows they already have or that do not satisfy the predicate
+// of dest. It returns the offset after the last copied row, so that rows appended to source after the copy can be
+// copied by another call.
+func (c *Cluster) copyRows(source string, from string, dest string, targets []string, offset int) (int, bool) {
+	end := c.nodeEnd(from)
+	for {
+		batch := Dataset{}
+		if ok := end.Call("Node.RPCScanFragment", ScanFragmentArgs{Fragment: source, Offset: offset,
+			Limit: scanBatchSize}, &batch); !ok ||
+			batch.Schema.TableName == "" {
+			return offset, false
+		}
+		if len(batch.Rows) > 0 {
+			for _, nodeId := range targets {
+				reply := ""
+				ok := c.nodeEnd(nodeId).Call("Node.RPCAppendRows", AppendRowsArgs{Fragment: dest, Rows: batch}, &reply)
+				if !ok || reply[0] != '0' {
+					return offset, false
+				}
+			}
+		}
+		offset += len(batch.Rows)
+		if len(batch.Rows) < scanBatchSize {
+			return offset, true
+		}
+	}
+}
+
+// fragmentIds returns the ids of the rows of a fragment on a node.
+func (c *Cluster) fragmentIds(nodeId string, fragment string) ([]string, bool) {
+	values := make(map[string]map[string]interface{})
+	if !scanFragment(c.nodeEnd(nodeId), fragment, nil, values) {
+		return nil, false
+	}
+	ids := make([]string, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	return ids, true
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+// rangeFragment builds the rule of a fragment with the given columns, defined by one atom on a column.
+func rangeFragment(column string, op string, val interface{}, columns ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"predicate": map[string]interface{}{
+			column: [...]map[string]interface{}{{
+				"op":  op,
+				"val": val,
+			},
+			},
+		},
+		"column": columns,
+	}
+}
+
+// all fragments start on node0 and node1, and joins keep running while they are spread over the other nodes
+func TestRebalanceWhileJoining(t *testing.T) {
+	setupLab3()
+
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"0":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows:   joinedTableContent,
+	}
+	stop := make(chan bool)
+	wrong := make(chan Dataset, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				results := Dataset{}
+				cli.Call("Cluster.JoinWithHints", []interface{}{
+					[]string{studentTableName, courseRegistrationTableName},
+					QueryHints{JoinStrategy: JoinAtCoordinator, DisableCache: true},
+				}, &results)
+				if !datasetDuplicateChecking(expectedDataset, results) {
+					select {
+					case wrong <- results:
+					default:
+					}
+				}
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+		}()
+	}
+
+	reply := ""
+	cli.Call("Cluster.Rebalance", "", &reply)
+	close(stop)
+	wg.Wait()
+	if reply != "0 OK" {
+		t.Fatalf("Rebalance failed: %v", reply)
+	}
+	select {
+	case results := <-wrong:
+		t.Errorf("Incorrect join results during rebalancing, expected %v, actual %v", expectedDataset, results)
+	default:
+	}
+
+	placement := c.currentPlacement()
+	if placement.Epoch < 2 {
+		t.Errorf("No replica has been moved, placement %v", placement.FragmentNodes)
+	}
+	for fragment, nodeIds := range placement.FragmentNodes {
+		for _, nodeId := range nodeIds {
+			cnt := -1
+			c.nodeEnd(nodeId).Call("Node.RPCCountRows", FragmentArgs{Fragment: fragment}, &cnt)
+			if cnt < 0 {
+				t.Errorf("%v is placed on %v which does not hold it", fragment, nodeId)
+			}
+		}
+	}
+
+	results := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results after rebalancing, expected %v, actual %v", expectedDataset, results)
+	}
+}
+
+// node0 holds a replica of every fragment, which are moved to the other nodes before node0 is drained
+func TestDecommissionNode(t *testing.T) {
+	setupLab3()
+
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"0":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+
+	reply := ""
+	cli.Call("Cluster.DecommissionNode", "Node0", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("DecommissionNode failed: %v", reply)
+	}
+	for fragment, nodeIds := range c.currentPlacement().FragmentNodes {
+		for _, nodeId := range nodeIds {
+			if nodeId == "Node0" {
+				t.Errorf("%v is still placed on the decommissioned node", fragment)
+			}
+		}
+	}
+
+	reply = ""
+	args := InsertArgs{Fragment: studentTableName + "|0", Row: Row{9, "Bob", 20, 3.0, "x"}}
+	c.nodeEnd("Node0").Call("Node.RPCInsert", args, &reply)
+	if reply != "1 Node Draining" {
+		t.Errorf("A drained node should reject writes, actual %v", reply)
+	}
+
+	results := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows:   joinedTableContent,
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results after decommissioning, expected %v, actual %v", expectedDataset, results)
+	}
+}
@@ -0,0 +1,157 @@
+package models
+
+import "strings"
+
+// RenameTable renames a table, its fragments "from|i" becoming "to|i" on every node holding them. From now on, the
+// requests on the old name fail with "1 Table Renamed To <to>", or a Dataset with that Error for the queries, until
+// another table is built with the old name. The queries on the old name which are still running when the rename
+// starts fail in the same way instead of returning the rows of the fragments they could read before.
+// params: from string, to string
+func (c *Cluster) RenameTable(params []interface{}, reply *string) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	from := params[0].(string)
+	to := params[1].(string)
+	_, ok := c.catalog.Schema(from)
+	if !ok {
+		if err := c.currentPlacement().renamedError(from); err != "" {
+			*reply = "1 " + err
+		} else {
+			*reply = "1 No Such Table"
+		}
+		return
+	}
+	if err := c.currentPlacement().readOnlyError(from); err != "" {
+		*reply = "1 " + err
+		return
+	}
+	if _, exists := c.catalog.Schema(to); exists {
+		*reply = "1 Table Exists"
+		return
+	}
+	if to == "" || strings.Contains(to, "|") {
+		*reply = "1 Invalid Table Name"
+		return
+	}
+
+	// the queries on the old name fail from now on, so that none of them sees the fragments being renamed
+	marked := c.currentPlacement().clone()
+	marked.Renamed[from] = to
+	c.installPlacement(marked)
+	renamed := make([]RowLocation, 0)
+	for _, fragment := range marked.Fragments(from) {
+		for _, nodeId := range marked.Replicas(fragment) {
+			msg := ""
+			c.nodeEnd(nodeId).Call("Node.RPCRenameTable", RenameTableArgs{Fragment: fragment,
+				NewFragment: renamedFragment(fragment, to)}, &msg)
+			if len(msg) == 0 || msg[0] != '0' {
+				for _, l := range renamed {
+					c.nodeEnd(l.NodeId).Call("Node.RPCRenameTable",
+						RenameTableArgs{Fragment: renamedFragment(l.Fragment, to), NewFragment: l.Fragment}, &msg)
+				}
+				restored := c.currentPlacement().clone()
+				delete(restored.Renamed, from)
+				c.installPlacement(restored)
+				*reply = "1 cannot rename " + fragment + " on " + nodeId
+				return
+			}
+			renamed = append(renamed, RowLocation{NodeId: nodeId, Fragment: fragment})
+		}
+	}
+
+	next := marked.clone()
+	for _, fragment := range marked.Fragments(from) {
+		newFragment := renamedFragment(fragment, to)
+		next.FragmentNodes[newFragment] = next.FragmentNodes[fragment]
+		next.FragmentRules[newFragment] = next.FragmentRules[fragment]
+		delete(next.FragmentNodes, fragment)
+		delete(next.FragmentRules, fragment)
+		c.fragmentVersions[newFragment] = c.fragmentVersions[fragment]
+		delete(c.fragmentVersions, fragment)
+	}
+	// the names the table had before are renamed to the new name as well
+	for old, current := range next.Renamed {
+		if current == from {
+			next.Renamed[old] = to
+		}
+	}
+	delete(next.Renamed, to)
+	if masks, ok := next.Masks[from]; ok {
+		next.Masks[to] = masks
+		delete(next.Masks, from)
+	}
+
+	c.rowCache.Invalidate(from)
+	c.rowIndex.RenameTable(from, to)
+	c.installCatalog(next, func(cat *Catalog) { cat.RenameTable(from, to) })
+	*reply = "0 OK"
+}
+
+// renamedFragment returns the name of a fragment "tableName|i" once its table is renamed to the given name.
+func renamedFragment(fragment string, tableName string) string {
+	return tableName + fragment[strings.LastIndex(fragment, "|"):]
+}
+
+// renamedError returns why a request on a table fails if the table has been renamed, "" if it has not.
+func (p *Placement) renamedError(tableName string) string {
+	if to, ok := p.Renamed[tableName]; ok {
+		return "Table Renamed To " + to
+	}
+	return ""
+}
+
+// failRenamed replaces the reply of a query with an error if one of its tables has been renamed, when or since the
+// query started. It is deferred by the queries before they read anything.
+func (c *Cluster) failRenamed(reply *Dataset, tableNames ...string) {
+	placement := c.currentPlacement()
+	for _, tableName := range tableNames {
+		if err := placement.renamedError(tableName); err != "" {
+			*reply = Dataset{Error: err}
+			return
+		}
+	}
+}
+
+// RPCRenameTable renames a fragment held by this node, together with the snapshots taken of it.
+func (n *Node) RPCRenameTable(args RenameTableArgs, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer n.logIfOk("RPCRenameTable", args, reply)
+
+	from := args.Fragment
+	to := args.NewFragment
+	t, ok := n.TableMap[from]
+	if !ok {
+		*reply = "1 no such table"
+		return
+	}
+	if _, ok := n.TableMap[to]; ok {
+		*reply = "1 table already exists"
+		return
+	}
+	// the schemas may be shared with the readers of the table, so they are copied instead of being modified
+	schema := *t.schema
+	schema.TableName = to
+	t.schema = &schema
+	if t.fullSchema != nil {
+		fullSchema := *t.fullSchema
+		fullSchema.TableName = fragmentTable(to)
+		t.fullSchema = &fullSchema
+	}
+	delete(n.TableMap, from)
+	n.TableMap[to] = t
+
+	n.snapshotMu.Lock()
+	defer n.snapshotMu.Unlock()
+	for _, snapshot := range n.snapshots {
+		if snapshot.fragment == from {
+			snapshot.fragment = to
+			snapshot.schema.TableName = to
+		}
+	}
+	*reply = "0 OK"
+}
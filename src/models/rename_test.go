@@ -0,0 +1,108 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestRenameTable(t *testing.T) {
+	setupDDL()
+	reply := ""
+	cli.Call("Cluster.CreateIndex", []interface{}{studentTableName, "sid"}, &reply)
+	definition := TableDefinition{}
+	cli.Call("Cluster.DescribeTable", studentTableName, &definition)
+
+	cli.Call("Cluster.RenameTable", []interface{}{studentTableName, "pupil"}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot rename the table: %v", reply)
+	}
+	cli.Call("Cluster.RenameTable", []interface{}{"pupil", courseRegistrationTableName}, &reply)
+	if reply != "1 Table Exists" {
+		t.Errorf("a table should not be renamed to an existing one, actual %v", reply)
+	}
+
+	// the fragments are renamed on every node
+	for _, fragment := range definition.Fragments {
+		for _, nodeId := range fragment.Nodes {
+			old, renamed := Dataset{}, Dataset{}
+			end := c.nodeEnd(nodeId)
+			end.Call("Node.RPCScanFragment", ScanFragmentArgs{Fragment: fragment.Fragment, Limit: scanBatchSize}, &old)
+			end.Call("Node.RPCScanFragment", ScanFragmentArgs{Fragment: renamedFragment(fragment.Fragment, "pupil"),
+				Limit: scanBatchSize}, &renamed)
+			if old.Schema.TableName != "" || renamed.Schema.TableName != renamedFragment(fragment.Fragment, "pupil") {
+				t.Errorf("%v is not renamed on %v: %v %v", fragment.Fragment, nodeId, old.Schema, renamed.Schema)
+			}
+		}
+	}
+
+	// the table keeps its rows and its key under the new name
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{"pupil", QueryHints{}}, &result)
+	if len(result.Rows) != len(studentRows) || result.Schema.TableName != "pupil" {
+		t.Errorf("expected %v rows of pupil, actual %v", len(studentRows), result)
+	}
+	result = Dataset{}
+	cli.Call("Cluster.Get", []interface{}{"pupil", 1}, &result)
+	if len(result.Rows) != 1 || !result.Rows[0].Equals(&studentRows[1]) {
+		t.Errorf("expected %v, actual %v", studentRows[1], result.Rows)
+	}
+	cli.Call("Cluster.FragmentWrite", []interface{}{"pupil", Row{1, "Bob", 20, 3.0}}, &reply)
+	if reply != "1 Duplicate Key" {
+		t.Errorf("expected a duplicate key, actual %v", reply)
+	}
+	result = Dataset{}
+	cli.Call("Cluster.Join", []string{"pupil", courseRegistrationTableName}, &result)
+	if len(result.Rows) != len(joinedTableContent) {
+		t.Errorf("expected %v joined rows, actual %v", len(joinedTableContent), result.Rows)
+	}
+
+	// the requests on the old name tell it has been renamed
+	result = Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{}}, &result)
+	if result.Error != "Table Renamed To pupil" {
+		t.Errorf("expected the table to be renamed, actual %v", result)
+	}
+	result = Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &result)
+	if result.Error != "Table Renamed To pupil" {
+		t.Errorf("expected the table to be renamed, actual %v", result)
+	}
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Bob", 20, 3.0}}, &reply)
+	if reply != "1 Table Renamed To pupil" {
+		t.Errorf("expected the table to be renamed, actual %v", reply)
+	}
+
+	// the renames are replayed by the restarted nodes
+	for _, nodeId := range []string{"Node0", "Node1", "Node2", "Node3"} {
+		cli.Call("Cluster.RestartNode", nodeId, &reply)
+		if reply != "0 OK" {
+			t.Fatalf("cannot restart %v: %v", nodeId, reply)
+		}
+	}
+	result = Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{"pupil", QueryHints{DisableCache: true}}, &result)
+	if len(result.Rows) != len(studentRows) {
+		t.Errorf("expected %v rows of pupil after restarting, actual %v", len(studentRows), result.Rows)
+	}
+
+	// the old name can be given to a new table
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, studentTablePartitionRules}, &reply)
+	result = Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{}}, &result)
+	if result.Error != "" || result.Schema.TableName != studentTableName || len(result.Rows) != 0 {
+		t.Errorf("expected an empty table, actual %v", result)
+	}
+}
+
+// a query which is running when its table is renamed fails
+func TestRenameRunningQuery(t *testing.T) {
+	setupDDL()
+	reply := ""
+	result := Dataset{Schema: *studentTableSchema, Rows: studentRows}
+	q := c.beginQuery(QueryHints{})
+	cli.Call("Cluster.RenameTable", []interface{}{studentTableName, "pupil"}, &reply)
+	c.failRenamed(&result, studentTableName)
+	c.endQuery(q)
+	if reply != "0 OK" || result.Error != "Table Renamed To pupil" {
+		t.Errorf("expected the query to fail, actual %v %v", reply, result)
+	}
+}
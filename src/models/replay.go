@@ -0,0 +1,121 @@
+package models
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"../labgob"
+	"../labrpc"
+)
+
+// RecordedCall is a call made by a client to a cluster, see Recorder.
+type RecordedCall struct {
+	// when the call was made, relative to the creation of the Recorder
+	Offset time.Duration
+	// the name of the method, e.g., "Cluster.FragmentWrite"
+	Method string
+	Args   interface{}
+}
+
+// Recorder is a client end which records the calls made through it, so that they can be saved to a file and
+// replayed against another cluster by Replay, e.g., to compare join implementations or fragmentation schemes on the
+// same workload. Calls may be made concurrently.
+type Recorder struct {
+	end   *labrpc.ClientEnd
+	start time.Time
+	mu    sync.Mutex
+	calls []RecordedCall
+}
+
+// ReplayedCall is the outcome of replaying a RecordedCall.
+type ReplayedCall struct {
+	Method  string
+	Latency time.Duration
+	// whether the call reached the cluster
+	Ok bool
+	// the reply of the cluster
+	Reply interface{}
+}
+
+// NewRecorder creates a Recorder making its calls through end.
+func NewRecorder(end *labrpc.ClientEnd) *Recorder {
+	return &Recorder{end: end, start: time.Now()}
+}
+
+// Call records the call and makes it, in the way of labrpc.ClientEnd.Call.
+func (r *Recorder) Call(method string, args interface{}, reply interface{}) bool {
+	r.mu.Lock()
+	r.calls = append(r.calls, RecordedCall{Offset: time.Since(r.start), Method: method, Args: args})
+	r.mu.Unlock()
+	return r.end.Call(method, args, reply)
+}
+
+// Calls returns the calls recorded so far.
+func (r *Recorder) Calls() []RecordedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedCall(nil), r.calls...)
+}
+
+// Save writes the calls recorded so far to a file.
+func (r *Recorder) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return labgob.NewEncoder(file).Encode(r.Calls())
+}
+
+// LoadRecording reads the calls saved by Recorder.Save.
+func LoadRecording(path string) ([]RecordedCall, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	calls := make([]RecordedCall, 0)
+	if err := labgob.NewDecoder(file).Decode(&calls); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
+
+// Replay makes the calls saved in a file through end one after another, keeping the recorded pauses between them
+// divided by speed, e.g., 1 replays the calls as they were made and 2 twice as fast. A speed of 0 replays the calls
+// without pausing.
+func Replay(path string, end *labrpc.ClientEnd, speed float64) ([]ReplayedCall, error) {
+	calls, err := LoadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	results := make([]ReplayedCall, 0, len(calls))
+	for _, call := range calls {
+		if speed > 0 {
+			if wait := time.Duration(float64(call.Offset)/speed) - time.Since(start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		reply := newReply(call.Method)
+		begin := time.Now()
+		ok := end.Call(call.Method, call.Args, reply)
+		results = append(results, ReplayedCall{Method: call.Method, Latency: time.Since(begin), Ok: ok, Reply: reply})
+	}
+	return results, nil
+}
+
+// newReply allocates the reply of a method of Cluster, e.g., "Cluster.Scan", of the type of its reply parameter as
+// Cluster.Execute does, a string for an unknown method.
+func newReply(method string) interface{} {
+	name := strings.TrimPrefix(method, "Cluster.")
+	if m, ok := reflect.TypeOf(&Cluster{}).MethodByName(name); ok && m.Type.NumIn() == 3 &&
+		m.Type.In(2).Kind() == reflect.Ptr {
+		return reflect.New(m.Type.In(2).Elem()).Interface()
+	}
+	reply := ""
+	return &reply
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// the creation and the filling of the lab3 tables are recorded against one cluster and replayed against another
+func TestRecordAndReplay(t *testing.T) {
+	setupLab3()
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"2":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+
+	recorder := NewRecorder(cli)
+	reply := ""
+	recorder.Call("Cluster.BuildTable", []interface{}{courseRegistrationTableSchema, courseRegistrationTablePartitionRules}, &reply)
+	recorder.Call("Cluster.BuildTable", []interface{}{studentTableSchema, studentTablePartitionRules}, &reply)
+	for _, row := range studentRows {
+		recorder.Call("Cluster.FragmentWrite", []interface{}{studentTableName, row}, &reply)
+	}
+	time.Sleep(20 * time.Millisecond)
+	for _, row := range courseRegistrationRows {
+		recorder.Call("Cluster.FragmentWrite", []interface{}{courseRegistrationTableName, row}, &reply)
+	}
+	results := Dataset{}
+	recorder.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+
+	path := filepath.Join(t.TempDir(), "workload")
+	if err := recorder.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	setupLab3()
+	start := time.Now()
+	replayed, err := Replay(path, cli, 2)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("The pause between the writes should be replayed, the replay took %v", elapsed)
+	}
+	if len(replayed) != len(recorder.Calls()) {
+		t.Fatalf("Expected %v replayed calls, actual %v", len(recorder.Calls()), len(replayed))
+	}
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows:   joinedTableContent,
+	}
+	last := replayed[len(replayed)-1]
+	if !last.Ok || !datasetDuplicateChecking(expectedDataset, *last.Reply.(*Dataset)) {
+		t.Errorf("Incorrect replayed join results, expected %v, actual %v", expectedDataset, last.Reply)
+	}
+}
+
+// the replies are allocated by the signatures of the methods
+func TestNewReply(t *testing.T) {
+	if _, ok := newReply("Cluster.Query").(*Dataset); !ok {
+		t.Errorf("expected a Dataset for Query")
+	}
+	if _, ok := newReply("Cluster.Execute").(*Response); !ok {
+		t.Errorf("expected a Response for Execute")
+	}
+	if _, ok := newReply("Cluster.HealthCheck").(*HealthReport); !ok {
+		t.Errorf("expected a HealthReport for HealthCheck")
+	}
+	if _, ok := newReply("Cluster.FragmentWrite").(*string); !ok {
+		t.Errorf("expected a string for FragmentWrite")
+	}
+	if _, ok := newReply("Cluster.Unknown").(*string); !ok {
+		t.Errorf("expected a string for an unknown method")
+	}
+}
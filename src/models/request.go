@@ -0,0 +1,194 @@
+package models
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultRequestWindow is how long the coordinator keeps the reply of a request by default, see SetRequestWindow.
+const defaultRequestWindow = time.Minute
+
+// requestAttempts is how many times Client.Execute sends a request before giving up.
+const requestAttempts = 10
+
+// Request is a call of a method of the coordinator identified by a unique id, so that the coordinator executes it
+// once however many times it is delivered, see Cluster.Execute.
+type Request struct {
+	// unique among the requests of all clients, the retries of a request carrying the same id
+	Id string
+	// the method of Cluster to call, e.g., "FragmentWrite"
+	Method string
+	// the argument of the method, e.g., []interface{}{tableName, row} for FragmentWrite
+	Args interface{}
+}
+
+// Response is the reply to a Request.
+type Response struct {
+	// the reply of the method, e.g., a string for FragmentWrite or a Dataset for Scan
+	Reply interface{}
+	// whether the reply is the one kept from an earlier delivery of the request, which has not been executed again
+	Replayed bool
+	// why the request could not be executed, "No Such Method <name>" or "Wrong Arguments", empty if it was
+	Error string
+}
+
+// NewRequest creates a request of the method with a new id.
+func NewRequest(method string, args interface{}) Request {
+	return Request{Id: uuid.New().String(), Method: method, Args: args}
+}
+
+// executedRequest is a request the coordinator has executed, or is executing.
+type executedRequest struct {
+	// closed once the request has been executed
+	done     chan struct{}
+	response Response
+	// when the request was executed, its reply being forgotten a window later
+	finished time.Time
+}
+
+// requestCache keeps the replies of the requests executed lately, see Cluster.Execute.
+type requestCache struct {
+	mu     sync.Mutex
+	window time.Duration
+	// request id -> the request
+	requests map[string]*executedRequest
+	// the ids of the requests executed, in the order they finished
+	finished []string
+}
+
+func newRequestCache() *requestCache {
+	return &requestCache{window: defaultRequestWindow, requests: make(map[string]*executedRequest)}
+}
+
+// begin returns the request with the id if it has been executed or is being executed, and true; otherwise it records
+// the request as being executed and returns it with false, the caller having to finish it.
+func (rc *requestCache) begin(id string) (*executedRequest, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.expire(time.Now())
+	if request, ok := rc.requests[id]; ok {
+		return request, true
+	}
+	request := &executedRequest{done: make(chan struct{})}
+	rc.requests[id] = request
+	return request, false
+}
+
+// finish records the response of a request returned by begin.
+func (rc *requestCache) finish(id string, request *executedRequest, response Response) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	request.response = response
+	request.finished = time.Now()
+	rc.finished = append(rc.finished, id)
+	close(request.done)
+}
+
+// setWindow sets how long the replies are kept, forgetting those kept longer than that.
+func (rc *requestCache) setWindow(window time.Duration) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.window = window
+	rc.expire(time.Now())
+}
+
+// expire forgets the requests finished a window before now. The caller must hold mu.
+func (rc *requestCache) expire(now time.Time) {
+	expired := 0
+	for _, id := range rc.finished {
+		if now.Sub(rc.requests[id].finished) < rc.window {
+			break
+		}
+		delete(rc.requests, id)
+		expired++
+	}
+	rc.finished = rc.finished[expired:]
+}
+
+// Execute calls a method of the coordinator on behalf of a client at most once for each request id: the reply is kept
+// for a window (see SetRequestWindow), and a retry of the request in the meantime gets the same reply without the
+// request being executed again, or waits for the reply if the request is still being executed. A request lost by the
+// unreliable network may thus be retried until its reply arrives, without its writes being applied twice or its reads
+// answering differently, see Client.Execute. The reply types of the methods are registered with labgob, as those
+// of the queries (Dataset) and of the writes (string) are. A request without id is executed every time.
+func (c *Cluster) Execute(request Request, reply *Response) {
+	executeOnce(reflect.ValueOf(c), c.requests, request, reply)
+}
+
+// executeOnce calls the method of the receiver named by the request at most once for each request id, the replies
+// being kept in requests, see Cluster.Execute. The retries of a request whose method panicked get the Error
+// "Request Failed".
+func executeOnce(receiver reflect.Value, requests *requestCache, request Request, reply *Response) {
+	method := receiver.MethodByName(request.Method)
+	if !method.IsValid() || request.Method == "Execute" || method.Type().NumIn() != 2 ||
+		method.Type().In(1).Kind() != reflect.Ptr {
+		*reply = Response{Error: "No Such Method " + request.Method}
+		return
+	}
+	args := reflect.Zero(method.Type().In(0))
+	if request.Args != nil {
+		args = reflect.ValueOf(request.Args)
+		if !args.Type().AssignableTo(method.Type().In(0)) {
+			*reply = Response{Error: "Wrong Arguments"}
+			return
+		}
+	}
+	call := func() Response {
+		result := reflect.New(method.Type().In(1).Elem())
+		method.Call([]reflect.Value{args, result})
+		return Response{Reply: result.Elem().Interface()}
+	}
+	if request.Id == "" {
+		*reply = call()
+		return
+	}
+
+	executed, ok := requests.begin(request.Id)
+	if ok {
+		<-executed.done
+		*reply = executed.response
+		reply.Replayed = true
+		return
+	}
+	response := Response{Error: "Request Failed"}
+	// the retries waiting for the reply are released even if the method panics
+	defer func() {
+		requests.finish(request.Id, executed, response)
+	}()
+	response = call()
+	*reply = response
+}
+
+// SetRequestWindow sets how long the replies of the requests are kept, see Execute, the replies kept longer than that
+// being forgotten.
+func (c *Cluster) SetRequestWindow(window time.Duration, reply *string) {
+	c.requests.setWindow(window)
+	*reply = "0 OK"
+}
+
+// Execute sends a request to the coordinator until it is answered, at most requestAttempts times, and sets the reply
+// of its method to reply, which must be a pointer to the reply type of the method. The request is executed once
+// however many times it is sent, see Cluster.Execute. It returns false if the coordinator never answered, or could
+// not execute the request.
+func (cl *Client) Execute(request Request, reply interface{}) bool {
+	for attempt := 0; attempt < requestAttempts; attempt++ {
+		response := Response{}
+		if !cl.coordinator.Call("Cluster.Execute", request, &response) {
+			continue
+		}
+		if response.Error != "" || response.Reply == nil {
+			return false
+		}
+		value := reflect.ValueOf(response.Reply)
+		target := reflect.ValueOf(reply).Elem()
+		if !value.Type().AssignableTo(target.Type()) {
+			return false
+		}
+		target.Set(value)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExecuteOnce(t *testing.T) {
+	setupSoftDelete(0)
+	client := NewClient(network, "ClientB", c.Name)
+	request := NewRequest("FragmentWrite", []interface{}{studentTableName, Row{3, "Alice", 20, 3.9}})
+	response := Response{}
+	cli.Call("Cluster.Execute", request, &response)
+	if response.Reply != "0 OK" || response.Replayed {
+		t.Fatalf("expected the row written, actual %v", response)
+	}
+
+	// the reply of the first delivery was lost, the retries get it again without writing the row twice
+	response = Response{}
+	cli.Call("Cluster.Execute", request, &response)
+	if response.Reply != "0 OK" || !response.Replayed {
+		t.Errorf("expected the reply replayed, actual %v", response)
+	}
+	reply := ""
+	if !client.Execute(request, &reply) || reply != "0 OK" {
+		t.Errorf("expected the reply replayed to the client, actual %v", reply)
+	}
+	if rows := scanRows(studentTableName); len(rows) != len(studentRows)+1 {
+		t.Errorf("expected the row written once, actual %v", rows)
+	}
+	response = Response{}
+	cli.Call("Cluster.Execute", Request{Method: "FragmentWrite", Args: request.Args}, &response)
+	if response.Reply != "1 Duplicate Key" {
+		t.Errorf("a request without id should be executed again, actual %v", response)
+	}
+
+	response = Response{}
+	cli.Call("Cluster.Execute", NewRequest("Drop", ""), &response)
+	if response.Error != "No Such Method Drop" {
+		t.Errorf("expected no such method, actual %v", response)
+	}
+	response = Response{}
+	cli.Call("Cluster.Execute", NewRequest("FragmentWrite", studentTableName), &response)
+	if response.Error != "Wrong Arguments" {
+		t.Errorf("expected wrong arguments, actual %v", response)
+	}
+	result := Dataset{}
+	if !client.Execute(NewRequest("Scan", []interface{}{studentTableName}), &result) ||
+		len(result.Rows) != len(studentRows)+1 {
+		t.Errorf("expected the rows scanned, actual %v", result)
+	}
+
+	// the reply is forgotten after the window
+	cli.Call("Cluster.SetRequestWindow", time.Millisecond, &reply)
+	time.Sleep(2 * time.Millisecond)
+	response = Response{}
+	cli.Call("Cluster.Execute", request, &response)
+	if response.Reply != "1 Duplicate Key" || response.Replayed {
+		t.Errorf("expected the request executed again, actual %v", response)
+	}
+}
+
+// the requests retried over an unreliable network are applied once, a retry of a request whose reply was lost
+// failing with a duplicate key if it were executed again
+func TestExecuteOnceUnreliable(t *testing.T) {
+	setupSoftDelete(0)
+	client := NewClient(network, "ClientB", c.Name)
+	requests := make([]Request, 20)
+	for i := range requests {
+		requests[i] = NewRequest("FragmentWrite", []interface{}{studentTableName, Row{10 + i, "Alice", 20, 3.0}})
+	}
+	network.Reliable(false)
+	replies := make([]string, len(requests))
+	for i, request := range requests {
+		client.Execute(request, &replies[i])
+	}
+	network.Reliable(true)
+	// each request gets the same reply however many times it is sent
+	for i, request := range requests {
+		reply := ""
+		if !client.Execute(request, &reply) || (replies[i] != "" && reply != replies[i]) {
+			t.Errorf("expected the reply %v replayed, actual %v", replies[i], reply)
+		}
+		if reply == "1 Duplicate Key" {
+			t.Errorf("%v should not be written twice", request.Args)
+		}
+	}
+}
+
+// panicker is a receiver whose method panics, see TestExecuteOncePanic.
+type panicker struct{}
+
+func (p *panicker) Fail(args interface{}, reply *string) {
+	panic("failed")
+}
+
+// the retries of a request whose method panicked get a failure instead of waiting forever
+func TestExecuteOncePanic(t *testing.T) {
+	requests := newRequestCache()
+	request := NewRequest("Fail", "")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected the method to panic")
+			}
+		}()
+		executeOnce(reflect.ValueOf(&panicker{}), requests, request, &Response{})
+	}()
+
+	replied := make(chan Response)
+	go func() {
+		response := Response{}
+		executeOnce(reflect.ValueOf(&panicker{}), requests, request, &response)
+		replied <- response
+	}()
+	select {
+	case response := <-replied:
+		if response.Error != "Request Failed" || !response.Replayed {
+			t.Errorf("expected the failure replayed, actual %v", response)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the retry should not wait for the request which panicked")
+	}
+}
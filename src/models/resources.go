@@ -0,0 +1,126 @@
+package models
+
+import (
+	"time"
+)
+
+// NodeResources are simulated constraints of a node, so that scheduling and rebalancing can be tested against
+// heterogeneous clusters. The zero value puts no constraint.
+type NodeResources struct {
+	// how many RPCs the node serves at the same time, further RPCs wait for one of them to finish. There is no limit
+	// if not positive.
+	MaxConcurrentRPCs int
+	// how long the node takes to read each row it scans
+	ScanLatencyPerRow time.Duration
+	// how many rows the node can store over all its fragments, further rows are rejected with "1 Storage Full".
+	// There is no limit if not positive.
+	StorageCapacity int
+	// how many RPCs may wait for a slot before the node signals that it is overloaded, see NodeLoad. The queue never
+	// overloads the node if not positive.
+	MaxQueuedRPCs int
+}
+
+// SetNodeResources sets the simulated constraints of a node, see NodeResources. The RPCs already being served are not
+// affected, and the constraints are kept when the node restarts.
+// params: nodeId string, resources NodeResources
+func (c *Cluster) SetNodeResources(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	nodeId := params[0].(string)
+	resources := params[1].(NodeResources)
+	if !contains(c.nodeIds, nodeId) {
+		*reply = "1 no such node"
+		return
+	}
+	if ok := c.nodeEnd(nodeId).Call("Node.RPCSetResources", resources, reply); !ok {
+		*reply = "1 node unreachable"
+		return
+	}
+	c.nodeResources[nodeId] = resources
+}
+
+// RPCSetResources sets the simulated constraints of this node.
+func (n *Node) RPCSetResources(resources NodeResources, reply *string) {
+	n.resourceMu.Lock()
+	defer n.resourceMu.Unlock()
+	n.resources = resources
+	n.slots = nil
+	if resources.MaxConcurrentRPCs > 0 {
+		n.slots = make(chan struct{}, resources.MaxConcurrentRPCs)
+	}
+	*reply = "0 OK"
+}
+
+// RPCGetResources returns the simulated constraints of this node.
+func (n *Node) RPCGetResources(args interface{}, reply *NodeResources) {
+	n.resourceMu.Lock()
+	defer n.resourceMu.Unlock()
+	*reply = n.resources
+}
+
+// admit waits until the node may serve one more RPC, and returns the function to call when the RPC is served. The
+// RPCs of the node defer it first, before taking the lock of the node.
+func (n *Node) admit() func() {
+	n.resourceMu.Lock()
+	slots := n.slots
+	n.queued++
+	n.resourceMu.Unlock()
+	if slots != nil {
+		slots <- struct{}{}
+	}
+	n.resourceMu.Lock()
+	n.queued--
+	n.serving++
+	n.resourceMu.Unlock()
+	return func() {
+		if slots != nil {
+			<-slots
+		}
+		n.resourceMu.Lock()
+		n.serving--
+		n.resourceMu.Unlock()
+	}
+}
+
+// storageFull tells whether the node cannot store extra more rows.
+func (n *Node) storageFull(extra int) bool {
+	n.resourceMu.Lock()
+	capacity := n.resources.StorageCapacity
+	n.resourceMu.Unlock()
+	if capacity <= 0 {
+		return false
+	}
+	stored := 0
+	for _, t := range n.TableMap {
+		stored += t.Count()
+	}
+	return stored+extra > capacity
+}
+
+// rowIterator iterates the rows of a table of the node, taking the simulated scan latency for each row.
+func (n *Node) rowIterator(t *Table) RowIterator {
+	return n.scanIterator(t.RowIterator())
+}
+
+// scanIterator makes the iterator take the simulated scan latency for each row.
+func (n *Node) scanIterator(iterator RowIterator) RowIterator {
+	n.resourceMu.Lock()
+	latency := n.resources.ScanLatencyPerRow
+	n.resourceMu.Unlock()
+	if latency <= 0 {
+		return iterator
+	}
+	return &slowRowIterator{RowIterator: iterator, latency: latency}
+}
+
+// slowRowIterator sleeps for latency before returning each row.
+type slowRowIterator struct {
+	RowIterator
+	latency time.Duration
+}
+
+func (iter *slowRowIterator) Next() *Row {
+	time.Sleep(iter.latency)
+	return iter.RowIterator.Next()
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newResourceTestNode(t *testing.T, resources NodeResources) *Node {
+	n := NewNode("TestNode")
+	reply := ""
+	n.RPCSetResources(resources, &reply)
+	schema := TableSchema{TableName: "t|0", ColumnSchemas: []ColumnSchema{
+		{Name: "id", DataType: TypeString},
+		{Name: "v", DataType: TypeInt32},
+	}}
+	fullSchema := TableSchema{TableName: "t", ColumnSchemas: []ColumnSchema{
+		{Name: "v", DataType: TypeInt32},
+		{Name: "id", DataType: TypeString},
+	}}
+	n.RPCCreateTable(CreateTableArgs{Schema: schema, Predicate: Predicate{}, FullSchema: fullSchema}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot create the table: %v", reply)
+	}
+	return n
+}
+
+func TestNodeStorageCapacity(t *testing.T) {
+	n := newResourceTestNode(t, NodeResources{StorageCapacity: 2})
+	for i, expected := range []string{"0 OK", "0 OK", "1 Storage Full"} {
+		reply := ""
+		n.RPCInsert(InsertArgs{Fragment: "t|0", Row: Row{i, "id" + strconv.Itoa(i)}}, &reply)
+		if reply != expected {
+			t.Errorf("insert %v: expected %v, actual %v", i, expected, reply)
+		}
+	}
+	reply := ""
+	rows := Dataset{Rows: []Row{{"id0", 0}, {"id9", 9}}}
+	n.RPCAppendRows(AppendRowsArgs{Fragment: "t|0", Rows: rows}, &reply)
+	if reply != "1 Storage Full" {
+		t.Errorf("appending a new row to a full node should fail, actual %v", reply)
+	}
+	rows.Rows = rows.Rows[:1]
+	n.RPCAppendRows(AppendRowsArgs{Fragment: "t|0", Rows: rows}, &reply)
+	if reply != "0 OK" {
+		t.Errorf("appending an existing row takes no space, actual %v", reply)
+	}
+}
+
+func TestNodeScanLatencyAndConcurrency(t *testing.T) {
+	latency := 10 * time.Millisecond
+	n := newResourceTestNode(t, NodeResources{MaxConcurrentRPCs: 1, ScanLatencyPerRow: latency})
+	for i := 0; i < 2; i++ {
+		reply := ""
+		n.RPCInsert(InsertArgs{Fragment: "t|0", Row: Row{i, "id" + strconv.Itoa(i)}}, &reply)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dataset := Dataset{}
+			n.RPCScanFragment(ScanFragmentArgs{Fragment: "t|0", Offset: 0, Limit: 10}, &dataset)
+			if len(dataset.Rows) != 2 {
+				t.Errorf("expected 2 rows, actual %v", dataset.Rows)
+			}
+		}()
+	}
+	wg.Wait()
+	// three scans of two rows served one after another
+	if elapsed := time.Since(start); elapsed < 6*latency {
+		t.Errorf("the scans should be served one at a time, elapsed %v", elapsed)
+	}
+}
+
+func TestSetNodeResources(t *testing.T) {
+	setupLab3()
+
+	resources := NodeResources{MaxConcurrentRPCs: 2, StorageCapacity: 100}
+	reply := ""
+	cli.Call("Cluster.SetNodeResources", []interface{}{"Node1", resources}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot set the resources: %v", reply)
+	}
+	cli.Call("Cluster.SetNodeResources", []interface{}{"Node9", resources}, &reply)
+	if reply[0] != '1' {
+		t.Errorf("the resources of an unknown node should not be set")
+	}
+
+	cli.Call("Cluster.RestartNode", "Node1", &reply)
+	actual := NodeResources{}
+	c.nodeEnd("Node1").Call("Node.RPCGetResources", "", &actual)
+	if actual != resources {
+		t.Errorf("the resources should be kept after a restart, expected %v, actual %v", resources, actual)
+	}
+}
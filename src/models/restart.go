@@ -0,0 +1,191 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"../labrpc"
+)
+
+// RestartNode simulates a crash and a restart of a node: the server of the node is removed from the network, so that
+// calls in flight fail as if the node crashed, and a fresh Node replays the write-ahead log kept by the persister of
+// the node to rehydrate its fragments, then serves under the same name. The rows a replica missed while it could not
+// be written (e.g., the node was disconnected) are copied back from another replica of the fragment, and the rows
+// deleted meanwhile are removed, see catchUp. Writes wait until the node is back. The reply is "0 OK", or "1 <reason>" if the node is unknown or cannot be rehydrated, in
+// which case the node stays down.
+// params: nodeId string, e.g., "Node3"
+func (c *Cluster) RestartNode(nodeId string, reply *string) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	persister, ok := c.persisters[nodeId]
+	if !ok || !contains(c.nodeIds, nodeId) {
+		*reply = "1 no such node"
+		return
+	}
+	c.network.DeleteServer(nodeId)
+	// the crash also stops the goroutines of the node, e.g., its gossiping
+	c.nodes[nodeId].stopGossip()
+	c.nodes[nodeId].stopVerification()
+	// the restarted node rebuilds its stores from the log, those of the crashed one are released
+	c.nodes[nodeId].Close()
+	c.publish(Event{Type: EventNodeLeft, NodeId: nodeId})
+
+	node := NewNode(nodeId)
+	node.persister = persister
+	node.gossip.network = c.network
+	node.dataDir = c.dataDir
+	c.nodes[nodeId] = node
+	if err := node.rehydrate(); err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+	msg := ""
+	node.RPCSetResources(c.nodeResources[nodeId], &msg)
+	if c.gossipInterval > 0 {
+		node.RPCStartGossip(GossipConfig{Peers: c.nodeIds, Interval: c.gossipInterval}, &msg)
+	}
+	if c.verifyInterval > 0 {
+		node.RPCStartVerification(c.verifyInterval, &msg)
+	}
+	server := labrpc.MakeServer()
+	server.AddService(labrpc.MakeService(node))
+	c.network.AddServer(nodeId, server)
+
+	c.catchUp(nodeId)
+	c.publish(Event{Type: EventNodeJoined, NodeId: nodeId})
+	*reply = "0 OK"
+}
+
+// CatchUpNode reconciles the replicas a node holds of the fragments of this coordinator with their other replicas, see
+// catchUp, e.g., after the node was restarted. RestartNode does it itself, while a sharded cluster needs the
+// coordinators that did not restart the node to do it for their own fragments, see Router.RestartNode.
+// params: nodeId string, e.g., "Node3"
+func (c *Cluster) CatchUpNode(nodeId string, reply *string) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if !contains(c.nodeIds, nodeId) {
+		*reply = "1 no such node"
+		return
+	}
+	c.catchUp(nodeId)
+	*reply = "0 OK"
+}
+
+// catchUp reconciles each replica held by the node with the other replicas of the fragment by the ids of their rows,
+// against the rows the coordinator holds in the fragment (see Catalog.Ids and RowIndex): the rows of the node the
+// coordinator no longer holds (e.g., deleted while the node could not be reached) are removed, soft-deleted rows being
+// hidden behind tombstones, then the rows one replica holds and another misses (e.g., written while either could not
+// be reached) are copied to it.
+func (c *Cluster) catchUp(nodeId string) {
+	placement := c.currentPlacement()
+	for fragment, nodeIds := range placement.FragmentNodes {
+		if !contains(nodeIds, nodeId) {
+			continue
+		}
+		// the rows the coordinator holds in the fragment
+		tableName := fragmentTable(fragment)
+		live := make(map[string]bool)
+		for _, id := range c.catalog.Ids(tableName) {
+			if contains(c.rowIndex.Fragments(tableName, id), fragment) {
+				live[id] = true
+			}
+		}
+		held, ok := c.fragmentIds(nodeId, fragment)
+		if !ok || !c.removeExtraRows(nodeId, fragment, held, live) {
+			continue
+		}
+		has := make(map[string]bool, len(held))
+		for _, id := range held {
+			if live[id] {
+				has[id] = true
+			}
+		}
+		for _, source := range nodeIds {
+			if source == nodeId {
+				continue
+			}
+			ids, ok := c.fragmentIds(source, fragment)
+			if !ok {
+				continue
+			}
+			sourceHas := make(map[string]bool, len(ids))
+			for _, id := range ids {
+				sourceHas[id] = true
+			}
+			// the other replica lacks rows of the node, e.g., it could not be reached when they were written
+			if missing := missingIds(has, sourceHas); len(missing) > 0 {
+				if _, ok := c.copyRows(fragment, nodeId, fragment, []string{source}, 0); ok {
+					c.addLocations(tableName, missing, RowLocation{NodeId: source, Fragment: fragment})
+				}
+			}
+			sourceLive := make(map[string]bool, len(ids))
+			for _, id := range ids {
+				if live[id] {
+					sourceLive[id] = true
+				}
+			}
+			if missing := missingIds(sourceLive, has); len(missing) > 0 {
+				if _, ok := c.copyRows(fragment, source, fragment, []string{nodeId}, 0); ok {
+					c.addLocations(tableName, missing, RowLocation{NodeId: nodeId, Fragment: fragment})
+					for _, id := range missing {
+						has[id] = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// missingIds returns the ids in a that are not in b.
+func missingIds(a map[string]bool, b map[string]bool) []string {
+	missing := make([]string, 0)
+	for id := range a {
+		if !b[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// addLocations records that the rows of the table with the ids are held at the location.
+func (c *Cluster) addLocations(tableName string, ids []string, location RowLocation) {
+	for _, id := range ids {
+		c.rowIndex.Add(tableName, id, location)
+	}
+	c.fragmentVersions[location.Fragment]++
+}
+
+// removeExtraRows removes from the replica of a fragment on the node, which holds the rows held, those of its rows
+// whose id is not live, i.e., that the coordinator no longer holds. It returns false if the node fails to remove them.
+func (c *Cluster) removeExtraRows(nodeId string, fragment string, held []string, live map[string]bool) bool {
+	extra := make([]string, 0)
+	for _, id := range held {
+		if !live[id] {
+			extra = append(extra, id)
+		}
+	}
+	if len(extra) == 0 {
+		return true
+	}
+	msg := ""
+	if c.catalog.Storage(fragmentTable(fragment)).SoftDelete {
+		c.nodeEnd(nodeId).Call("Node.RPCTombstoneRows", TombstoneRowsArgs{Fragment: fragment, Ids: extra,
+			DeletedAt: time.Now().UnixNano()}, &msg)
+	} else {
+		c.nodeEnd(nodeId).Call("Node.RPCRemoveRows", FragmentIdsArgs{Fragment: fragment, Ids: extra}, &msg)
+	}
+	if !strings.HasPrefix(msg, "0") {
+		return false
+	}
+	for _, id := range extra {
+		c.rowIndex.RemoveLocation(fragmentTable(fragment), id, RowLocation{NodeId: nodeId, Fragment: fragment})
+	}
+	c.fragmentVersions[fragment]++
+	return true
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"../labrpc"
+)
+
+// every node restarts one after another, including node3 holding the only replica of courseRegistration
+func TestRestartNode(t *testing.T) {
+	setupLab3()
+
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"1|2": rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows:   joinedTableContent,
+	}
+	for _, nodeId := range []string{"Node0", "Node1", "Node2", "Node3"} {
+		reply := ""
+		cli.Call("Cluster.RestartNode", nodeId, &reply)
+		if reply != "0 OK" {
+			t.Fatalf("cannot restart %v: %v", nodeId, reply)
+		}
+		results := Dataset{}
+		cli.Call("Cluster.JoinWithHints", []interface{}{[]string{studentTableName, courseRegistrationTableName},
+			QueryHints{DisableCache: true}}, &results)
+		if !datasetDuplicateChecking(expectedDataset, results) {
+			t.Errorf("Incorrect join results after restarting %v, expected %v, actual %v", nodeId, expectedDataset,
+				results)
+		}
+	}
+
+	// the restarted nodes keep logging their changes
+	reply := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{courseRegistrationTableName, Row{2, 1}}, &reply)
+	cli.Call("Cluster.RestartNode", "Node3", &reply)
+	results := Dataset{}
+	cli.Call("Cluster.JoinWithHints", []interface{}{[]string{studentTableName, courseRegistrationTableName},
+		QueryHints{DisableCache: true}}, &results)
+	expectedDataset.Rows = append(append([]Row(nil), joinedTableContent...), Row{2, "Hana", 21, 4.0, 1})
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, results)
+	}
+
+	cli.Call("Cluster.RestartNode", "Node9", &reply)
+	if reply[0] != '1' {
+		t.Errorf("an unknown node should not be restarted")
+	}
+}
+
+// a row deleted while a replica was down is removed from the replica when its node restarts
+func TestRestartNodeRemovesDeleted(t *testing.T) {
+	setupLab3()
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"1|2": rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+
+	network.DeleteServer("Node0")
+	reply := ""
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"name": {{Op: "==", Val: "Smith"}}}}, &reply)
+	if reply != "0 1" {
+		t.Fatalf("expected the row to be deleted, actual %v", reply)
+	}
+	cli.Call("Cluster.RestartNode", "Node0", &reply)
+	if count := c.nodes["Node0"].TableMap[studentTableName+"|0"].Count(); count != 0 {
+		t.Errorf("expected the deleted row to be removed from Node0, %v stored", count)
+	}
+	network.DeleteServer("Node1")
+	if rows := scanRows(studentTableName); len(rows) != 2 {
+		t.Errorf("expected the rows but the deleted one, actual %v", rows)
+	}
+}
+
+// a row written while a replica was unreachable is copied to it, not removed from the others, when a node restarts
+func TestRestartNodeKeepsWritten(t *testing.T) {
+	setupLab3()
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"1|2": rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+
+	network.DeleteServer("Node1")
+	reply := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Eve", 20, 3.0}}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("expected the row to be written, actual %v", reply)
+	}
+	// Node1 comes back without restarting, then Node0 restarts
+	server := labrpc.MakeServer()
+	server.AddService(labrpc.MakeService(c.nodes["Node1"]))
+	network.AddServer("Node1", server)
+	cli.Call("Cluster.RestartNode", "Node0", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot restart Node0: %v", reply)
+	}
+	for _, nodeId := range []string{"Node0", "Node1"} {
+		if count := c.nodes[nodeId].TableMap[studentTableName+"|0"].Count(); count != 2 {
+			t.Errorf("expected 2 rows stored on %v, actual %v", nodeId, count)
+		}
+	}
+	if rows := scanRows(studentTableName); len(rows) != 4 {
+		t.Errorf("expected the written row to be kept, actual %v", rows)
+	}
+}
+
+// a node restarts from its checkpoint and the records logged since, the log being truncated by the checkpoint
+func TestRestartNodeFromCheckpoint(t *testing.T) {
+	setupSoftDelete(0)
+	reply := ""
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"name": {{Op: "==", Val: "John"}}}}, &reply)
+	n := c.nodes["Node2"]
+	n.mu.Lock()
+	n.checkpoint()
+	n.mu.Unlock()
+	if n.persister.Len() != 0 || n.persister.Snapshot() == nil {
+		t.Fatalf("expected the log to be replaced by a snapshot, %v records", n.persister.Len())
+	}
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Eve", 20, 3.9}}, &reply)
+	if n.persister.Len() != 1 {
+		t.Errorf("expected the write to be logged after the snapshot, %v records", n.persister.Len())
+	}
+
+	cli.Call("Cluster.RestartNode", "Node2", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot restart Node2: %v", reply)
+	}
+	if count := c.nodes["Node2"].TableMap[studentTableName+"|1"].Count(); count != 3 {
+		t.Errorf("expected 3 rows stored on Node2 with the soft-deleted one, actual %v", count)
+	}
+	if rows := scanRows(studentTableName); len(rows) != 3 {
+		t.Errorf("expected the rows but the deleted one, actual %v", rows)
+	}
+	// the tombstone survives the restart
+	cli.Call("Cluster.Undelete", []interface{}{studentTableName, Predicate{}, int64(0)}, &reply)
+	if rows := scanRows(studentTableName); reply != "0 1 0" || len(rows) != 4 {
+		t.Errorf("expected the deleted row back, actual %v %v", reply, rows)
+	}
+}
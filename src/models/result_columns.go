@@ -0,0 +1,123 @@
+package models
+
+// ResultColumn describes a column of the result of a query beyond its name and type, see Dataset.Columns.
+type ResultColumn struct {
+	Name     string
+	DataType int
+	// the table the column comes from. A common column of a join comes from every table joined on it, the first of
+	// them being reported.
+	Table string
+	// the name referring to the column without ambiguity: "table.column" if another column of the result has the same
+	// name (with another type, so that the tables are not joined on it), the name of the column otherwise
+	Alias string
+	// whether the column may hold null, which every column but the primary key of a table may. A common column of a
+	// join holds the values equal in every table joined on it, so it cannot hold null if one of them cannot.
+	Nullable bool
+}
+
+// schema returns the name and the type of the column.
+func (rc ResultColumn) schema() ColumnSchema {
+	return ColumnSchema{Name: rc.Name, DataType: rc.DataType}
+}
+
+// tableColumns describes the columns of a table as read by a query, in the order of its schema.
+func (s *CatalogSnapshot) tableColumns(tableName string) []ResultColumn {
+	key, keyed := s.Key(tableName)
+	schema, _ := s.Schema(tableName)
+	columns := make([]ResultColumn, 0, len(schema.ColumnSchemas))
+	for _, cs := range schema.ColumnSchemas {
+		columns = append(columns, ResultColumn{Name: cs.Name, DataType: cs.DataType, Table: tableName, Alias: cs.Name,
+			Nullable: !keyed || cs.Name != key})
+	}
+	return columns
+}
+
+// joinColumns describes the columns of the natural join of two results described by their columns, in the order of
+// the schema built by joinSchema.
+func joinColumns(a []ResultColumn, b []ResultColumn) []ResultColumn {
+	columns := append(make([]ResultColumn, 0, len(a)+len(b)), a...)
+	for _, col2 := range b {
+		common := false
+		for i, col1 := range columns[:len(a)] {
+			if col1.schema() == col2.schema() {
+				columns[i].Nullable = col1.Nullable && col2.Nullable
+				common = true
+				break
+			}
+		}
+		if !common {
+			columns = append(columns, col2)
+		}
+	}
+
+	count := make(map[string]int)
+	for _, col := range columns {
+		count[col.Name]++
+	}
+	for i, col := range columns {
+		columns[i].Alias = col.Name
+		if count[col.Name] > 1 {
+			columns[i].Alias = col.Table + "." + col.Name
+		}
+	}
+	return columns
+}
+
+// joinedColumns describes the columns of the natural join of the tables in the given order, nil if a table is
+// unknown.
+func (s *CatalogSnapshot) joinedColumns(tableNames []string) []ResultColumn {
+	var columns []ResultColumn
+	for i, tableName := range tableNames {
+		if _, ok := s.Schema(tableName); !ok {
+			return nil
+		}
+		if i == 0 {
+			columns = s.tableColumns(tableName)
+		} else {
+			columns = joinColumns(columns, s.tableColumns(tableName))
+		}
+	}
+	return columns
+}
+
+// reorderColumns reorders the columns of a successful result to the given columns, see QueryHints.Columns. It is
+// deferred by the queries before failRenamed, so that it runs after it.
+func reorderColumns(reply *Dataset, columns []string) {
+	if len(columns) == 0 || reply.Error != "" || len(reply.Columns) != len(reply.Schema.ColumnSchemas) {
+		return
+	}
+	positions := make([]int, len(columns))
+	for i, name := range columns {
+		positions[i] = -1
+		for j, col := range reply.Columns {
+			if col.Alias == name {
+				positions[i] = j
+				break
+			}
+		}
+		if positions[i] < 0 {
+			*reply = Dataset{Error: "No Such Column " + name}
+			return
+		}
+	}
+
+	result := Dataset{Schema: TableSchema{TableName: reply.Schema.TableName,
+		ColumnSchemas: make([]ColumnSchema, len(columns))}, Rows: make([]Row, len(reply.Rows)),
+		Provenance: reply.Provenance, Columns: make([]ResultColumn, len(columns)), Unavailable: reply.Unavailable}
+	for i, j := range positions {
+		result.Schema.ColumnSchemas[i] = reply.Schema.ColumnSchemas[j]
+		result.Columns[i] = reply.Columns[j]
+	}
+	for k, row := range reply.Rows {
+		// the empty rows of MultiGet stand for the keys that do not exist
+		if len(row) == 0 {
+			result.Rows[k] = row
+			continue
+		}
+		result.Rows[k] = make(Row, len(positions))
+		for i, j := range positions {
+			result.Rows[k][i] = row[j]
+		}
+	}
+	*reply = result
+}
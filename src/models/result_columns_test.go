@@ -0,0 +1,121 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestResultColumns(t *testing.T) {
+	setupSoftDelete(0)
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName}, &result)
+	expected := []ResultColumn{
+		{Name: "sid", DataType: TypeInt32, Table: studentTableName, Alias: "sid", Nullable: false},
+		{Name: "name", DataType: TypeString, Table: studentTableName, Alias: "name", Nullable: true},
+		{Name: "age", DataType: TypeInt32, Table: studentTableName, Alias: "age", Nullable: true},
+		{Name: "grade", DataType: TypeFloat, Table: studentTableName, Alias: "grade", Nullable: true},
+	}
+	if !equalColumns(result.Columns, expected) {
+		t.Errorf("expected %v, actual %v", expected, result.Columns)
+	}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 7}, &result)
+	if !equalColumns(result.Columns, expected) {
+		t.Errorf("a missing row should be described as well, actual %v", result.Columns)
+	}
+	reply := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{nil, "Eve", 20, 3.0}}, &reply)
+	if reply != "1 Null Key" {
+		t.Errorf("the key cannot be null, actual %v", reply)
+	}
+
+	// the common column is not nullable as student.sid is not, and the names of different types are told apart
+	scores := TableSchema{TableName: "score", ColumnSchemas: []ColumnSchema{
+		{Name: "sid", DataType: TypeInt32}, {Name: "name", DataType: TypeInt32}}}
+	rules, _ := NewRuleSet(scores).AddHorizontalRule(Predicate{}, 4).Marshal()
+	cli.Call("Cluster.BuildTable", []interface{}{scores, rules}, &reply)
+	cli.Call("Cluster.FragmentWrite", []interface{}{"score", Row{1, 90}}, &reply)
+	cli.Call("Cluster.Join", []string{studentTableName, "score"}, &result)
+	if len(result.Rows) != 1 || len(result.Columns) != len(result.Schema.ColumnSchemas) {
+		t.Fatalf("unexpected join results %v", result)
+	}
+	expected = append(expected, ResultColumn{Name: "name", DataType: TypeInt32, Table: "score", Alias: "score.name",
+		Nullable: true})
+	expected[1].Alias = "student.name"
+	if !equalColumns(result.Columns, expected) {
+		t.Errorf("expected %v, actual %v", expected, result.Columns)
+	}
+	cli.Call("Cluster.Join", []string{"score", courseRegistrationTableName}, &result)
+	if len(result.Columns) != 3 || !result.Columns[0].Nullable || result.Columns[0].Table != "score" {
+		t.Errorf("sid is nullable in both tables, actual %v", result.Columns)
+	}
+}
+
+func equalColumns(a []ResultColumn, b []ResultColumn) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// the columns of a join are in the order of the schemas whichever way the tables are fragmented, and the hints
+// reorder them
+func TestColumnOrder(t *testing.T) {
+	setupSoftDelete(0)
+	reply := ""
+	enrolment := TableSchema{TableName: "enrolment", ColumnSchemas: []ColumnSchema{
+		{Name: "room", DataType: TypeString}, {Name: "courseId", DataType: TypeInt32},
+		{Name: "sid", DataType: TypeInt32}}}
+	rules, _ := NewRuleSet(enrolment).AddVerticalRule([]string{"sid", "courseId"}, 4).
+		AddVerticalRule([]string{"room"}, 3).Marshal()
+	cli.Call("Cluster.BuildTable", []interface{}{enrolment, rules}, &reply)
+	cli.Call("Cluster.FragmentWrite", []interface{}{"enrolment", Row{"A101", 1, 0}}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("FragmentWrite failed: %v", reply)
+	}
+
+	result := Dataset{}
+	cli.Call("Cluster.Join", []string{"enrolment", studentTableName}, &result)
+	expected := []string{"room", "courseId", "sid", "name", "age", "grade"}
+	if !equalNames(result.Schema.ColumnSchemas, expected) || len(result.Rows) != 1 ||
+		result.Rows[0][0] != "A101" || result.Rows[0][3] != "John" {
+		t.Errorf("expected the columns %v, actual %v", expected, result)
+	}
+
+	hints := QueryHints{Columns: []string{"name", "room", "sid"}}
+	cli.Call("Cluster.JoinWithHints", []interface{}{[]string{"enrolment", studentTableName}, hints}, &result)
+	if !equalNames(result.Schema.ColumnSchemas, hints.Columns) || len(result.Columns) != 3 ||
+		result.Columns[1].Table != "enrolment" || len(result.Rows) != 1 ||
+		result.Rows[0][0] != "John" || result.Rows[0][1] != "A101" || result.Rows[0][2] != 0 {
+		t.Errorf("expected the columns %v, actual %v", hints.Columns, result)
+	}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{Columns: []string{"grade", "sid"}}}, &result)
+	if !equalNames(result.Schema.ColumnSchemas, []string{"grade", "sid"}) || len(result.Rows) != 3 ||
+		len(result.Rows[0]) != 2 {
+		t.Errorf("expected the grades and the ids, actual %v", result)
+	}
+	cli.Call("Cluster.MultiGet", []interface{}{studentTableName, []interface{}{0, 7},
+		QueryHints{Columns: []string{"name"}}}, &result)
+	if len(result.Rows) != 2 || len(result.Rows[0]) != 1 || result.Rows[0][0] != "John" || len(result.Rows[1]) != 0 {
+		t.Errorf("expected the name and a missing row, actual %v", result)
+	}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{Columns: []string{"room"}}}, &result)
+	if result.Error != "No Such Column room" {
+		t.Errorf("expected an unknown column, actual %v", result)
+	}
+}
+
+func equalNames(columns []ColumnSchema, names []string) bool {
+	if len(columns) != len(names) {
+		return false
+	}
+	for i := range columns {
+		if columns[i].Name != names[i] {
+			return false
+		}
+	}
+	return true
+}
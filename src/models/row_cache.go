@@ -0,0 +1,116 @@
+package models
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultRowCacheCapacity is how many reassembled rows the coordinator keeps for each table.
+const defaultRowCacheCapacity = 1024
+
+// RowCache is an LRU cache of fully reassembled rows kept by the coordinator.
+// A row of a vertically fragmented table is spread over several fragments (and nodes), so rebuilding it costs one RPC
+// per fragment per node. The cache remembers the rebuilt row together with the versions of the fragments it was built
+// from, and an entry is only served while those versions have not changed.
+type RowCache struct {
+	mu sync.Mutex
+	// how many rows can be cached for each table
+	capacity int
+	// tableName -> cached rows of that table
+	tables map[string]*tableRowCache
+}
+
+type tableRowCache struct {
+	// most recently used entries are at the front
+	entries *list.List
+	// row id -> element in entries
+	index map[string]*list.Element
+}
+
+type rowCacheEntry struct {
+	id string
+	// the fragment versions of the table when the row was reassembled
+	versions string
+	row      Row
+}
+
+// NewRowCache creates an empty RowCache which holds at most capacity rows per table.
+func NewRowCache(capacity int) *RowCache {
+	return &RowCache{capacity: capacity, tables: make(map[string]*tableRowCache)}
+}
+
+// Get returns a copy of the cached row with the given id, or false if the row is not cached or was cached under
+// different fragment versions. Stale entries are dropped on the way.
+func (rc *RowCache) Get(tableName string, id string, versions string) (Row, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	tc, ok := rc.tables[tableName]
+	if !ok {
+		return nil, false
+	}
+	elem, ok := tc.index[id]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*rowCacheEntry)
+	if entry.versions != versions {
+		tc.entries.Remove(elem)
+		delete(tc.index, id)
+		return nil, false
+	}
+	tc.entries.MoveToFront(elem)
+	return copyRow(entry.row), true
+}
+
+// Put stores a copy of the row under the given id and fragment versions, evicting the least recently used row of the
+// table if the table is full.
+func (rc *RowCache) Put(tableName string, id string, versions string, row Row) {
+	if rc.capacity <= 0 {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	tc, ok := rc.tables[tableName]
+	if !ok {
+		tc = &tableRowCache{entries: list.New(), index: make(map[string]*list.Element)}
+		rc.tables[tableName] = tc
+	}
+	if elem, ok := tc.index[id]; ok {
+		entry := elem.Value.(*rowCacheEntry)
+		entry.versions = versions
+		entry.row = copyRow(row)
+		tc.entries.MoveToFront(elem)
+		return
+	}
+	tc.index[id] = tc.entries.PushFront(&rowCacheEntry{id: id, versions: versions, row: copyRow(row)})
+	for tc.entries.Len() > rc.capacity {
+		oldest := tc.entries.Back()
+		tc.entries.Remove(oldest)
+		delete(tc.index, oldest.Value.(*rowCacheEntry).id)
+	}
+}
+
+// Invalidate drops every cached row of the table.
+func (rc *RowCache) Invalidate(tableName string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	delete(rc.tables, tableName)
+}
+
+// Len returns how many rows of the table are cached.
+func (rc *RowCache) Len(tableName string) int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if tc, ok := rc.tables[tableName]; ok {
+		return tc.entries.Len()
+	}
+	return 0
+}
+
+func copyRow(row Row) Row {
+	res := make(Row, len(row))
+	copy(res, row)
+	return res
+}
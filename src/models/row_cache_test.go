@@ -0,0 +1,39 @@
+package models
+
+import "testing"
+
+func TestRowCache(t *testing.T) {
+	rc := NewRowCache(2)
+	rc.Put("t", "a", "0", Row{1, "a"})
+	rc.Put("t", "b", "0", Row{2, "b"})
+
+	row, ok := rc.Get("t", "a", "0")
+	if !ok || row[0] != 1 {
+		t.Errorf("row a should be cached, got %v", row)
+	}
+
+	// the returned row is a copy
+	row[0] = 100
+	if row, _ = rc.Get("t", "a", "0"); row[0] != 1 {
+		t.Errorf("cached row should not be modified by the caller, got %v", row)
+	}
+
+	// b is the least recently used one now
+	rc.Put("t", "c", "0", Row{3, "c"})
+	if _, ok = rc.Get("t", "b", "0"); ok {
+		t.Errorf("row b should have been evicted")
+	}
+
+	// a fragment has changed
+	if _, ok = rc.Get("t", "a", "1"); ok {
+		t.Errorf("row a should be stale under new versions")
+	}
+	if rc.Len("t") != 1 {
+		t.Errorf("stale row should be dropped, %d rows left", rc.Len("t"))
+	}
+
+	rc.Invalidate("t")
+	if rc.Len("t") != 0 {
+		t.Errorf("table should have no cached rows after invalidation")
+	}
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+)
+
+// RowLocation tells that a node holds (a replica of) a fragment which contains a row.
+type RowLocation struct {
+	NodeId   string
+	Fragment string
+}
+
+// RowIndex maps the id of each row to the places where the row is stored, so that the coordinator can contact only
+// the nodes owning a row instead of broadcasting to the whole cluster.
+// It is maintained by the coordinator on every write and every replica change.
+type RowIndex struct {
+	mu sync.RWMutex
+	// tableName -> row id -> locations
+	tables map[string]map[string][]RowLocation
+	// tableName -> primary key -> row id, only for tables with a primary key
+	keys map[string]map[string]string
+	// tableName -> row id -> primary key, the reverse of keys
+	idKeys map[string]map[string]string
+}
+
+// NewRowIndex creates an empty RowIndex.
+func NewRowIndex() *RowIndex {
+	return &RowIndex{tables: make(map[string]map[string][]RowLocation), keys: make(map[string]map[string]string),
+		idKeys: make(map[string]map[string]string)}
+}
+
+// Add records that the row is stored at the location. Adding an existing location is a no-op.
+func (ri *RowIndex) Add(tableName string, id string, location RowLocation) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	rows, ok := ri.tables[tableName]
+	if !ok {
+		rows = make(map[string][]RowLocation)
+		ri.tables[tableName] = rows
+	}
+	for _, l := range rows[id] {
+		if l == location {
+			return
+		}
+	}
+	rows[id] = append(rows[id], location)
+}
+
+// RemoveLocation records that the row is no longer stored at the location, e.g., a replica has been moved.
+func (ri *RowIndex) RemoveLocation(tableName string, id string, location RowLocation) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	rows, ok := ri.tables[tableName]
+	if !ok {
+		return
+	}
+	locations := rows[id]
+	for i, l := range locations {
+		if l == location {
+			rows[id] = append(locations[:i:i], locations[i+1:]...)
+			break
+		}
+	}
+	if len(rows[id]) == 0 {
+		delete(rows, id)
+	}
+}
+
+// RemoveFragment records that no row is stored in the fragment any more, e.g., the fragment has been merged into
+// another one.
+func (ri *RowIndex) RemoveFragment(tableName string, fragment string) {
+	ri.removeLocations(tableName, func(l RowLocation) bool { return l.Fragment == fragment })
+}
+
+// RemoveNodeFragment records that no row is stored in the replica of the fragment on the node any more.
+func (ri *RowIndex) RemoveNodeFragment(tableName string, nodeId string, fragment string) {
+	location := RowLocation{NodeId: nodeId, Fragment: fragment}
+	ri.removeLocations(tableName, func(l RowLocation) bool { return l == location })
+}
+
+func (ri *RowIndex) removeLocations(tableName string, removed func(RowLocation) bool) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	rows := ri.tables[tableName]
+	for id, locations := range rows {
+		kept := make([]RowLocation, 0, len(locations))
+		for _, l := range locations {
+			if !removed(l) {
+				kept = append(kept, l)
+			}
+		}
+		if len(kept) == 0 {
+			delete(rows, id)
+		} else {
+			rows[id] = kept
+		}
+	}
+}
+
+// Remove forgets the row entirely.
+func (ri *RowIndex) Remove(tableName string, id string) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	if rows, ok := ri.tables[tableName]; ok {
+		delete(rows, id)
+	}
+	if key, ok := ri.idKeys[tableName][id]; ok {
+		delete(ri.keys[tableName], key)
+		delete(ri.idKeys[tableName], id)
+	}
+}
+
+// DropTable forgets all rows of the table.
+func (ri *RowIndex) DropTable(tableName string) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	delete(ri.tables, tableName)
+	delete(ri.keys, tableName)
+	delete(ri.idKeys, tableName)
+}
+
+// RenameTable moves the rows of a table under its new name, the fragments of their locations being renamed as well.
+func (ri *RowIndex) RenameTable(from string, to string) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	if rows, ok := ri.tables[from]; ok {
+		for id, locations := range rows {
+			renamed := make([]RowLocation, len(locations))
+			for i, l := range locations {
+				renamed[i] = RowLocation{NodeId: l.NodeId, Fragment: to + l.Fragment[len(from):]}
+			}
+			rows[id] = renamed
+		}
+		ri.tables[to] = rows
+		delete(ri.tables, from)
+	}
+	if keys, ok := ri.keys[from]; ok {
+		ri.keys[to] = keys
+		ri.idKeys[to] = ri.idKeys[from]
+		delete(ri.keys, from)
+		delete(ri.idKeys, from)
+	}
+}
+
+// DropKeys forgets the primary keys of the rows of the table, the rows themselves are kept.
+func (ri *RowIndex) DropKeys(tableName string) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	delete(ri.keys, tableName)
+	delete(ri.idKeys, tableName)
+}
+
+// SetKey records the primary key of a row. It returns false if another row has the same key.
+func (ri *RowIndex) SetKey(tableName string, key interface{}, id string) bool {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	k := keyString(key)
+	if _, ok := ri.keys[tableName]; !ok {
+		ri.keys[tableName] = make(map[string]string)
+		ri.idKeys[tableName] = make(map[string]string)
+	}
+	if other, ok := ri.keys[tableName][k]; ok && other != id {
+		return false
+	}
+	ri.keys[tableName][k] = id
+	ri.idKeys[tableName][id] = k
+	return true
+}
+
+// KeyToId returns the id of the row with the given primary key.
+func (ri *RowIndex) KeyToId(tableName string, key interface{}) (string, bool) {
+	ri.mu.RLock()
+	defer ri.mu.RUnlock()
+	id, ok := ri.keys[tableName][keyString(key)]
+	return id, ok
+}
+
+// keyString normalizes a key value so that e.g. 1 and json.Number("1") are the same key.
+func keyString(key interface{}) string {
+	return fmt.Sprint(key)
+}
+
+// Locations returns a copy of the locations of the row, or nil if the row is unknown.
+func (ri *RowIndex) Locations(tableName string, id string) []RowLocation {
+	ri.mu.RLock()
+	defer ri.mu.RUnlock()
+
+	locations := ri.tables[tableName][id]
+	if locations == nil {
+		return nil
+	}
+	res := make([]RowLocation, len(locations))
+	copy(res, locations)
+	return res
+}
+
+// Fragments returns the fragments holding the row.
+func (ri *RowIndex) Fragments(tableName string, id string) []string {
+	fragments := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, l := range ri.Locations(tableName, id) {
+		if !seen[l.Fragment] {
+			seen[l.Fragment] = true
+			fragments = append(fragments, l.Fragment)
+		}
+	}
+	return fragments
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRowIndex(t *testing.T) {
+	ri := NewRowIndex()
+	a := RowLocation{NodeId: "Node0", Fragment: "student|0"}
+	b := RowLocation{NodeId: "Node1", Fragment: "student|0"}
+	ri.Add("student", "r1", a)
+	ri.Add("student", "r1", b)
+	ri.Add("student", "r1", a)
+	if locations := ri.Locations("student", "r1"); !reflect.DeepEqual(locations, []RowLocation{a, b}) {
+		t.Errorf("expected %v, actual %v", []RowLocation{a, b}, locations)
+	}
+	if fragments := ri.Fragments("student", "r1"); !reflect.DeepEqual(fragments, []string{"student|0"}) {
+		t.Errorf("expected the fragment once, actual %v", fragments)
+	}
+	if ri.Locations("student", "r2") != nil || ri.Locations("course", "r1") != nil {
+		t.Errorf("expected no location of an unknown row")
+	}
+
+	// the keys are normalized, and two rows cannot have the same one
+	if !ri.SetKey("student", 1, "r1") || !ri.SetKey("student", json.Number("1"), "r1") {
+		t.Errorf("expected the key of r1 to be set")
+	}
+	if ri.SetKey("student", json.Number("1"), "r2") {
+		t.Errorf("expected a duplicate key to be refused")
+	}
+	if id, ok := ri.KeyToId("student", json.Number("1")); !ok || id != "r1" {
+		t.Errorf("expected r1, actual %v %v", id, ok)
+	}
+
+	// the row moves from Node0 to Node2, and is still found by its key
+	c := RowLocation{NodeId: "Node2", Fragment: "student|0"}
+	ri.Add("student", "r1", c)
+	ri.RemoveLocation("student", "r1", a)
+	if locations := ri.Locations("student", "r1"); !reflect.DeepEqual(locations, []RowLocation{b, c}) {
+		t.Errorf("expected %v after the move, actual %v", []RowLocation{b, c}, locations)
+	}
+	if id, _ := ri.KeyToId("student", 1); !reflect.DeepEqual(ri.Locations("student", id), []RowLocation{b, c}) {
+		t.Errorf("expected the moved row to be found by its key, actual %v", ri.Locations("student", id))
+	}
+	ri.RemoveNodeFragment("student", "Node1", "student|0")
+	if locations := ri.Locations("student", "r1"); !reflect.DeepEqual(locations, []RowLocation{c}) {
+		t.Errorf("expected %v, actual %v", []RowLocation{c}, locations)
+	}
+
+	ri.Remove("student", "r1")
+	if ri.Locations("student", "r1") != nil {
+		t.Errorf("expected r1 to be forgotten")
+	}
+	if _, ok := ri.KeyToId("student", 1); ok {
+		t.Errorf("expected the key of r1 to be forgotten")
+	}
+	if !ri.SetKey("student", 1, "r2") {
+		t.Errorf("expected the key of a removed row to be free")
+	}
+}
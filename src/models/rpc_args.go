@@ -0,0 +1,170 @@
+package models
+
+// The arguments of the RPCs of the nodes, one type for each shape of arguments, so that the codecs encode the values
+// with their types instead of as lists of interfaces, see Cluster.SetCodec. The columns of the masks of a scan, if any,
+// are masked, see Cluster.MaskColumn.
+
+// FragmentArgs names the fragment an RPC works on, see Node.RPCCountRows, Node.RPCDropTable and
+// Node.RPCSnapshotFragment.
+type FragmentArgs struct {
+	Fragment string
+}
+
+// FragmentIdsArgs names rows of a fragment by their ids, see Node.RPCRemoveRows and Node.RPCUndeleteRows.
+type FragmentIdsArgs struct {
+	Fragment string
+	Ids      []string
+}
+
+// CreateTableArgs are the arguments of Node.RPCCreateTable.
+type CreateTableArgs struct {
+	// the schema of the fragment, the id column first
+	Schema    TableSchema
+	Predicate Predicate
+	// the schema of the table, the id column last
+	FullSchema TableSchema
+	Storage    TableStorage
+}
+
+// InsertArgs are the arguments of Node.RPCInsert and Node.RPCJoin.
+type InsertArgs struct {
+	Fragment string
+	// the row in the layout of the schema of the table, its id last
+	Row Row
+}
+
+// AppendRowsArgs are the arguments of Node.RPCAppendRows.
+type AppendRowsArgs struct {
+	Fragment string
+	// the rows in the layout of the schema of the fragment
+	Rows Dataset
+}
+
+// SetPredicateArgs are the arguments of Node.RPCSetPredicate.
+type SetPredicateArgs struct {
+	Fragment   string
+	Predicate  Predicate
+	FullSchema TableSchema
+}
+
+// RenameTableArgs are the arguments of Node.RPCRenameTable.
+type RenameTableArgs struct {
+	Fragment    string
+	NewFragment string
+}
+
+// ScanLineDataArgs are the arguments of Node.ScanLineData.
+type ScanLineDataArgs struct {
+	Fragment string
+	Id       string
+	Masks    map[string]ColumnMask
+}
+
+// ScanFragmentArgs are the arguments of Node.RPCScanFragment.
+type ScanFragmentArgs struct {
+	Fragment string
+	Offset   int
+	Limit    int
+	Masks    map[string]ColumnMask
+}
+
+// ScanLinesArgs are the arguments of Node.RPCScanLines, the i-th lookup asking for the row with Ids[i] in
+// Fragments[i].
+type ScanLinesArgs struct {
+	Fragments []string
+	Ids       []string
+	Masks     map[string]ColumnMask
+}
+
+// ScanAsOfArgs are the arguments of Node.RPCScanAsOf.
+type ScanAsOfArgs struct {
+	Fragment string
+	// in nanoseconds since the Unix epoch
+	AsOf  int64
+	Masks map[string]ColumnMask
+}
+
+// LookupKeyArgs are the arguments of Node.RPCLookupKey.
+type LookupKeyArgs struct {
+	Fragment string
+	Column   string
+	Key      interface{}
+	Masks    map[string]ColumnMask
+}
+
+// LocateArgs are the arguments of Node.RPCLocate.
+type LocateArgs struct {
+	TableName string
+	Key       interface{}
+}
+
+// LocalJoinArgs are the arguments of Node.RPCLocalJoin, the fragments of the two tables joined.
+type LocalJoinArgs struct {
+	Fragments1 []string
+	Fragments2 []string
+}
+
+// BroadcastJoinArgs are the arguments of Node.RPCBroadcastJoin.
+type BroadcastJoinArgs struct {
+	Fragments []string
+	// the rows of the other table sent by the coordinator
+	Shipped Dataset
+	// whether the columns of Shipped come first in the joined rows
+	ShippedFirst bool
+}
+
+// SemiJoinIdsArgs are the arguments of Node.RPCSemiJoinIds.
+type SemiJoinIdsArgs struct {
+	Fragment string
+	Keys     Dataset
+}
+
+// ExecutePlanArgs are the arguments of Node.RPCExecutePlan.
+type ExecutePlanArgs struct {
+	Fragment string
+	Plan     QueryPlan
+	Where    Predicate
+	Masks    map[string]ColumnMask
+}
+
+// ScanSnapshotArgs are the arguments of Node.RPCScanSnapshot.
+type ScanSnapshotArgs struct {
+	Snapshot string
+	// the position of the first row asked for, where the previous scan of the snapshot stopped unless a batch is asked
+	// again
+	Offset int
+	Limit  int
+	Masks  map[string]ColumnMask
+}
+
+// ReleaseSnapshotArgs are the arguments of Node.RPCReleaseSnapshot.
+type ReleaseSnapshotArgs struct {
+	Snapshot string
+}
+
+// TombstoneRowsArgs are the arguments of Node.RPCTombstoneRows, the times in nanoseconds since the Unix epoch.
+type TombstoneRowsArgs struct {
+	Fragment    string
+	Ids         []string
+	DeletedAt   int64
+	PurgeBefore int64
+}
+
+// ScanTombstonesArgs are the arguments of Node.RPCScanTombstones.
+type ScanTombstonesArgs struct {
+	Fragment string
+	// in nanoseconds since the Unix epoch
+	Since int64
+}
+
+// PurgeTombstonesArgs are the arguments of Node.RPCPurgeTombstones.
+type PurgeTombstonesArgs struct {
+	Fragment string
+	// in nanoseconds since the Unix epoch
+	Before int64
+}
+
+// MisplacedRowsArgs are the arguments of Node.RPCMisplacedRows.
+type MisplacedRowsArgs struct {
+	TableName string
+}
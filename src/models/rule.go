@@ -9,6 +9,14 @@ import (
 type Rule struct {
 	Predicate
 	Column []string
+	// where the replicas of the fragment may be placed, see PlacementConstraint
+	Constraints []PlacementConstraint
+	// how many replicas BuildTable places on the nodes of the key of the rule, every node of the key holding one if
+	// zero, see placeRules
+	Replicas int
+	// the fragments of the table whose rules share this group never have replicas on the same node, e.g., the
+	// partitions of a table, so that a node failure takes down at most one of them
+	AntiAffinity string
 }
 
 type Predicate map[string][]Atom
@@ -16,6 +24,9 @@ type Predicate map[string][]Atom
 type Atom struct {
 	Op  string
 	Val interface{}
+	// the name of the Partitioner and the number of partitions if Op is PartitionOp, Val being the partition
+	Partitioner string
+	Partitions  int
 	RealValue
 }
 
@@ -27,6 +38,9 @@ type RealValue struct {
 }
 
 func (n *Atom) Check(value interface{}) bool {
+	if n.Op == PartitionOp {
+		return n.checkPartition(value)
+	}
 	if value == nil {
 		return (n.Val == nil && (n.Op == "==" || n.Op == "=" || n.Op == ">=" || n.Op == "<=")) || (n.Val != nil && (n.Op == "!=" || n.Op == "<>"))
 	}
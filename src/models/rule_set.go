@@ -0,0 +1,251 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RuleSet builds the fragmentation rules of a table, so that they need not be written as raw JSON keyed by node lists.
+// The methods adding rules can be chained, and Marshal validates the rules and serializes them in the format
+// BuildTable expects:
+//
+//	rules, err := NewRuleSet(schema).
+//		AddHorizontalRule(Predicate{"grade": {{Op: "<=", Val: 3.6}}}, 0, 1).
+//		AddHorizontalRule(Predicate{"grade": {{Op: ">", Val: 3.6}}}, 2).
+//		Marshal()
+type RuleSet struct {
+	schema    TableSchema
+	fragments []ruleSetFragment
+}
+
+type ruleSetFragment struct {
+	predicate   Predicate
+	columns     []string
+	nodes       []int
+	constraints []PlacementConstraint
+	// see Rule
+	replicas     int
+	antiAffinity string
+}
+
+// validOps are the operators an Atom may use.
+var validOps = map[string]bool{"=": true, "==": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true,
+	">=": true, PartitionOp: true}
+
+// NewRuleSet creates an empty RuleSet for a table with the given schema, which should not contain the id column.
+func NewRuleSet(schema TableSchema) *RuleSet {
+	return &RuleSet{schema: schema}
+}
+
+// AddHorizontalRule adds a fragment holding all columns of the rows satisfying the predicate, placed on the nodes.
+func (rs *RuleSet) AddHorizontalRule(predicate Predicate, nodes ...int) *RuleSet {
+	return rs.AddRule(predicate, allColumns(rs.schema), nodes...)
+}
+
+// AddVerticalRule adds a fragment holding some columns of all rows, placed on the nodes.
+func (rs *RuleSet) AddVerticalRule(columns []string, nodes ...int) *RuleSet {
+	return rs.AddRule(Predicate{}, columns, nodes...)
+}
+
+// AddPartitionRules adds a fragment holding all columns for each of the node lists, the rows being given to the
+// fragments by the partition the named Partitioner maps their value of the column to: the rows of the first partition
+// are placed on nodes[0], and so on.
+//
+//	NewRuleSet(schema).AddPartitionRules("sid", "hash", []int{0, 1}, []int{2, 3})
+func (rs *RuleSet) AddPartitionRules(column string, partitioner string, nodes ...[]int) *RuleSet {
+	for i, partitionNodes := range nodes {
+		rs.AddHorizontalRule(Predicate{column: {{Op: PartitionOp, Val: i, Partitioner: partitioner,
+			Partitions: len(nodes)}}}, partitionNodes...)
+	}
+	return rs
+}
+
+// AddRule adds a fragment holding some columns of the rows satisfying the predicate, placed on the nodes.
+func (rs *RuleSet) AddRule(predicate Predicate, columns []string, nodes ...int) *RuleSet {
+	rs.fragments = append(rs.fragments, ruleSetFragment{predicate: predicate, columns: columns, nodes: nodes})
+	return rs
+}
+
+// Constrain adds placement constraints to the rule added last, see PlacementConstraint.
+func (rs *RuleSet) Constrain(constraints ...PlacementConstraint) *RuleSet {
+	if len(rs.fragments) > 0 {
+		last := &rs.fragments[len(rs.fragments)-1]
+		last.constraints = append(last.constraints, constraints...)
+	}
+	return rs
+}
+
+// Replicate places the rule added last on as many of its nodes as the count, chosen by BuildTable, or on as many of all
+// nodes if the rule was added without node.
+func (rs *RuleSet) Replicate(count int) *RuleSet {
+	if len(rs.fragments) > 0 {
+		rs.fragments[len(rs.fragments)-1].replicas = count
+	}
+	return rs
+}
+
+// AntiAffinity puts the rule added last in an anti-affinity group, whose fragments never have replicas on the same
+// node.
+func (rs *RuleSet) AntiAffinity(group string) *RuleSet {
+	if len(rs.fragments) > 0 {
+		rs.fragments[len(rs.fragments)-1].antiAffinity = group
+	}
+	return rs
+}
+
+// Validate checks that every fragment is placed on some node, or on a number of replicas its nodes can hold, and uses
+// the columns of the schema with values of their types or partitions of registered partitioners, that every column is
+// held by some fragment, and that no two fragments are placed on the same set of nodes, which the format of BuildTable
+// cannot express.
+func (rs *RuleSet) Validate() error {
+	if len(rs.fragments) == 0 {
+		return errors.New("no rule")
+	}
+	types := make(map[string]int)
+	for _, cs := range rs.schema.ColumnSchemas {
+		types[cs.Name] = cs.DataType
+	}
+	covered := make(map[string]bool)
+	keys := make(map[string]bool)
+	for i, fragment := range rs.fragments {
+		if len(fragment.nodes) == 0 && fragment.replicas == 0 {
+			return fmt.Errorf("rule %v is not placed on any node", i)
+		}
+		key := rs.key(i)
+		if hasDuplicates(fragment.nodes) {
+			return fmt.Errorf("rule %v is placed on the same node twice", i)
+		}
+		if fragment.replicas < 0 || (len(fragment.nodes) > 0 && fragment.replicas > len(fragment.nodes)) {
+			return fmt.Errorf("rule %v cannot have %v replicas on %v nodes", i, fragment.replicas, len(fragment.nodes))
+		}
+		if keys[key] {
+			return fmt.Errorf("rule %v is placed on the same nodes %v as another rule", i, key)
+		}
+		keys[key] = true
+		if len(fragment.columns) == 0 {
+			return fmt.Errorf("rule %v has no column", i)
+		}
+		for _, constraint := range fragment.constraints {
+			if constraint.Label == "" {
+				return fmt.Errorf("rule %v has a placement constraint without label", i)
+			}
+		}
+		for _, column := range fragment.columns {
+			if _, ok := types[column]; !ok {
+				return fmt.Errorf("rule %v has unknown column %v", i, column)
+			}
+			covered[column] = true
+		}
+		for column, atoms := range fragment.predicate {
+			dataType, ok := types[column]
+			if !ok {
+				return fmt.Errorf("rule %v has a predicate on unknown column %v", i, column)
+			}
+			for _, atom := range atoms {
+				if !validOps[atom.Op] {
+					return fmt.Errorf("rule %v has unknown operator %v", i, atom.Op)
+				}
+				if atom.Op == PartitionOp {
+					if err := validPartition(atom); err != nil {
+						return fmt.Errorf("rule %v partitions %v: %v", i, column, err)
+					}
+					continue
+				}
+				if atom.Val == nil && !OpIsEqualOrNotEqual(atom.Op) {
+					return fmt.Errorf("rule %v compares %v with null by %v", i, column, atom.Op)
+				}
+				if !CheckType(atom.Val, dataType) {
+					return fmt.Errorf("rule %v compares %v with %v of a wrong type", i, column, atom.Val)
+				}
+			}
+		}
+	}
+	for _, cs := range rs.schema.ColumnSchemas {
+		if !covered[cs.Name] {
+			return fmt.Errorf("column %v is not held by any rule", cs.Name)
+		}
+	}
+	return nil
+}
+
+// Marshal validates the rules and serializes them in the format BuildTable expects.
+func (rs *RuleSet) Marshal() ([]byte, error) {
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+	rules := make(map[string]interface{}, len(rs.fragments))
+	for i, fragment := range rs.fragments {
+		predicate := make(map[string]interface{}, len(fragment.predicate))
+		for column, atoms := range fragment.predicate {
+			values := make([]map[string]interface{}, len(atoms))
+			for i, atom := range atoms {
+				values[i] = map[string]interface{}{"op": atom.Op, "val": atom.Val}
+				if atom.Op == PartitionOp {
+					values[i]["partitioner"] = atom.Partitioner
+					values[i]["partitions"] = atom.Partitions
+				}
+			}
+			predicate[column] = values
+		}
+		rule := map[string]interface{}{"predicate": predicate, "column": fragment.columns}
+		if len(fragment.constraints) > 0 {
+			rule["constraints"] = fragment.constraints
+		}
+		if fragment.replicas > 0 {
+			rule["replicas"] = fragment.replicas
+		}
+		if fragment.antiAffinity != "" {
+			rule["antiAffinity"] = fragment.antiAffinity
+		}
+		rules[rs.key(i)] = rule
+	}
+	return json.Marshal(rules)
+}
+
+// validPartition checks that the partitioner of a partition atom is registered and its partition is one of its
+// partitions.
+func validPartition(atom Atom) error {
+	if _, ok := lookupPartitioner(atom.Partitioner); !ok {
+		return fmt.Errorf("unknown partitioner %v", atom.Partitioner)
+	}
+	partition, ok := numberValue(atom.Val)
+	if !ok || partition != float64(int(partition)) || partition < 0 || int(partition) >= atom.Partitions {
+		return fmt.Errorf("%v is not one of %v partitions", atom.Val, atom.Partitions)
+	}
+	return nil
+}
+
+func hasDuplicates(nodes []int) bool {
+	seen := make(map[int]bool)
+	for _, node := range nodes {
+		if seen[node] {
+			return true
+		}
+		seen[node] = true
+	}
+	return false
+}
+
+// key returns the key of the rule of the i-th fragment, its node list or, for a fragment placed on a number of
+// replicas of any node, "*i".
+func (rs *RuleSet) key(i int) string {
+	if len(rs.fragments[i].nodes) == 0 {
+		return "*" + strconv.Itoa(i)
+	}
+	return rs.fragments[i].key()
+}
+
+// key returns the node list of the fragment in the form of the keys of the rules, e.g., "0|1".
+func (f ruleSetFragment) key() string {
+	nodes := append([]int(nil), f.nodes...)
+	sort.Ints(nodes)
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = strconv.Itoa(node)
+	}
+	return strings.Join(names, "|")
+}
@@ -0,0 +1,51 @@
+package models
+
+import "testing"
+
+// the rules of TestLab3NonOverlapping built by a RuleSet
+func TestRuleSet(t *testing.T) {
+	setupLab3()
+
+	var err error
+	studentTablePartitionRules, err = NewRuleSet(*studentTableSchema).
+		AddHorizontalRule(Predicate{"grade": {{Op: "<=", Val: 3.6}}}, 0, 1).
+		AddHorizontalRule(Predicate{"grade": {{Op: ">", Val: 3.6}}}, 1, 2).
+		Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	courseRegistrationTablePartitionRules, err = NewRuleSet(*courseRegistrationTableSchema).
+		AddVerticalRule([]string{"sid", "courseId"}, 3).
+		Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+
+	results := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows:   joinedTableContent,
+	}
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, results)
+	}
+
+	invalid := map[string]*RuleSet{
+		"no rule":        NewRuleSet(*studentTableSchema),
+		"no node":        NewRuleSet(*studentTableSchema).AddHorizontalRule(Predicate{}),
+		"same nodes":     NewRuleSet(*studentTableSchema).AddHorizontalRule(Predicate{}, 0, 1).AddHorizontalRule(Predicate{}, 1, 0),
+		"unknown column": NewRuleSet(*studentTableSchema).AddVerticalRule([]string{"sid", "name", "age", "grade", "x"}, 0),
+		"uncovered":      NewRuleSet(*studentTableSchema).AddVerticalRule([]string{"sid", "name"}, 0),
+		"wrong type":     NewRuleSet(*studentTableSchema).AddHorizontalRule(Predicate{"age": {{Op: "<", Val: "old"}}}, 0),
+		"unknown op":     NewRuleSet(*studentTableSchema).AddHorizontalRule(Predicate{"age": {{Op: "~", Val: 1}}}, 0),
+	}
+	for name, rs := range invalid {
+		if err := rs.Validate(); err == nil {
+			t.Errorf("Validate should fail for %v", name)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// enumeration of query priorities, see QueryHints
+const (
+	// the priority of queries without hints
+	PriorityNormal = iota
+	// latency-sensitive queries, e.g., point lookups of an application
+	PriorityInteractive
+	// analytical queries that may wait, e.g., large joins
+	PriorityBatch
+	numPriorities
+)
+
+// priorityWeights are the shares of the query slots given to each priority while queries of several priorities wait,
+// so that a flood of batch queries slows interactive queries down little but is not starved by them either.
+var priorityWeights = [numPriorities]float64{
+	PriorityNormal:      4,
+	PriorityInteractive: 16,
+	PriorityBatch:       1,
+}
+
+// PriorityStats are the metrics of the queries of a priority, see SchedulerStats.
+type PriorityStats struct {
+	Priority int
+	// queries waiting for a slot and queries being executed
+	Waiting int
+	Running int
+	// how many queries have been admitted, and how long they waited in total and at most
+	Admitted  int
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// queryScheduler admits queries at the coordinator. At most limit queries run at the same time, and the others wait
+// in one queue per priority. A freed slot goes to the waiting priority that has been served the least relative to its
+// weight (stride scheduling), so each priority gets its share of the slots no matter how many queries the others send.
+type queryScheduler struct {
+	mu sync.Mutex
+	// how many queries may run at the same time, no limit if not positive
+	limit   int
+	running int
+	// waiting queries of each priority, the elements are *queryWaiter
+	queues [numPriorities]*list.List
+	// the virtual time of each priority, advanced by 1/weight each time one of its queries is admitted
+	pass [numPriorities]float64
+	// the virtual time of the last admitted query, a priority starting to wait does not get credit for the time it
+	// did not wait
+	now   float64
+	stats [numPriorities]PriorityStats
+}
+
+type queryWaiter struct {
+	since time.Time
+	ready chan struct{}
+}
+
+func newQueryScheduler() *queryScheduler {
+	s := &queryScheduler{}
+	for p := range s.queues {
+		s.queues[p] = list.New()
+		s.stats[p].Priority = p
+	}
+	return s
+}
+
+// schedulingPriority returns the priority of the hints, unknown priorities being normal.
+func schedulingPriority(hints QueryHints) int {
+	if hints.Priority < 0 || hints.Priority >= numPriorities {
+		return PriorityNormal
+	}
+	return hints.Priority
+}
+
+// acquire waits until a query of the priority may run.
+func (s *queryScheduler) acquire(priority int) {
+	s.mu.Lock()
+	if s.limit <= 0 || (s.running < s.limit && s.waiting() == 0) {
+		s.admit(priority, 0)
+		s.mu.Unlock()
+		return
+	}
+	waiter := &queryWaiter{since: time.Now(), ready: make(chan struct{})}
+	if s.queues[priority].Len() == 0 && s.pass[priority] < s.now {
+		s.pass[priority] = s.now
+	}
+	s.queues[priority].PushBack(waiter)
+	s.stats[priority].Waiting++
+	s.mu.Unlock()
+	<-waiter.ready
+}
+
+// release frees the slot of a finished query of the priority.
+func (s *queryScheduler) release(priority int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.stats[priority].Running--
+	s.dispatch()
+}
+
+// setLimit changes how many queries may run at the same time, admitting waiting queries if it grows.
+func (s *queryScheduler) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.dispatch()
+}
+
+// dispatch admits waiting queries while there are free slots.
+func (s *queryScheduler) dispatch() {
+	for (s.limit <= 0 || s.running < s.limit) && s.waiting() > 0 {
+		next := -1
+		for p := range s.queues {
+			if s.queues[p].Len() > 0 && (next < 0 || s.pass[p] < s.pass[next]) {
+				next = p
+			}
+		}
+		waiter := s.queues[next].Remove(s.queues[next].Front()).(*queryWaiter)
+		s.stats[next].Waiting--
+		s.now = s.pass[next]
+		s.pass[next] += 1 / priorityWeights[next]
+		s.admit(next, time.Since(waiter.since))
+		close(waiter.ready)
+	}
+}
+
+func (s *queryScheduler) admit(priority int, wait time.Duration) {
+	s.running++
+	stats := &s.stats[priority]
+	stats.Running++
+	stats.Admitted++
+	stats.TotalWait += wait
+	if wait > stats.MaxWait {
+		stats.MaxWait = wait
+	}
+}
+
+func (s *queryScheduler) waiting() int {
+	n := 0
+	for _, queue := range s.queues {
+		n += queue.Len()
+	}
+	return n
+}
+
+// SetMaxConcurrentQueries limits how many queries the coordinator executes at the same time, the others wait for a
+// slot by their priorities, see QueryHints. There is no limit if not positive, which is the default.
+func (c *Cluster) SetMaxConcurrentQueries(limit int, reply *string) {
+	c.scheduler.setLimit(limit)
+	*reply = "0 OK"
+}
+
+// SchedulerStats returns the metrics of the queries of each priority, indexed by priority.
+func (c *Cluster) SchedulerStats(args interface{}, reply *[]PriorityStats) {
+	c.scheduler.mu.Lock()
+	defer c.scheduler.mu.Unlock()
+	*reply = append([]PriorityStats(nil), c.scheduler.stats[:]...)
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n queries of the priority wait in the scheduler.
+func waitQueued(t *testing.T, s *queryScheduler, priority int, n int) {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		waiting := s.stats[priority].Waiting
+		s.mu.Unlock()
+		if waiting == n {
+			return
+		}
+	}
+	t.Fatalf("%v queries of priority %v should be waiting", n, priority)
+}
+
+// a flood of batch queries does not delay the interactive queries sent after it
+func TestQuerySchedulerPriorities(t *testing.T) {
+	s := newQueryScheduler()
+	s.setLimit(1)
+	s.acquire(PriorityNormal)
+
+	var mu sync.Mutex
+	order := make([]int, 0)
+	var wg sync.WaitGroup
+	run := func(priority int) {
+		defer wg.Done()
+		s.acquire(priority)
+		mu.Lock()
+		order = append(order, priority)
+		mu.Unlock()
+		s.release(priority)
+	}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go run(PriorityBatch)
+	}
+	waitQueued(t, s, PriorityBatch, 20)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go run(PriorityInteractive)
+	}
+	waitQueued(t, s, PriorityInteractive, 5)
+
+	s.release(PriorityNormal)
+	wg.Wait()
+	if len(order) != 25 {
+		t.Fatalf("expected 25 queries, actual %v", order)
+	}
+	interactive := 0
+	for _, priority := range order[:6] {
+		if priority == PriorityInteractive {
+			interactive++
+		}
+	}
+	if interactive != 5 {
+		t.Errorf("the interactive queries should be admitted first, actual order %v", order)
+	}
+
+	stats := s.stats
+	if stats[PriorityBatch].Admitted != 20 || stats[PriorityInteractive].Admitted != 5 ||
+		stats[PriorityNormal].Admitted != 1 {
+		t.Errorf("unexpected admissions %v", stats)
+	}
+	for _, st := range stats {
+		if st.Waiting != 0 || st.Running != 0 {
+			t.Errorf("no query should be waiting or running, actual %v", st)
+		}
+	}
+	if stats[PriorityBatch].MaxWait <= 0 {
+		t.Errorf("the batch queries should have waited, actual %v", stats[PriorityBatch])
+	}
+}
+
+// batch queries still get their share while interactive queries keep waiting
+func TestQuerySchedulerNoStarvation(t *testing.T) {
+	s := newQueryScheduler()
+	s.setLimit(1)
+	s.acquire(PriorityNormal)
+	for i := 0; i < 40; i++ {
+		go s.acquire(PriorityInteractive)
+	}
+	waitQueued(t, s, PriorityInteractive, 40)
+	go s.acquire(PriorityBatch)
+	waitQueued(t, s, PriorityBatch, 1)
+
+	s.release(PriorityNormal)
+	for i := 0; i < 20; i++ {
+		s.release(PriorityInteractive)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats[PriorityBatch].Admitted != 1 {
+		t.Errorf("the batch query should have been admitted among the first 21 queries, actual %v", s.stats)
+	}
+}
+
+func TestSchedulerStats(t *testing.T) {
+	setupLab3()
+	defineTablesLab3()
+	studentTablePartitionRules = []byte(`{"0": {"predicate": {}, "column": ["sid", "name", "age", "grade"]}}`)
+	courseRegistrationTablePartitionRules = []byte(`{"1": {"predicate": {}, "column": ["sid", "courseId"]}}`)
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+
+	reply := ""
+	cli.Call("Cluster.SetMaxConcurrentQueries", 2, &reply)
+	results := Dataset{}
+	cli.Call("Cluster.JoinWithHints", []interface{}{[]string{studentTableName, courseRegistrationTableName},
+		QueryHints{Priority: PriorityBatch}}, &results)
+	if len(results.Rows) != len(joinedTableContent) {
+		t.Errorf("expected %v rows, actual %v", len(joinedTableContent), results.Rows)
+	}
+	stats := make([]PriorityStats, 0)
+	cli.Call("Cluster.SchedulerStats", "", &stats)
+	if len(stats) != numPriorities || stats[PriorityBatch].Admitted != 1 || stats[PriorityBatch].Running != 0 {
+		t.Errorf("unexpected stats %v", stats)
+	}
+}
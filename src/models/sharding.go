@@ -0,0 +1,472 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"../labrpc"
+)
+
+// Router is the routing tier of a sharded cluster, in which several coordinators share the nodes and each of them owns
+// a disjoint set of tables, so that requests on tables owned by different coordinators do not wait for each other
+// (e.g., the writes serialized by each coordinator). The Router accepts the requests a Cluster does and forwards each
+// of them to the coordinator owning its table, a table being given to the coordinator owning the fewest tables when
+// it is built.
+// A join of tables owned by one coordinator is executed by that coordinator, while the tables of a join spanning
+// coordinators are read from their owners and joined by the Router. The requests on the nodes rather than on tables
+// (e.g., RestartNode) are sent to every coordinator.
+type Router struct {
+	mu sync.Mutex
+	// serializes the builds of the tables, so that two new tables are not given to a coordinator at the same time
+	buildMu sync.Mutex
+	// the names of the coordinators in the network
+	coordinators []string
+	// table name -> the name of the coordinator owning the table
+	tableName2coordinator map[string]string
+	// the replies of the requests executed lately by the Router, see Execute
+	requests *requestCache
+	network  *labrpc.Network
+	// the name of the router in the network, which the clients connect to
+	Name string
+}
+
+// NewShardedCluster creates a cluster of nodeNum nodes as NewCluster does, with coordinatorNum (at least one)
+// coordinators sharing the nodes and a Router in front of them. The Router is named routerName in the network, and
+// the coordinators "<routerName>/Coordinator0", "<routerName>/Coordinator1", ..., the clients should only send their
+// requests to the Router.
+func NewShardedCluster(nodeNum int, coordinatorNum int, network *labrpc.Network, routerName string) (*Router,
+	[]*Cluster) {
+	coordinators := make([]*Cluster, coordinatorNum)
+	names := make([]string, coordinatorNum)
+	for i := range coordinators {
+		names[i] = fmt.Sprintf("%v/Coordinator%v", routerName, i)
+		if i == 0 {
+			coordinators[i] = NewCluster(nodeNum, network, names[i])
+		} else {
+			coordinators[i] = newCoordinator(coordinators[0].nodeIds, coordinators[0].persisters, coordinators[0].nodes,
+				network, names[i])
+		}
+	}
+
+	r := &Router{coordinators: names, tableName2coordinator: make(map[string]string), requests: newRequestCache(),
+		network: network, Name: routerName}
+	server := labrpc.MakeServer()
+	server.AddService(labrpc.MakeService(r))
+	network.AddServer(routerName, server)
+	return r, coordinators
+}
+
+// coordinatorEnd returns a client end connected to the given coordinator.
+func (r *Router) coordinatorEnd(coordinator string) *labrpc.ClientEnd {
+	endName := r.Name + "->" + coordinator
+	end := r.network.MakeEnd(endName)
+	r.network.Connect(endName, coordinator)
+	r.network.Enable(endName, true)
+	return end
+}
+
+// owner returns the coordinator owning a table, and false if the table has not been built.
+func (r *Router) owner(tableName string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	coordinator, ok := r.tableName2coordinator[tableName]
+	return coordinator, ok
+}
+
+// choose returns the coordinator owning a table, or the coordinator owning the fewest tables if it is not owned yet,
+// without giving the table to it. Ties are broken by the order of the coordinators.
+func (r *Router) choose(tableName string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if coordinator, ok := r.tableName2coordinator[tableName]; ok {
+		return coordinator
+	}
+	owned := make(map[string]int)
+	for _, coordinator := range r.tableName2coordinator {
+		owned[coordinator]++
+	}
+	least := r.coordinators[0]
+	for _, coordinator := range r.coordinators {
+		if owned[coordinator] < owned[least] {
+			least = coordinator
+		}
+	}
+	return least
+}
+
+// forward calls the method of the coordinator owning the table, the reply is "1 <reason>" if there is no such
+// table or the coordinator cannot be reached.
+func (r *Router) forward(tableName string, method string, args interface{}, reply *string) {
+	coordinator, ok := r.owner(tableName)
+	if !ok {
+		*reply = "1 No Such Table"
+		return
+	}
+	if !r.coordinatorEnd(coordinator).Call("Cluster."+method, args, reply) {
+		*reply = "1 coordinator unreachable"
+	}
+}
+
+// forwardQuery is forward for the methods replying a Dataset, a failure being reported with an empty schema.
+func (r *Router) forwardQuery(tableName string, method string, args interface{}, reply *Dataset) {
+	result := Dataset{}
+	coordinator, ok := r.owner(tableName)
+	if !ok || !r.coordinatorEnd(coordinator).Call("Cluster."+method, args, &result) {
+		result = Dataset{}
+	}
+	*reply = result
+}
+
+// broadcast calls the method of every coordinator in order. The reply is "0 OK" if every coordinator succeeds, or the
+// reply of the first one failing, after which the rest are not called.
+func (r *Router) broadcast(method string, args interface{}, reply *string) {
+	for _, coordinator := range r.coordinators {
+		msg := ""
+		if !r.coordinatorEnd(coordinator).Call("Cluster."+method, args, &msg) {
+			*reply = "1 " + coordinator + " unreachable"
+			return
+		}
+		if len(msg) == 0 || msg[0] != '0' {
+			*reply = msg
+			return
+		}
+	}
+	*reply = "0 OK"
+}
+
+// SayHello tells the visitor which coordinators the Router forwards requests to.
+func (r *Router) SayHello(visitor string, reply *string) {
+	*reply = fmt.Sprintf("Hello %s, I am the router of %s", visitor, strings.Join(r.coordinators, ", "))
+}
+
+// BuildTable builds the table on the coordinator owning it, or on the coordinator owning the fewest tables if it is
+// new, see Cluster.BuildTable. A new table is only given to the coordinator once it has been built there.
+// params: the same as Cluster.BuildTable
+func (r *Router) BuildTable(params []interface{}, reply *string) {
+	r.buildMu.Lock()
+	defer r.buildMu.Unlock()
+	tableName := params[0].(TableSchema).TableName
+	coordinator := r.choose(tableName)
+	if !r.coordinatorEnd(coordinator).Call("Cluster.BuildTable", params, reply) {
+		*reply = "1 coordinator unreachable"
+		return
+	}
+	if strings.HasPrefix(*reply, "0") {
+		r.mu.Lock()
+		r.tableName2coordinator[tableName] = coordinator
+		r.mu.Unlock()
+	}
+}
+
+// DropTable drops the table on its coordinator, after which the table may be given to another coordinator when it is
+// built again, see Cluster.DropTable.
+// params: the same as Cluster.DropTable
+func (r *Router) DropTable(params []interface{}, reply *string) {
+	tableName := params[0].(string)
+	if _, ok := r.owner(tableName); !ok && len(params) > 1 && params[1].(bool) {
+		*reply = "0 Not Exists"
+		return
+	}
+	r.forward(tableName, "DropTable", params, reply)
+	if strings.HasPrefix(*reply, "0") {
+		r.mu.Lock()
+		delete(r.tableName2coordinator, tableName)
+		r.mu.Unlock()
+	}
+}
+
+// RenameTable renames the table on its coordinator, see Cluster.RenameTable. The old name stays owned by the same
+// coordinator, which tells the requests on it that the table has been renamed.
+// params: the same as Cluster.RenameTable
+func (r *Router) RenameTable(params []interface{}, reply *string) {
+	from := params[0].(string)
+	to := params[1].(string)
+	coordinator, ok := r.owner(from)
+	if !ok {
+		*reply = "1 No Such Table"
+		return
+	}
+	if owner, ok := r.owner(to); ok && owner != coordinator {
+		*reply = "1 Table Exists"
+		return
+	}
+	r.forward(from, "RenameTable", params, reply)
+	if strings.HasPrefix(*reply, "0") {
+		r.mu.Lock()
+		r.tableName2coordinator[to] = coordinator
+		r.mu.Unlock()
+	}
+}
+
+// CreateIndex see Cluster.CreateIndex.
+// params: the same as Cluster.CreateIndex
+func (r *Router) CreateIndex(params []interface{}, reply *string) {
+	r.forward(params[0].(string), "CreateIndex", params, reply)
+}
+
+// DescribeTable see Cluster.DescribeTable.
+// params: the same as Cluster.DescribeTable
+func (r *Router) DescribeTable(tableName string, reply *TableDefinition) {
+	result := TableDefinition{}
+	coordinator, ok := r.owner(tableName)
+	if !ok || !r.coordinatorEnd(coordinator).Call("Cluster.DescribeTable", tableName, &result) {
+		result = TableDefinition{}
+	}
+	*reply = result
+}
+
+// Fsck see Cluster.Fsck.
+// params: the same as Cluster.Fsck
+func (r *Router) Fsck(tableName string, reply *FsckReport) {
+	result := FsckReport{}
+	coordinator, ok := r.owner(tableName)
+	if !ok {
+		result = FsckReport{TableName: tableName, Error: "No Such Table"}
+	} else if !r.coordinatorEnd(coordinator).Call("Cluster.Fsck", tableName, &result) {
+		result = FsckReport{TableName: tableName, Error: "coordinator unreachable"}
+	}
+	*reply = result
+}
+
+// FragmentWrite see Cluster.FragmentWrite.
+// params: the same as Cluster.FragmentWrite
+func (r *Router) FragmentWrite(params []interface{}, reply *string) {
+	r.forward(params[0].(string), "FragmentWrite", params, reply)
+}
+
+// WriteRecord see Cluster.WriteRecord.
+// params: the same as Cluster.WriteRecord
+func (r *Router) WriteRecord(params []interface{}, reply *string) {
+	r.forward(params[0].(string), "WriteRecord", params, reply)
+}
+
+// ImportTable see Cluster.ImportTable.
+// params: the same as Cluster.ImportTable
+func (r *Router) ImportTable(params []interface{}, reply *string) {
+	r.forward(params[0].(string), "ImportTable", params, reply)
+}
+
+// ExportTable see Cluster.ExportTable.
+// params: the same as Cluster.ExportTable
+func (r *Router) ExportTable(params []interface{}, reply *string) {
+	name := params[0].(string)
+	if strings.Contains(name, "|") {
+		name = fragmentTable(name)
+	}
+	r.forward(name, "ExportTable", params, reply)
+}
+
+// SplitFragment see Cluster.SplitFragment.
+// params: the same as Cluster.SplitFragment
+func (r *Router) SplitFragment(params []interface{}, reply *string) {
+	r.forward(fragmentTable(params[0].(string)), "SplitFragment", params, reply)
+}
+
+// MergeFragments see Cluster.MergeFragments.
+// params: the same as Cluster.MergeFragments
+func (r *Router) MergeFragments(params []interface{}, reply *string) {
+	r.forward(fragmentTable(params[0].(string)), "MergeFragments", params, reply)
+}
+
+// SuggestFragmentation see Cluster.SuggestFragmentation.
+// params: the same as Cluster.SuggestFragmentation
+func (r *Router) SuggestFragmentation(params []interface{}, reply *[]byte) {
+	result := make([]byte, 0)
+	coordinator, ok := r.owner(params[0].(string))
+	if !ok || !r.coordinatorEnd(coordinator).Call("Cluster.SuggestFragmentation", params, &result) {
+		result = nil
+	}
+	*reply = result
+}
+
+// Get see Cluster.Get.
+// params: the same as Cluster.Get
+func (r *Router) Get(params []interface{}, reply *Dataset) {
+	r.forwardQuery(params[0].(string), "Get", params, reply)
+}
+
+// MultiGet see Cluster.MultiGet.
+// params: the same as Cluster.MultiGet
+func (r *Router) MultiGet(params []interface{}, reply *Dataset) {
+	r.forwardQuery(params[0].(string), "MultiGet", params, reply)
+}
+
+// Scan see Cluster.Scan.
+// params: the same as Cluster.Scan
+func (r *Router) Scan(params []interface{}, reply *Dataset) {
+	r.forwardQuery(params[0].(string), "Scan", params, reply)
+}
+
+// Query see Cluster.Query.
+// params: the same as Cluster.Query
+func (r *Router) Query(params []interface{}, reply *Dataset) {
+	r.forwardQuery(params[0].(string), "Query", params, reply)
+}
+
+// Execute calls a method of the Router at most once for each request id, as Cluster.Execute does for the coordinator.
+// The Router keeps the replies itself, since a request may be forwarded to several coordinators (e.g., a join).
+func (r *Router) Execute(request Request, reply *Response) {
+	executeOnce(reflect.ValueOf(r), r.requests, request, reply)
+}
+
+// SetRequestWindow sets how long the Router keeps the replies of the requests, see Cluster.SetRequestWindow.
+func (r *Router) SetRequestWindow(window time.Duration, reply *string) {
+	r.requests.setWindow(window)
+	*reply = "0 OK"
+}
+
+// Join see Cluster.Join.
+func (r *Router) Join(tableNames []string, reply *Dataset) {
+	r.join(tableNames, QueryHints{}, reply)
+}
+
+// JoinWithHints see Cluster.JoinWithHints. The hints are passed to the coordinators of the tables, and the memory
+// budget is also followed by the Router when it joins the tables itself.
+// params: tableNames []string, hints QueryHints
+func (r *Router) JoinWithHints(params []interface{}, reply *Dataset) {
+	r.join(params[0].([]string), params[1].(QueryHints), reply)
+}
+
+func (r *Router) join(tableNames []string, hints QueryHints, reply *Dataset) {
+	empty := Dataset{Schema: TableSchema{ColumnSchemas: make([]ColumnSchema, 0)}, Rows: make([]Row, 0)}
+	owners := make(map[string]bool)
+	for _, tableName := range tableNames {
+		coordinator, ok := r.owner(tableName)
+		if !ok {
+			*reply = empty
+			return
+		}
+		owners[coordinator] = true
+	}
+	if len(tableNames) < 2 {
+		*reply = empty
+		return
+	}
+	if len(owners) == 1 {
+		result := Dataset{}
+		coordinator, _ := r.owner(tableNames[0])
+		if !r.coordinatorEnd(coordinator).Call("Cluster.JoinWithHints", []interface{}{tableNames, hints}, &result) {
+			result = empty
+		}
+		*reply = result
+		return
+	}
+
+	// the tables are scanned in the order of their schemas, the joined result being reordered at last
+	defer reorderColumns(reply, hints.Columns)
+	scanHints := hints
+	scanHints.Columns = nil
+	tables := make([]Dataset, len(tableNames))
+	inputs := make([]joinInput, len(tableNames))
+	for i, tableName := range tableNames {
+		table := Dataset{}
+		r.forwardQuery(tableName, "Scan", []interface{}{tableName, scanHints}, &table)
+		if table.Schema.TableName == "" {
+			empty.Error = table.Error
+			*reply = empty
+			return
+		}
+		tables[i] = table
+		inputs[i] = newJoinInput(table.Schema, table.Rows)
+	}
+	resultColumns := tables[0].Columns
+	for _, table := range tables[1:] {
+		resultColumns = joinColumns(resultColumns, table.Columns)
+	}
+	if hints.WithProvenance {
+		*reply = joinDatasets(&queryContext{hints: hints}, tables)
+		reply.Columns = resultColumns
+		return
+	}
+	columns, rows := joinTables(&queryContext{hints: hints}, inputs)
+	*reply = Dataset{Schema: TableSchema{TableName: "", ColumnSchemas: columns}, Rows: rows, Columns: resultColumns}
+}
+
+// SetNodeResources sets the simulated constraints of a node through every coordinator, so that each of them sets
+// them again when it restarts the node, see Cluster.SetNodeResources.
+// params: the same as Cluster.SetNodeResources
+func (r *Router) SetNodeResources(params []interface{}, reply *string) {
+	r.broadcast("SetNodeResources", params, reply)
+}
+
+// SetMaxConcurrentQueries limits the queries executed at the same time by each coordinator, see
+// Cluster.SetMaxConcurrentQueries.
+func (r *Router) SetMaxConcurrentQueries(limit int, reply *string) {
+	r.broadcast("SetMaxConcurrentQueries", limit, reply)
+}
+
+// SchedulerStats sums up the metrics of the queries of each priority over the coordinators, see
+// Cluster.SchedulerStats.
+func (r *Router) SchedulerStats(args interface{}, reply *[]PriorityStats) {
+	total := make([]PriorityStats, numPriorities)
+	for p := range total {
+		total[p].Priority = p
+	}
+	for _, coordinator := range r.coordinators {
+		stats := make([]PriorityStats, 0)
+		if !r.coordinatorEnd(coordinator).Call("Cluster.SchedulerStats", args, &stats) {
+			continue
+		}
+		for p, st := range stats {
+			total[p].Waiting += st.Waiting
+			total[p].Running += st.Running
+			total[p].Admitted += st.Admitted
+			total[p].TotalWait += st.TotalWait
+			if st.MaxWait > total[p].MaxWait {
+				total[p].MaxWait = st.MaxWait
+			}
+		}
+	}
+	*reply = total
+}
+
+// StartGossip makes the nodes gossip the metadata of the tables of every coordinator, see Cluster.StartGossip.
+func (r *Router) StartGossip(interval time.Duration, reply *string) {
+	r.broadcast("StartGossip", interval, reply)
+}
+
+// StopGossip makes the nodes stop gossiping, see Cluster.StopGossip.
+func (r *Router) StopGossip(args interface{}, reply *string) {
+	r.broadcast("StopGossip", args, reply)
+}
+
+// Rebalance rebalances the fragments of each coordinator in turn, see Cluster.Rebalance. Each coordinator only moves
+// its own fragments, by the rows of its own tables.
+func (r *Router) Rebalance(args interface{}, reply *string) {
+	r.broadcast("Rebalance", args, reply)
+}
+
+// DecommissionNode moves the replicas of every coordinator off the node, see Cluster.DecommissionNode.
+// params: nodeId string, e.g., "Node3"
+func (r *Router) DecommissionNode(nodeId string, reply *string) {
+	r.broadcast("DecommissionNode", nodeId, reply)
+}
+
+// RestartNode restarts the node through the first coordinator, see Cluster.RestartNode, after which the other
+// coordinators copy back the rows their fragments missed on the node, see Cluster.CatchUpNode.
+// params: nodeId string, e.g., "Node3"
+func (r *Router) RestartNode(nodeId string, reply *string) {
+	msg := ""
+	if !r.coordinatorEnd(r.coordinators[0]).Call("Cluster.RestartNode", nodeId, &msg) {
+		*reply = "1 " + r.coordinators[0] + " unreachable"
+		return
+	}
+	if len(msg) == 0 || msg[0] != '0' {
+		*reply = msg
+		return
+	}
+	for _, coordinator := range r.coordinators[1:] {
+		if !r.coordinatorEnd(coordinator).Call("Cluster.CatchUpNode", nodeId, &msg) {
+			*reply = "1 " + coordinator + " unreachable"
+			return
+		}
+		if len(msg) == 0 || msg[0] != '0' {
+			*reply = msg
+			return
+		}
+	}
+	*reply = "0 OK"
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"../labrpc"
+)
+
+// setupSharded sets up a sharded cluster of 5 nodes and 2 coordinators, with cli connected to its router.
+func setupSharded() []*Cluster {
+	network = labrpc.MakeNetwork()
+	router, coordinators := NewShardedCluster(5, 2, network, "MyRouter")
+	cli = network.MakeEnd("ClientA")
+	network.Connect("ClientA", router.Name)
+	network.Enable("ClientA", true)
+
+	defineTablesLab3()
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"1|2": rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"2|3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	reply := ""
+	cli.Call("Router.BuildTable", []interface{}{studentTableSchema, studentTablePartitionRules, "sid"}, &reply)
+	cli.Call("Router.BuildTable",
+		[]interface{}{courseRegistrationTableSchema, courseRegistrationTablePartitionRules}, &reply)
+	for _, row := range studentRows {
+		cli.Call("Router.FragmentWrite", []interface{}{studentTableName, row}, &reply)
+	}
+	for _, row := range courseRegistrationRows {
+		cli.Call("Router.FragmentWrite", []interface{}{courseRegistrationTableName, row}, &reply)
+	}
+	return coordinators
+}
+
+func TestShardedCluster(t *testing.T) {
+	coordinators := setupSharded()
+
+	// the tables are owned by different coordinators
+	if _, ok := coordinators[0].catalog.Schema(studentTableName); !ok {
+		t.Errorf("%v should be owned by the first coordinator", studentTableName)
+	}
+	if _, ok := coordinators[1].catalog.Schema(courseRegistrationTableName); !ok {
+		t.Errorf("%v should be owned by the second coordinator", courseRegistrationTableName)
+	}
+	if _, ok := coordinators[0].catalog.Schema(courseRegistrationTableName); ok {
+		t.Errorf("%v should not be owned by the first coordinator", courseRegistrationTableName)
+	}
+
+	results := Dataset{}
+	cli.Call("Router.Get", []interface{}{studentTableName, 1}, &results)
+	if len(results.Rows) != 1 || !results.Rows[0].Equals(&studentRows[1]) {
+		t.Errorf("expected %v, actual %v", studentRows[1], results)
+	}
+	results = Dataset{}
+	cli.Call("Router.Scan", []interface{}{courseRegistrationTableName}, &results)
+	if !compareDataset(Dataset{Schema: *courseRegistrationTableSchema, Rows: courseRegistrationRows}, results) {
+		t.Errorf("Incorrect scan results, actual %v", results)
+	}
+
+	expectedDataset := Dataset{Schema: joinedTableSchema, Rows: joinedTableContent}
+	results = Dataset{}
+	cli.Call("Router.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, results)
+	}
+
+	reply := ""
+	cli.Call("Router.FragmentWrite", []interface{}{"unknown", Row{0}}, &reply)
+	if reply != "1 No Such Table" {
+		t.Errorf("unexpected reply %v", reply)
+	}
+}
+
+// the tables of a join owned by the same coordinator are joined by it
+func TestShardedClusterLocalJoin(t *testing.T) {
+	setupSharded()
+	enrollment := TableSchema{TableName: "enrollment", ColumnSchemas: []ColumnSchema{
+		{Name: "courseId", DataType: TypeInt32},
+		{Name: "capacity", DataType: TypeInt32},
+	}}
+	rules, _ := json.Marshal(map[string]interface{}{
+		"4": rangeFragment("courseId", ">=", 0, "courseId", "capacity"),
+	})
+	reply := ""
+	// the coordinators own one table each, so the new table goes to the first one too
+	cli.Call("Router.BuildTable", []interface{}{enrollment, rules}, &reply)
+	cli.Call("Router.FragmentWrite", []interface{}{"enrollment", Row{2, 30}}, &reply)
+
+	expectedDataset := Dataset{
+		Schema: TableSchema{ColumnSchemas: append(append([]ColumnSchema(nil), joinedTableSchema.ColumnSchemas...),
+			ColumnSchema{Name: "capacity", DataType: TypeInt32})},
+		Rows: []Row{{2, "Hana", 21, 4.0, 2, 30}},
+	}
+	results := Dataset{}
+	cli.Call("Router.Join", []string{studentTableName, courseRegistrationTableName, "enrollment"}, &results)
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, results)
+	}
+	results = Dataset{}
+	cli.Call("Router.Join", []string{"enrollment", studentTableName}, &results)
+	if len(results.Rows) != 0 {
+		t.Errorf("tables without common columns should join no row, actual %v", results)
+	}
+}
+
+func TestShardedClusterRestartNode(t *testing.T) {
+	setupSharded()
+
+	// node2 holds fragments of the tables of both coordinators
+	network.DeleteServer("Node2")
+	reply := ""
+	cli.Call("Router.FragmentWrite", []interface{}{courseRegistrationTableName, Row{2, 1}}, &reply)
+	cli.Call("Router.RestartNode", "Node2", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot restart Node2: %v", reply)
+	}
+
+	// node3 holds the other replica of courseRegistration, only the restarted node can answer
+	network.DeleteServer("Node3")
+	expectedDataset := Dataset{Schema: joinedTableSchema,
+		Rows: append(append([]Row(nil), joinedTableContent...), Row{2, "Hana", 21, 4.0, 1})}
+	results := Dataset{}
+	cli.Call("Router.JoinWithHints", []interface{}{[]string{studentTableName, courseRegistrationTableName},
+		QueryHints{DisableCache: true}}, &results)
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results, expected %v, actual %v", expectedDataset, results)
+	}
+}
+
+// a table which fails to be built is not given to any coordinator, and the records and the requests are forwarded
+func TestShardedClusterBuildFailure(t *testing.T) {
+	coordinators := setupSharded()
+	enrollment := TableSchema{TableName: "enrollment", ColumnSchemas: []ColumnSchema{
+		{Name: "courseId", DataType: TypeInt32},
+		{Name: "capacity", DataType: TypeInt32},
+	}}
+	invalid := rangeFragment("courseId", ">=", 0, "courseId", "capacity")
+	invalid["replicas"] = -1
+	rules, _ := json.Marshal(map[string]interface{}{"4": invalid})
+	reply := ""
+	cli.Call("Router.BuildTable", []interface{}{enrollment, rules}, &reply)
+	if reply[0] != '1' {
+		t.Fatalf("expected the build to fail, actual %v", reply)
+	}
+	cli.Call("Router.FragmentWrite", []interface{}{"enrollment", Row{2, 30}}, &reply)
+	if reply != "1 No Such Table" {
+		t.Errorf("the table should not be owned after a failed build, actual %v", reply)
+	}
+
+	// the failed build is not counted, so the table still goes to the first coordinator
+	rules, _ = json.Marshal(map[string]interface{}{"4": rangeFragment("courseId", ">=", 0, "courseId", "capacity")})
+	cli.Call("Router.BuildTable", []interface{}{enrollment, rules}, &reply)
+	if _, ok := coordinators[0].catalog.Schema("enrollment"); !ok || reply != "0 OK" {
+		t.Fatalf("enrollment should be built by the first coordinator, actual %v", reply)
+	}
+	cli.Call("Router.WriteRecord", []interface{}{"enrollment",
+		map[string]interface{}{"courseId": 2, "capacity": 30}}, &reply)
+	if reply != "0 OK" {
+		t.Errorf("cannot write the record: %v", reply)
+	}
+
+	request := NewRequest("Scan", []interface{}{"enrollment"})
+	response := Response{}
+	cli.Call("Router.Execute", request, &response)
+	cli.Call("Router.Execute", request, &response)
+	results, _ := response.Reply.(Dataset)
+	if !response.Replayed || len(results.Rows) != 1 || !results.Rows[0].Equals(&Row{2, 30}) {
+		t.Errorf("expected the row once, actual %v", response)
+	}
+}
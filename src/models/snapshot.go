@@ -0,0 +1,402 @@
+package models
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultSnapshotLease is how long a node keeps a snapshot of a fragment which is not scanned by default, see
+// Node.RPCSetSnapshotLease.
+const defaultSnapshotLease = time.Minute
+
+// SnapshotRowStore keeps rows in memory as an immutable slice of rows plus a delta of the changes made since the
+// slice was built: rows are only ever appended to it, and removed rows are marked instead of being taken out. A
+// snapshot of the store (see snapshot) shares the slice with the store and only copies the marks, so that taking one
+// does not copy the rows and writes continue without disturbing it. Once most of the slice is marked, the rows left
+// are compacted into a new slice, the old one is kept by the snapshots still reading it.
+type SnapshotRowStore struct {
+	rows []Row
+	// the indexes of the removed rows in rows
+	removed map[int]bool
+}
+
+// rows are compacted once more than this many of them, and more than half of them, are removed
+const minCompactedRows = 64
+
+func NewSnapshotRowStore() *SnapshotRowStore {
+	return &SnapshotRowStore{rows: make([]Row, 0), removed: make(map[int]bool)}
+}
+
+func (s *SnapshotRowStore) count() int {
+	return len(s.rows) - len(s.removed)
+}
+
+func (s *SnapshotRowStore) iterator() RowIterator {
+	return &frozenRowIterator{rows: s.rows, removed: s.removed}
+}
+
+func (s *SnapshotRowStore) insert(row *Row) {
+	s.rows = append(s.rows, copyRow(*row))
+}
+
+func (s *SnapshotRowStore) remove(row *Row) {
+	for i, r := range s.rows {
+		if !s.removed[i] && r.Equals(row) {
+			s.removed[i] = true
+			break
+		}
+	}
+	if len(s.removed) > minCompactedRows && 2*len(s.removed) > len(s.rows) {
+		rows := make([]Row, 0, s.count())
+		for i, r := range s.rows {
+			if !s.removed[i] {
+				rows = append(rows, r)
+			}
+		}
+		s.rows = rows
+		s.removed = make(map[int]bool)
+	}
+}
+
+func (s *SnapshotRowStore) snapshot() RowIterable {
+	removed := make(map[int]bool, len(s.removed))
+	for i := range s.removed {
+		removed[i] = true
+	}
+	// the full slice expression keeps the rows appended later out of the snapshot
+	return &frozenRows{rows: s.rows[:len(s.rows):len(s.rows)], removed: removed}
+}
+
+// RowIterable is a read-only view of rows which can be iterated more than once.
+type RowIterable interface {
+	count() int
+	iterator() RowIterator
+}
+
+// snapshotter is implemented by the row stores able to take snapshots without copying their rows. A snapshot is not
+// changed by the later writes of the store.
+type snapshotter interface {
+	snapshot() RowIterable
+}
+
+// frozenRows is a snapshot of rows in memory.
+type frozenRows struct {
+	rows    []Row
+	removed map[int]bool
+}
+
+func (f *frozenRows) count() int {
+	return len(f.rows) - len(f.removed)
+}
+
+func (f *frozenRows) iterator() RowIterator {
+	return &frozenRowIterator{rows: f.rows, removed: f.removed}
+}
+
+type frozenRowIterator struct {
+	rows    []Row
+	removed map[int]bool
+	next    int
+}
+
+func (iter *frozenRowIterator) HasNext() bool {
+	for iter.next < len(iter.rows) && iter.removed[iter.next] {
+		iter.next++
+	}
+	return iter.next < len(iter.rows)
+}
+
+func (iter *frozenRowIterator) Next() *Row {
+	if !iter.HasNext() {
+		return nil
+	}
+	row := iter.rows[iter.next]
+	iter.next++
+	return &row
+}
+
+// snapshot of a DiskRowStore copies the positions of its blocks and its tail only, as a block is never overwritten
+// in the file: changing a block writes it at the end of the file instead. The blocks of a snapshot are read from the
+// file without going through the cache of the store.
+func (s *DiskRowStore) snapshot() RowIterable {
+	snapshot := &diskSnapshot{store: s, blocks: append([]diskBlock(nil), s.blocks...), length: s.length}
+	snapshot.tail = s.tail[:len(s.tail):len(s.tail)]
+	return snapshot
+}
+
+type diskSnapshot struct {
+	store  *DiskRowStore
+	blocks []diskBlock
+	tail   []Row
+	length int
+}
+
+func (d *diskSnapshot) count() int {
+	return d.length
+}
+
+// Err tells why the store has failed, see DiskRowStore.Err.
+func (d *diskSnapshot) Err() error {
+	return d.store.Err()
+}
+
+func (d *diskSnapshot) iterator() RowIterator {
+	rows := make([]RowIterator, 0, len(d.blocks)+1)
+	for _, block := range d.blocks {
+		rows = append(rows, &lazyBlockIterator{store: d.store, block: block})
+	}
+	rows = append(rows, &frozenRowIterator{rows: d.tail})
+	return &concatIterator{iterators: rows}
+}
+
+// lazyBlockIterator reads a block from the file when it is first iterated, and iterates no row of a block which
+// cannot be read, the store failing.
+type lazyBlockIterator struct {
+	store *DiskRowStore
+	block diskBlock
+	rows  *frozenRowIterator
+}
+
+func (iter *lazyBlockIterator) HasNext() bool {
+	if iter.rows == nil {
+		rows, err := iter.store.readFile(iter.block)
+		if err != nil {
+			iter.store.fail(err)
+		}
+		iter.rows = &frozenRowIterator{rows: rows}
+	}
+	return iter.rows.HasNext()
+}
+
+func (iter *lazyBlockIterator) Next() *Row {
+	if !iter.HasNext() {
+		return nil
+	}
+	return iter.rows.Next()
+}
+
+// concatIterator iterates the rows of each iterator in turn.
+type concatIterator struct {
+	iterators []RowIterator
+}
+
+func (iter *concatIterator) HasNext() bool {
+	for len(iter.iterators) > 0 && !iter.iterators[0].HasNext() {
+		iter.iterators = iter.iterators[1:]
+	}
+	return len(iter.iterators) > 0
+}
+
+func (iter *concatIterator) Next() *Row {
+	if !iter.HasNext() {
+		return nil
+	}
+	return iter.iterators[0].Next()
+}
+
+// Snapshot returns a view of the rows of the table that later writes do not change. It is cheap if the store of the
+// table is a snapshotter, while the rows of other stores are copied.
+func (t *Table) Snapshot() RowIterable {
+	if s, ok := t.rowStore.(snapshotter); ok {
+		if len(t.tombstones) == 0 {
+			return s.snapshot()
+		}
+		// the rows deleted later stay in the snapshot, while those undeleted later stay out of it
+		tombstones := make(map[string]int64, len(t.tombstones))
+		for id, at := range t.tombstones {
+			tombstones[id] = at
+		}
+		return &liveRows{rows: s.snapshot(), tombstones: tombstones}
+	}
+	rows := make([]Row, 0, t.Count())
+	for iter := t.RowIterator(); iter.HasNext(); {
+		rows = append(rows, *iter.Next())
+	}
+	return &frozenRows{rows: rows}
+}
+
+// fragmentSnapshot is a snapshot of a fragment taken by RPCSnapshotFragment.
+type fragmentSnapshot struct {
+	fragment string
+	schema   TableSchema
+	rows     RowIterable
+	// when the snapshot is released unless it is scanned before, guarded by snapshotMu of the node
+	expires time.Time
+	// guards the cursor, as the same snapshot may be scanned concurrently
+	mu sync.Mutex
+	// the rows not scanned yet, nil before the first scan, and how many rows have been scanned before them, see
+	// RPCScanSnapshot
+	cursor   RowIterator
+	position int
+}
+
+// RPCSnapshotFragment takes a snapshot of a fragment, which can be scanned by RPCScanSnapshot while the fragment is
+// being written, until it is released by RPCReleaseSnapshot, the fragment is dropped, or it has not been scanned for
+// a lease, see RPCSetSnapshotLease, so that the snapshots of a reader which has gone away do not hold their rows
+// forever. The reply is "0 <snapshot id>", or "1 <reason>" if the fragment does not exist on this node.
+func (n *Node) RPCSnapshotFragment(args FragmentArgs, reply *string) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fragment := args.Fragment
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		*reply = "1 no such table"
+		return
+	}
+	n.snapshotMu.Lock()
+	defer n.snapshotMu.Unlock()
+	now := time.Now()
+	n.expireSnapshots(now)
+	n.snapshotNum++
+	id := fragment + "@" + strconv.Itoa(n.snapshotNum)
+	n.snapshots[id] = &fragmentSnapshot{fragment: fragment, schema: *t.schema, rows: t.Snapshot(),
+		expires: now.Add(n.snapshotLease)}
+	*reply = "0 " + id
+}
+
+// RPCScanSnapshot returns at most limit rows of a snapshot starting from the offset-th row, together with the schema
+// of the fragment, as RPCScanFragment does for the fragment itself, and renews the lease of the snapshot. The scan
+// goes on from where the previous one of the snapshot stopped, so that a snapshot read batch by batch is iterated
+// once; it only starts again from the first row if the offset is not where the previous scan stopped, e.g., because
+// its reply was lost and the batch is asked again. A dataset with an empty table name is returned if the snapshot
+// does not exist (anymore), or its store has failed.
+func (n *Node) RPCScanSnapshot(args ScanSnapshotArgs, dataset *Dataset) {
+	defer n.admit()()
+	id := args.Snapshot
+	offset := args.Offset
+	limit := args.Limit
+
+	// a snapshot of a dropped fragment may not be readable anymore
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	n.snapshotMu.Lock()
+	now := time.Now()
+	n.expireSnapshots(now)
+	snapshot, ok := n.snapshots[id]
+	if ok {
+		snapshot.expires = now.Add(n.snapshotLease)
+	}
+	n.snapshotMu.Unlock()
+	if !ok {
+		*dataset = Dataset{}
+		return
+	}
+	snapshot.mu.Lock()
+	defer snapshot.mu.Unlock()
+	if snapshot.cursor == nil || snapshot.position != offset {
+		snapshot.cursor = n.scanIterator(snapshot.rows.iterator())
+		snapshot.position = 0
+		for snapshot.position < offset && snapshot.cursor.HasNext() {
+			snapshot.cursor.Next()
+			snapshot.position++
+		}
+	}
+	result := Dataset{Schema: snapshot.schema, Rows: make([]Row, 0)}
+	for len(result.Rows) < limit && snapshot.cursor.HasNext() {
+		result.Rows = append(result.Rows, *snapshot.cursor.Next())
+		snapshot.position++
+	}
+	if s, ok := snapshot.rows.(failingStore); ok && s.Err() != nil {
+		*dataset = Dataset{}
+		return
+	}
+	result.Rows = maskRows(result.Schema, result.Rows, args.Masks)
+	*dataset = result
+}
+
+// RPCReleaseSnapshot releases a snapshot taken by RPCSnapshotFragment.
+func (n *Node) RPCReleaseSnapshot(args ReleaseSnapshotArgs, reply *string) {
+	defer n.admit()()
+	n.snapshotMu.Lock()
+	defer n.snapshotMu.Unlock()
+	delete(n.snapshots, args.Snapshot)
+	*reply = "0 OK"
+}
+
+// RPCSetSnapshotLease sets how long the snapshots which are not scanned are kept, see RPCSnapshotFragment, those not
+// scanned for longer than that being released.
+func (n *Node) RPCSetSnapshotLease(lease time.Duration, reply *string) {
+	n.snapshotMu.Lock()
+	defer n.snapshotMu.Unlock()
+	now := time.Now()
+	for _, snapshot := range n.snapshots {
+		snapshot.expires = snapshot.expires.Add(lease - n.snapshotLease)
+	}
+	n.snapshotLease = lease
+	n.expireSnapshots(now)
+	*reply = "0 OK"
+}
+
+// expireSnapshots releases the snapshots whose lease has expired by now. The caller must hold snapshotMu.
+func (n *Node) expireSnapshots(now time.Time) {
+	for id, snapshot := range n.snapshots {
+		if !now.Before(snapshot.expires) {
+			delete(n.snapshots, id)
+		}
+	}
+}
+
+// releaseSnapshots releases the snapshots of a fragment, e.g., because the fragment is dropped.
+func (n *Node) releaseSnapshots(fragment string) {
+	n.snapshotMu.Lock()
+	defer n.snapshotMu.Unlock()
+	for id, snapshot := range n.snapshots {
+		if snapshot.fragment == fragment {
+			delete(n.snapshots, id)
+		}
+	}
+}
+
+// readFragment reads a whole fragment with its id column through end. A fragment fitting in a batch is read by a
+// single RPC, while a larger one is read batch by batch from a snapshot, so that the writes made meanwhile neither
+// shift the batches nor show up in some of them only. The nodes mask the columns of the masks, if any, see
+// Cluster.MaskColumn.
+func readFragment(end *nodeClient, fragment string, masks map[string]ColumnMask) (Dataset, bool) {
+	result := Dataset{}
+	ok := streamFragment(end, fragment, masks, scanBatchSize, func(batch Dataset) bool {
+		result.Schema = batch.Schema
+		result.Rows = append(result.Rows, batch.Rows...)
+		return true
+	})
+	if !ok {
+		return Dataset{}, false
+	}
+	return result, true
+}
+
+// streamFragment reads a whole fragment as readFragment does, in batches of at most batchSize rows, and hands each
+// batch to emit as soon as it arrives instead of collecting them. It returns false if the fragment could not be read
+// completely, or emit returned false, in which case the batches handed so far are only a part of the fragment.
+func streamFragment(end *nodeClient, fragment string, masks map[string]ColumnMask, batchSize int,
+	emit func(Dataset) bool) bool {
+	first := Dataset{}
+	args := ScanFragmentArgs{Fragment: fragment, Limit: batchSize, Masks: masks}
+	if ok := end.Call("Node.RPCScanFragment", args, &first); !ok ||
+		first.Schema.TableName == "" {
+		return false
+	}
+	if len(first.Rows) < batchSize {
+		return emit(first)
+	}
+
+	reply := ""
+	if ok := end.Call("Node.RPCSnapshotFragment", FragmentArgs{Fragment: fragment}, &reply); !ok || reply[0] != '0' {
+		return false
+	}
+	id := reply[2:]
+	defer end.Call("Node.RPCReleaseSnapshot", ReleaseSnapshotArgs{Snapshot: id}, &reply)
+	for offset := 0; ; offset += batchSize {
+		batch := Dataset{}
+		ok := end.Call("Node.RPCScanSnapshot", ScanSnapshotArgs{Snapshot: id, Offset: offset, Limit: batchSize,
+			Masks: masks}, &batch)
+		if !ok || batch.Schema.TableName == "" || !emit(batch) {
+			return false
+		}
+		if len(batch.Rows) < batchSize {
+			return true
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// checkRows checks that the rows iterated are rows i for each i in expected.
+func checkRows(t *testing.T, rows RowIterable, expected []int) {
+	row := func(i int) Row { return Row{i, "row" + strconv.Itoa(i)} }
+	actual := make([]Row, 0)
+	for iter := rows.iterator(); iter.HasNext(); {
+		actual = append(actual, *iter.Next())
+	}
+	if rows.count() != len(expected) || len(actual) != len(expected) {
+		t.Fatalf("expected %v rows, actual %v (count %v)", len(expected), actual, rows.count())
+	}
+	for i, j := range expected {
+		if r := row(j); !actual[i].Equals(&r) {
+			t.Errorf("expected %v, actual %v", r, actual[i])
+		}
+	}
+}
+
+// testSnapshots writes a store after taking a snapshot of it, enough to compact a SnapshotRowStore
+func testSnapshots(t *testing.T, s RowStore) {
+	row := func(i int) *Row { return &Row{i, "row" + strconv.Itoa(i)} }
+	before := make([]int, 0)
+	for i := 0; i < 200; i++ {
+		s.insert(row(i))
+		before = append(before, i)
+	}
+	snapshot := s.(snapshotter).snapshot()
+
+	after := make([]int, 0)
+	for i := 0; i < 200; i++ {
+		if i%4 != 0 {
+			s.remove(row(i))
+		} else {
+			after = append(after, i)
+		}
+	}
+	for i := 200; i < 210; i++ {
+		s.insert(row(i))
+		after = append(after, i)
+	}
+	checkRows(t, snapshot, before)
+	checkRows(t, s, after)
+
+	// a snapshot taken later sees the writes made before it only
+	later := s.(snapshotter).snapshot()
+	s.remove(row(0))
+	s.insert(row(300))
+	checkRows(t, later, after)
+	checkRows(t, snapshot, before)
+}
+
+func TestSnapshotRowStore(t *testing.T) {
+	testSnapshots(t, NewSnapshotRowStore())
+}
+
+func TestDiskRowStoreSnapshot(t *testing.T) {
+	s, err := NewDiskRowStore(t.TempDir(), 16, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testSnapshots(t, s)
+}
+
+// a snapshot of a fragment is not changed by the writes made while it is scanned
+func TestSnapshotFragment(t *testing.T) {
+	setupLab3()
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0": rangeFragment("sid", ">=", 0, "sid", "name", "age", "grade"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules}, &reply)
+	for i := 0; i < 2*scanBatchSize; i++ {
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{i, "s" + strconv.Itoa(i), 20, 3.0}},
+			&reply)
+	}
+
+	end := c.nodeEnd("Node0")
+	fragment := studentTableName + "|0"
+	end.Call("Node.RPCSnapshotFragment", FragmentArgs{Fragment: fragment}, &reply)
+	if reply[0] != '0' {
+		t.Fatalf("cannot take a snapshot: %v", reply)
+	}
+	snapshot := reply[2:]
+	for i := 0; i < 10; i++ {
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{1000 + i, "new", 20, 3.0}}, &reply)
+	}
+	scanned := 0
+	for offset := 0; ; offset += scanBatchSize {
+		batch := Dataset{}
+		end.Call("Node.RPCScanSnapshot", ScanSnapshotArgs{Snapshot: snapshot, Offset: offset, Limit: scanBatchSize},
+			&batch)
+		if batch.Schema.TableName != fragment {
+			t.Fatalf("cannot scan the snapshot, actual %v", batch.Schema)
+		}
+		scanned += len(batch.Rows)
+		if len(batch.Rows) < scanBatchSize {
+			break
+		}
+	}
+	if scanned != 2*scanBatchSize {
+		t.Errorf("expected %v rows in the snapshot, actual %v", 2*scanBatchSize, scanned)
+	}
+
+	// the fragment itself is read through a snapshot too, as it does not fit in a batch
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{studentTableName, QueryHints{DisableCache: true}}, &result)
+	if len(result.Rows) != 2*scanBatchSize+10 {
+		t.Errorf("expected %v rows, actual %v", 2*scanBatchSize+10, len(result.Rows))
+	}
+
+	end.Call("Node.RPCReleaseSnapshot", ReleaseSnapshotArgs{Snapshot: snapshot}, &reply)
+	batch := Dataset{}
+	end.Call("Node.RPCScanSnapshot", ScanSnapshotArgs{Snapshot: snapshot, Limit: scanBatchSize}, &batch)
+	if batch.Schema.TableName != "" {
+		t.Errorf("a released snapshot should not be scanned")
+	}
+}
+
+// a snapshot is scanned from where the previous scan stopped, and released once it is not scanned for its lease
+func TestSnapshotLease(t *testing.T) {
+	setupLab3()
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0": rangeFragment("sid", ">=", 0, "sid", "name", "age", "grade"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules}, &reply)
+	for i := 0; i < 10; i++ {
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{i, "s" + strconv.Itoa(i), 20, 3.0}},
+			&reply)
+	}
+	end := c.nodeEnd("Node0")
+	end.Call("Node.RPCSetSnapshotLease", 300*time.Millisecond, &reply)
+	end.Call("Node.RPCSnapshotFragment", FragmentArgs{Fragment: studentTableName + "|0"}, &reply)
+	if reply[0] != '0' {
+		t.Fatalf("cannot take a snapshot: %v", reply)
+	}
+	snapshot := reply[2:]
+	scan := func(offset int) Dataset {
+		batch := Dataset{}
+		end.Call("Node.RPCScanSnapshot", ScanSnapshotArgs{Snapshot: snapshot, Offset: offset, Limit: 4}, &batch)
+		return batch
+	}
+
+	first, second := scan(0), scan(4)
+	if len(first.Rows) != 4 || len(second.Rows) != 4 || first.Rows[0].Equals(&second.Rows[0]) {
+		t.Fatalf("expected two batches of 4 rows, actual %v and %v", first.Rows, second.Rows)
+	}
+	// a batch asked again is the same
+	if again := scan(4); len(again.Rows) != 4 || !again.Rows[0].Equals(&second.Rows[0]) {
+		t.Errorf("expected %v again, actual %v", second.Rows, again.Rows)
+	}
+
+	// each scan renews the lease
+	time.Sleep(150 * time.Millisecond)
+	if last := scan(8); len(last.Rows) != 2 {
+		t.Errorf("expected the 2 rows left, actual %v", last.Rows)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if batch := scan(10); batch.Schema.TableName == "" || len(batch.Rows) != 0 {
+		t.Errorf("expected the snapshot to be kept while it is scanned, actual %v", batch)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if batch := scan(10); batch.Schema.TableName != "" {
+		t.Errorf("expected the snapshot to be released once its lease expired, actual %v", batch)
+	}
+}
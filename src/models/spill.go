@@ -0,0 +1,271 @@
+package models
+
+import (
+	"bufio"
+	"errors"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"../labgob"
+)
+
+// rowSource hands the rows of one side of a join to emit batch by batch, stopping at the first error emit returns. It
+// returns that error, or an error of its own if it cannot read all rows.
+type rowSource func(emit func([]Row) error) error
+
+// errIncompleteTable is returned by the source of a table some fragment of which could only be read in part.
+var errIncompleteTable = errors.New("the table could not be read completely")
+
+// sliceSource returns a source handing the rows, already in memory, in a single batch.
+func sliceSource(rows []Row) rowSource {
+	return func(emit func([]Row) error) error {
+		return emit(rows)
+	}
+}
+
+// spillJoin joins two tables at the coordinator by graceHashJoin if the rows the coordinator records for them exceed
+// the memory budget of the hints, merging each matching pair with merge. The rows are streamed from the fragments
+// into the partition files batch by batch (see tableSource), so that they are never all held by the coordinator. It
+// returns the joined rows and the most rows of the tables held in memory at once, or false if the tables fit in the
+// budget or cannot be spilled, in which case they should be joined in memory.
+func (c *Cluster) spillJoin(q *queryContext, tableName1 string, tableName2 string, table1_columns []ColumnSchema,
+	table2_columns []ColumnSchema, same_columns1 []int, same_columns2 []int, merge func(Row, Row) Row) ([]Row, int,
+	bool) {
+	budget := q.hints.MemoryBudget
+	size := len(q.catalog.Ids(tableName1)) + len(q.catalog.Ids(tableName2))
+	if budget <= 0 || size <= budget {
+		return nil, 0, false
+	}
+	rows, peak, err := graceHashJoin(c.tableSource(q, tableName1, table1_columns, budget),
+		c.tableSource(q, tableName2, table2_columns, budget), same_columns1, same_columns2, size, budget, merge)
+	return rows, peak, err == nil
+}
+
+// spillRows is spillJoin for rows already pulled to the coordinator, e.g., the intermediate results of a join of
+// several tables.
+func spillRows(q *queryContext, rows1 []Row, rows2 []Row, same_columns1 []int, same_columns2 []int,
+	merge func(Row, Row) Row) ([]Row, bool) {
+	budget := q.hints.MemoryBudget
+	if budget <= 0 || len(rows1)+len(rows2) <= budget {
+		return nil, false
+	}
+	rows, _, err := graceHashJoin(sliceSource(rows1), sliceSource(rows2), same_columns1, same_columns2,
+		len(rows1)+len(rows2), budget, merge)
+	return rows, err == nil
+}
+
+// tableSource returns a source reading the rows of a table in batches of at most batchSize rows, each row following
+// fullSchema and satisfying the Where hint of the query, each fragment being read from the first replica that answers.
+// A table whose fragments do not all hold every column is read whole by getTableRows instead, its rows having to be
+// reassembled. The source fails if a replica stops answering in the middle of a fragment, the rows of the fragment
+// handed so far being only a part of it.
+func (c *Cluster) tableSource(q *queryContext, tableName string, fullSchema []ColumnSchema, batchSize int) rowSource {
+	for _, fragment := range q.placement.Fragments(tableName) {
+		if len(q.placement.Rule(fragment).Column) < len(fullSchema) || q.hints.AsOf != 0 {
+			return sliceSource(getTableRows(c, q, tableName, fullSchema))
+		}
+	}
+	return func(emit func([]Row) error) error {
+		ids := make(map[string]bool)
+		for _, id := range q.catalog.Ids(tableName) {
+			ids[id] = true
+		}
+		for _, fragment := range q.placement.Fragments(tableName) {
+			if q.prunes(tableName, fragment) {
+				continue
+			}
+			read := false
+			for _, nodeId := range c.readOrder(q.placement.Replicas(fragment)) {
+				emitted := false
+				var err error
+				read = streamFragment(c.nodeEnd(nodeId), fragment, q.columnMasks(tableName), batchSize,
+					func(batch Dataset) bool {
+						emitted = true
+						err = emit(tableBatch(q, tableName, fullSchema, batch, ids))
+						return err == nil
+					})
+				if err != nil {
+					return err
+				}
+				if read {
+					break
+				}
+				if emitted {
+					return errIncompleteTable
+				}
+			}
+			if !read {
+				q.markUnavailable(fragment)
+			}
+		}
+		return nil
+	}
+}
+
+// tableBatch returns the rows of a batch of a fragment holding every column of a table which belong to the table (the
+// ids of which are given) and satisfy the Where hint of the query, each row following fullSchema.
+func tableBatch(q *queryContext, tableName string, fullSchema []ColumnSchema, batch Dataset,
+	ids map[string]bool) []Row {
+	positions := make(map[string]int)
+	for j, cs := range batch.Schema.ColumnSchemas {
+		positions[cs.Name] = j
+	}
+	rows := make([]Row, 0, len(batch.Rows))
+	for _, line := range batch.Rows {
+		if !ids[line[0].(string)] {
+			continue
+		}
+		row := make(Row, len(fullSchema))
+		for i, cs := range fullSchema {
+			row[i] = line[positions[cs.Name]]
+		}
+		rows = append(rows, row)
+	}
+	rows, _ = q.filterRows(tableName, fullSchema, rows, nil)
+	return rows
+}
+
+// graceHashJoin partitions both sides of a join by the hash of their common columns into temporary files, so that
+// each partition holds about budget of the size rows of both sides, then joins the partitions one after another with
+// an in-memory hash table. Rows can only match rows of the same partition, so at most a batch of a source, or one
+// partition of each side, is held in memory besides the joined rows. A partition may still exceed the budget if many
+// rows share the same common values. It also returns the most rows of the sides held in memory at once.
+func graceHashJoin(source1 rowSource, source2 rowSource, same_columns1 []int, same_columns2 []int, size int,
+	budget int, merge func(Row, Row) Row) ([]Row, int, error) {
+	dir, err := ioutil.TempDir("", "join-spill")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	partitions := size/budget + 1
+	peak := 0
+	files1, err := spillPartitions(filepath.Join(dir, "left"), source1, same_columns1, partitions, &peak)
+	if err != nil {
+		return nil, 0, err
+	}
+	files2, err := spillPartitions(filepath.Join(dir, "right"), source2, same_columns2, partitions, &peak)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result_rows := make([]Row, 0)
+	for p := 0; p < partitions; p++ {
+		right, err := readPartition(files2[p])
+		if err != nil {
+			return nil, 0, err
+		}
+		table := make(map[string][]Row)
+		for _, row := range right {
+			key := joinKey(row, same_columns2)
+			table[key] = append(table[key], row)
+		}
+		left, err := readPartition(files1[p])
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(left)+len(right) > peak {
+			peak = len(left) + len(right)
+		}
+		for _, row1 := range left {
+			for _, row2 := range table[joinKey(row1, same_columns1)] {
+				if rowsMatch(row1, row2, same_columns1, same_columns2) {
+					result_rows = append(result_rows, merge(row1, row2))
+				}
+			}
+		}
+	}
+	return result_rows, peak, nil
+}
+
+// spillPartitions writes the rows of the source into n files named prefix0, prefix1, ..., a row goes to the file
+// chosen by the hash of its key columns. The names of the files are returned, and peak is raised to the largest batch
+// of the source.
+func spillPartitions(prefix string, source rowSource, keyColumns []int, n int, peak *int) ([]string, error) {
+	names := make([]string, n)
+	files := make([]*os.File, n)
+	writers := make([]*bufio.Writer, n)
+	encoders := make([]*labgob.LabEncoder, n)
+	defer func() {
+		for _, file := range files {
+			if file != nil {
+				file.Close()
+			}
+		}
+	}()
+	for i := range files {
+		names[i] = prefix + strconv.Itoa(i)
+		file, err := os.Create(names[i])
+		if err != nil {
+			return nil, err
+		}
+		files[i] = file
+		writers[i] = bufio.NewWriter(file)
+		encoders[i] = labgob.NewEncoder(writers[i])
+	}
+	err := source(func(rows []Row) error {
+		if len(rows) > *peak {
+			*peak = len(rows)
+		}
+		for _, row := range rows {
+			h := fnv.New32a()
+			h.Write([]byte(joinKey(row, keyColumns)))
+			if err := encoders[h.Sum32()%uint32(n)].Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, writer := range writers {
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// readPartition reads the rows written by spillPartitions into a file.
+func readPartition(path string) ([]Row, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := labgob.NewDecoder(bufio.NewReader(file))
+	rows := make([]Row, 0)
+	for {
+		row := Row{}
+		if err := decoder.Decode(&row); err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+// joinKey returns the values of the key columns of a row as a string, rows with the same values have the same key.
+func joinKey(row Row, keyColumns []int) string {
+	key := make(Row, len(keyColumns))
+	for i, index := range keyColumns {
+		key[i] = row[index]
+	}
+	return keyString(key)
+}
+
+// rowsMatch tells whether two rows agree on the common columns, in the way of matchRows.
+func rowsMatch(row1 Row, row2 Row, same_columns1 []int, same_columns2 []int) bool {
+	for k := range same_columns1 {
+		if row1[same_columns1[k]] != row2[same_columns2[k]] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGraceHashJoin(t *testing.T) {
+	rows1 := make([]Row, 0)
+	rows2 := make([]Row, 0)
+	for i := 0; i < 200; i++ {
+		rows1 = append(rows1, Row{i % 50, "name", nil})
+		rows2 = append(rows2, Row{i % 30, i})
+	}
+	merge := func(row1 Row, row2 Row) Row { return mergeRows(row1, row2, []int{0}) }
+	expected := joinAtCoordinator(rows1, rows2, []int{0}, []int{0}, true)
+	actual, peak, err := graceHashJoin(sliceSource(rows1), sliceSource(rows2), []int{0}, []int{0}, 400, 16, merge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peak != 200 {
+		t.Errorf("expected a whole side held at once, actual %v rows", peak)
+	}
+	if !compareRows(expected, actual, []int{0, 1, 2, 3}) {
+		t.Errorf("the spilled join differs from the in-memory join, expected %v rows, actual %v", len(expected),
+			len(actual))
+	}
+}
+
+// the rows of the tables are streamed into the partitions, never being all held by the coordinator
+func TestSpillJoinStreams(t *testing.T) {
+	setupLab3()
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"2":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	buildTablesLab3(cli)
+	reply := ""
+	for i := 0; i < 200; i++ {
+		cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{i, "name", 20, float64(i%5) + 0.5}},
+			&reply)
+		cli.Call("Cluster.FragmentWrite", []interface{}{courseRegistrationTableName, Row{i % 100, i}}, &reply)
+	}
+
+	budget := 20
+	q := c.beginQuery(QueryHints{MemoryBudget: budget})
+	defer c.endQuery(q)
+	schema1, _ := q.catalog.Schema(studentTableName)
+	schema2, _ := q.catalog.Schema(courseRegistrationTableName)
+	columns := make([]ColumnSchema, 0)
+	same_columns1, same_columns2 := make([]int, 0), make([]int, 0)
+	createJoinSchema([]interface{}{schema1.ColumnSchemas, schema2.ColumnSchemas}, &columns, &same_columns1,
+		&same_columns2)
+	rows, peak, ok := c.spillJoin(q, studentTableName, courseRegistrationTableName, schema1.ColumnSchemas,
+		schema2.ColumnSchemas, same_columns1, same_columns2, func(row1 Row, row2 Row) Row {
+			return mergeRows(row1, row2, same_columns2)
+		})
+	if !ok {
+		t.Fatalf("expected the join to be spilled")
+	}
+	expected := joinAtCoordinator(getTableRows(c, q, studentTableName, schema1.ColumnSchemas),
+		getTableRows(c, q, courseRegistrationTableName, schema2.ColumnSchemas), same_columns1, same_columns2, true)
+	if len(rows) != 200 || !compareRows(expected, rows, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("the spilled join differs from the in-memory join, expected %v rows, actual %v", len(expected),
+			len(rows))
+	}
+	// a batch of a fragment, or a partition of each side, but never the 400 rows
+	if peak > 4*budget {
+		t.Errorf("expected at most %v rows held at once, actual %v", 4*budget, peak)
+	}
+}
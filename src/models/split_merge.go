@@ -0,0 +1,316 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// SplitFragment splits a horizontal fragment into two by a range of a column: the rows whose value of the column is
+// at most the given value stay in the fragment, and the others are moved to a new fragment with the same columns and
+// replicas. The column must be one of the columns of the fragment. Rows having null in the column would satisfy
+// neither range, so the split is refused while the fragment holds some.
+// Writes and queries continue while the rows are being copied, only the final catch-up blocks writes for a moment.
+// The reply is "0 <new fragment>" if the split succeeds, or "1 <reason>" otherwise, in which case the fragment is left
+// as it was.
+// params: fragment string, column string, value interface{}
+func (c *Cluster) SplitFragment(params []interface{}, reply *string) {
+	fragment := params[0].(string)
+	column := params[1].(string)
+	value := predicateValue(params[2])
+
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+
+	placement := c.currentPlacement()
+	rule, ok := placement.FragmentRules[fragment]
+	if !ok {
+		c.writeMu.Unlock()
+		if err := placement.renamedError(fragmentTable(fragment)); err != "" {
+			*reply = "1 " + err
+		} else {
+			*reply = "1 no such fragment"
+		}
+		return
+	}
+	held := false
+	for _, name := range rule.Column {
+		held = held || name == column
+	}
+	if !held {
+		c.writeMu.Unlock()
+		*reply = "1 " + column + " is not a column of " + fragment
+		return
+	}
+	tableName := fragmentTable(fragment)
+	fullSchema := c.fullSchema(tableName)
+	low := Rule{Predicate: addAtom(rule.Predicate, column, Atom{Op: "<=", Val: value}), Column: rule.Column,
+		Constraints: rule.Constraints}
+	high := Rule{Predicate: addAtom(rule.Predicate, column, Atom{Op: ">", Val: value}), Column: rule.Column,
+		Constraints: rule.Constraints}
+
+	// the new fragment is created empty and installed first, from then on the rows written into the upper range are
+	// written into both fragments, while the existing rows are copied
+	newFragment := tableName + "|" + strconv.Itoa(c.catalog.Num(tableName))
+	replicas := placement.Replicas(fragment)
+	if len(replicas) == 0 {
+		c.writeMu.Unlock()
+		*reply = "1 no replica of " + fragment
+		return
+	}
+	if err := c.createFragment(newFragment, high, fullSchema, replicas); err != nil {
+		c.writeMu.Unlock()
+		*reply = "1 " + err.Error()
+		return
+	}
+	c.catalog.IncrementNum(tableName)
+	next := placement.clone()
+	next.FragmentRules[newFragment] = high
+	next.FragmentNodes[newFragment] = append([]string(nil), replicas...)
+	c.installPlacement(next)
+	c.writeMu.Unlock()
+
+	offset, ok := c.copyRows(fragment, replicas[0], newFragment, replicas, 0)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if ok {
+		_, ok = c.copyRows(fragment, replicas[0], newFragment, replicas, offset)
+	}
+	moved, listed := c.fragmentIds(replicas[0], newFragment)
+	if !ok || !listed {
+		c.removeFragment(newFragment)
+		*reply = "1 cannot copy rows of " + fragment
+		return
+	}
+	// checked while the writes are blocked, so that no row with null is written before the fragment is narrowed
+	if nulls, ok := c.holdsNull(replicas[0], fragment, column); nulls || !ok {
+		c.removeFragment(newFragment)
+		*reply = "1 " + column + " is null in some rows of " + fragment
+		return
+	}
+	for _, id := range moved {
+		for _, nodeId := range replicas {
+			c.rowIndex.Add(tableName, id, RowLocation{NodeId: nodeId, Fragment: newFragment})
+		}
+	}
+
+	// queries starting from now on read the moved rows from the new fragment only, the moved rows are removed from the
+	// old fragment once the queries that may still read them there finish
+	next = c.currentPlacement().clone()
+	next.FragmentRules[fragment] = low
+	c.installPlacement(next)
+	c.waitForReaders(next.Epoch)
+	for _, nodeId := range replicas {
+		msg := ""
+		c.nodeEnd(nodeId).Call("Node.RPCSetPredicate", SetPredicateArgs{Fragment: fragment, Predicate: low.Predicate,
+			FullSchema: fullSchema}, &msg)
+	}
+	for _, id := range moved {
+		for _, nodeId := range replicas {
+			c.rowIndex.RemoveLocation(tableName, id, RowLocation{NodeId: nodeId, Fragment: fragment})
+		}
+	}
+	c.fragmentVersions[fragment]++
+	*reply = "0 " + newFragment
+}
+
+// MergeFragments merges two fragments of a table into the first one. The fragments must have the same columns, and
+// predicates that only differ by complementary ranges of one column, e.g., two fragments split by SplitFragment.
+// Like SplitFragment, writes and queries continue while the rows are being copied.
+// The reply is "0 OK" if the merge succeeds, or "1 <reason>" otherwise.
+// params: fragment1 string, fragment2 string
+func (c *Cluster) MergeFragments(params []interface{}, reply *string) {
+	fragment1 := params[0].(string)
+	fragment2 := params[1].(string)
+
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+
+	placement := c.currentPlacement()
+	rule1, ok1 := placement.FragmentRules[fragment1]
+	rule2, ok2 := placement.FragmentRules[fragment2]
+	if !ok1 || !ok2 || fragment1 == fragment2 || fragmentTable(fragment1) != fragmentTable(fragment2) {
+		c.writeMu.Unlock()
+		if err := placement.renamedError(fragmentTable(fragment1)); err != "" {
+			*reply = "1 " + err
+		} else {
+			*reply = "1 no such fragments"
+		}
+		return
+	}
+	merged, ok := mergePredicates(rule1.Predicate, rule2.Predicate)
+	if !ok || !reflect.DeepEqual(rule1.Column, rule2.Column) {
+		c.writeMu.Unlock()
+		*reply = "1 fragments cannot be merged"
+		return
+	}
+	tableName := fragmentTable(fragment1)
+	fullSchema := c.fullSchema(tableName)
+	replicas1, replicas2 := placement.Replicas(fragment1), placement.Replicas(fragment2)
+	if len(replicas1) == 0 || len(replicas2) == 0 {
+		c.writeMu.Unlock()
+		*reply = "1 no replica of the fragments"
+		return
+	}
+
+	// the first fragment is widened first, from then on the rows written into the range of the second fragment are
+	// written into both fragments, while the existing rows are copied
+	for _, nodeId := range replicas1 {
+		msg := ""
+		c.nodeEnd(nodeId).Call("Node.RPCSetPredicate", SetPredicateArgs{Fragment: fragment1, Predicate: merged,
+			FullSchema: fullSchema}, &msg)
+		if len(msg) == 0 || msg[0] != '0' {
+			c.writeMu.Unlock()
+			*reply = "1 cannot widen " + fragment1 + " on " + nodeId
+			return
+		}
+	}
+	next := placement.clone()
+	next.FragmentRules[fragment1] = Rule{Predicate: merged, Column: rule1.Column, Constraints: rule1.Constraints}
+	c.installPlacement(next)
+	c.writeMu.Unlock()
+
+	offset, ok := c.copyRows(fragment2, replicas2[0], fragment1, replicas1, 0)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if ok {
+		_, ok = c.copyRows(fragment2, replicas2[0], fragment1, replicas1, offset)
+	}
+	moved, listed := c.fragmentIds(replicas2[0], fragment2)
+	if !ok || !listed {
+		// the first fragment stays widened, which is harmless as the rows of both fragments are deduplicated by id
+		*reply = "1 cannot copy rows of " + fragment2
+		return
+	}
+	for _, id := range moved {
+		for _, nodeId := range replicas1 {
+			c.rowIndex.Add(tableName, id, RowLocation{NodeId: nodeId, Fragment: fragment1})
+		}
+	}
+	c.removeFragment(fragment2)
+	c.fragmentVersions[fragment1]++
+	*reply = "0 OK"
+}
+
+// holdsNull tells whether some row of a fragment on the node has null in the column, and false if the fragment cannot
+// be read.
+func (c *Cluster) holdsNull(nodeId string, fragment string, column string) (bool, bool) {
+	rows, ok := readFragment(c.nodeEnd(nodeId), fragment, nil)
+	if !ok {
+		return false, false
+	}
+	for j, cs := range rows.Schema.ColumnSchemas {
+		if cs.Name != column {
+			continue
+		}
+		for _, row := range rows.Rows {
+			if row[j] == nil {
+				return true, true
+			}
+		}
+	}
+	return false, true
+}
+
+// createFragment creates an empty fragment on each of the nodes, and drops the created replicas if some node fails.
+func (c *Cluster) createFragment(fragment string, rule Rule, fullSchema TableSchema, nodeIds []string) error {
+	for i, nodeId := range nodeIds {
+		reply := ""
+		c.nodeEnd(nodeId).Call("Node.RPCCreateTable", CreateTableArgs{Schema: *fragmentSchema(fragment, rule,
+			fullSchema), Predicate: rule.Predicate, FullSchema: fullSchema,
+			Storage: c.catalog.Storage(fullSchema.TableName)}, &reply)
+		if len(reply) == 0 || reply[0] != '0' {
+			for _, created := range nodeIds[:i] {
+				msg := ""
+				c.nodeEnd(created).Call("Node.RPCDropTable", FragmentArgs{Fragment: fragment}, &msg)
+			}
+			return errors.New("cannot create " + fragment + " on " + nodeId)
+		}
+	}
+	return nil
+}
+
+// removeFragment uninstalls a fragment, forgets its rows in the row index, and drops its replicas once no query may
+// read them. The caller must hold writeMu.
+func (c *Cluster) removeFragment(fragment string) {
+	next := c.currentPlacement().clone()
+	replicas := next.FragmentNodes[fragment]
+	delete(next.FragmentNodes, fragment)
+	delete(next.FragmentRules, fragment)
+	c.installPlacement(next)
+	c.rowIndex.RemoveFragment(fragmentTable(fragment), fragment)
+	c.waitForReaders(next.Epoch)
+	for _, nodeId := range replicas {
+		reply := ""
+		c.nodeEnd(nodeId).Call("Node.RPCDropTable", FragmentArgs{Fragment: fragment}, &reply)
+	}
+	delete(c.fragmentVersions, fragment)
+}
+
+// predicateValue converts a value given by a client to the form of a value decoded from the JSON rules.
+func predicateValue(value interface{}) interface{} {
+	switch value.(type) {
+	case int, int32, int64, float32, float64:
+		return json.Number(fmt.Sprint(value))
+	}
+	return value
+}
+
+// addAtom returns a copy of the predicate with one more atom on the column.
+func addAtom(predicate Predicate, column string, atom Atom) Predicate {
+	result := make(Predicate, len(predicate)+1)
+	for k, v := range predicate {
+		result[k] = append([]Atom(nil), v...)
+	}
+	result[column] = append(result[column], atom)
+	return result
+}
+
+// complementaryOps are the pairs of operators whose ranges on the same value cover all values without overlapping.
+var complementaryOps = map[string]string{"<=": ">", ">": "<=", "<": ">=", ">=": "<"}
+
+// mergePredicates returns the predicate satisfied by the rows satisfying either p1 or p2, if p2 only differs from p1
+// by the complement of one atom of p1.
+func mergePredicates(p1 Predicate, p2 Predicate) (Predicate, bool) {
+	if len(p1) != len(p2) {
+		return nil, false
+	}
+	merged := make(Predicate, len(p1))
+	differs := false
+	for column, atoms1 := range p1 {
+		atoms2, ok := p2[column]
+		if !ok || len(atoms1) != len(atoms2) {
+			return nil, false
+		}
+		if reflect.DeepEqual(atoms1, atoms2) {
+			merged[column] = atoms1
+			continue
+		}
+		// exactly one atom may differ, and it must be the complement of its counterpart
+		kept := make([]Atom, 0, len(atoms1))
+		diff := -1
+		for i := range atoms1 {
+			if atoms1[i].Op == atoms2[i].Op && fmt.Sprint(atoms1[i].Val) == fmt.Sprint(atoms2[i].Val) &&
+				atoms1[i].Partitioner == atoms2[i].Partitioner && atoms1[i].Partitions == atoms2[i].Partitions {
+				kept = append(kept, atoms1[i])
+			} else if diff < 0 {
+				diff = i
+			} else {
+				return nil, false
+			}
+		}
+		if differs || complementaryOps[atoms1[diff].Op] != atoms2[diff].Op ||
+			fmt.Sprint(atoms1[diff].Val) != fmt.Sprint(atoms2[diff].Val) {
+			return nil, false
+		}
+		differs = true
+		if len(kept) > 0 {
+			merged[column] = kept
+		}
+	}
+	return merged, differs
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// the whole student table starts in one fragment on node0 and node1, which is split by grade and merged back
+func TestSplitAndMergeFragment(t *testing.T) {
+	setupLab3()
+
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"grade": [...]map[string]interface{}{{
+					"op":  ">=",
+					"val": 0,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "name", "age", "grade",
+			},
+		},
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"2": map[string]interface{}{
+			"predicate": map[string]interface{}{
+				"courseId": [...]map[string]interface{}{{
+					"op":  ">=",
+					"val": 0,
+				},
+				},
+			},
+			"column": [...]string{
+				"sid", "courseId",
+			},
+		},
+	})
+
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+	expectedDataset := Dataset{
+		Schema: joinedTableSchema,
+		Rows:   joinedTableContent,
+	}
+	count := func(nodeId string, fragment string) int {
+		cnt := -1
+		c.nodeEnd(nodeId).Call("Node.RPCCountRows", FragmentArgs{Fragment: fragment}, &cnt)
+		return cnt
+	}
+
+	reply := ""
+	cli.Call("Cluster.SplitFragment", []interface{}{studentTableName + "|0", "grade", 3.6}, &reply)
+	if reply != "0 "+studentTableName+"|1" {
+		t.Fatalf("Split failed: %v", reply)
+	}
+	for _, nodeId := range []string{"Node0", "Node1"} {
+		if low, high := count(nodeId, studentTableName+"|0"), count(nodeId, studentTableName+"|1"); low != 1 || high != 2 {
+			t.Errorf("Incorrect split on %v, expected 1 and 2 rows, actual %v and %v", nodeId, low, high)
+		}
+	}
+	results := Dataset{}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &results)
+	if !datasetDuplicateChecking(expectedDataset, results) {
+		t.Errorf("Incorrect join results after splitting, expected %v, actual %v", expectedDataset, results)
+	}
+
+	// a row written after the split goes into the upper fragment only
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Ann", 20, 3.9}}, &reply)
+	if low, high := count("Node0", studentTableName+"|0"), count("Node0", studentTableName+"|1"); low != 1 || high != 3 {
+		t.Errorf("Incorrect write after split, expected 1 and 3 rows, actual %v and %v", low, high)
+	}
+
+	reply = ""
+	cli.Call("Cluster.MergeFragments", []interface{}{studentTableName + "|0", studentTableName + "|1"}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("Merge failed: %v", reply)
+	}
+	if merged := count("Node0", studentTableName+"|0"); merged != 4 {
+		t.Errorf("Incorrect merge, expected 4 rows, actual %v", merged)
+	}
+	if removed := count("Node0", studentTableName+"|1"); removed != -1 {
+		t.Errorf("The merged fragment should be dropped, actual %v rows", removed)
+	}
+	results = Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, c.catalog.Ids(studentTableName)[3]}, &results)
+	if len(results.Rows) != 1 || results.Rows[0][1] != "Ann" {
+		t.Errorf("Incorrect lookup after merging, actual %v", results)
+	}
+
+	reply = ""
+	cli.Call("Cluster.MergeFragments", []interface{}{studentTableName + "|0", courseRegistrationTableName + "|0"}, &reply)
+	if reply[0] != '1' {
+		t.Errorf("Fragments of different tables should not be merged, actual %v", reply)
+	}
+}
+
+// a fragment holding rows with null in the split column is not split, and keeps its rows
+func TestSplitFragmentNull(t *testing.T) {
+	setupLab3()
+	studentTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", ">=", 0, "sid", "name", "age", "grade"),
+	})
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"2": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	buildTablesLab3(cli)
+	insertDataLab3(cli)
+	reply := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Eve", nil, 3.0}}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot write the row: %v", reply)
+	}
+
+	cli.Call("Cluster.SplitFragment", []interface{}{studentTableName + "|0", "age", 22}, &reply)
+	if reply != "1 age is null in some rows of "+studentTableName+"|0" {
+		t.Errorf("expected the split to be refused, actual %v", reply)
+	}
+	if fragments := c.currentPlacement().Fragments(studentTableName); len(fragments) != 1 {
+		t.Errorf("expected the fragment to be left as it was, actual %v", fragments)
+	}
+	if rows := scanRows(studentTableName); len(rows) != 4 {
+		t.Errorf("expected every row to be kept, actual %v", rows)
+	}
+}
@@ -0,0 +1,272 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"../labrpc"
+)
+
+// standbyMisses is how many heartbeats in a row the primary coordinator must miss before a standby takes over.
+const standbyMisses = 3
+
+// CoordinatorState is the metadata a coordinator holds beside the nodes, which a standby copies from the primary, see
+// NewStandby. The rows themselves, and the write-ahead logs of the nodes, are on the nodes and their disks.
+// The catalog and the placement, which grow with the tables, are sent as their changes since the standby copied them
+// last; the rest, which grows with the nodes and the fragments only, is sent in full.
+type CoordinatorState struct {
+	NodeIds []string
+	// the changes of the entries of the tables in the catalog
+	Catalog CatalogChanges
+	// how many writes each fragment has applied
+	FragmentVersions map[string]int
+	// nil if its epoch is the one the standby holds
+	Placement      *Placement
+	NodeResources  map[string]NodeResources
+	NodeLabels     map[string]NodeLabels
+	GossipInterval time.Duration
+}
+
+// StateSince tells a coordinator which of its metadata a standby holds already, see Cluster.CoordinatorState.
+type StateSince struct {
+	// whether the standby holds nothing yet, e.g., at its first heartbeat
+	Full bool
+	// the epoch of the placement and the change of the catalog copied last
+	Epoch  int
+	Change int
+	// how many ids of each table the standby holds
+	IdCounts map[string]int
+}
+
+// CoordinatorState copies the metadata of the coordinator that the standby does not hold yet to reply, a standby
+// tailing the coordinator calls it at each heartbeat.
+func (c *Cluster) CoordinatorState(since StateSince, reply *CoordinatorState) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	change := since.Change
+	if since.Full {
+		change = -1
+	}
+	state := CoordinatorState{NodeIds: append([]string(nil), c.nodeIds...),
+		Catalog: c.catalog.ChangesSince(change, since.IdCounts), FragmentVersions: make(map[string]int),
+		NodeResources: make(map[string]NodeResources), NodeLabels: make(map[string]NodeLabels),
+		GossipInterval: c.gossipInterval}
+	if placement := c.currentPlacement(); since.Full || placement.Epoch != since.Epoch {
+		state.Placement = placement
+	}
+	for fragment, version := range c.fragmentVersions {
+		state.FragmentVersions[fragment] = version
+	}
+	for nodeId, resources := range c.nodeResources {
+		state.NodeResources[nodeId] = resources
+	}
+	for nodeId, labels := range c.nodeLabels {
+		state.NodeLabels[nodeId] = labels
+	}
+	*reply = state
+}
+
+// Standby is a warm standby of a coordinator: it copies the metadata of the primary coordinator at every heartbeat,
+// and takes over the network name of the primary once the primary misses standbyMisses heartbeats in a row, so that
+// the clients connected to the primary keep working with the standby.
+// The metadata is copied in full at the first heartbeat, and as the changes since the previous one afterwards, see
+// CoordinatorState. The writes the primary made after the last heartbeat are recovered from the nodes when the
+// standby takes over: the id index is rebuilt from the rows of the replicas that answer, see
+// rebuildRowIndex. The standby does not tell a crashed primary from an unreachable one, so a primary cut off from its
+// standby must not keep serving.
+type Standby struct {
+	// the coordinator that takes over, which is not in the network until then
+	cluster *Cluster
+	// the name of the primary in the network
+	primary string
+	end     *labrpc.ClientEnd
+	mu      sync.Mutex
+	// how many heartbeats have copied the metadata of the primary
+	syncs int
+	// the epoch of the placement and the change of the catalog of the primary copied last, see StateSince
+	epoch    int
+	change   int
+	promoted bool
+	stopped  bool
+	stop     chan struct{}
+}
+
+// NewStandby starts a standby of a coordinator which heartbeats the coordinator at the given interval. The standby
+// shares the nodes of the primary, and nothing else.
+func NewStandby(primary *Cluster, interval time.Duration) *Standby {
+	name := primary.Name + "/Standby"
+	s := &Standby{cluster: newCoordinatorState(primary.nodeIds, primary.persisters, primary.nodes, primary.network,
+		name), primary: primary.Name, end: primary.network.MakeEnd(name), stop: make(chan struct{})}
+	primary.network.Connect(name, primary.Name)
+	primary.network.Enable(name, true)
+	go s.heartbeatLoop(interval)
+	return s
+}
+
+// Coordinator returns the coordinator of the standby, which serves under the name of the primary once promoted.
+func (s *Standby) Coordinator() *Cluster {
+	return s.cluster
+}
+
+// Syncs returns how many heartbeats have copied the metadata of the primary.
+func (s *Standby) Syncs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.syncs
+}
+
+// Promoted tells whether the standby has taken over the primary.
+func (s *Standby) Promoted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.promoted
+}
+
+// Stop stops the heartbeats of a standby which has not been promoted.
+func (s *Standby) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.promoted && !s.stopped {
+		close(s.stop)
+		s.stopped = true
+	}
+}
+
+func (s *Standby) heartbeatLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	misses := 0
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		since := StateSince{Full: s.Syncs() == 0, Epoch: s.epoch, Change: s.change,
+			IdCounts: s.cluster.catalog.IdCounts()}
+		state := CoordinatorState{}
+		if !s.end.Call("Cluster.CoordinatorState", since, &state) {
+			misses++
+			if misses >= standbyMisses {
+				s.promote()
+				return
+			}
+			continue
+		}
+		misses = 0
+		if state.Placement != nil {
+			s.epoch = state.Placement.Epoch
+		}
+		s.change = state.Catalog.Change
+		s.cluster.restoreState(state)
+		s.mu.Lock()
+		s.syncs++
+		s.mu.Unlock()
+	}
+}
+
+// promote makes the standby serve under the name of the primary, once its metadata is brought up to date with the
+// nodes.
+func (s *Standby) promote() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.promoted = true
+	s.mu.Unlock()
+
+	c := s.cluster
+	c.migrationMu.Lock()
+	c.writeMu.Lock()
+	c.Name = s.primary
+	c.rebuildRowIndex()
+	if c.gossipInterval > 0 {
+		c.publishMetadata(c.currentPlacement())
+	}
+	c.writeMu.Unlock()
+	c.migrationMu.Unlock()
+	c.network.AddServer(s.primary, c.server())
+	c.publish(Event{Type: EventCoordinatorPromoted})
+}
+
+// restoreState brings the metadata of the coordinator up to date with a copy of the metadata of another one, see
+// CoordinatorState, the placement copied taking the next epoch.
+func (c *Cluster) restoreState(state CoordinatorState) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.nodeIds = state.NodeIds
+	c.fragmentVersions = make(map[string]int)
+	for fragment, version := range state.FragmentVersions {
+		c.fragmentVersions[fragment] = version
+	}
+	c.nodeResources = make(map[string]NodeResources)
+	for nodeId, resources := range state.NodeResources {
+		c.nodeResources[nodeId] = resources
+	}
+	c.nodeLabels = make(map[string]NodeLabels)
+	for nodeId, labels := range state.NodeLabels {
+		c.nodeLabels[nodeId] = labels
+	}
+	c.gossipInterval = state.GossipInterval
+	// the maps decoded empty are nil, which the clone makes again. The placement is not published to the nodes, the
+	// standby not being a coordinator yet.
+	c.placement.mu.Lock()
+	c.catalog.ApplyChanges(state.Catalog)
+	if state.Placement != nil {
+		c.placement.current = state.Placement.clone()
+	}
+	c.placement.mu.Unlock()
+}
+
+// rebuildRowIndex rebuilds the id index of every table from the rows of the replicas that answer, the rows written
+// since the metadata was copied being appended to the ids of their tables. The caller must hold writeMu.
+func (c *Cluster) rebuildRowIndex() {
+	placement := c.currentPlacement()
+	c.rowIndex = NewRowIndex()
+	catalog := c.catalog.Snapshot()
+	for _, tableName := range catalog.TableNames() {
+		key, keyed := catalog.Key(tableName)
+		stored := make(map[string]bool)
+		added := make([]string, 0)
+		known := make(map[string]bool, len(catalog.Ids(tableName)))
+		for _, id := range catalog.Ids(tableName) {
+			known[id] = true
+		}
+		for _, fragment := range placement.Fragments(tableName) {
+			for _, nodeId := range placement.Replicas(fragment) {
+				dataset, ok := readFragment(c.nodeEnd(nodeId), fragment, nil)
+				if !ok {
+					continue
+				}
+				position := -1
+				for i, cs := range dataset.Schema.ColumnSchemas {
+					if keyed && cs.Name == key {
+						position = i
+					}
+				}
+				for _, row := range dataset.Rows {
+					id := row[0].(string)
+					c.rowIndex.Add(tableName, id, RowLocation{NodeId: nodeId, Fragment: fragment})
+					if position >= 0 {
+						c.rowIndex.SetKey(tableName, row[position], id)
+					}
+					if !stored[id] && !known[id] {
+						added = append(added, id)
+					}
+					stored[id] = true
+				}
+			}
+		}
+		ids := make([]string, 0, len(stored))
+		for _, id := range catalog.Ids(tableName) {
+			if stored[id] {
+				ids = append(ids, id)
+			}
+		}
+		c.catalog.SetIds(tableName, append(ids, added...))
+	}
+	c.rowCache = NewRowCache(defaultRowCacheCapacity)
+}
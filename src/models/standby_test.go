@@ -0,0 +1,131 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// waitFor polls the condition until it holds, failing the test if it does not within a few seconds.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStandbyFailover(t *testing.T) {
+	setupSoftDelete(0)
+	standby := NewStandby(c, 10*time.Millisecond)
+	defer standby.Stop()
+	waitFor(t, "the first heartbeat", func() bool { return standby.Syncs() > 0 })
+	s := standby.Coordinator().Subscribe(1, EventCoordinatorPromoted)
+	defer s.Close()
+
+	// the row written last may not have been copied by a heartbeat
+	reply := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Eve", 20, 3.0}}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("FragmentWrite failed: %v", reply)
+	}
+	network.DeleteServer(c.Name)
+	waitFor(t, "the standby to take over", standby.Promoted)
+	if event := nextEvent(t, s); event.Coordinator != c.Name {
+		t.Errorf("expected the standby to serve as %v, actual %v", c.Name, event)
+	}
+
+	// the client keeps using the name of the primary
+	result := Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 3}, &result)
+	if len(result.Rows) != 1 || result.Rows[0][1] != "Eve" {
+		t.Errorf("expected the row written before the crash, actual %v", result)
+	}
+	if rows := scanRows(studentTableName); len(rows) != 4 {
+		t.Errorf("expected 4 rows, actual %v", rows)
+	}
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{0, "Eve", 20, 3.0}}, &reply)
+	if reply != "1 Duplicate Key" {
+		t.Errorf("the keys should be known by the standby, actual %v", reply)
+	}
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"name": {{Op: "==", Val: "Eve"}}}}, &reply)
+	if reply != "0 1" {
+		t.Errorf("expected the row to be deleted, actual %v", reply)
+	}
+	cli.Call("Cluster.Join", []string{studentTableName, courseRegistrationTableName}, &result)
+	if !datasetDuplicateChecking(Dataset{Schema: joinedTableSchema, Rows: joinedTableContent}, result) {
+		t.Errorf("unexpected join results %v", result)
+	}
+	cli.Call("Cluster.RestartNode", "Node2", &reply)
+	if reply != "0 OK" {
+		t.Errorf("the standby should manage the nodes, actual %v", reply)
+	}
+}
+
+// a stopped standby does not take over
+func TestStandbyStop(t *testing.T) {
+	setupSoftDelete(0)
+	standby := NewStandby(c, 5*time.Millisecond)
+	waitFor(t, "the first heartbeat", func() bool { return standby.Syncs() > 0 })
+	standby.Stop()
+	network.DeleteServer(c.Name)
+	time.Sleep(10 * standbyMisses * 5 * time.Millisecond)
+	if standby.Promoted() {
+		t.Errorf("a stopped standby should not take over")
+	}
+}
+
+// the heartbeats after the first one send the changes of the metadata only
+func TestCoordinatorStateChanges(t *testing.T) {
+	setupSoftDelete(0)
+	full := CoordinatorState{}
+	cli.Call("Cluster.CoordinatorState", StateSince{Full: true}, &full)
+	if full.Placement == nil || len(full.Catalog.Tables) != 2 {
+		t.Fatalf("expected the whole metadata, actual %v", full)
+	}
+	since := StateSince{Epoch: full.Placement.Epoch, Change: full.Catalog.Change,
+		IdCounts: map[string]int{studentTableName: len(full.Catalog.Tables[studentTableName].Ids),
+			courseRegistrationTableName: len(full.Catalog.Tables[courseRegistrationTableName].Ids)}}
+
+	reply := ""
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{3, "Eve", 20, 3.0}}, &reply)
+	state := CoordinatorState{}
+	cli.Call("Cluster.CoordinatorState", since, &state)
+	if state.Placement != nil || len(state.Catalog.Tables) != 0 || len(state.Catalog.AddedIds) != 1 ||
+		len(state.Catalog.AddedIds[studentTableName]) != 1 {
+		t.Errorf("expected the id written only, actual %v", state.Catalog)
+	}
+}
+
+// a copy of a catalog brought up to date with its changes holds the same tables
+func TestCatalogChanges(t *testing.T) {
+	primary := NewCatalog()
+	for _, tableName := range []string{"a", "b", "c"} {
+		primary.CreateTable(CatalogTable{Schema: TableSchema{TableName: tableName}})
+		primary.AddIds(tableName, tableName+"0", tableName+"1")
+	}
+	copied := NewCatalog()
+	changes := primary.ChangesSince(-1, nil)
+	copied.ApplyChanges(changes)
+
+	primary.AddIds("a", "a2")
+	primary.SetIds("b", []string{"b1"})
+	primary.RenameTable("c", "d")
+	since := changes.Change
+	changes = primary.ChangesSince(since, copied.IdCounts())
+	if len(changes.AddedIds) != 1 || len(changes.Tables) != 2 {
+		t.Errorf("expected the ids of a and the entries of b and d, actual %v", changes)
+	}
+	copied.ApplyChanges(changes)
+	if !reflect.DeepEqual(copied.Snapshot().tables, primary.Snapshot().tables) {
+		t.Errorf("expected %v, actual %v", primary.Snapshot().tables, copied.Snapshot().tables)
+	}
+
+	primary.DropTable("a")
+	copied.ApplyChanges(primary.ChangesSince(changes.Change, copied.IdCounts()))
+	if !reflect.DeepEqual(copied.Snapshot().tables, primary.Snapshot().tables) {
+		t.Errorf("expected %v, actual %v", primary.Snapshot().tables, copied.Snapshot().tables)
+	}
+}
@@ -6,6 +6,14 @@ type Table struct {
 	schema, fullSchema *TableSchema
 	rowStore           RowStore
 	predicate          *Predicate
+	// row id -> when the row was soft-deleted (in nanoseconds since the Unix epoch), the rows deleted are kept in the
+	// store but hidden from the iterators, see RPCTombstoneRows
+	tombstones map[string]int64
+	// the versions of the rows kept for the reads as of an earlier time, nil if the table keeps none, see
+	// RPCScanAsOf
+	history *rowHistory
+	// how the rows are stored, see TableStorage, kept for the checkpoints of the node, see Node.checkpoint
+	storage TableStorage
 }
 
 func NewTable(schema *TableSchema, rowStore RowStore) *Table {
@@ -33,21 +41,48 @@ func (t *Table) GetColumnType(i int) int {
 	return t.schema.ColumnSchemas[i].DataType
 }
 
+// RowIterator iterates the rows of the table which have not been soft-deleted.
 func (t *Table) RowIterator() RowIterator {
-	return t.rowStore.iterator()
+	if len(t.tombstones) == 0 {
+		return t.rowStore.iterator()
+	}
+	return &liveRowIterator{RowIterator: t.rowStore.iterator(), tombstones: t.tombstones}
 }
 
 // Insert inserts a row into the store. The row will be copied by the store.
 func (t *Table) Insert(row *Row) {
 	t.rowStore.insert(row)
+	if t.history != nil {
+		t.history.insert(*row)
+	}
 }
 
 // Remove removes a row from the store, and does not concern whether it exists.
 func (t *Table) Remove(row *Row) {
+	count := t.rowStore.count()
 	t.rowStore.remove(row)
+	if t.history != nil && t.rowStore.count() < count {
+		t.history.remove(*row, t.tombstones)
+	}
 }
 
-// Count returns how many rows are in the table.
+// Count returns how many rows are in the table, including those soft-deleted which still take space.
 func (t *Table) Count() int {
 	return t.rowStore.count()
 }
+
+// satisfies tells whether a row in the layout of the schema satisfies the predicate of the table. Atoms on columns
+// that are not in the schema cannot be checked and are ignored.
+func (t *Table) satisfies(row Row) bool {
+	if t.predicate == nil {
+		return true
+	}
+	for i, cs := range t.schema.ColumnSchemas {
+		for _, atom := range (*t.predicate)[cs.Name] {
+			if !atom.Check(row[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
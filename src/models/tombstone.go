@@ -0,0 +1,494 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Delete deletes the rows of a table satisfying the predicate, which may use any column of the table. If the table
+// is stored with SoftDelete (see TableStorage), the rows are hidden from the queries behind tombstones instead of being
+// removed, until they are brought back by Undelete or purged by PurgeTombstones or the TombstoneRetention of the
+// table. The reply is "0 <number of rows deleted>", or "1 <reason>" if nothing is deleted, e.g., "1 Cannot Read Table"
+// if a fragment cannot be read. If no replica of a fragment answers any more when the rows are deleted, the rows it
+// holds are kept and the reply is "1 Partially Deleted <deleted> of <rows>: <fragments> unreachable".
+// params: tableName string, predicate Predicate
+func (c *Cluster) Delete(params []interface{}, reply *string) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tableName := params[0].(string)
+	schema, predicate, err := c.writableTable(tableName, params[1].(Predicate))
+	if err != "" {
+		*reply = "1 " + err
+		return
+	}
+
+	// writes are blocked, so the rows read are all rows of the table, each following its id in the catalog
+	q := c.beginRawQuery(QueryHints{DisableCache: true})
+	rows := getTableRows(c, q, tableName, schema.ColumnSchemas)
+	c.endQuery(q)
+	ids := q.catalog.Ids(tableName)
+	if len(rows) != len(ids) {
+		*reply = "1 Cannot Read Table"
+		return
+	}
+	deleted := make([]string, 0)
+	for i, row := range rows {
+		if admitsRow(predicate, row, schema) {
+			deleted = append(deleted, ids[i])
+		}
+	}
+	if len(deleted) == 0 {
+		*reply = "0 0"
+		return
+	}
+
+	storage := c.catalog.Storage(tableName)
+	now := time.Now()
+	purgeBefore := int64(0)
+	if storage.TombstoneRetention > 0 {
+		purgeBefore = now.Add(-storage.TombstoneRetention).UnixNano()
+	}
+	// the fragments holding some of the rows deleted, in order, and the ids of those rows each of them holds
+	placement := c.currentPlacement()
+	affected := make([]string, 0)
+	fragmentIds := make(map[string][]string)
+	for _, id := range deleted {
+		for _, fragment := range c.rowIndex.Fragments(tableName, id) {
+			fragmentIds[fragment] = append(fragmentIds[fragment], id)
+		}
+	}
+	for _, fragment := range placement.Fragments(tableName) {
+		if len(fragmentIds[fragment]) > 0 {
+			affected = append(affected, fragment)
+		}
+	}
+	// a row is deleted once a replica of each fragment holding it has deleted it, the other replicas dropping it when
+	// they catch up (see RestartNode); the rows of a fragment none of whose replicas answered any more are kept
+	failed := make(map[string]bool)
+	unreachable := make([]string, 0)
+	removed := make([]RowLocation, 0)
+	for _, fragment := range affected {
+		done := false
+		for _, nodeId := range placement.Replicas(fragment) {
+			msg := ""
+			if storage.SoftDelete {
+				c.nodeEnd(nodeId).Call("Node.RPCTombstoneRows", TombstoneRowsArgs{Fragment: fragment,
+					Ids: fragmentIds[fragment], DeletedAt: now.UnixNano(), PurgeBefore: purgeBefore}, &msg)
+			} else {
+				c.nodeEnd(nodeId).Call("Node.RPCRemoveRows", FragmentIdsArgs{Fragment: fragment,
+					Ids: fragmentIds[fragment]}, &msg)
+			}
+			if strings.HasPrefix(msg, "0") {
+				done = true
+				removed = append(removed, RowLocation{NodeId: nodeId, Fragment: fragment})
+			}
+		}
+		if done {
+			c.fragmentVersions[fragment]++
+		} else {
+			unreachable = append(unreachable, fragment)
+			for _, id := range fragmentIds[fragment] {
+				failed[id] = true
+			}
+		}
+	}
+
+	isDeleted := make(map[string]bool, len(deleted))
+	for _, id := range deleted {
+		isDeleted[id] = true
+	}
+	kept := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if isDeleted[id] && !failed[id] {
+			c.rowIndex.Remove(tableName, id)
+			continue
+		}
+		kept = append(kept, id)
+		if failed[id] {
+			for _, location := range removed {
+				c.rowIndex.RemoveLocation(tableName, id, location)
+			}
+		}
+	}
+	c.catalog.SetIds(tableName, kept)
+	if len(unreachable) > 0 {
+		*reply = fmt.Sprintf("1 Partially Deleted %v of %v: %v unreachable", len(deleted)-len(failed), len(deleted),
+			strings.Join(unreachable, ", "))
+		return
+	}
+	*reply = fmt.Sprintf("0 %v", len(deleted))
+}
+
+// Undelete brings back the rows of a soft-deleted table satisfying the predicate which have been deleted at or after
+// asOf (in nanoseconds since the Unix epoch, see time.Time.UnixNano), so that the table holds them again as it did
+// at that time. Only the rows still behind tombstones can be brought back: those purged, and those whose replicas
+// have been moved or split since they were deleted, are lost. The reply is "0 <restored> <skipped>", the rows whose
+// primary key has been taken by another row since being skipped.
+// params: tableName string, predicate Predicate, asOf int64
+func (c *Cluster) Undelete(params []interface{}, reply *string) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tableName := params[0].(string)
+	asOf := params[2].(int64)
+	schema, predicate, err := c.writableTable(tableName, params[1].(Predicate))
+	if err != "" {
+		*reply = "1 " + err
+		return
+	}
+	if !c.catalog.Storage(tableName).SoftDelete {
+		*reply = "1 Not Soft Deleted"
+		return
+	}
+
+	// row id -> column name -> value, and fragment -> the ids of its rows deleted since asOf
+	values := make(map[string]map[string]interface{})
+	held := make(map[string]map[string]bool)
+	placement := c.currentPlacement()
+	for _, fragment := range placement.Fragments(tableName) {
+		for _, nodeId := range placement.Replicas(fragment) {
+			dataset := Dataset{}
+			c.nodeEnd(nodeId).Call("Node.RPCScanTombstones", ScanTombstonesArgs{Fragment: fragment, Since: asOf},
+				&dataset)
+			if dataset.Schema.TableName == "" {
+				continue
+			}
+			held[fragment] = make(map[string]bool)
+			for _, row := range dataset.Rows {
+				id := row[0].(string)
+				held[fragment][id] = true
+				if _, ok := values[id]; !ok {
+					values[id] = make(map[string]interface{})
+				}
+				for j, cs := range dataset.Schema.ColumnSchemas[1:] {
+					values[id][cs.Name] = row[j+1]
+				}
+			}
+			break
+		}
+		if held[fragment] == nil {
+			*reply = "1 Cannot Read " + fragment
+			return
+		}
+	}
+
+	ids := make([]string, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	keyColumn, _ := c.catalog.Key(tableName)
+	restored := make([]string, 0)
+	skipped := 0
+	for _, id := range ids {
+		row := make(Row, 0, len(schema.ColumnSchemas))
+		for _, cs := range schema.ColumnSchemas {
+			if value, ok := values[id][cs.Name]; ok {
+				row = append(row, value)
+			}
+		}
+		// a row not deleted from every fragment has not been deleted by Delete
+		if len(row) != len(schema.ColumnSchemas) || !admitsRow(predicate, row, schema) {
+			continue
+		}
+		taken := false
+		for i, cs := range schema.ColumnSchemas {
+			if cs.Name == keyColumn && !c.rowIndex.SetKey(tableName, row[i], id) {
+				taken = true
+			}
+		}
+		if taken {
+			skipped++
+			continue
+		}
+		restored = append(restored, id)
+	}
+
+	if len(restored) > 0 {
+		for _, fragment := range placement.Fragments(tableName) {
+			for _, nodeId := range placement.Replicas(fragment) {
+				msg := ""
+				c.nodeEnd(nodeId).Call("Node.RPCUndeleteRows", FragmentIdsArgs{Fragment: fragment, Ids: restored}, &msg)
+				if len(msg) == 0 || msg[0] != '0' {
+					continue
+				}
+				c.fragmentVersions[fragment]++
+				for _, id := range restored {
+					if held[fragment][id] {
+						c.rowIndex.Add(tableName, id, RowLocation{NodeId: nodeId, Fragment: fragment})
+					}
+				}
+			}
+		}
+		c.catalog.AddIds(tableName, restored...)
+	}
+	*reply = fmt.Sprintf("0 %v %v", len(restored), skipped)
+}
+
+// PurgeTombstones removes the rows of a table which have been soft-deleted before the given time (in nanoseconds
+// since the Unix epoch), after which they can no longer be brought back by Undelete.
+// params: tableName string, before int64
+func (c *Cluster) PurgeTombstones(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tableName := params[0].(string)
+	before := params[1].(int64)
+	if _, _, err := c.writableTable(tableName, Predicate{}); err != "" {
+		*reply = "1 " + err
+		return
+	}
+	placement := c.currentPlacement()
+	for _, fragment := range placement.Fragments(tableName) {
+		for _, nodeId := range placement.Replicas(fragment) {
+			msg := ""
+			if !c.nodeEnd(nodeId).Call("Node.RPCPurgeTombstones", PurgeTombstonesArgs{Fragment: fragment,
+				Before: before}, &msg) ||
+				len(msg) == 0 || msg[0] != '0' {
+				*reply = "1 cannot purge " + fragment + " on " + nodeId
+				return
+			}
+		}
+	}
+	*reply = "0 OK"
+}
+
+// writableTable returns the schema of a table the predicate of a write is about, and the predicate with its numbers
+// as the rules have them (see predicateValue), or why the table cannot be written by it.
+func (c *Cluster) writableTable(tableName string, predicate Predicate) (TableSchema, Predicate, string) {
+	schema, ok := c.catalog.Schema(tableName)
+	if !ok {
+		if err := c.currentPlacement().renamedError(tableName); err != "" {
+			return schema, nil, err
+		}
+		return schema, nil, "No Such Table"
+	}
+	if err := c.currentPlacement().readOnlyError(tableName); err != "" {
+		return schema, nil, err
+	}
+	normalized := make(Predicate, len(predicate))
+	for column, atoms := range predicate {
+		found := false
+		for _, cs := range schema.ColumnSchemas {
+			found = found || cs.Name == column
+		}
+		if !found {
+			return schema, nil, "No Such Column " + column
+		}
+		for _, atom := range atoms {
+			atom.Val = predicateValue(atom.Val)
+			normalized[column] = append(normalized[column], atom)
+		}
+	}
+	// the predicate is typed on a copy, as admitsRow types it by itself
+	typed := make(Predicate, len(normalized))
+	for column, atoms := range normalized {
+		typed[column] = append([]Atom(nil), atoms...)
+	}
+	if msg := typePredicate(typed, schema); msg != "" {
+		return schema, nil, msg[2:]
+	}
+	return schema, normalized, ""
+}
+
+// RPCTombstoneRows soft-deletes the rows with the given ids from a fragment at the given time, hiding them from the
+// scans until RPCUndeleteRows. The rows soft-deleted before PurgeBefore are purged, none if it is 0.
+func (n *Node) RPCTombstoneRows(args TombstoneRowsArgs, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer n.logIfOk("RPCTombstoneRows", args, reply)
+
+	fragment := args.Fragment
+	deletedAt := args.DeletedAt
+	purgeBefore := args.PurgeBefore
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		*reply = "1 no such table"
+		return
+	}
+	deleted := make(map[string]bool)
+	for _, id := range args.Ids {
+		deleted[id] = true
+	}
+	tombstones := make(map[string]int64, len(t.tombstones))
+	for id, at := range t.tombstones {
+		tombstones[id] = at
+	}
+	for iterator := t.RowIterator(); iterator.HasNext(); {
+		if id, _ := (*iterator.Next())[0].(string); deleted[id] {
+			tombstones[id] = deletedAt
+		}
+	}
+	// the map is replaced rather than modified, as it may be shared with the iterators of the readers
+	t.tombstones = tombstones
+	if purgeBefore > 0 {
+		t.purgeTombstones(purgeBefore)
+	}
+	*reply = "0 OK"
+}
+
+// RPCScanTombstones returns the rows of a fragment soft-deleted at or after the given time, together with the
+// schema of the fragment. A dataset with an empty table name is returned if the fragment does not exist on this node.
+func (n *Node) RPCScanTombstones(args ScanTombstonesArgs, dataset *Dataset) {
+	defer n.admit()()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	fragment := args.Fragment
+	since := args.Since
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		*dataset = Dataset{}
+		return
+	}
+	result := Dataset{Schema: *t.schema, Rows: make([]Row, 0)}
+	for iterator := t.rowStore.iterator(); iterator.HasNext(); {
+		row := *iterator.Next()
+		if at, ok := t.tombstones[row[0].(string)]; ok && at >= since {
+			result.Rows = append(result.Rows, row)
+		}
+	}
+	*dataset = result
+}
+
+// RPCUndeleteRows brings back the soft-deleted rows with the given ids of a fragment.
+func (n *Node) RPCUndeleteRows(args FragmentIdsArgs, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer n.logIfOk("RPCUndeleteRows", args, reply)
+
+	fragment := args.Fragment
+	t, ok := n.TableMap[fragment]
+	if !ok {
+		*reply = "1 no such table"
+		return
+	}
+	tombstones := make(map[string]int64, len(t.tombstones))
+	for id, at := range t.tombstones {
+		tombstones[id] = at
+	}
+	for _, id := range args.Ids {
+		delete(tombstones, id)
+	}
+	t.tombstones = tombstones
+	*reply = "0 OK"
+}
+
+// RPCPurgeTombstones removes the rows of a fragment soft-deleted before the given time.
+func (n *Node) RPCPurgeTombstones(args PurgeTombstonesArgs, reply *string) {
+	defer n.admit()()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer n.logIfOk("RPCPurgeTombstones", args, reply)
+
+	t, ok := n.TableMap[args.Fragment]
+	if !ok {
+		*reply = "1 no such table"
+		return
+	}
+	t.purgeTombstones(args.Before)
+	if err := storeError(t); err != nil {
+		*reply = "1 " + err.Error()
+		return
+	}
+	*reply = "0 OK"
+}
+
+// purgeTombstones removes the rows soft-deleted before the given time from the store.
+func (t *Table) purgeTombstones(before int64) {
+	purged := make([]Row, 0)
+	for iterator := t.rowStore.iterator(); iterator.HasNext(); {
+		row := *iterator.Next()
+		if at, ok := t.tombstones[row[0].(string)]; ok && at < before {
+			purged = append(purged, row)
+		}
+	}
+	if len(purged) == 0 {
+		return
+	}
+	tombstones := make(map[string]int64, len(t.tombstones))
+	for id, at := range t.tombstones {
+		tombstones[id] = at
+	}
+	for i := range purged {
+		t.Remove(&purged[i])
+		delete(tombstones, purged[i][0].(string))
+	}
+	t.tombstones = tombstones
+}
+
+// liveRowIterator skips the rows having a tombstone.
+type liveRowIterator struct {
+	RowIterator
+	tombstones map[string]int64
+	next       *Row
+}
+
+func (iter *liveRowIterator) HasNext() bool {
+	for iter.next == nil && iter.RowIterator.HasNext() {
+		row := iter.RowIterator.Next()
+		if id, _ := (*row)[0].(string); !hasTombstone(iter.tombstones, id) {
+			iter.next = row
+		}
+	}
+	return iter.next != nil
+}
+
+func (iter *liveRowIterator) Next() *Row {
+	if !iter.HasNext() {
+		return nil
+	}
+	row := iter.next
+	iter.next = nil
+	return row
+}
+
+func hasTombstone(tombstones map[string]int64, id string) bool {
+	_, ok := tombstones[id]
+	return ok
+}
+
+// liveRows is a snapshot of a table hiding the rows soft-deleted when it was taken.
+type liveRows struct {
+	rows       RowIterable
+	tombstones map[string]int64
+}
+
+func (l *liveRows) count() int {
+	count := 0
+	for iterator := l.iterator(); iterator.HasNext(); iterator.Next() {
+		count++
+	}
+	return count
+}
+
+func (l *liveRows) iterator() RowIterator {
+	return &liveRowIterator{RowIterator: l.rows.iterator(), tombstones: l.tombstones}
+}
+
+// Delete see Cluster.Delete.
+// params: the same as Cluster.Delete
+func (r *Router) Delete(params []interface{}, reply *string) {
+	r.forward(params[0].(string), "Delete", params, reply)
+}
+
+// Undelete see Cluster.Undelete.
+// params: the same as Cluster.Undelete
+func (r *Router) Undelete(params []interface{}, reply *string) {
+	r.forward(params[0].(string), "Undelete", params, reply)
+}
+
+// PurgeTombstones see Cluster.PurgeTombstones.
+// params: the same as Cluster.PurgeTombstones
+func (r *Router) PurgeTombstones(params []interface{}, reply *string) {
+	r.forward(params[0].(string), "PurgeTombstones", params, reply)
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// setupSoftDelete builds the student table with soft deletes and sid as its key, the rows with grade <= 3.6 on Node0
+// and Node1, the others on Node2, and courseRegistration with hard deletes on Node3.
+func setupSoftDelete(retention time.Duration) {
+	setupLab3()
+	rules, _ := json.Marshal(map[string]interface{}{
+		"0|1": rangeFragment("grade", "<=", 3.6, "sid", "name", "age", "grade"),
+		"2":   rangeFragment("grade", ">", 3.6, "sid", "name", "age", "grade"),
+	})
+	reply := ""
+	cli.Call("Cluster.BuildTable", []interface{}{studentTableSchema, rules, "sid",
+		TableStorage{SoftDelete: true, TombstoneRetention: retention}}, &reply)
+	courseRegistrationTablePartitionRules, _ = json.Marshal(map[string]interface{}{
+		"3": rangeFragment("courseId", ">=", 0, "sid", "courseId"),
+	})
+	cli.Call("Cluster.BuildTable", []interface{}{courseRegistrationTableSchema, courseRegistrationTablePartitionRules},
+		&reply)
+	insertDataLab3(cli)
+}
+
+// scanRows returns the rows of a table read from the fragments.
+func scanRows(tableName string) []Row {
+	result := Dataset{}
+	cli.Call("Cluster.Scan", []interface{}{tableName, QueryHints{DisableCache: true}}, &result)
+	return result.Rows
+}
+
+func TestSoftDelete(t *testing.T) {
+	setupSoftDelete(0)
+	asOf := time.Now().UnixNano()
+	reply := ""
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"grade": {{Op: ">", Val: 3.6}}}}, &reply)
+	if reply != "0 2" {
+		t.Fatalf("expected 2 rows deleted, actual %v", reply)
+	}
+	if rows := scanRows(studentTableName); len(rows) != 1 || !rows[0].Equals(&studentRows[1]) {
+		t.Errorf("expected only %v, actual %v", studentRows[1], rows)
+	}
+	result := Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 0}, &result)
+	if len(result.Rows) != 0 {
+		t.Errorf("a deleted row should not be found, actual %v", result.Rows)
+	}
+	report := FsckReport{}
+	cli.Call("Cluster.Fsck", studentTableName, &report)
+	if report.Error != "" || len(report.Inconsistencies) != 0 {
+		t.Errorf("the deleted rows should not be inconsistent, actual %v", report)
+	}
+
+	// the key of a deleted row can be taken by another row, which keeps the deleted row from coming back
+	cli.Call("Cluster.FragmentWrite", []interface{}{studentTableName, Row{2, "Eve", 20, 3.0}}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot reuse the key of a deleted row: %v", reply)
+	}
+	// the tombstones are replayed by the restarted nodes
+	cli.Call("Cluster.RestartNode", "Node2", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("cannot restart Node2: %v", reply)
+	}
+	if rows := scanRows(studentTableName); len(rows) != 2 {
+		t.Errorf("expected 2 rows after restarting, actual %v", rows)
+	}
+
+	cli.Call("Cluster.Undelete", []interface{}{studentTableName, Predicate{}, asOf}, &reply)
+	if reply != "0 1 1" {
+		t.Fatalf("expected 1 row restored and 1 skipped, actual %v", reply)
+	}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, 0}, &result)
+	if len(result.Rows) != 1 || !result.Rows[0].Equals(&studentRows[0]) {
+		t.Errorf("expected %v, actual %v", studentRows[0], result.Rows)
+	}
+	if rows := scanRows(studentTableName); len(rows) != 3 {
+		t.Errorf("expected 3 rows, actual %v", rows)
+	}
+
+	// the rows deleted before asOf stay deleted, and the purged rows cannot be restored
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"name": {{Op: "==", Val: "John"}}}}, &reply)
+	cli.Call("Cluster.Undelete", []interface{}{studentTableName, Predicate{}, time.Now().UnixNano()}, &reply)
+	if reply != "0 0 0" {
+		t.Errorf("expected nothing restored, actual %v", reply)
+	}
+	cli.Call("Cluster.PurgeTombstones", []interface{}{studentTableName, time.Now().UnixNano()}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("PurgeTombstones failed: %v", reply)
+	}
+	cli.Call("Cluster.Undelete", []interface{}{studentTableName, Predicate{}, asOf}, &reply)
+	if reply != "0 0 0" {
+		t.Errorf("expected nothing to restore, actual %v", reply)
+	}
+	placement := c.currentPlacement()
+	for _, fragment := range placement.Fragments(studentTableName) {
+		if replicas := placement.Replicas(fragment); replicas[0] != "Node2" {
+			continue
+		}
+		if count := c.nodes["Node2"].TableMap[fragment].Count(); count != 0 {
+			t.Errorf("the purged rows should be removed, %v left", count)
+		}
+	}
+}
+
+func TestHardDelete(t *testing.T) {
+	setupSoftDelete(0)
+	reply := ""
+	cli.Call("Cluster.Delete", []interface{}{courseRegistrationTableName, Predicate{"courseId": {{Op: ">=", Val: 1}}}},
+		&reply)
+	if reply != "0 2" {
+		t.Fatalf("expected 2 rows deleted, actual %v", reply)
+	}
+	if rows := scanRows(courseRegistrationTableName); len(rows) != 2 {
+		t.Errorf("expected 2 rows left, actual %v", rows)
+	}
+	if count := c.nodes["Node3"].TableMap[courseRegistrationTableName+"|0"].Count(); count != 2 {
+		t.Errorf("expected the rows to be removed, %v stored", count)
+	}
+	cli.Call("Cluster.Undelete", []interface{}{courseRegistrationTableName, Predicate{}, int64(0)}, &reply)
+	if reply != "1 Not Soft Deleted" {
+		t.Errorf("the rows of a hard-deleted table cannot be restored, actual %v", reply)
+	}
+	cli.Call("Cluster.Delete", []interface{}{courseRegistrationTableName, Predicate{"x": {{Op: ">=", Val: 1}}}}, &reply)
+	if reply != "1 No Such Column x" {
+		t.Errorf("expected an unknown column, actual %v", reply)
+	}
+	cli.Call("Cluster.Delete", []interface{}{courseRegistrationTableName, Predicate{"sid": {{Op: ">=", Val: "a"}}}},
+		&reply)
+	if reply != "1 TypeError" {
+		t.Errorf("expected a type error, actual %v", reply)
+	}
+}
+
+// the tombstones older than the retention are purged by the next delete
+func TestTombstoneRetention(t *testing.T) {
+	setupSoftDelete(time.Nanosecond)
+	reply := ""
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"name": {{Op: "==", Val: "John"}}}}, &reply)
+	time.Sleep(time.Millisecond)
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"name": {{Op: "==", Val: "Hana"}}}}, &reply)
+	cli.Call("Cluster.Undelete", []interface{}{studentTableName, Predicate{}, int64(0)}, &reply)
+	if reply != "0 1 0" {
+		t.Errorf("expected only the row deleted last restored, actual %v", reply)
+	}
+	if rows := scanRows(studentTableName); len(rows) != 2 {
+		t.Errorf("expected 2 rows, actual %v", rows)
+	}
+}
+
+// nothing is deleted while no replica of a fragment holding the rows answers, and only those fragments change
+func TestDeleteUnreachable(t *testing.T) {
+	setupSoftDelete(0)
+	versions := func() (int, int) {
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+		return c.fragmentVersions[studentTableName+"|0"], c.fragmentVersions[studentTableName+"|1"]
+	}
+	network.DeleteServer("Node2")
+	reply := ""
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"grade": {{Op: ">", Val: 3.6}}}}, &reply)
+	if reply != "1 Cannot Read Table" {
+		t.Errorf("expected the delete to fail, actual %v", reply)
+	}
+	if ids := c.catalog.Ids(studentTableName); len(ids) != 3 {
+		t.Errorf("expected every row to be kept, actual %v", ids)
+	}
+	cli.Call("Cluster.RestartNode", "Node2", &reply)
+
+	// a fragment with an answering replica deletes its rows, the other fragment is not changed
+	network.DeleteServer("Node1")
+	low, high := versions()
+	cli.Call("Cluster.Delete", []interface{}{studentTableName, Predicate{"name": {{Op: "==", Val: "Smith"}}}}, &reply)
+	if reply != "0 1" {
+		t.Errorf("expected the row to be deleted, actual %v", reply)
+	}
+	if newLow, newHigh := versions(); newLow != low+1 || newHigh != high {
+		t.Errorf("expected only the version of the lower fragment to change, actual %v %v", newLow-low,
+			newHigh-high)
+	}
+	if ids := c.catalog.Ids(studentTableName); len(ids) != 2 {
+		t.Errorf("expected the row to be deleted, actual %v", ids)
+	}
+}
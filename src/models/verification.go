@@ -0,0 +1,375 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MisplacedRow is a row held by a replica of a fragment whose rule predicate the row does not satisfy (anymore), as
+// found by the verification of the node holding the replica, see Cluster.StartVerification.
+type MisplacedRow struct {
+	Fragment string
+	NodeId   string
+	Id       string
+	// the row in the layout of the fragment, the id column first
+	Row Row
+}
+
+// verifier is the background verification of the rule predicates of a node.
+type verifier struct {
+	mu sync.Mutex
+	// fragment -> the rows found misplaced by the last verification, the fragments without any are absent
+	misplaced map[string][]MisplacedRow
+	// how many verifications have been completed
+	passes int
+	// closed to stop the verification, nil if the node is not verifying
+	stop chan struct{}
+}
+
+func newVerifier() *verifier {
+	return &verifier{misplaced: make(map[string][]MisplacedRow)}
+}
+
+// RPCStartVerification makes this node check the rows of its fragments against their rule predicates every interval,
+// or changes the interval if the node is verifying already. The rows found misplaced are reported by
+// RPCMisplacedRows.
+func (n *Node) RPCStartVerification(interval time.Duration, reply *string) {
+	defer n.admit()()
+	v := n.verifier
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if interval <= 0 {
+		*reply = "1 interval must be positive"
+		return
+	}
+	if v.stop != nil {
+		close(v.stop)
+	}
+	v.stop = make(chan struct{})
+	go n.verificationLoop(v.stop, interval)
+	*reply = "0 OK"
+}
+
+// RPCStopVerification stops the verification of this node, the rows found misplaced so far are still reported.
+func (n *Node) RPCStopVerification(args interface{}, reply *string) {
+	defer n.admit()()
+	n.stopVerification()
+	*reply = "0 OK"
+}
+
+func (n *Node) stopVerification() {
+	v := n.verifier
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.stop != nil {
+		close(v.stop)
+		v.stop = nil
+	}
+}
+
+func (n *Node) verificationLoop(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			n.verifyPredicates()
+		}
+	}
+}
+
+// verifyPredicates checks every row of the fragments of this node against the predicate of its fragment, atoms on
+// the columns a fragment does not hold being ignored, and replaces the report of the last verification.
+func (n *Node) verifyPredicates() {
+	misplaced := make(map[string][]MisplacedRow)
+	n.mu.RLock()
+	for fragment, t := range n.TableMap {
+		if t.predicate == nil {
+			continue
+		}
+		iterator := n.rowIterator(t)
+		for iterator.HasNext() {
+			row := *iterator.Next()
+			if t.satisfies(row) {
+				continue
+			}
+			id, _ := row[0].(string)
+			misplaced[fragment] = append(misplaced[fragment], MisplacedRow{Fragment: fragment, NodeId: n.Identifier,
+				Id: id, Row: append(Row(nil), row...)})
+		}
+	}
+	n.mu.RUnlock()
+
+	v := n.verifier
+	v.mu.Lock()
+	v.misplaced = misplaced
+	v.passes++
+	v.mu.Unlock()
+}
+
+// RPCMisplacedRows replies the rows of the fragments of a table found misplaced by the last verification of this
+// node, and how many verifications the node has completed.
+func (n *Node) RPCMisplacedRows(args MisplacedRowsArgs, reply *VerificationReport) {
+	defer n.admit()()
+	v := n.verifier
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	tableName := args.TableName
+	report := VerificationReport{Passes: v.passes, Rows: make([]MisplacedRow, 0)}
+	for fragment, rows := range v.misplaced {
+		if fragmentTable(fragment) == tableName {
+			report.Rows = append(report.Rows, rows...)
+		}
+	}
+	*reply = report
+}
+
+// VerificationReport lists the misplaced rows of a table, see Cluster.MisplacedRows.
+type VerificationReport struct {
+	// the least number of verifications completed by the nodes holding the replicas of the table, zero if one of
+	// them has not completed any yet or cannot be reached
+	Passes int
+	// the misplaced rows ordered by fragment, node and id
+	Rows []MisplacedRow
+	// why the table cannot be verified, "" if it can
+	Error string
+}
+
+// StartVerification makes every node check the rows of its fragments against their rule predicates every interval in
+// the background, e.g., to find the rows written around the coordinator or changed on the nodes after they had been
+// placed. If migrate is set, the coordinator also moves the rows reported misplaced to the fragments whose rules
+// they satisfy every interval, see MigrateMisplacedRows.
+// params: interval time.Duration, (optional) migrate bool
+func (c *Cluster) StartVerification(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	interval := params[0].(time.Duration)
+	if interval <= 0 {
+		*reply = "1 interval must be positive"
+		return
+	}
+	c.verifyInterval = interval
+	for _, nodeId := range c.nodeIds {
+		msg := ""
+		c.nodeEnd(nodeId).Call("Node.RPCStartVerification", interval, &msg)
+	}
+	if c.stopMigration != nil {
+		close(c.stopMigration)
+		c.stopMigration = nil
+	}
+	if len(params) > 1 && params[1].(bool) {
+		c.stopMigration = make(chan struct{})
+		go c.migrationLoop(c.stopMigration, interval)
+	}
+	*reply = "0 OK"
+}
+
+// StopVerification makes the nodes stop verifying, and the coordinator stop migrating the misplaced rows.
+func (c *Cluster) StopVerification(args interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.verifyInterval = 0
+	for _, nodeId := range c.nodeIds {
+		msg := ""
+		c.nodeEnd(nodeId).Call("Node.RPCStopVerification", "", &msg)
+	}
+	if c.stopMigration != nil {
+		close(c.stopMigration)
+		c.stopMigration = nil
+	}
+	*reply = "0 OK"
+}
+
+func (c *Cluster) migrationLoop(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		for _, tableName := range c.catalog.Snapshot().TableNames() {
+			reply := ""
+			c.MigrateMisplacedRows(tableName, &reply)
+		}
+	}
+}
+
+// MisplacedRows collects the rows of a table found misplaced by the last verification of each node holding a replica
+// of one of its fragments. The report is as of the last verifications, so it may still list rows migrated since.
+// params: tableName string
+func (c *Cluster) MisplacedRows(tableName string, reply *VerificationReport) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if _, ok := c.catalog.Schema(tableName); !ok {
+		err := c.currentPlacement().renamedError(tableName)
+		if err == "" {
+			err = "No Such Table"
+		}
+		*reply = VerificationReport{Error: err}
+		return
+	}
+	*reply = c.misplacedRows(tableName)
+}
+
+// misplacedRows collects the misplaced rows of the fragments of a table in the current placement. The caller must
+// hold writeMu.
+func (c *Cluster) misplacedRows(tableName string) VerificationReport {
+	placement := c.currentPlacement()
+	report := VerificationReport{Passes: -1, Rows: make([]MisplacedRow, 0)}
+	for _, nodeId := range c.nodeIds {
+		holds := false
+		for _, fragment := range placement.Fragments(tableName) {
+			holds = holds || contains(placement.Replicas(fragment), nodeId)
+		}
+		if !holds {
+			continue
+		}
+		nodeReport := VerificationReport{}
+		if !c.nodeEnd(nodeId).Call("Node.RPCMisplacedRows", MisplacedRowsArgs{TableName: tableName}, &nodeReport) {
+			nodeReport.Passes = 0
+		}
+		if report.Passes < 0 || nodeReport.Passes < report.Passes {
+			report.Passes = nodeReport.Passes
+		}
+		for _, row := range nodeReport.Rows {
+			// the replicas retired by a change of placement are not verified
+			if contains(placement.Replicas(row.Fragment), row.NodeId) {
+				report.Rows = append(report.Rows, row)
+			}
+		}
+	}
+	if report.Passes < 0 {
+		report.Passes = 0
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Fragment != b.Fragment {
+			return fragmentNumber(a.Fragment) < fragmentNumber(b.Fragment)
+		}
+		if a.NodeId != b.NodeId {
+			return a.NodeId < b.NodeId
+		}
+		return a.Id < b.Id
+	})
+	return report
+}
+
+// MigrateMisplacedRows moves the rows of a table reported misplaced (see MisplacedRows) to the fragments whose rules
+// they satisfy: each row is reassembled, written into the replicas of those fragments which do not hold it yet, then
+// removed from the fragments whose rules it does not satisfy, keeping its id. A row which no fragment holding one of
+// its columns admits is left where it is, and so is a row which no replica of one of those fragments accepted (e.g.,
+// all of them are down), until a later pass writes it there. The reply is "0 <how many rows have been moved>".
+// params: tableName string
+func (c *Cluster) MigrateMisplacedRows(tableName string, reply *string) {
+	c.migrationMu.Lock()
+	defer c.migrationMu.Unlock()
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	schema, ok := c.catalog.Schema(tableName)
+	if !ok {
+		if err := c.currentPlacement().renamedError(tableName); err != "" {
+			*reply = "1 " + err
+		} else {
+			*reply = "1 No Such Table"
+		}
+		return
+	}
+	if err := c.currentPlacement().readOnlyError(tableName); err != "" {
+		*reply = "1 " + err
+		return
+	}
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, row := range c.misplacedRows(tableName).Rows {
+		if !seen[row.Id] {
+			seen[row.Id] = true
+			ids = append(ids, row.Id)
+		}
+	}
+
+	placement := c.currentPlacement()
+	moved := 0
+	for _, id := range ids {
+		q := c.beginRawQuery(QueryHints{DisableCache: true})
+		line := getLineByid(c, q, tableName, id, schema.ColumnSchemas)
+		c.endQuery(q)
+		if line.Schema.TableName == "" || len(line.Rows) == 0 || len(line.Rows[0]) != len(schema.ColumnSchemas) {
+			continue
+		}
+		row := append(append(Row(nil), line.Rows[0]...), id)
+		held := make(map[string]bool)
+		for _, fragment := range c.rowIndex.Fragments(tableName, id) {
+			held[fragment] = true
+		}
+		// the columns held by the fragments admitting the row must be all columns of the table
+		admitted := make([]string, 0)
+		columns := make(map[string]bool)
+		for _, fragment := range placement.Fragments(tableName) {
+			rule := placement.Rule(fragment)
+			if admitsRow(rule.Predicate, row, schema) {
+				admitted = append(admitted, fragment)
+				for _, column := range rule.Column {
+					columns[column] = true
+				}
+			}
+		}
+		if len(columns) < len(schema.ColumnSchemas) {
+			continue
+		}
+
+		changed := false
+		written := true
+		for _, fragment := range admitted {
+			if held[fragment] {
+				continue
+			}
+			accepted := false
+			for _, nodeId := range placement.Replicas(fragment) {
+				msg := ""
+				c.nodeEnd(nodeId).Call("Node.RPCInsert", InsertArgs{Fragment: fragment, Row: row}, &msg)
+				if len(msg) > 0 && msg[0] == '0' {
+					c.rowIndex.Add(tableName, id, RowLocation{NodeId: nodeId, Fragment: fragment})
+					c.fragmentVersions[fragment]++
+					changed = true
+					accepted = true
+				}
+			}
+			written = written && accepted
+		}
+		// the old copies are kept until every admitting fragment holds the row, the next pass retrying the rest
+		if !written {
+			continue
+		}
+		for fragment := range held {
+			if contains(admitted, fragment) {
+				continue
+			}
+			for _, nodeId := range placement.Replicas(fragment) {
+				msg := ""
+				c.nodeEnd(nodeId).Call("Node.RPCRemoveRows", FragmentIdsArgs{Fragment: fragment, Ids: []string{id}},
+					&msg)
+				if len(msg) > 0 && msg[0] == '0' {
+					c.rowIndex.RemoveLocation(tableName, id, RowLocation{NodeId: nodeId, Fragment: fragment})
+					c.fragmentVersions[fragment]++
+					changed = true
+				}
+			}
+		}
+		if changed {
+			moved++
+		}
+	}
+	*reply = fmt.Sprintf("0 %v", moved)
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// changeOnNodes changes a column of a row in every replica of the fragments of a table holding it, behind the back
+// of the coordinator, as an update changing the partitioning column would. It returns the id of the row.
+func changeOnNodes(tableName string, sid int, column string, val interface{}) string {
+	placement := c.currentPlacement()
+	id := ""
+	for _, fragment := range placement.Fragments(tableName) {
+		for _, nodeId := range placement.Replicas(fragment) {
+			n := c.nodes[nodeId]
+			n.mu.Lock()
+			t := n.TableMap[fragment]
+			var found *Row
+			for iterator := t.RowIterator(); iterator.HasNext(); {
+				if row := iterator.Next(); (*row)[1] == sid {
+					found = row
+				}
+			}
+			if found != nil {
+				changed := append(Row(nil), (*found)...)
+				for i, cs := range t.schema.ColumnSchemas {
+					if cs.Name == column {
+						changed[i] = val
+					}
+				}
+				id = changed[0].(string)
+				t.Remove(found)
+				t.Insert(&changed)
+			}
+			n.mu.Unlock()
+		}
+	}
+	return id
+}
+
+func TestVerification(t *testing.T) {
+	setupDDL()
+	reply := ""
+	cli.Call("Cluster.StartVerification", []interface{}{5 * time.Millisecond}, &reply)
+	defer cli.Call("Cluster.StopVerification", "", &reply)
+	if reply != "0 OK" {
+		t.Fatalf("StartVerification failed: %v", reply)
+	}
+	// the row of Smith moves out of the range of its fragment
+	id := changeOnNodes(studentTableName, 1, "grade", 3.9)
+	report := VerificationReport{}
+	waitFor(t, "the misplaced rows", func() bool {
+		report = VerificationReport{}
+		cli.Call("Cluster.MisplacedRows", studentTableName, &report)
+		return len(report.Rows) == 2
+	})
+	for i, nodeId := range []string{"Node0", "Node1"} {
+		if row := report.Rows[i]; row.NodeId != nodeId || row.Id != id || row.Row[4] != 3.9 {
+			t.Errorf("expected the row on %v, actual %v", nodeId, row)
+		}
+	}
+	report = VerificationReport{}
+	cli.Call("Cluster.MisplacedRows", courseRegistrationTableName, &report)
+	if report.Passes == 0 || len(report.Rows) != 0 {
+		t.Errorf("expected no misplaced row, actual %v", report)
+	}
+
+	cli.Call("Cluster.MigrateMisplacedRows", studentTableName, &reply)
+	if reply != "0 1" {
+		t.Fatalf("expected a row to be moved, actual %v", reply)
+	}
+	for _, fragment := range c.rowIndex.Fragments(studentTableName, id) {
+		if !contains(c.currentPlacement().Replicas(fragment), "Node2") {
+			t.Errorf("expected the row in the upper fragment, actual %v", fragment)
+		}
+	}
+	waitFor(t, "the verification of the moved row", func() bool {
+		report = VerificationReport{}
+		cli.Call("Cluster.MisplacedRows", studentTableName, &report)
+		return len(report.Rows) == 0
+	})
+	if rows := scanRows(studentTableName); len(rows) != 3 {
+		t.Errorf("expected each row once, actual %v", rows)
+	}
+	fsck := FsckReport{}
+	cli.Call("Cluster.Fsck", studentTableName, &fsck)
+	if len(fsck.Inconsistencies) != 0 {
+		t.Errorf("expected no inconsistency, actual %v", fsck.Inconsistencies)
+	}
+}
+
+// the coordinator moves the misplaced rows itself if asked to
+func TestVerificationMigrates(t *testing.T) {
+	setupDDL()
+	reply := ""
+	cli.Call("Cluster.StartVerification", []interface{}{5 * time.Millisecond, true}, &reply)
+	defer cli.Call("Cluster.StopVerification", "", &reply)
+	id := changeOnNodes(studentTableName, 0, "grade", 2.0)
+	waitFor(t, "the row to be moved", func() bool {
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+		fragments := c.rowIndex.Fragments(studentTableName, id)
+		return len(fragments) == 1 && contains(c.currentPlacement().Replicas(fragments[0]), "Node0")
+	})
+	result := Dataset{}
+	cli.Call("Cluster.Get", []interface{}{studentTableName, id}, &result)
+	if len(result.Rows) != 1 || result.Rows[0][3] != 2.0 {
+		t.Errorf("expected the changed row, actual %v", result)
+	}
+}
+
+// a row is not removed from where it is while no replica of its new fragment accepts it
+func TestMigrateMisplacedRowsUnreachable(t *testing.T) {
+	setupDDL()
+	reply := ""
+	cli.Call("Cluster.StartVerification", []interface{}{5 * time.Millisecond}, &reply)
+	defer cli.Call("Cluster.StopVerification", "", &reply)
+	id := changeOnNodes(studentTableName, 1, "grade", 3.9)
+	waitFor(t, "the misplaced rows", func() bool {
+		report := VerificationReport{}
+		cli.Call("Cluster.MisplacedRows", studentTableName, &report)
+		return len(report.Rows) == 2
+	})
+	network.DeleteServer("Node2")
+	network.DeleteServer("Node3")
+	cli.Call("Cluster.MigrateMisplacedRows", studentTableName, &reply)
+	if reply != "0 0" {
+		t.Errorf("expected no row to be moved, actual %v", reply)
+	}
+	for _, nodeId := range []string{"Node0", "Node1"} {
+		n := c.nodes[nodeId]
+		n.mu.Lock()
+		found := false
+		for iterator := n.TableMap[studentTableName+"|0"].RowIterator(); iterator.HasNext(); {
+			found = found || (*iterator.Next())[0] == id
+		}
+		n.mu.Unlock()
+		if !found {
+			t.Errorf("expected the row to stay on %v", nodeId)
+		}
+	}
+
+	// once the replicas are back, the next pass moves the row
+	cli.Call("Cluster.RestartNode", "Node2", &reply)
+	cli.Call("Cluster.RestartNode", "Node3", &reply)
+	cli.Call("Cluster.MigrateMisplacedRows", studentTableName, &reply)
+	if reply != "0 1" {
+		t.Fatalf("expected a row to be moved, actual %v", reply)
+	}
+	if rows := scanRows(studentTableName); len(rows) != 3 {
+		t.Errorf("expected each row once, actual %v", rows)
+	}
+}
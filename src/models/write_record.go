@@ -0,0 +1,143 @@
+package models
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// WriteRecord writes a logical record of a table given by its columns, the columns it lacks being null, into the
+// fragments admitting it, all of them or none, see writeRow. The record is checked in full before anything is
+// written: the reply is "1 No Such Column <column>" for a column the table does not have, and "1 TypeError" for a
+// value which does not fit the type of its column.
+// params: tableName string, record map[string]interface{}
+func (c *Cluster) WriteRecord(params []interface{}, reply *string) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	tableName := params[0].(string)
+	record := params[1].(map[string]interface{})
+	schema, ok := c.catalog.Schema(tableName)
+	if !ok {
+		if err := c.currentPlacement().renamedError(tableName); err != "" {
+			*reply = "1 " + err
+		} else {
+			*reply = "1 No Such Table"
+		}
+		return
+	}
+	known := make(map[string]bool)
+	for _, cs := range schema.ColumnSchemas {
+		known[cs.Name] = true
+	}
+	columns := make([]string, 0, len(record))
+	for column := range record {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		if !known[column] {
+			*reply = "1 No Such Column " + column
+			return
+		}
+	}
+	row := make(Row, len(schema.ColumnSchemas))
+	for i, cs := range schema.ColumnSchemas {
+		if !CheckType(record[cs.Name], cs.DataType) {
+			*reply = "1 TypeError"
+			return
+		}
+		row[i] = record[cs.Name]
+	}
+	*reply = c.writeRow(tableName, row)
+}
+
+// writeRow writes a row in the layout of the schema of a table under a new id as a mini-transaction: the row is
+// inserted into every fragment whose rule admits it, and if a fragment has no replica accepting it, the inserts done
+// so far are rolled back, so that no fragment holds a part of the row that the others lack. The replicas missing the
+// row of a fragment that another replica has accepted catch up later, as with any write. Between them, the fragments
+// admitting the row must hold all columns of the table, otherwise the reply is "1 Not Insert". The caller must hold
+// writeMu.
+func (c *Cluster) writeRow(tableName string, row Row) string {
+	placement := c.currentPlacement()
+	if err := placement.renamedError(tableName); err != "" {
+		return "1 " + err
+	}
+	if err := placement.readOnlyError(tableName); err != "" {
+		return "1 " + err
+	}
+	schema, ok := c.catalog.Schema(tableName)
+	if !ok {
+		return "1 Not Insert"
+	}
+	keyColumn, keyed := c.catalog.Key(tableName)
+	keyIndex := -1
+	for i, cs := range schema.ColumnSchemas {
+		if keyed && cs.Name == keyColumn && i < len(row) {
+			keyIndex = i
+		}
+	}
+	if keyIndex >= 0 && row[keyIndex] == nil {
+		return "1 Null Key"
+	}
+
+	admitted := make([]string, 0)
+	columns := make(map[string]bool)
+	for _, fragment := range placement.Fragments(tableName) {
+		rule := placement.Rule(fragment)
+		if admitsRow(rule.Predicate, row, schema) {
+			admitted = append(admitted, fragment)
+			for _, column := range rule.Column {
+				columns[column] = true
+			}
+		}
+	}
+	if len(columns) < len(schema.ColumnSchemas) {
+		return "1 Not Insert"
+	}
+
+	id := uuid.New().String()
+	if keyIndex >= 0 && !c.rowIndex.SetKey(tableName, row[keyIndex], id) {
+		return "1 Duplicate Key"
+	}
+	row = append(row, id)
+	written := make([]RowLocation, 0)
+	// the replicas which have not answered may have inserted the row all the same
+	unanswered := make([]RowLocation, 0)
+	for _, fragment := range admitted {
+		accepted := false
+		failure := ""
+		// only the nodes holding a replica of a fragment are asked to insert into it
+		for _, nodeId := range placement.Replicas(fragment) {
+			msg := ""
+			c.nodeEnd(nodeId).Call("Node.RPCInsert", InsertArgs{Fragment: fragment, Row: row}, &msg)
+			location := RowLocation{NodeId: nodeId, Fragment: fragment}
+			if len(msg) > 0 && msg[0] == '0' {
+				accepted = true
+				c.fragmentVersions[fragment]++
+				written = append(written, location)
+			} else if msg == "" {
+				unanswered = append(unanswered, location)
+			} else {
+				failure = msg[2:]
+			}
+		}
+		if !accepted {
+			for _, location := range append(written, unanswered...) {
+				msg := ""
+				args := FragmentIdsArgs{Fragment: location.Fragment, Ids: []string{id}}
+				c.nodeEnd(location.NodeId).Call("Node.RPCRemoveRows", args, &msg)
+			}
+			c.rowIndex.Remove(tableName, id)
+			if failure != "" {
+				return "1 cannot write into " + fragment + ": " + failure
+			}
+			return "1 cannot write into " + fragment
+		}
+	}
+	for _, location := range written {
+		c.rowIndex.Add(tableName, id, location)
+	}
+	c.catalog.AddIds(tableName, id)
+	return "0 OK"
+}
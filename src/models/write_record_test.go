@@ -0,0 +1,94 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+// setDraining makes a node refuse the writes or accept them again.
+func setDraining(nodeId string, draining bool) {
+	n := c.nodes[nodeId]
+	n.mu.Lock()
+	n.draining = draining
+	n.mu.Unlock()
+}
+
+// fragmentSize returns how many rows a replica of a fragment holds.
+func fragmentSize(nodeId string, fragment string) int {
+	n := c.nodes[nodeId]
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	size := 0
+	for iterator := n.TableMap[fragment].RowIterator(); iterator.HasNext(); iterator.Next() {
+		size++
+	}
+	return size
+}
+
+func TestWriteRecord(t *testing.T) {
+	setupSoftDelete(0)
+	reply := ""
+	enrolment := TableSchema{TableName: "enrolment", ColumnSchemas: []ColumnSchema{
+		{Name: "room", DataType: TypeString}, {Name: "courseId", DataType: TypeInt32},
+		{Name: "sid", DataType: TypeInt32}}}
+	rules, _ := NewRuleSet(enrolment).AddVerticalRule([]string{"sid", "courseId"}, 4).
+		AddVerticalRule([]string{"room"}, 3).Marshal()
+	cli.Call("Cluster.BuildTable", []interface{}{enrolment, rules}, &reply)
+
+	cli.Call("Cluster.WriteRecord", []interface{}{"enrolment",
+		map[string]interface{}{"sid": 0, "courseId": 1, "room": "A101"}}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("WriteRecord failed: %v", reply)
+	}
+	cli.Call("Cluster.WriteRecord", []interface{}{"enrolment", map[string]interface{}{"sid": 1, "courseId": 2}}, &reply)
+	if reply != "0 OK" {
+		t.Fatalf("WriteRecord failed: %v", reply)
+	}
+	rows := scanRows("enrolment")
+	if len(rows) != 2 || rows[0][0] != "A101" || rows[1][0] != nil || rows[1][2] != 1 {
+		t.Errorf("expected the records with the missing room null, actual %v", rows)
+	}
+	cli.Call("Cluster.WriteRecord", []interface{}{"enrolment", map[string]interface{}{"sid": 2, "seat": 3}}, &reply)
+	if reply != "1 No Such Column seat" {
+		t.Errorf("expected an unknown column, actual %v", reply)
+	}
+	cli.Call("Cluster.WriteRecord", []interface{}{"enrolment", map[string]interface{}{"sid": "2"}}, &reply)
+	if reply != "1 TypeError" {
+		t.Errorf("expected a type error, actual %v", reply)
+	}
+	cli.Call("Cluster.WriteRecord", []interface{}{studentTableName, map[string]interface{}{"name": "Eve"}}, &reply)
+	if reply != "1 Null Key" {
+		t.Errorf("the key cannot be null, actual %v", reply)
+	}
+
+	// the second fragment cannot be written, so the columns written into the first one are rolled back
+	placement := c.currentPlacement()
+	first, second := placement.Fragments("enrolment")[0], placement.Fragments("enrolment")[1]
+	setDraining(placement.Replicas(second)[0], true)
+	cli.Call("Cluster.FragmentWrite", []interface{}{"enrolment", Row{"B202", 3, 2}}, &reply)
+	if !strings.HasPrefix(reply, "1 cannot write into "+second) {
+		t.Errorf("expected %v not to be written, actual %v", second, reply)
+	}
+	if size := fragmentSize(placement.Replicas(first)[0], first); size != 2 {
+		t.Errorf("expected no part of the row to be left, actual %v rows", size)
+	}
+	setDraining(placement.Replicas(second)[0], false)
+	cli.Call("Cluster.FragmentWrite", []interface{}{"enrolment", Row{"B202", 3, 2}}, &reply)
+	if rows := scanRows("enrolment"); reply != "0 OK" || len(rows) != 3 {
+		t.Errorf("expected the row to be written once the node is back, actual %v %v", reply, rows)
+	}
+
+	// the key of a row rolled back is free again
+	setDraining("Node2", true)
+	cli.Call("Cluster.WriteRecord", []interface{}{studentTableName,
+		map[string]interface{}{"sid": 5, "name": "Eve", "age": 20, "grade": 4.0}}, &reply)
+	if reply[0] != '1' {
+		t.Errorf("expected the write to fail, actual %v", reply)
+	}
+	setDraining("Node2", false)
+	cli.Call("Cluster.WriteRecord", []interface{}{studentTableName,
+		map[string]interface{}{"sid": 5, "name": "Eve", "age": 20, "grade": 4.0}}, &reply)
+	if reply != "0 OK" {
+		t.Errorf("expected the key to be free, actual %v", reply)
+	}
+}
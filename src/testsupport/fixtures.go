@@ -0,0 +1,61 @@
+package testsupport
+
+import "../models"
+
+// Fixture is a table together with its initial rows.
+type Fixture struct {
+	Schema models.TableSchema
+	Rows   []models.Row
+}
+
+// Students is the student table of the labs, with three students.
+func Students() Fixture {
+	return Fixture{
+		Schema: models.TableSchema{TableName: "student", ColumnSchemas: []models.ColumnSchema{
+			{Name: "sid", DataType: models.TypeInt32},
+			{Name: "name", DataType: models.TypeString},
+			{Name: "age", DataType: models.TypeInt32},
+			{Name: "grade", DataType: models.TypeFloat},
+		}},
+		Rows: []models.Row{
+			{0, "John", 22, 4.0},
+			{1, "Smith", 23, 3.6},
+			{2, "Hana", 21, 4.0},
+		},
+	}
+}
+
+// CourseRegistrations is the courseRegistration table of the labs, the courses each of the Students takes.
+func CourseRegistrations() Fixture {
+	return Fixture{
+		Schema: models.TableSchema{TableName: "courseRegistration", ColumnSchemas: []models.ColumnSchema{
+			{Name: "sid", DataType: models.TypeInt32},
+			{Name: "courseId", DataType: models.TypeInt32},
+		}},
+		Rows: []models.Row{
+			{0, 0},
+			{0, 1},
+			{1, 0},
+			{2, 2},
+		},
+	}
+}
+
+// StudentCourses is the result of joining Students with CourseRegistrations.
+func StudentCourses() models.Dataset {
+	return models.Dataset{
+		Schema: models.TableSchema{ColumnSchemas: []models.ColumnSchema{
+			{Name: "sid", DataType: models.TypeInt32},
+			{Name: "name", DataType: models.TypeString},
+			{Name: "age", DataType: models.TypeInt32},
+			{Name: "grade", DataType: models.TypeFloat},
+			{Name: "courseId", DataType: models.TypeInt32},
+		}},
+		Rows: []models.Row{
+			{0, "John", 22, 4.0, 0},
+			{0, "John", 22, 4.0, 1},
+			{1, "Smith", 23, 3.6, 0},
+			{2, "Hana", 21, 4.0, 2},
+		},
+	}
+}
@@ -0,0 +1,271 @@
+// Package testsupport helps writing the integration tests of a cluster: it sets up a cluster on a simulated network,
+// builds tables from fixtures and loads their rows, injects faults, and checks the results of the queries. The steps
+// can be chained, each setting up step failing the test at once if the cluster does not do as asked, while the checks
+// of the results report every mismatch:
+//
+//	h := testsupport.New(t, 5)
+//	students := testsupport.Students()
+//	h.Build(students, models.NewRuleSet(students.Schema).AddHorizontalRule(models.Predicate{}, 0, 1)).
+//		Load(students).
+//		Crash("Node0").
+//		Scan(students.Schema.TableName).ExpectRows(students.Rows...)
+package testsupport
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"../labrpc"
+	"../models"
+)
+
+// the names of the coordinator and of the client end of a harness in its network
+const (
+	ClusterName = "TestCluster"
+	ClientName  = "TestClient"
+)
+
+// Harness is a cluster set up for a test.
+type Harness struct {
+	t testing.TB
+	// the simulated network of the cluster, e.g., to count the calls to a node
+	Network *labrpc.Network
+	Cluster *models.Cluster
+	// the client end connected to the coordinator
+	Client *labrpc.ClientEnd
+}
+
+// New sets up a cluster of the given number of nodes, named "Node0", "Node1", ..., on a network of its own.
+func New(t testing.TB, nodes int) *Harness {
+	network := labrpc.MakeNetwork()
+	cluster := models.NewCluster(nodes, network, ClusterName)
+	client := network.MakeEnd(ClientName)
+	network.Connect(ClientName, ClusterName)
+	network.Enable(ClientName, true)
+	return &Harness{t: t, Network: network, Cluster: cluster, Client: client}
+}
+
+// Call calls a method of the coordinator, e.g., "Cluster.Scan", and fails the test if the coordinator does not answer.
+func (h *Harness) Call(method string, args interface{}, reply interface{}) *Harness {
+	h.t.Helper()
+	if !h.Client.Call(method, args, reply) {
+		h.t.Fatalf("%v: the cluster does not answer", method)
+	}
+	return h
+}
+
+// Do calls a method of the coordinator replying a string, and fails the test unless the reply starts with "0".
+func (h *Harness) Do(method string, args interface{}) *Harness {
+	h.t.Helper()
+	reply := ""
+	h.Call(method, args, &reply)
+	if !strings.HasPrefix(reply, "0") {
+		h.t.Fatalf("%v %v: %v", method, args, reply)
+	}
+	return h
+}
+
+// Build builds the table of a fixture with the rules, the whole table being placed on Node0 if the rules are nil. The
+// params are the optional params of Cluster.BuildTable, e.g., the primary key column and the storage.
+func (h *Harness) Build(fixture Fixture, rules *models.RuleSet, params ...interface{}) *Harness {
+	h.t.Helper()
+	if rules == nil {
+		rules = models.NewRuleSet(fixture.Schema).AddHorizontalRule(models.Predicate{}, 0)
+	}
+	marshaled, err := rules.Marshal()
+	if err != nil {
+		h.t.Fatalf("the rules of %v: %v", fixture.Schema.TableName, err)
+	}
+	return h.Do("Cluster.BuildTable", append([]interface{}{fixture.Schema, marshaled}, params...))
+}
+
+// Load writes the rows of the fixtures into their tables.
+func (h *Harness) Load(fixtures ...Fixture) *Harness {
+	h.t.Helper()
+	for _, fixture := range fixtures {
+		h.Insert(fixture.Schema.TableName, fixture.Rows...)
+	}
+	return h
+}
+
+// Insert writes the rows into the table, see Cluster.FragmentWrite.
+func (h *Harness) Insert(tableName string, rows ...models.Row) *Harness {
+	h.t.Helper()
+	for _, row := range rows {
+		h.Do("Cluster.FragmentWrite", []interface{}{tableName, row})
+	}
+	return h
+}
+
+// Crash takes the nodes down, the calls to them failing until they are restarted.
+func (h *Harness) Crash(nodeIds ...string) *Harness {
+	for _, nodeId := range nodeIds {
+		h.Network.DeleteServer(nodeId)
+	}
+	return h
+}
+
+// Restart restarts the nodes from their disks, see Cluster.RestartNode, whether they have crashed or not.
+func (h *Harness) Restart(nodeIds ...string) *Harness {
+	h.t.Helper()
+	for _, nodeId := range nodeIds {
+		h.Do("Cluster.RestartNode", nodeId)
+	}
+	return h
+}
+
+// Unreliable makes the network drop or delay some of the calls and their replies, until Reliable is called.
+func (h *Harness) Unreliable() *Harness {
+	h.Network.Reliable(false)
+	return h
+}
+
+// Reliable stops dropping the calls, see Unreliable.
+func (h *Harness) Reliable() *Harness {
+	h.Network.Reliable(true)
+	return h
+}
+
+// Constrain sets the simulated constraints of a node, e.g., to make it slow, see models.NodeResources.
+func (h *Harness) Constrain(nodeId string, resources models.NodeResources) *Harness {
+	h.t.Helper()
+	return h.Do("Cluster.SetNodeResources", []interface{}{nodeId, resources})
+}
+
+// Scan reads the rows of a table with the hints, if any, see Cluster.Scan.
+func (h *Harness) Scan(tableName string, hints ...models.QueryHints) *Result {
+	h.t.Helper()
+	params := []interface{}{tableName}
+	for _, hint := range hints {
+		params = append(params, hint)
+	}
+	return h.query("Scan "+tableName, "Cluster.Scan", params)
+}
+
+// Join joins the tables with the hints, if any, see Cluster.Join.
+func (h *Harness) Join(tableNames []string, hints ...models.QueryHints) *Result {
+	h.t.Helper()
+	what := "Join " + strings.Join(tableNames, ", ")
+	if len(hints) == 0 {
+		return h.query(what, "Cluster.Join", tableNames)
+	}
+	return h.query(what, "Cluster.JoinWithHints", []interface{}{tableNames, hints[0]})
+}
+
+// Get looks up the row of a key, see Cluster.Get.
+func (h *Harness) Get(tableName string, key interface{}) *Result {
+	h.t.Helper()
+	return h.query(fmt.Sprintf("Get %v %v", tableName, key), "Cluster.Get", []interface{}{tableName, key})
+}
+
+func (h *Harness) query(what string, method string, args interface{}) *Result {
+	h.t.Helper()
+	result := &Result{h: h, what: what}
+	h.Call(method, args, &result.Dataset)
+	return result
+}
+
+// Result is the result of a query of a Harness, whose checks report every mismatch without stopping the test.
+type Result struct {
+	h *Harness
+	// the query, e.g., "Scan student"
+	what string
+	models.Dataset
+}
+
+// Then returns the harness the query was executed by, to chain the next steps of the test.
+func (r *Result) Then() *Harness {
+	return r.h
+}
+
+// ExpectRows checks that the result holds the rows in any order, each as many times as given.
+func (r *Result) ExpectRows(rows ...models.Row) *Result {
+	r.h.t.Helper()
+	if r.Error != "" || !sameRows(rows, r.Rows, nil) {
+		r.h.t.Errorf("%v: expected the rows %v, actual %v", r.what, rows, r.Dataset)
+	}
+	return r
+}
+
+// ExpectDataset checks that the result holds the columns of the expected dataset, by name in any order, and its rows
+// in any order.
+func (r *Result) ExpectDataset(expected models.Dataset) *Result {
+	r.h.t.Helper()
+	mapping := columnMapping(expected.Schema, r.Schema)
+	if r.Error != "" || mapping == nil || !sameRows(expected.Rows, r.Rows, mapping) {
+		r.h.t.Errorf("%v: expected %v, actual %v", r.what, expected, r.Dataset)
+	}
+	return r
+}
+
+// ExpectCount checks that the result holds as many rows.
+func (r *Result) ExpectCount(count int) *Result {
+	r.h.t.Helper()
+	if r.Error != "" || len(r.Rows) != count {
+		r.h.t.Errorf("%v: expected %v rows, actual %v", r.what, count, r.Dataset)
+	}
+	return r
+}
+
+// ExpectError checks that the query failed with the error, see models.Dataset.Error.
+func (r *Result) ExpectError(err string) *Result {
+	r.h.t.Helper()
+	if r.Error != err {
+		r.h.t.Errorf("%v: expected the error %q, actual %v", r.what, err, r.Dataset)
+	}
+	return r
+}
+
+// ExpectUnavailable checks that the result lists the fragments as unavailable, see models.QueryHints.Strictness.
+func (r *Result) ExpectUnavailable(fragments ...string) *Result {
+	r.h.t.Helper()
+	if strings.Join(r.Unavailable, ",") != strings.Join(fragments, ",") {
+		r.h.t.Errorf("%v: expected %v unavailable, actual %v", r.what, fragments, r.Unavailable)
+	}
+	return r
+}
+
+// columnMapping returns the position in b of each column of a, or nil if they do not have the same columns.
+func columnMapping(a models.TableSchema, b models.TableSchema) []int {
+	if len(a.ColumnSchemas) != len(b.ColumnSchemas) {
+		return nil
+	}
+	mapping := make([]int, len(a.ColumnSchemas))
+	for i, ca := range a.ColumnSchemas {
+		mapping[i] = -1
+		for j, cb := range b.ColumnSchemas {
+			if ca.Name == cb.Name {
+				mapping[i] = j
+				break
+			}
+		}
+		if mapping[i] < 0 {
+			return nil
+		}
+	}
+	return mapping
+}
+
+// sameRows tells whether a and b hold the same rows in any order, each as many times, the columns of the rows of a
+// being at the positions of the mapping in those of b, or at the same positions if the mapping is nil.
+func sameRows(a []models.Row, b []models.Row, mapping []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	used := make([]bool, len(b))
+	for _, rowA := range a {
+		found := false
+		for j, rowB := range b {
+			if !used[j] && len(rowA) == len(rowB) && (mapping == nil && rowA.Equals(&rowB) ||
+				mapping != nil && rowA.EqualsWithColumnMapping(&rowB, mapping)) {
+				used[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
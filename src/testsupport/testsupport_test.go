@@ -0,0 +1,59 @@
+package testsupport
+
+import (
+	"testing"
+
+	"../models"
+)
+
+func TestHarness(t *testing.T) {
+	students, courses := Students(), CourseRegistrations()
+	h := New(t, 5).
+		Build(students, models.NewRuleSet(students.Schema).
+			AddHorizontalRule(models.Predicate{"grade": {{Op: "<=", Val: 3.6}}}, 0, 1).
+			AddHorizontalRule(models.Predicate{"grade": {{Op: ">", Val: 3.6}}}, 2), "sid").
+		Build(courses, nil).
+		Load(students, courses)
+	h.Scan(students.Schema.TableName).ExpectRows(students.Rows...)
+	h.Join([]string{students.Schema.TableName, courses.Schema.TableName}).ExpectDataset(StudentCourses())
+	h.Get(students.Schema.TableName, 1).ExpectRows(students.Rows[1])
+
+	// Smith is still read from Node0, the others are not read until Node2 is back
+	strict := models.QueryHints{DisableCache: true, Strictness: models.RequireComplete}
+	h.Crash("Node1", "Node2").
+		Scan(students.Schema.TableName, models.QueryHints{DisableCache: true}).
+		ExpectRows(students.Rows[1]).ExpectUnavailable("student|1").
+		Then().
+		Join([]string{students.Schema.TableName, courses.Schema.TableName}, strict).
+		ExpectError("Fragments Unavailable: student|1")
+	h.Restart("Node1", "Node2").
+		Scan(students.Schema.TableName, models.QueryHints{DisableCache: true}).ExpectCount(len(students.Rows))
+}
+
+// recorder records the failures of the checks instead of failing the test.
+type recorder struct {
+	testing.TB
+	failures int
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures++
+}
+
+// the checks report the mismatches
+func TestResultMismatch(t *testing.T) {
+	students := Students()
+	h := New(t, 1).Build(students, nil).Load(students)
+	r := &recorder{TB: t}
+	h.t = r
+	h.Scan(students.Schema.TableName).
+		ExpectCount(1).
+		ExpectRows(students.Rows[0], students.Rows[0], students.Rows[1]).
+		ExpectError("TypeError").
+		ExpectCount(len(students.Rows))
+	if r.failures != 3 {
+		t.Errorf("expected 3 failed checks, actual %v", r.failures)
+	}
+}